@@ -1,6 +1,10 @@
 package ast
 
-import "monkey/token"
+import (
+	"fmt"
+	"monkey/token"
+	"strings"
+)
 
 // Node represents a node in the AST.
 type Node interface {
@@ -67,6 +71,8 @@ func (expressionStatement *ExpressionStatement) String() string {
 type Identifier struct {
 	Token token.Token // the token.IDENT token
 	Value string
+
+	slot int // the slot of the local it names, which ResolveLocals finds
 }
 
 func (identifier *Identifier) String() string       { return identifier.Value }
@@ -83,16 +89,68 @@ func (integerLiteral *IntegerLiteral) String() string       { return integerLite
 func (integerLiteral *IntegerLiteral) expressionNode()      {}
 func (integerLiteral *IntegerLiteral) TokenLiteral() string { return integerLiteral.Token.Literal }
 
+// StringLiteral represents a string literal in the AST.
+type StringLiteral struct {
+	Token token.Token // the token.STRING token
+	Value string
+}
+
+func (stringLiteral *StringLiteral) String() string       { return stringLiteral.Token.Literal }
+func (stringLiteral *StringLiteral) expressionNode()      {}
+func (stringLiteral *StringLiteral) TokenLiteral() string { return stringLiteral.Token.Literal }
+
+// BytesLiteral represents a bytes literal in the AST.
+type BytesLiteral struct {
+	Token token.Token // the token.BYTES token
+	Value string      // the bytes, which need not be UTF-8
+}
+
+func (bytesLiteral *BytesLiteral) String() string       { return QuoteBytes([]byte(bytesLiteral.Value)) }
+func (bytesLiteral *BytesLiteral) expressionNode()      {}
+func (bytesLiteral *BytesLiteral) TokenLiteral() string { return bytesLiteral.Token.Literal }
+
+// QuoteBytes writes the bytes as a bytes literal, escaping the bytes that are not
+// printable ASCII characters.
+func QuoteBytes(value []byte) string {
+	var output strings.Builder
+
+	output.WriteString(`b"`)
+	for _, char := range value {
+		switch {
+		case char == '"' || char == '\\':
+			output.WriteByte('\\')
+			output.WriteByte(char)
+		case char >= ' ' && char <= '~':
+			output.WriteByte(char)
+		default:
+			fmt.Fprintf(&output, `\x%02x`, char)
+		}
+	}
+	output.WriteByte('"')
+
+	return output.String()
+}
+
 // LetStatement represents a let statement in the AST.
 type LetStatement struct {
 	Token token.Token // the token.LET token
 	Name  *Identifier
 	Value Expression
+
+	// Exported is set by a leading export, which makes the binding part of a module
+	Exported bool
+
+	// Doc is the text of the /// comments on the lines right above the statement,
+	// without their slashes, which documents the binding
+	Doc string
 }
 
 func (letStatement *LetStatement) String() string {
 	var output string
 
+	if letStatement.Exported {
+		output += "export "
+	}
 	output += letStatement.TokenLiteral() + " "
 	output += letStatement.Name.String()
 	output += " = "
@@ -154,6 +212,20 @@ func (prefixExpression *PrefixExpression) TokenLiteral() string {
 	return prefixExpression.Token.Literal
 }
 
+// SpawnExpression represents a spawn expression in the AST, which calls the function
+// without arguments on a goroutine of its own.
+type SpawnExpression struct {
+	Token    token.Token // the spawn token
+	Function Expression
+}
+
+func (spawnExpression *SpawnExpression) String() string {
+	return "(spawn " + spawnExpression.Function.String() + ")"
+}
+
+func (spawnExpression *SpawnExpression) expressionNode()      {}
+func (spawnExpression *SpawnExpression) TokenLiteral() string { return spawnExpression.Token.Literal }
+
 // InfixExpression represents an infix expression in the AST.
 type InfixExpression struct {
 	Token    token.Token // the operator token, e.g. +
@@ -214,10 +286,74 @@ func (ifExpression *IfExpression) String() string {
 func (ifExpression *IfExpression) expressionNode()      {}
 func (ifExpression *IfExpression) TokenLiteral() string { return ifExpression.Token.Literal }
 
+// TryExpression represents a try expression in the AST, whose handler runs with the
+// error of the body bound to the parameter if the body fails.
+type TryExpression struct {
+	Token     token.Token // the try token
+	Body      *BlockStatement
+	Parameter *Identifier
+	Handler   *BlockStatement
+}
+
+func (tryExpression *TryExpression) String() string {
+	var output string
+
+	output = "try "
+	output += tryExpression.Body.String()
+	output += "catch(" + tryExpression.Parameter.String() + ") "
+	output += tryExpression.Handler.String()
+
+	return output
+}
+
+func (tryExpression *TryExpression) expressionNode()      {}
+func (tryExpression *TryExpression) TokenLiteral() string { return tryExpression.Token.Literal }
+
+// SelectExpression represents a select expression in the AST, which waits for the first
+// of the channels of its cases to give a value and runs the body of that case.
+type SelectExpression struct {
+	Token token.Token // the select token
+	Cases []*SelectCase
+}
+
+// SelectCase is a case of a select expression, whose body runs with the value received
+// from the channel bound to the name, if it has one.
+type SelectCase struct {
+	Name    *Identifier
+	Channel Expression
+	Body    *BlockStatement
+}
+
+func (selectExpression *SelectExpression) String() string {
+	cases := make([]string, len(selectExpression.Cases))
+	for i, selectCase := range selectExpression.Cases {
+		cases[i] = selectCase.String()
+	}
+
+	return "select { " + strings.Join(cases, ", ") + " }"
+}
+
+func (selectExpression *SelectExpression) expressionNode() {}
+func (selectExpression *SelectExpression) TokenLiteral() string {
+	return selectExpression.Token.Literal
+}
+
+func (selectCase *SelectCase) String() string {
+	var output string
+
+	if selectCase.Name != nil {
+		output = selectCase.Name.String() + " = "
+	}
+	output += selectCase.Channel.String() + " => " + selectCase.Body.String()
+
+	return output
+}
+
 // BlockStatement represents a block statement in the AST.
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	Closing    token.Token // the } token
 }
 
 func (blockStatement *BlockStatement) String() string {
@@ -238,6 +374,8 @@ type FunctionLiteral struct {
 	Token      token.Token // the fn token
 	Parameters []*Identifier
 	Body       *BlockStatement
+
+	locals *Locals // the locals of the function, which ResolveLocals finds
 }
 
 func (functionLiteral *FunctionLiteral) String() string {
@@ -262,17 +400,50 @@ func (functionLiteral *FunctionLiteral) String() string {
 func (functionLiteral *FunctionLiteral) expressionNode()      {}
 func (functionLiteral *FunctionLiteral) TokenLiteral() string { return functionLiteral.Token.Literal }
 
+// MacroLiteral represents a macro literal in the AST.
+type MacroLiteral struct {
+	Token      token.Token // the macro token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (macroLiteral *MacroLiteral) String() string {
+	var output string
+
+	output = macroLiteral.TokenLiteral()
+	output += "("
+
+	for i, parameter := range macroLiteral.Parameters {
+		if i != 0 {
+			output += ", "
+		}
+
+		output += parameter.String()
+	}
+
+	output += ")" + macroLiteral.Body.String()
+
+	return output
+}
+
+func (macroLiteral *MacroLiteral) expressionNode()      {}
+func (macroLiteral *MacroLiteral) TokenLiteral() string { return macroLiteral.Token.Literal }
+
 // CallExpression represents a call expression in the AST.
 type CallExpression struct {
-	Token     token.Token // the ( token
+	Token     token.Token // the ( or ?( token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Optional  bool // f?(x), which is null without calling f when f is null
 }
 
 func (callExpression *CallExpression) String() string {
 	var output string
 
 	output = callExpression.Function.String()
+	if callExpression.Optional {
+		output += "?"
+	}
 	output += "("
 
 	for i, argument := range callExpression.Arguments {
@@ -290,3 +461,145 @@ func (callExpression *CallExpression) String() string {
 
 func (callExpression *CallExpression) expressionNode()      {}
 func (callExpression *CallExpression) TokenLiteral() string { return callExpression.Token.Literal }
+
+// MethodCallExpression represents a call of a method of the receiver, as in arr.len(),
+// in the AST.
+type MethodCallExpression struct {
+	Token     token.Token // the . token
+	Receiver  Expression
+	Method    *Identifier // the name of the method, which is not bound like a variable
+	Arguments []Expression
+}
+
+func (methodCallExpression *MethodCallExpression) String() string {
+	var output string
+
+	output = methodCallExpression.Receiver.String() + "." + methodCallExpression.Method.String() + "("
+
+	for i, argument := range methodCallExpression.Arguments {
+		if i != 0 {
+			output += ", "
+		}
+
+		output += argument.String()
+	}
+
+	output += ")"
+
+	return output
+}
+
+func (methodCallExpression *MethodCallExpression) expressionNode() {}
+func (methodCallExpression *MethodCallExpression) TokenLiteral() string {
+	return methodCallExpression.Token.Literal
+}
+
+// ArrayLiteral represents an array literal in the AST.
+type ArrayLiteral struct {
+	Token    token.Token // the [ token
+	Elements []Expression
+}
+
+func (arrayLiteral *ArrayLiteral) String() string {
+	var output string
+
+	output = "["
+
+	for i, element := range arrayLiteral.Elements {
+		if i != 0 {
+			output += ", "
+		}
+
+		output += element.String()
+	}
+
+	output += "]"
+
+	return output
+}
+
+func (arrayLiteral *ArrayLiteral) expressionNode()      {}
+func (arrayLiteral *ArrayLiteral) TokenLiteral() string { return arrayLiteral.Token.Literal }
+
+// HashLiteral represents a hash literal in the AST, such as {"a": 1}.
+type HashLiteral struct {
+	Token token.Token // the { token
+	Pairs []*HashLiteralPair
+}
+
+// HashLiteralPair is a key of a hash literal with the value it maps to, in the order
+// they are written.
+type HashLiteralPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hashLiteral *HashLiteral) String() string {
+	pairs := make([]string, len(hashLiteral.Pairs))
+	for i, pair := range hashLiteral.Pairs {
+		pairs[i] = pair.Key.String() + ": " + pair.Value.String()
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func (hashLiteral *HashLiteral) expressionNode()      {}
+func (hashLiteral *HashLiteral) TokenLiteral() string { return hashLiteral.Token.Literal }
+
+// IndexExpression represents an index expression in the AST.
+type IndexExpression struct {
+	Token    token.Token // the [ or ?[ token
+	Left     Expression
+	Index    Expression
+	Optional bool // h?[key], which is null without indexing h when h is null
+}
+
+func (indexExpression *IndexExpression) String() string {
+	var output string
+
+	output = "("
+	output += indexExpression.Left.String()
+	if indexExpression.Optional {
+		output += "?"
+	}
+	output += "[" + indexExpression.Index.String() + "])"
+
+	return output
+}
+
+func (indexExpression *IndexExpression) expressionNode()      {}
+func (indexExpression *IndexExpression) TokenLiteral() string { return indexExpression.Token.Literal }
+
+// SliceExpression represents the slice form of an index expression in the AST, such
+// as s[1:4]. A bound that is left out, as in s[:3], is nil.
+type SliceExpression struct {
+	Token    token.Token // the [ or ?[ token
+	Left     Expression
+	Start    Expression
+	End      Expression
+	Optional bool // s?[1:], which is null without slicing s when s is null
+}
+
+func (sliceExpression *SliceExpression) String() string {
+	var output string
+
+	output = "("
+	output += sliceExpression.Left.String()
+	if sliceExpression.Optional {
+		output += "?"
+	}
+	output += "["
+	if sliceExpression.Start != nil {
+		output += sliceExpression.Start.String()
+	}
+	output += ":"
+	if sliceExpression.End != nil {
+		output += sliceExpression.End.String()
+	}
+	output += "])"
+
+	return output
+}
+
+func (sliceExpression *SliceExpression) expressionNode()      {}
+func (sliceExpression *SliceExpression) TokenLiteral() string { return sliceExpression.Token.Literal }
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -26,3 +27,227 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestInspect(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Expression: &InfixExpression{
+					Left:     &Identifier{Value: "a"},
+					Operator: "+",
+					Right: &CallExpression{
+						Function:  &Identifier{Value: "f"},
+						Arguments: []Expression{&IntegerLiteral{Value: 1}},
+					},
+				},
+			},
+		},
+	}
+
+	var visited []string
+	Inspect(program, func(node Node) bool {
+		switch node := node.(type) {
+		case *Identifier:
+			visited = append(visited, node.Value)
+		case *IntegerLiteral:
+			visited = append(visited, "1")
+		case *CallExpression:
+			visited = append(visited, "call")
+		}
+		return true
+	})
+
+	expected := []string{"a", "call", "f", "1"}
+	if strings.Join(visited, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong visiting order. expected=%v, got=%v", expected, visited)
+	}
+
+	// returning false skips the children
+	count := 0
+	Inspect(program, func(node Node) bool {
+		count++
+		_, isCall := node.(*CallExpression)
+		return !isCall
+	})
+	if count != 5 {
+		t.Errorf("wrong number of nodes visited. expected=5, got=%d", count)
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2} }
+
+	// turnOneIntoTwo replaces every 1 with a 2
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+
+		return two()
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{&InfixExpression{Left: one(), Operator: "+", Right: two()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+		{&InfixExpression{Left: two(), Operator: "+", Right: one()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+		{&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+		{&IndexExpression{Left: one(), Index: one()}, &IndexExpression{Left: two(), Index: two()}},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&LetStatement{Name: &Identifier{Value: "x"}, Value: one()}, &LetStatement{Name: &Identifier{Value: "x"}, Value: two()}},
+		{
+			&FunctionLiteral{Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}},
+			&FunctionLiteral{Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}}},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+	}
+
+	for _, tt := range tests {
+		original := tt.input.String()
+
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if modified.String() != tt.expected.String() {
+			t.Errorf("not modified. expected=%q, got=%q", tt.expected.String(), modified.String())
+		}
+
+		// the modification happens on a copy
+		if tt.input.String() != original {
+			t.Errorf("input changed. expected=%q, got=%q", original, tt.input.String())
+		}
+	}
+
+	// the modifier replaces nodes as well as changing them
+	replaced := Modify(&ArrayLiteral{Elements: []Expression{one()}}, func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"}
+		}
+		return node
+	})
+	if replaced.String() != "[x]" {
+		t.Errorf("node not replaced. got=%q", replaced.String())
+	}
+}
+
+func TestResolveLocals(t *testing.T) {
+	identifier := func(name string) *Identifier { return &Identifier{Value: name} }
+	x, y, z, v, inner := identifier("x"), identifier("y"), identifier("z"), identifier("v"), identifier("y")
+
+	// fn(x) { let y = x; try { z } catch (e) { y }; select { v = y => v }; fn(a) { y } }
+	nested := &FunctionLiteral{
+		Parameters: []*Identifier{identifier("a")},
+		Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: inner}}},
+	}
+	function := &FunctionLiteral{
+		Parameters: []*Identifier{identifier("x")},
+		Body: &BlockStatement{Statements: []Statement{
+			&LetStatement{Name: identifier("y"), Value: x},
+			&ExpressionStatement{Expression: &TryExpression{
+				Body:      &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: z}}},
+				Parameter: identifier("e"),
+				Handler:   &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: y}}},
+			}},
+			&ExpressionStatement{Expression: &SelectExpression{Cases: []*SelectCase{{
+				Name:    identifier("v"),
+				Channel: identifier("y"),
+				Body:    &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: v}}},
+			}}}},
+			&ExpressionStatement{Expression: nested},
+		}},
+	}
+	inner.slot = -1
+	ResolveLocals(function)
+
+	locals := function.Locals()
+	if got := strings.Join(locals.Names, " "); got != "x y e v" {
+		t.Errorf("wrong locals. expected=%q, got=%q", "x y e v", got)
+	}
+	if slot, ok := locals.Slot("e"); !ok || slot != 2 {
+		t.Errorf("wrong slot of e. got=%d, %t", slot, ok)
+	}
+	if _, ok := locals.Slot("z"); ok {
+		t.Errorf("z is not a local")
+	}
+	if x.Slot() != 0 || y.Slot() != 1 || v.Slot() != 3 {
+		t.Errorf("identifiers not pointed at their slots. got x=%d, y=%d, v=%d", x.Slot(), y.Slot(), v.Slot())
+	}
+	if inner.Slot() != -1 {
+		t.Errorf("identifier of a nested function resolved. got=%d", inner.Slot())
+	}
+}
+
+func TestEqual(t *testing.T) {
+	identifier := func(name string, line int) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Line: line}, Value: name}
+	}
+	sum := func(left, right Expression) Expression {
+		return &InfixExpression{Left: left, Operator: "+", Right: right}
+	}
+
+	tests := []struct {
+		a, b     Node
+		expected bool
+	}{
+		{identifier("x", 1), identifier("x", 2), true},
+		{identifier("x", 1), identifier("y", 1), false},
+		{sum(identifier("x", 1), identifier("y", 1)), sum(identifier("x", 3), identifier("y", 3)), true},
+		{sum(identifier("x", 1), identifier("y", 1)), sum(identifier("y", 1), identifier("x", 1)), false},
+		{&ArrayLiteral{Elements: []Expression{identifier("x", 1)}}, &ArrayLiteral{}, false},
+		{&IfExpression{Condition: identifier("x", 1), Consequence: &BlockStatement{}}, &IfExpression{Condition: identifier("x", 1), Consequence: &BlockStatement{}, Alternative: &BlockStatement{}}, false},
+		{identifier("x", 1), &StringLiteral{Value: "x"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Equal(%s, %s) wrong. expected=%t, got=%t", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func TestMoveTokens(t *testing.T) {
+	identifier := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5}, Value: "x"}
+	block := &BlockStatement{
+		Token:      token.Token{Type: token.LBRACE, Line: 1, Column: 8},
+		Statements: []Statement{&ExpressionStatement{Token: identifier.Token, Expression: identifier}},
+		Closing:    token.Token{Type: token.RBRACE, Line: 2, Column: 1},
+	}
+	function := &FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Line: 1, Column: 1}, Body: block}
+
+	var lines []int
+	MoveTokens(function, func(tok token.Token) token.Token {
+		tok.Line += 2
+		lines = append(lines, tok.Line)
+		return tok
+	})
+
+	// every token is moved once, including those that are not the first of their node
+	if len(lines) != 5 {
+		t.Errorf("wrong number of tokens moved. expected=5, got=%d", len(lines))
+	}
+	if function.Token.Line != 3 || identifier.Token.Line != 3 || block.Closing.Line != 4 {
+		t.Errorf("tokens not moved. got fn at %d, x at %d, } at %d", function.Token.Line, identifier.Token.Line, block.Closing.Line)
+	}
+}
@@ -0,0 +1,60 @@
+package ast
+
+import (
+	"monkey/token"
+	"reflect"
+)
+
+// Equal reports whether two nodes are the same tree: nodes of the same types with the
+// same values and children, wherever their tokens are in the source.
+func Equal(a, b Node) bool {
+	return equalValues(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+// tokenType is the type of the tokens of the nodes, which Equal leaves out.
+var tokenType = reflect.TypeOf(token.Token{})
+
+// equalValues compares two values of the fields of nodes, skipping tokens and the
+// unexported fields that the resolution of locals sets.
+func equalValues(a, b reflect.Value) bool {
+	if a.IsValid() != b.IsValid() {
+		return false
+	}
+	if !a.IsValid() {
+		return true
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equalValues(a.Elem(), b.Elem())
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equalValues(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if field.Type == tokenType || !field.IsExported() {
+				continue
+			}
+			if !equalValues(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.Interface() == b.Interface()
+	}
+}
@@ -0,0 +1,82 @@
+package ast
+
+// Locals are the names a function binds itself, its parameters first and then those
+// of its let statements, catch clauses and select cases, each of which the environment
+// of a call holds in a slot of its own rather than in a map.
+type Locals struct {
+	Names []string
+	slots map[string]int
+}
+
+// Slot returns the slot of the local with the name, if the function binds it.
+func (locals *Locals) Slot(name string) (int, bool) {
+	slot, ok := locals.slots[name]
+	return slot, ok
+}
+
+// Locals returns the locals of the function, or nil if they were never resolved.
+func (functionLiteral *FunctionLiteral) Locals() *Locals { return functionLiteral.locals }
+
+// Slot returns the slot of the local the identifier names in the function around it.
+// It is only a hint: an identifier a macro moved into another function may point at
+// a slot of another name, so the slot must be checked against the name.
+func (identifier *Identifier) Slot() int { return identifier.slot }
+
+// ResolveLocals finds the locals of the function and points the identifiers of its
+// body that name them at their slots. The bodies of the functions and macros it
+// contains are theirs to resolve.
+func ResolveLocals(function *FunctionLiteral) {
+	locals := &Locals{slots: map[string]int{}}
+	define := func(name string) {
+		if _, ok := locals.slots[name]; !ok {
+			locals.slots[name] = len(locals.Names)
+			locals.Names = append(locals.Names, name)
+		}
+	}
+
+	for _, parameter := range function.Parameters {
+		define(parameter.Value)
+	}
+	inspectLocal(function.Body, func(node Node) {
+		switch node := node.(type) {
+		case *LetStatement:
+			define(node.Name.Value)
+		case *TryExpression:
+			if node.Parameter != nil {
+				define(node.Parameter.Value)
+			}
+		case *SelectExpression:
+			for _, selectCase := range node.Cases {
+				if selectCase.Name != nil {
+					define(selectCase.Name.Value)
+				}
+			}
+		}
+	})
+
+	for _, parameter := range function.Parameters {
+		parameter.slot = locals.slots[parameter.Value]
+	}
+	inspectLocal(function.Body, func(node Node) {
+		if identifier, ok := node.(*Identifier); ok {
+			if slot, ok := locals.slots[identifier.Value]; ok {
+				identifier.slot = slot
+			}
+		}
+	})
+
+	function.locals = locals
+}
+
+// inspectLocal calls visit for each node of the body that is not inside a function or
+// macro it contains.
+func inspectLocal(body Node, visit func(Node)) {
+	Inspect(body, func(node Node) bool {
+		switch node.(type) {
+		case *FunctionLiteral, *MacroLiteral:
+			return false
+		}
+		visit(node)
+		return true
+	})
+}
@@ -0,0 +1,204 @@
+package ast
+
+// ModifierFunc returns the node to put in place of the node it is given. It should
+// return a new node rather than change the one it is given.
+type ModifierFunc func(Node) Node
+
+// Modify returns a copy of the AST in which every node, children first, is replaced
+// by the result of the modifier. The AST given is left unchanged, so a function body
+// can be modified every time it runs. Missing expressions, such as the value of a
+// let statement that failed to parse, are left missing.
+func Modify(node Node, modifier ModifierFunc) Node {
+	return ModifyExcept(node, nil, modifier)
+}
+
+// ModifyExcept is like Modify, except that the nodes for which keep returns true are
+// left as they are, together with everything below them. A nil keep keeps nothing.
+func ModifyExcept(node Node, keep func(Node) bool, modifier ModifierFunc) Node {
+	modification := &modification{keep: keep, modifier: modifier}
+	return modification.node(node)
+}
+
+// modification holds what a call to ModifyExcept applies throughout the AST.
+type modification struct {
+	keep     func(Node) bool
+	modifier ModifierFunc
+}
+
+// node modifies a node and its children.
+func (modification *modification) node(node Node) Node {
+	if node == nil {
+		return nil
+	}
+	if modification.keep != nil && modification.keep(node) {
+		return node
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		copied := *node
+		copied.Statements = modification.statements(node.Statements)
+		return modification.modifier(&copied)
+	case *LetStatement:
+		copied := *node
+		copied.Value = modification.expression(node.Value)
+		return modification.modifier(&copied)
+	case *ReturnStatement:
+		copied := *node
+		copied.ReturnValue = modification.expression(node.ReturnValue)
+		return modification.modifier(&copied)
+	case *ExpressionStatement:
+		copied := *node
+		copied.Expression = modification.expression(node.Expression)
+		return modification.modifier(&copied)
+	case *BlockStatement:
+		copied := *node
+		copied.Statements = modification.statements(node.Statements)
+		return modification.modifier(&copied)
+	case *PrefixExpression:
+		copied := *node
+		copied.Right = modification.expression(node.Right)
+		return modification.modifier(&copied)
+	case *SpawnExpression:
+		copied := *node
+		copied.Function = modification.expression(node.Function)
+		return modification.modifier(&copied)
+	case *InfixExpression:
+		copied := *node
+		copied.Left = modification.expression(node.Left)
+		copied.Right = modification.expression(node.Right)
+		return modification.modifier(&copied)
+	case *IfExpression:
+		copied := *node
+		copied.Condition = modification.expression(node.Condition)
+		copied.Consequence = modification.block(node.Consequence)
+		copied.Alternative = modification.block(node.Alternative)
+		return modification.modifier(&copied)
+	case *TryExpression:
+		copied := *node
+		copied.Body = modification.block(node.Body)
+		copied.Parameter, _ = modification.node(node.Parameter).(*Identifier)
+		copied.Handler = modification.block(node.Handler)
+		return modification.modifier(&copied)
+	case *SelectExpression:
+		copied := *node
+		copied.Cases = make([]*SelectCase, len(node.Cases))
+		for i, selectCase := range node.Cases {
+			modified := *selectCase
+			if selectCase.Name != nil {
+				modified.Name, _ = modification.node(selectCase.Name).(*Identifier)
+			}
+			modified.Channel = modification.expression(selectCase.Channel)
+			modified.Body = modification.block(selectCase.Body)
+			copied.Cases[i] = &modified
+		}
+		return modification.modifier(&copied)
+	case *FunctionLiteral:
+		copied := *node
+		copied.Parameters = modification.identifiers(node.Parameters)
+		copied.Body = modification.block(node.Body)
+		return modification.modifier(&copied)
+	case *MacroLiteral:
+		copied := *node
+		copied.Parameters = modification.identifiers(node.Parameters)
+		copied.Body = modification.block(node.Body)
+		return modification.modifier(&copied)
+	case *CallExpression:
+		copied := *node
+		copied.Function = modification.expression(node.Function)
+		copied.Arguments = modification.expressions(node.Arguments)
+		return modification.modifier(&copied)
+	case *MethodCallExpression:
+		// the name of the method is not a variable, so it is left alone
+		copied := *node
+		copied.Receiver = modification.expression(node.Receiver)
+		copied.Arguments = modification.expressions(node.Arguments)
+		return modification.modifier(&copied)
+	case *ArrayLiteral:
+		copied := *node
+		copied.Elements = modification.expressions(node.Elements)
+		return modification.modifier(&copied)
+	case *HashLiteral:
+		copied := *node
+		copied.Pairs = make([]*HashLiteralPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			copied.Pairs[i] = &HashLiteralPair{
+				Key:   modification.expression(pair.Key),
+				Value: modification.expression(pair.Value),
+			}
+		}
+		return modification.modifier(&copied)
+	case *IndexExpression:
+		copied := *node
+		copied.Left = modification.expression(node.Left)
+		copied.Index = modification.expression(node.Index)
+		return modification.modifier(&copied)
+	case *SliceExpression:
+		copied := *node
+		copied.Left = modification.expression(node.Left)
+		copied.Start = modification.expression(node.Start)
+		copied.End = modification.expression(node.End)
+		return modification.modifier(&copied)
+	}
+
+	// the remaining nodes have no children
+	return modification.modifier(node)
+}
+
+// expression modifies an expression that may be missing.
+func (modification *modification) expression(expression Expression) Expression {
+	if expression == nil {
+		return nil
+	}
+
+	modified, _ := modification.node(expression).(Expression)
+	return modified
+}
+
+// expressions modifies each of the expressions into a new list.
+func (modification *modification) expressions(expressions []Expression) []Expression {
+	if expressions == nil {
+		return nil
+	}
+
+	modified := make([]Expression, len(expressions))
+	for i, expression := range expressions {
+		modified[i] = modification.expression(expression)
+	}
+
+	return modified
+}
+
+// statements modifies each of the statements into a new list.
+func (modification *modification) statements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+
+	modified := make([]Statement, len(statements))
+	for i, statement := range statements {
+		modified[i], _ = modification.node(statement).(Statement)
+	}
+
+	return modified
+}
+
+// identifiers modifies each of the identifiers, such as the parameters of a function, into a new list.
+func (modification *modification) identifiers(identifiers []*Identifier) []*Identifier {
+	modified := make([]*Identifier, len(identifiers))
+	for i, identifier := range identifiers {
+		modified[i], _ = modification.node(identifier).(*Identifier)
+	}
+
+	return modified
+}
+
+// block modifies a block that may be missing.
+func (modification *modification) block(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+
+	modified, _ := modification.node(block).(*BlockStatement)
+	return modified
+}
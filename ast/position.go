@@ -0,0 +1,99 @@
+package ast
+
+import (
+	"monkey/token"
+	"reflect"
+)
+
+// StartToken returns the first token of the node in the source, which gives its position.
+func StartToken(node Node) token.Token {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) > 0 {
+			return StartToken(node.Statements[0])
+		}
+	case *LetStatement:
+		return node.Token
+	case *ReturnStatement:
+		return node.Token
+	case *ExpressionStatement:
+		return node.Token
+	case *BlockStatement:
+		return node.Token
+	case *Identifier:
+		return node.Token
+	case *IntegerLiteral:
+		return node.Token
+	case *StringLiteral:
+		return node.Token
+	case *BytesLiteral:
+		return node.Token
+	case *Boolean:
+		return node.Token
+	case *PrefixExpression:
+		return node.Token
+	case *SpawnExpression:
+		return node.Token
+	case *IfExpression:
+		return node.Token
+	case *TryExpression:
+		return node.Token
+	case *SelectExpression:
+		return node.Token
+	case *FunctionLiteral:
+		return node.Token
+	case *MacroLiteral:
+		return node.Token
+	case *ArrayLiteral:
+		return node.Token
+	case *HashLiteral:
+		return node.Token
+	case *InfixExpression:
+		// operators come after their left operand
+		return StartToken(node.Left)
+	case *CallExpression:
+		return StartToken(node.Function)
+	case *MethodCallExpression:
+		return StartToken(node.Receiver)
+	case *IndexExpression:
+		return StartToken(node.Left)
+	case *SliceExpression:
+		return StartToken(node.Left)
+	}
+
+	return token.Token{}
+}
+
+// MoveTokens replaces every token of the node and of the nodes below it with the token
+// move returns for it, in place, as when an edit of the source above the node moves it.
+func MoveTokens(node Node, move func(token.Token) token.Token) {
+	moveTokens(reflect.ValueOf(node), move)
+}
+
+// moveTokens moves the tokens in a value of the fields of nodes, skipping the unexported
+// fields that the resolution of locals sets.
+func moveTokens(value reflect.Value, move func(token.Token) token.Token) {
+	switch value.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if !value.IsNil() {
+			moveTokens(value.Elem(), move)
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			moveTokens(value.Index(i), move)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if field.Type == tokenType {
+				tok := value.Field(i).Addr().Interface().(*token.Token)
+				*tok = move(*tok)
+				continue
+			}
+			moveTokens(value.Field(i), move)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package ast
+
+// Inspect traverses the AST in depth-first order, calling visit for each node.
+// If visit returns false the children of that node are skipped. Missing
+// expressions, such as the value of a let statement that failed to parse, are not visited.
+func Inspect(node Node, visit func(Node) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, statement := range node.Statements {
+			Inspect(statement, visit)
+		}
+	case *LetStatement:
+		Inspect(node.Name, visit)
+		Inspect(node.Value, visit)
+	case *ReturnStatement:
+		Inspect(node.ReturnValue, visit)
+	case *ExpressionStatement:
+		Inspect(node.Expression, visit)
+	case *BlockStatement:
+		for _, statement := range node.Statements {
+			Inspect(statement, visit)
+		}
+	case *PrefixExpression:
+		Inspect(node.Right, visit)
+	case *SpawnExpression:
+		Inspect(node.Function, visit)
+	case *InfixExpression:
+		Inspect(node.Left, visit)
+		Inspect(node.Right, visit)
+	case *IfExpression:
+		Inspect(node.Condition, visit)
+		Inspect(node.Consequence, visit)
+		if node.Alternative != nil {
+			Inspect(node.Alternative, visit)
+		}
+	case *TryExpression:
+		Inspect(node.Body, visit)
+		Inspect(node.Parameter, visit)
+		Inspect(node.Handler, visit)
+	case *SelectExpression:
+		for _, selectCase := range node.Cases {
+			if selectCase.Name != nil {
+				Inspect(selectCase.Name, visit)
+			}
+			Inspect(selectCase.Channel, visit)
+			Inspect(selectCase.Body, visit)
+		}
+	case *FunctionLiteral:
+		for _, parameter := range node.Parameters {
+			Inspect(parameter, visit)
+		}
+		Inspect(node.Body, visit)
+	case *MacroLiteral:
+		for _, parameter := range node.Parameters {
+			Inspect(parameter, visit)
+		}
+		Inspect(node.Body, visit)
+	case *CallExpression:
+		Inspect(node.Function, visit)
+		for _, argument := range node.Arguments {
+			Inspect(argument, visit)
+		}
+	case *MethodCallExpression:
+		// the name of the method is not a variable, so it is not visited
+		Inspect(node.Receiver, visit)
+		for _, argument := range node.Arguments {
+			Inspect(argument, visit)
+		}
+	case *ArrayLiteral:
+		for _, element := range node.Elements {
+			Inspect(element, visit)
+		}
+	case *HashLiteral:
+		for _, pair := range node.Pairs {
+			Inspect(pair.Key, visit)
+			Inspect(pair.Value, visit)
+		}
+	case *IndexExpression:
+		Inspect(node.Left, visit)
+		Inspect(node.Index, visit)
+	case *SliceExpression:
+		Inspect(node.Left, visit)
+		Inspect(node.Start, visit)
+		Inspect(node.End, visit)
+	}
+}
@@ -0,0 +1,340 @@
+package check
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/parser"
+	"sort"
+	"strings"
+)
+
+// Severity tells whether a finding is certain to be a bug or only suspicious, as it does
+// for the diagnostics of the parser.
+type Severity = parser.Severity
+
+const (
+	SEVERITY_ERROR   = parser.SEVERITY_ERROR
+	SEVERITY_WARNING = parser.SEVERITY_WARNING
+)
+
+// the rules a finding can come from, named in the output so they can be suppressed
+const (
+	RULE_UNBOUND_IDENTIFIER = "unbound-identifier"
+	RULE_UNREACHABLE_CODE   = "unreachable-code"
+	RULE_UNUSED_BINDING     = "unused-binding"
+	RULE_SHADOWED_BINDING   = "shadowed-binding"
+	RULE_PARSE_WARNING      = "parse-warning" // the warnings of the parser, such as statements with no effect
+)
+
+// Finding is a problem found in a program without running it.
+type Finding struct {
+	Severity Severity
+	Rule     string
+	Message  string
+	Line     int
+	Column   int
+}
+
+func (finding Finding) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s (%s)", finding.Line, finding.Column, finding.Severity, finding.Message, finding.Rule)
+}
+
+// Program analyzes a parsed program and returns its findings ordered by position.
+// The predefined names, such as ARGV, are treated as bound in addition to the builtins.
+func Program(program *ast.Program, predefined ...string) []Finding {
+	checker := &checker{}
+
+	global := newScope(nil)
+	for _, name := range predefined {
+		global.predeclare(name)
+	}
+
+	checker.statements(program.Statements, global)
+	checker.functions(global)
+	checker.unused(global)
+
+	// function bodies are checked late, so put the findings back in source order
+	sortFindings(checker.findings)
+
+	return checker.findings
+}
+
+// sortFindings orders the findings by position, keeping those at the same one in order.
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+}
+
+// checker walks a program collecting findings.
+type checker struct {
+	findings []Finding
+}
+
+// binding is a name bound by a let statement, a parameter, or predefined by the caller.
+type binding struct {
+	name      *ast.Identifier // nil for predefined names
+	parameter bool
+	used      bool
+}
+
+// scope holds the names bound by a program or a function body. Blocks of if
+// expressions share the scope they appear in, as they do when evaluated.
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+
+	// every binding made in the scope, including those replaced by a later let
+	all []*binding
+
+	// function and macro literals are checked once the scope they close over is
+	// complete, since their bodies may use names bound after them
+	pending []ast.Expression
+}
+
+// newScope creates a scope nested in the outer one, which is nil for the global scope.
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, bindings: map[string]*binding{}}
+}
+
+// predeclare binds a name that the program can use without defining it.
+func (scope *scope) predeclare(name string) {
+	scope.bindings[name] = &binding{used: true}
+}
+
+// declare binds the identifier in the scope.
+func (scope *scope) declare(name *ast.Identifier, parameter bool) {
+	binding := &binding{name: name, parameter: parameter}
+	scope.bindings[name.Value] = binding
+	scope.all = append(scope.all, binding)
+}
+
+// lookup returns the binding the name refers to in the scope or any enclosing one, or nil.
+func (scope *scope) lookup(name string) *binding {
+	for current := scope; current != nil; current = current.outer {
+		if binding, ok := current.bindings[name]; ok {
+			return binding
+		}
+	}
+
+	return nil
+}
+
+// names returns the names bound in the scope and the enclosing ones, innermost first,
+// followed by the builtins.
+func (scope *scope) names() []string {
+	var names []string
+	for current := scope; current != nil; current = current.outer {
+		local := make([]string, 0, len(current.bindings))
+		for name := range current.bindings {
+			local = append(local, name)
+		}
+
+		sort.Strings(local)
+		names = append(names, local...)
+	}
+
+	return append(names, evaluator.BuiltinNames()...)
+}
+
+// resolve reports whether the name is bound in the scope, any enclosing one, or
+// as a builtin, marking the binding it refers to as used.
+func (scope *scope) resolve(name string) bool {
+	if binding := scope.lookup(name); binding != nil {
+		binding.used = true
+		return true
+	}
+
+	return evaluator.IsBuiltin(name)
+}
+
+// statements checks a list of statements in order, binding names as let statements are reached.
+func (checker *checker) statements(statements []ast.Statement, scope *scope) {
+	for i, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.LetStatement:
+			// the value is evaluated before the name is bound
+			checker.expression(statement.Value, scope)
+			checker.shadowing(statement.Name, scope)
+			scope.declare(statement.Name, false)
+
+			// an exported binding is used by the programs that import it
+			if statement.Exported {
+				scope.bindings[statement.Name.Value].used = true
+			}
+		case *ast.ReturnStatement:
+			checker.expression(statement.ReturnValue, scope)
+
+			// nothing after a return runs
+			if i+1 < len(statements) {
+				checker.report(SEVERITY_WARNING, RULE_UNREACHABLE_CODE, statements[i+1], "unreachable code after return")
+			}
+		case *ast.ExpressionStatement:
+			checker.expression(statement.Expression, scope)
+		}
+	}
+}
+
+// expression checks that every identifier used by the expression is bound.
+func (checker *checker) expression(expression ast.Expression, scope *scope) {
+	ast.Inspect(expression, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if !scope.resolve(node.Value) {
+				checker.report(SEVERITY_ERROR, RULE_UNBOUND_IDENTIFIER, node, evaluator.NotFoundMessage(node.Value, scope.names()))
+			}
+		case *ast.IfExpression:
+			// the blocks may bind names, so their statements are checked in order
+			checker.expression(node.Condition, scope)
+			checker.statements(node.Consequence.Statements, scope)
+			if node.Alternative != nil {
+				checker.statements(node.Alternative.Statements, scope)
+			}
+			return false
+		case *ast.TryExpression:
+			// the handler binds the error like a let statement, after the body
+			checker.statements(node.Body.Statements, scope)
+			checker.shadowing(node.Parameter, scope)
+			scope.declare(node.Parameter, true)
+			checker.statements(node.Handler.Statements, scope)
+			return false
+		case *ast.SelectExpression:
+			// every channel is evaluated before a case binds the value it received
+			for _, selectCase := range node.Cases {
+				checker.expression(selectCase.Channel, scope)
+			}
+			for _, selectCase := range node.Cases {
+				if selectCase.Name != nil {
+					checker.shadowing(selectCase.Name, scope)
+					scope.declare(selectCase.Name, true)
+				}
+				checker.statements(selectCase.Body.Statements, scope)
+			}
+			return false
+		case *ast.FunctionLiteral:
+			scope.pending = append(scope.pending, node)
+			return false
+		case *ast.MacroLiteral:
+			scope.pending = append(scope.pending, node)
+			return false
+		case *ast.CallExpression:
+			// a quoted expression is not evaluated, except for what it unquotes
+			if function, ok := node.Function.(*ast.Identifier); ok && function.Value == evaluator.QUOTE {
+				checker.unquoted(node, scope)
+				return false
+			}
+
+			// import is a special form rather than a binding, so only its argument is checked
+			if function, ok := node.Function.(*ast.Identifier); ok && function.Value == evaluator.IMPORT {
+				for _, argument := range node.Arguments {
+					checker.expression(argument, scope)
+				}
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// unquoted checks the arguments of the unquote calls inside a quote, which are evaluated.
+func (checker *checker) unquoted(quote *ast.CallExpression, scope *scope) {
+	for _, argument := range quote.Arguments {
+		ast.Inspect(argument, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpression)
+			if !ok {
+				return true
+			}
+
+			if function, ok := call.Function.(*ast.Identifier); ok && function.Value == evaluator.UNQUOTE {
+				for _, unquoted := range call.Arguments {
+					checker.expression(unquoted, scope)
+				}
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// functions checks the bodies of the function and macro literals found in a scope that is now complete.
+func (checker *checker) functions(scope *scope) {
+	for _, literal := range scope.pending {
+		inner := newScope(scope)
+
+		var parameters []*ast.Identifier
+		var body *ast.BlockStatement
+		switch literal := literal.(type) {
+		case *ast.FunctionLiteral:
+			parameters, body = literal.Parameters, literal.Body
+		case *ast.MacroLiteral:
+			// macro bodies run during expansion, where gensym is available
+			parameters, body = literal.Parameters, literal.Body
+			inner.predeclare(evaluator.GENSYM)
+		}
+
+		for _, parameter := range parameters {
+			checker.shadowing(parameter, inner)
+			inner.declare(parameter, true)
+		}
+
+		checker.statements(body.Statements, inner)
+		checker.functions(inner)
+		checker.unused(inner)
+	}
+}
+
+// shadowing reports a name about to be bound in the scope that hides a binding of an enclosing
+// scope, which closures then silently stop seeing. Rebinding a name in the same scope is not shadowing.
+func (checker *checker) shadowing(name *ast.Identifier, scope *scope) {
+	if scope.outer == nil || strings.HasPrefix(name.Value, "_") {
+		return
+	}
+	if _, ok := scope.bindings[name.Value]; ok {
+		return
+	}
+
+	outer := scope.outer.lookup(name.Value)
+	if outer == nil {
+		return
+	}
+
+	if outer.name == nil {
+		checker.report(SEVERITY_WARNING, RULE_SHADOWED_BINDING, name, name.Value+" shadows a predefined name")
+		return
+	}
+
+	tok := outer.name.Token
+	message := fmt.Sprintf("%s shadows the binding at %d:%d", name.Value, tok.Line, tok.Column)
+	checker.report(SEVERITY_WARNING, RULE_SHADOWED_BINDING, name, message)
+}
+
+// unused reports the bindings of a complete scope that nothing refers to. Names
+// starting with an underscore are meant to be unused and are never reported.
+func (checker *checker) unused(scope *scope) {
+	for _, binding := range scope.all {
+		if binding.used || strings.HasPrefix(binding.name.Value, "_") {
+			continue
+		}
+
+		if binding.parameter {
+			checker.report(SEVERITY_WARNING, RULE_UNUSED_BINDING, binding.name, "parameter "+binding.name.Value+" is never used")
+		} else {
+			checker.report(SEVERITY_WARNING, RULE_UNUSED_BINDING, binding.name, binding.name.Value+" is bound but never used")
+		}
+	}
+}
+
+// report records a finding at the position of the node.
+func (checker *checker) report(severity Severity, rule string, node ast.Node, message string) {
+	tok := ast.StartToken(node)
+	checker.findings = append(checker.findings, Finding{
+		Severity: severity,
+		Rule:     rule,
+		Message:  message,
+		Line:     tok.Line,
+		Column:   tok.Column,
+	})
+}
@@ -0,0 +1,195 @@
+package check
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; puts(x + len(\"a\"));", nil},
+		{"puts(y);", []string{"1:6: error: identifier not found: y (unbound-identifier)"}},
+		{"let _x = x + 1;", []string{"1:10: error: identifier not found: x (unbound-identifier)"}},
+		{"x; let _x = 1;", []string{"1:1: error: identifier not found: x (unbound-identifier)"}},
+		// function bodies may use names bound after them, including their own
+		{"let f = fn(n) { g(n) + f(n) }; let g = fn(x) { x };", nil},
+		{"let f = fn(a) { a + b }; f", []string{"1:21: error: identifier not found: b (unbound-identifier)"}},
+		{"let total = 1; puts(totl, total);", []string{"1:21: error: identifier not found: totl — did you mean total? (unbound-identifier)"}},
+		{"let f = fn() { fn(a) { a } }; f; a", []string{"1:34: error: identifier not found: a (unbound-identifier)"}},
+		// if blocks bind in the enclosing scope
+		{"if (true) { let y = 1; }; y", nil},
+		// try blocks bind in the enclosing scope too, the error after the body
+		{"try { let y = 1; } catch (e) { e }; y", nil},
+		{"try { e } catch (e) { 1 }", []string{
+			"1:7: error: identifier not found: e (unbound-identifier)",
+			"1:18: warning: parameter e is never used (unused-binding)",
+		}},
+		// select cases bind the value received in the enclosing scope, after every channel
+		{"let ch = channel(); select { v = ch => v, timeout(1) => w }; v", []string{
+			"1:57: error: identifier not found: w (unbound-identifier)",
+		}},
+		{"select { v = channel() => 1, v => 2 }", []string{
+			"1:10: warning: parameter v is never used (unused-binding)",
+			"1:30: error: identifier not found: v (unbound-identifier)",
+		}},
+		{"ARGV", nil},
+		// the names of methods are not bindings
+		{"let s = \"a\"; s.upper()", nil},
+		// quoted names are not evaluated, unless they are unquoted
+		{"let x = 1; quote(y + unquote(x))", nil},
+		{"quote(unquote(z))", []string{"1:15: error: identifier not found: z (unbound-identifier)"}},
+		{"let unless = macro(c, a) { quote(if (!unquote(c)) { unquote(a) }) }; unless(true, 1)", nil},
+		// exported bindings are used by the importers, and import is not a binding
+		{"let helper = fn(x) { x }; export let f = fn(x) { helper(x) };", nil},
+		{"let m = import(path)", []string{
+			"1:5: warning: m is bound but never used (unused-binding)",
+			"1:16: error: identifier not found: path (unbound-identifier)",
+		}},
+		{"let m = macro() { gensym() }; m(); gensym()", []string{"1:36: error: identifier not found: gensym (unbound-identifier)"}},
+		{
+			"let m = macro(a) { b }; m(1)",
+			[]string{
+				"1:15: warning: parameter a is never used (unused-binding)",
+				"1:20: error: identifier not found: b (unbound-identifier)",
+			},
+		},
+		{
+			"let f = fn() { return 1; puts(2); 3 }; f",
+			[]string{"1:26: warning: unreachable code after return (unreachable-code)"},
+		},
+		{
+			"return 1;\nputs(z)",
+			[]string{
+				"2:1: warning: unreachable code after return (unreachable-code)",
+				"2:6: error: identifier not found: z (unbound-identifier)",
+			},
+		},
+		{
+			"let f = fn() { q };\nw",
+			[]string{
+				"1:5: warning: f is bound but never used (unused-binding)",
+				"1:16: error: identifier not found: q (unbound-identifier)",
+				"2:1: error: identifier not found: w (unbound-identifier)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testFindings(t, tt.input, Program(parse(t, tt.input), "ARGV"), tt.expected)
+	}
+}
+
+func TestUnusedBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1;", []string{"1:5: warning: x is bound but never used (unused-binding)"}},
+		{"let f = fn(a, b) { a }; f(1, 2)", []string{"1:15: warning: parameter b is never used (unused-binding)"}},
+		// a binding replaced before it was used is reported
+		{"let x = 1; let x = 2; x", []string{"1:5: warning: x is bound but never used (unused-binding)"}},
+		{"let x = 1; let x = x + 1; x", nil},
+		// a closure counts as a use, even when it runs later
+		{"let x = 1; let f = fn() { x }; f", nil},
+		{"let f = fn(n) { let y = n; 1 }; f", []string{"1:21: warning: y is bound but never used (unused-binding)"}},
+		{"let _x = 1; let f = fn(_a) { 1 }; f", nil},
+	}
+
+	for _, tt := range tests {
+		testFindings(t, tt.input, Program(parse(t, tt.input)), tt.expected)
+	}
+}
+
+func TestShadowedBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; let f = fn(x) { x }; f(x)", []string{"1:23: warning: x shadows the binding at 1:5 (shadowed-binding)"}},
+		{
+			"let x = 1; let f = fn() { let x = 2; x }; f(x)",
+			[]string{"1:31: warning: x shadows the binding at 1:5 (shadowed-binding)"},
+		},
+		{
+			"let f = fn(a) { fn(a) { a } }; f",
+			[]string{
+				"1:12: warning: parameter a is never used (unused-binding)",
+				"1:20: warning: a shadows the binding at 1:12 (shadowed-binding)",
+			},
+		},
+		{"let f = fn(ARGV) { ARGV }; f", []string{"1:12: warning: ARGV shadows a predefined name (shadowed-binding)"}},
+		// rebinding in the same scope and sibling functions do not shadow
+		{"let x = 1; let x = x + 1; x", nil},
+		{"let f = fn(a) { a }; let g = fn(a) { a }; f(g)", nil},
+		{"let f = fn(n) { let n = n + 1; n }; f", nil},
+		{"let _x = 1; let f = fn(_x) { 1 }; f", nil},
+	}
+
+	for _, tt := range tests {
+		testFindings(t, tt.input, Program(parse(t, tt.input), "ARGV"), tt.expected)
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; // check:ignore", nil},
+		{"// check:ignore unused-binding\nlet x = 1;", nil},
+		{"// check:ignore unused-binding\n\nlet x = 1;", []string{"3:5: warning: x is bound but never used (unused-binding)"}},
+		{
+			"let x = y; // check:ignore unused-binding",
+			[]string{"1:9: error: identifier not found: y (unbound-identifier)"},
+		},
+		{"let x = y; // check:ignore unused-binding, unbound-identifier", nil},
+		{
+			"let x = 1;\nx;\nputs(x);",
+			[]string{"2:1: warning: statement has no effect (parse-warning)"},
+		},
+		{"let x = 1;\nx; // check:ignore parse-warning\nputs(x);", nil},
+	}
+
+	for _, tt := range tests {
+		findings, diagnostics := Source(tt.input)
+		if len(diagnostics) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, diagnostics)
+		}
+
+		testFindings(t, tt.input, findings, tt.expected)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	return program
+}
+
+func testFindings(t *testing.T, input string, findings []Finding, expected []string) {
+	t.Helper()
+
+	if len(findings) != len(expected) {
+		t.Errorf("wrong number of findings for %q. expected=%v, got=%v", input, expected, findings)
+		return
+	}
+
+	for i, expected := range expected {
+		if findings[i].String() != expected {
+			t.Errorf("findings[%d] wrong for %q. expected=%q, got=%q", i, input, expected, findings[i].String())
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package check
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+// IGNORE_DIRECTIVE starts a comment that suppresses findings on its own line and
+// the line after it, e.g. `// check:ignore unused-binding`. Without rule names
+// every finding on those lines is suppressed.
+const IGNORE_DIRECTIVE = "check:ignore"
+
+// Source parses and analyzes a program, leaving out the findings suppressed by comments.
+// The warnings of the parser are among the findings, while the parse errors are returned
+// instead when the program does not parse.
+func Source(source string, predefined ...string) ([]Finding, []parser.Diagnostic) {
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		return nil, p.Diagnostics()
+	}
+
+	findings := Program(program, predefined...)
+	for _, warning := range p.Warnings() {
+		findings = append(findings, Finding{
+			Severity: SEVERITY_WARNING,
+			Rule:     RULE_PARSE_WARNING,
+			Message:  warning.Message,
+			Line:     warning.Line,
+			Column:   warning.Column,
+		})
+	}
+	sortFindings(findings)
+
+	return suppress(findings, l.Comments()), nil
+}
+
+// suppress removes the findings covered by an ignore directive.
+func suppress(findings []Finding, comments []token.Token) []Finding {
+	// the rules ignored on each line, with an empty list ignoring every rule
+	ignored := map[int][]string{}
+	for _, comment := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Literal, "//"))
+		if !strings.HasPrefix(text, IGNORE_DIRECTIVE) {
+			continue
+		}
+
+		rules := strings.FieldsFunc(text[len(IGNORE_DIRECTIVE):], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		for _, line := range []int{comment.Line, comment.Line + 1} {
+			existing, ok := ignored[line]
+			switch {
+			case ok && len(existing) == 0:
+				// every rule is already ignored on this line
+			case len(rules) == 0:
+				ignored[line] = []string{}
+			default:
+				ignored[line] = append(existing, rules...)
+			}
+		}
+	}
+
+	var kept []Finding
+	for _, finding := range findings {
+		if !isIgnored(finding, ignored) {
+			kept = append(kept, finding)
+		}
+	}
+
+	return kept
+}
+
+// isIgnored reports whether a directive covers the finding.
+func isIgnored(finding Finding, ignored map[int][]string) bool {
+	rules, ok := ignored[finding.Line]
+	if !ok {
+		return false
+	}
+	if len(rules) == 0 {
+		return true
+	}
+
+	for _, rule := range rules {
+		if rule == finding.Rule {
+			return true
+		}
+	}
+
+	return false
+}
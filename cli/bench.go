@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"time"
+)
+
+// BENCH_USAGE describes the command line of the bench subcommand.
+const BENCH_USAGE = `usage: monkey bench [-benchtime duration] [files or directories...]
+
+runs every bench_ function of the given files, and of the *_test.monkey files found
+in the given directories or the current one, reporting the time each call takes`
+
+// BENCH_FUNCTION_PREFIX marks the top-level functions that are run as benchmarks.
+const BENCH_FUNCTION_PREFIX = "bench_"
+
+// runBenchmarks discovers and runs the benchmarks, printing one line for each.
+func runBenchmarks(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, BENCH_USAGE)
+		fmt.Fprintln(stderr, "\nflags:")
+		flags.PrintDefaults()
+	}
+
+	benchTime := flags.Duration("benchtime", evaluator.BENCH_TIME, "run each benchmark for at least this `duration`")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := testFiles(paths)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return EXIT_NO_INPUT
+	}
+
+	status := EXIT_OK
+	for _, path := range files {
+		if code := runBenchmarkFile(path, *benchTime, stdout, stderr); code != EXIT_OK {
+			status = code
+		}
+	}
+
+	return status
+}
+
+// runBenchmarkFile runs the benchmarks of one file, each in a fresh evaluation of the file.
+func runBenchmarkFile(path string, benchTime time.Duration, stdout, stderr io.Writer) int {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "could not read %s: %s\n", path, err)
+		return EXIT_NO_INPUT
+	}
+
+	source := string(content)
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		printDiagnostics(stderr, path, source, p.Diagnostics())
+		return EXIT_PARSE_ERROR
+	}
+
+	program, errObj := expandMacros(program)
+	if errObj != nil {
+		printRuntimeError(stderr, path, source, errObj)
+		return EXIT_RUNTIME_ERROR
+	}
+
+	// the benchmarks run with the options of the file, as the file itself does
+	options := fileOptions(path)
+	for _, name := range functionNames(program, BENCH_FUNCTION_PREFIX) {
+		env := object.NewEnvironment()
+		env.Set("ARGV", argumentsArray(nil))
+
+		if errObj, ok := evaluator.EvalWithOptions(context.Background(), program, env, options).(*object.Error); ok {
+			printRuntimeError(stderr, path, source, errObj)
+			return EXIT_RUNTIME_ERROR
+		}
+
+		function, _ := env.Get(name)
+		call := evaluator.NewCaller(context.Background(), options)
+		iterations, perCall, errObj := evaluator.Benchmark(call, function, benchTime)
+		if errObj != nil {
+			printRuntimeError(stderr, path, source, errObj)
+			return EXIT_RUNTIME_ERROR
+		}
+
+		fmt.Fprintln(stdout, evaluator.FormatBenchmark(name, iterations, perCall))
+	}
+
+	return EXIT_OK
+}
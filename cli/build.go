@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/repl"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BUILD_USAGE describes the command line of the build subcommand.
+const BUILD_USAGE = `usage: monkey build [-o output] <file>
+
+compiles a program to bytecode that monkey run executes without parsing it again,
+written to the file name with its extension replaced by .monkeyc unless -o is given`
+
+// COMPILED_EXTENSION is the extension of the files written by monkey build.
+const COMPILED_EXTENSION = ".monkeyc"
+
+// runBuild compiles a script and writes its serialized bytecode.
+func runBuild(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, BUILD_USAGE)
+		fmt.Fprintln(stderr, "\nflags:")
+		flags.PrintDefaults()
+	}
+
+	output := flags.String("o", "", "write the bytecode to the `file`")
+
+	// the flags may come before or after the file
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+	path := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return EXIT_USAGE
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + COMPILED_EXTENSION
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "could not read %s: %s\n", path, err)
+		return EXIT_NO_INPUT
+	}
+
+	bytecode, status := compileSource(path, string(content), stderr)
+	if status != EXIT_OK {
+		return status
+	}
+
+	var serialized bytes.Buffer
+	if _, err := bytecode.WriteTo(&serialized); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", path, err)
+		return EXIT_CANT_CREATE
+	}
+	if err := os.WriteFile(*output, serialized.Bytes(), 0644); err != nil {
+		fmt.Fprintf(stderr, "could not write %s: %s\n", *output, err)
+		return EXIT_CANT_CREATE
+	}
+
+	return EXIT_OK
+}
+
+// compileSource parses, expands, and compiles a program for the virtual machine.
+func compileSource(name, source string, stderr io.Writer) (*compiler.Bytecode, int) {
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		printDiagnostics(stderr, name, source, p.Diagnostics())
+		return nil, EXIT_PARSE_ERROR
+	}
+
+	program, errObj := expandMacros(program)
+	if errObj != nil {
+		printRuntimeError(stderr, name, source, errObj)
+		return nil, EXIT_RUNTIME_ERROR
+	}
+
+	return compileProgram(name, program, stderr)
+}
+
+// compileProgram compiles and optimizes a parsed program for the virtual machine. ARGV is
+// the first global, so the arguments can be stored before the program runs.
+func compileProgram(name string, program *ast.Program, stderr io.Writer) (*compiler.Bytecode, int) {
+	symbolTable := compiler.NewGlobalSymbolTable()
+	symbolTable.Define("ARGV")
+
+	c := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := c.Compile(program); err != nil {
+		fmt.Fprintf(stderr, "%s: compile error: %s\n", name, err)
+		return nil, EXIT_PARSE_ERROR
+	}
+
+	return compiler.Optimize(c.Bytecode()), EXIT_OK
+}
+
+// runCompiled deserializes a program written by monkey build and runs it with the arguments bound to ARGV.
+func runCompiled(name string, content []byte, arguments []string, config runConfig, stderr io.Writer) int {
+	if config.trace {
+		fmt.Fprintf(stderr, "%s: --trace is not supported for compiled programs\n", name)
+		return EXIT_USAGE
+	}
+
+	bytecode, err := compiler.ReadBytecode(bytes.NewReader(content))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		return EXIT_PARSE_ERROR
+	}
+
+	// the source a compiled program was built from is not at hand to show
+	_, status := runBytecode(name, "", bytecode, arguments, stderr)
+	return status
+}
+
+// runProgramOnVM compiles a parsed program and runs it on the virtual machine, as
+// runSource does with the evaluator.
+func runProgramOnVM(name string, program *ast.Program, arguments []string, config runConfig, stdout, stderr io.Writer) int {
+	if config.trace {
+		fmt.Fprintf(stderr, "%s: --trace requires --engine=%s\n", name, repl.ENGINE_EVAL)
+		return EXIT_USAGE
+	}
+
+	bytecode, status := compileProgram(name, program, stderr)
+	if status != EXIT_OK {
+		return status
+	}
+
+	result, status := runBytecode(name, config.source, bytecode, arguments, stderr)
+	if status != EXIT_OK {
+		return status
+	}
+
+	// a program ending in a let statement has no value, as in the evaluator
+	if len(program.Statements) == 0 {
+		return EXIT_OK
+	}
+	if _, ok := program.Statements[len(program.Statements)-1].(*ast.LetStatement); ok {
+		return EXIT_OK
+	}
+
+	if config.printResult && result != nil && result != evaluator.NULL {
+		fmt.Fprintln(stdout, result.Inspect())
+	}
+
+	return EXIT_OK
+}
+
+// runBytecode runs compiled code with the arguments bound to ARGV and returns the value it
+// left, showing the source, if it is given, under a runtime error.
+func runBytecode(name, source string, bytecode *compiler.Bytecode, arguments []string, stderr io.Writer) (object.Object, int) {
+	globals := make([]object.Object, vm.GLOBALS_SIZE)
+	globals[0] = argumentsArray(arguments)
+
+	machine := vm.NewWithOptions(bytecode, globals, vm.Options{
+		MaxDepth:          loader.Options.MaxDepth,
+		AllowExec:         loader.Options.AllowExec,
+		CheckedArithmetic: loader.Options.CheckedArithmetic,
+		StrictBooleans:    loader.Options.StrictBooleans,
+	})
+	if err := machine.Run(); err != nil {
+		// the errors of the virtual machine are placed in the source by the source map
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			errObj = &object.Error{Message: err.Error()}
+		}
+		printRuntimeError(stderr, name, source, errObj)
+		return nil, EXIT_RUNTIME_ERROR
+	}
+
+	return machine.LastPoppedStackElem(), EXIT_OK
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"monkey/check"
+	"os"
+)
+
+// runCheck parses the files without running them and reports parse errors and
+// the findings of the static checks, which fail the check if they are errors, or
+// warnings when strict. Every file is checked even after a failure.
+func runCheck(paths []string, strict bool, stderr io.Writer) int {
+	status := EXIT_OK
+
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "could not read %s: %s\n", path, err)
+			status = EXIT_NO_INPUT
+			continue
+		}
+
+		// scripts run by the command line always have ARGV bound
+		findings, diagnostics := check.Source(string(content), "ARGV")
+		if len(diagnostics) != 0 {
+			printDiagnostics(stderr, path, string(content), diagnostics)
+			status = EXIT_PARSE_ERROR
+			continue
+		}
+
+		failed := false
+		for _, finding := range findings {
+			fmt.Fprintf(stderr, "%s:%s\n", path, finding)
+			failed = failed || strict || finding.Severity == check.SEVERITY_ERROR
+		}
+
+		// a worse status from an earlier file is kept
+		if failed && status == EXIT_OK {
+			status = EXIT_CHECK_FAILED
+		}
+	}
+
+	return status
+}
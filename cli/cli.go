@@ -0,0 +1,261 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/module"
+	"monkey/repl"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PLUGINS_VARIABLE names the environment variable that lists the plugins to load at
+// startup, separated like the directories of PATH.
+const PLUGINS_VARIABLE = "MONKEY_PLUGINS"
+
+// BANNER is printed when the interactive REPL starts.
+const BANNER = "Monkey v0.1"
+
+// USAGE describes the command line accepted by Run.
+const USAGE = `usage: monkey [flags]            start the interactive REPL, or run stdin if it is not a terminal
+       monkey [flags] run <file> [arguments...]  run a script
+       monkey [flags] <file> [arguments...]      run a script
+       monkey -e <program> [arguments...]        evaluate a program and print its result
+       monkey fmt [-w] [files...]                format programs in the canonical style
+       monkey [--strict] check <files...>        report problems in programs without running them
+       monkey disasm <file>                      print the bytecode a program compiles to
+       monkey build [-o output] <file>           compile a program to a .monkeyc file that run executes
+       monkey test [-v] [paths...]               run the test_ functions of *_test.monkey files
+       monkey bench [-benchtime d] [paths...]    run the bench_ functions of *_test.monkey files
+       monkey get [packages...]                  install packages into monkey_modules
+       monkey doc [-format f] <file or module>   print the documentation of the bindings a module exports
+       monkey serve [-addr address]              serve a scratchpad that runs programs sent to POST /eval
+
+arguments after the script or program are available to it in the ARGV array
+Go plugins given with -plugin or listed in $MONKEY_PLUGINS add builtins to every command
+imported modules are looked for next to the importing file, then in monkey_modules, then in
+the directories given with -path or listed in $MONKEY_PATH, then in the standard library
+       monkey --dump-tokens [--format text|json|sexpr] <file>
+       monkey --dump-ast [--format text|json|sexpr] <file>`
+
+// Run executes the monkey command line with the given arguments and returns the process exit code.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("monkey", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, USAGE)
+		fmt.Fprintln(stderr, "\nflags:")
+		flags.PrintDefaults()
+	}
+
+	expression := flags.String("e", "", "evaluate the `program` and print its result")
+	quiet := flags.Bool("q", false, "do not print the result of -e")
+	dumpTokensFlag := flags.Bool("dump-tokens", false, "print the tokens of the program instead of running it")
+	dumpASTFlag := flags.Bool("dump-ast", false, "print the syntax tree of the program instead of running it")
+	format := flags.String("format", FORMAT_TEXT, "output `format` of --dump-tokens and --dump-ast: text, json, or sexpr")
+	trace := flags.Bool("trace", false, "print every evaluated node and its result to stderr")
+	engine := flags.String("engine", repl.ENGINE_EVAL, "run programs with the tree-walking evaluator (eval) or the bytecode virtual machine (vm); eval stays the default until the vm is stable")
+	allowExec := flags.Bool("allow-exec", false, "let programs run commands with the exec builtin")
+	checkedArithmetic := flags.Bool("checked-arithmetic", false, "fail integer arithmetic that overflows with an error instead of making big integers")
+	strictBooleans := flags.Bool("strict-booleans", false, "fail conditions and operands of ! that are not booleans with an error")
+	strict := flags.Bool("strict", false, "treat warnings as errors: do not run programs the parser warns about, and fail monkey check on warnings")
+	maxDepth := flags.Int("max-depth", 0, "fail calls nested `deeper` than this with an error, with either engine, 10000 if zero and unlimited if negative")
+	var plugins pathList
+	flags.Var(&plugins, "plugin", "load builtins from the Go plugin at `path`, which can be repeated")
+	var modulePath pathList
+	flags.Var(&modulePath, "path", "search the `directories` for imported modules instead of $MONKEY_PATH, which can be repeated")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	args = flags.Args()
+
+	// plugins extend the builtins, so they are loaded before any program is looked at
+	if os.Getenv(PLUGINS_VARIABLE) != "" {
+		plugins = append(filepath.SplitList(os.Getenv(PLUGINS_VARIABLE)), plugins...)
+	}
+	for _, path := range plugins {
+		if err := evaluator.LoadPlugin(path); err != nil {
+			fmt.Fprintf(stderr, "could not load plugin %s: %s\n", path, err)
+			return EXIT_UNAVAILABLE
+		}
+	}
+
+	loader.Path = module.DefaultPath()
+	if len(modulePath) != 0 {
+		loader.Path = nil
+		for _, dirs := range modulePath {
+			loader.Path = append(loader.Path, filepath.SplitList(dirs)...)
+		}
+	}
+
+	loader.Options.AllowExec = *allowExec
+	loader.Options.MaxDepth = *maxDepth
+	loader.Options.CheckedArithmetic = *checkedArithmetic
+	loader.Options.StrictBooleans = *strictBooleans
+
+	// the dump flags inspect a program instead of running it
+	if *dumpTokensFlag || *dumpASTFlag {
+		return runDump(flags, args, *expression, *dumpTokensFlag, *format, stdout, stderr)
+	}
+
+	if *engine != repl.ENGINE_EVAL && *engine != repl.ENGINE_VM {
+		fmt.Fprintf(stderr, "unknown engine: %s\n", *engine)
+		return EXIT_USAGE
+	}
+
+	config := runConfig{trace: *trace, engine: *engine, strict: *strict}
+
+	// -e takes the place of a script file
+	if isFlagSet(flags, "e") {
+		config.printResult = !*quiet
+		return runSource("-e", *expression, args, config, stdout, stderr)
+	}
+
+	// without arguments start the REPL, unless a program is piped in
+	if len(args) == 0 {
+		if !isInteractive(stdin) {
+			return runStdin(stdin, config, stdout, stderr)
+		}
+
+		options := repl.Options{
+			Banner:            BANNER,
+			Trace:             *trace,
+			Engine:            *engine,
+			AllowExec:         *allowExec,
+			MaxDepth:          *maxDepth,
+			CheckedArithmetic: *checkedArithmetic,
+			StrictBooleans:    *strictBooleans,
+			Loader:            loader,
+		}
+		if err := repl.StartWithOptions(stdin, stdout, options); err != nil {
+			fmt.Fprintln(stderr, err)
+			return EXIT_USAGE
+		}
+		return EXIT_OK
+	}
+
+	switch args[0] {
+	case "run":
+		if len(args) < 2 {
+			flags.Usage()
+			return EXIT_USAGE
+		}
+		return runFile(args[1], args[2:], config, stdout, stderr)
+	case "fmt":
+		return runFmt(args[1:], stdin, stdout, stderr)
+	case "check":
+		if len(args) < 2 {
+			flags.Usage()
+			return EXIT_USAGE
+		}
+		return runCheck(args[1:], *strict, stderr)
+	case "test":
+		return runTests(args[1:], stdout, stderr)
+	case "bench":
+		return runBenchmarks(args[1:], stdout, stderr)
+	case "build":
+		return runBuild(args[1:], stderr)
+	case "get":
+		return runGet(args[1:], stdout, stderr)
+	case "doc":
+		return runDoc(args[1:], stdout, stderr)
+	case "serve":
+		return runServe(args[1:], stdout, stderr)
+	case "disasm":
+		if len(args) != 2 {
+			flags.Usage()
+			return EXIT_USAGE
+		}
+		return runDisasm(args[1], stdout, stderr)
+	case "help":
+		fmt.Fprintln(stdout, USAGE)
+		return EXIT_OK
+	default:
+		return runFile(args[0], args[1:], config, stdout, stderr)
+	}
+}
+
+// runDump prints the tokens or the syntax tree of the program given with -e or as a file.
+func runDump(flags *flag.FlagSet, args []string, expression string, tokens bool, format string, stdout, stderr io.Writer) int {
+	// the source is shown under parse errors unless it came from -e
+	name, source, shown := "-e", expression, ""
+	if !isFlagSet(flags, "e") {
+		if len(args) != 1 {
+			flags.Usage()
+			return EXIT_USAGE
+		}
+
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Fprintf(stderr, "could not read %s: %s\n", args[0], err)
+			return EXIT_NO_INPUT
+		}
+		name, source = args[0], string(content)
+		shown = source
+	}
+
+	if tokens {
+		if err := dumpTokens(stdout, source, format); err != nil {
+			fmt.Fprintln(stderr, err)
+			return EXIT_USAGE
+		}
+		return EXIT_OK
+	}
+
+	diagnostics, err := dumpAST(stdout, source, format)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return EXIT_USAGE
+	}
+
+	// the tree is still printed so partial results can be inspected
+	printDiagnostics(stderr, name, shown, diagnostics)
+	if len(diagnostics) != 0 {
+		return EXIT_PARSE_ERROR
+	}
+
+	return EXIT_OK
+}
+
+// pathList collects the values of a flag that can be given more than once.
+type pathList []string
+
+func (list *pathList) String() string { return strings.Join(*list, string(filepath.ListSeparator)) }
+func (list *pathList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// isInteractive reports whether the input is a terminal rather than a file or a pipe.
+func isInteractive(in io.Reader) bool {
+	file, ok := in.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// isFlagSet reports whether the flag was given on the command line, even if with an empty value.
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
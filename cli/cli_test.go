@@ -0,0 +1,1026 @@
+package cli
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"monkey"
+	"monkey/object"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunFile(t *testing.T) {
+	tests := []struct {
+		args           []string
+		script         string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			args:           []string{"run"},
+			script:         `let greet = fn(name) { "Hello, " + name + "!" }; puts(greet("Monkey"));`,
+			expectedStdout: "Hello, Monkey!\n",
+		},
+		{
+			args:           []string{},
+			script:         "puts(1 + 2)\n5 * 5",
+			expectedStdout: "3\n",
+		},
+		{
+			args:           []string{"run"},
+			script:         "puts(len(ARGV)); puts(ARGV[0]); puts(ARGV[1]);",
+			expectedStdout: "0\nnull\nnull\n",
+		},
+		{
+			args:           []string{"run"},
+			script:         "let x = ;",
+			expectedCode:   EXIT_PARSE_ERROR,
+			expectedStderr: "script.monkey:1:9: no prefix parse function for ; found",
+		},
+		{
+			args:           []string{"run"},
+			script:         "puts(1);\n1 + true; puts(2);",
+			expectedCode:   EXIT_RUNTIME_ERROR,
+			expectedStdout: "1\n",
+			expectedStderr: "script.monkey:2:3: runtime error: type mismatch: INTEGER + BOOLEAN",
+		},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "script.monkey")
+		if err := os.WriteFile(path, []byte(tt.script), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var stderr bytes.Buffer
+		var code int
+		stdout := captureStdout(t, func() {
+			code = Run(append(tt.args, path), strings.NewReader(""), os.Stdout, &stderr)
+		})
+
+		if code != tt.expectedCode {
+			t.Errorf("exit code wrong for %q. expected=%d, got=%d", tt.script, tt.expectedCode, code)
+		}
+		if stdout != tt.expectedStdout {
+			t.Errorf("stdout wrong for %q. expected=%q, got=%q", tt.script, tt.expectedStdout, stdout)
+		}
+		if !strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("stderr wrong for %q. expected to contain %q, got=%q", tt.script, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestErrorSnippets(t *testing.T) {
+	tests := []struct {
+		args           []string
+		script         string
+		expectedStderr string
+	}{
+		{
+			[]string{"run"},
+			"let x = ;\nlet y 5;",
+			"script.monkey:1:9: no prefix parse function for ; found\n" +
+				" 1 | let x = ;\n" +
+				"   |         ^\n" +
+				"script.monkey:2:7: expected next token to be =, got INT instead\n" +
+				" 2 | let y 5;\n" +
+				"   |       ^\n",
+		},
+		{
+			[]string{"run"},
+			"let half = fn(x) {\n\tx / 0\n};\nhalf(4);",
+			"script.monkey:2:4: runtime error: division by zero\n" +
+				" 2 | \tx / 0\n" +
+				"   | \t  ^\n" +
+				"    in half, called at script.monkey:4:5\n",
+		},
+		{
+			[]string{"run"},
+			"let s = \"é\";\nputs(s, lenght(s))",
+			"script.monkey:2:9: runtime error: identifier not found: lenght — did you mean len?\n" +
+				" 2 | puts(s, lenght(s))\n" +
+				"   |         ^~~~~~\n",
+		},
+		{
+			// columns count bytes, while the caret lines up with the characters
+			[]string{"--engine=vm"},
+			"\"é\" + 1",
+			"script.monkey:1:6: runtime error: type mismatch: STRING + INTEGER\n" +
+				" 1 | \"é\" + 1\n" +
+				"   |     ^\n",
+		},
+		{
+			[]string{"check"},
+			"puts(1,",
+			"script.monkey:1:8: no prefix parse function for EOF found\n" +
+				" 1 | puts(1,\n" +
+				"   |        ^\n" +
+				"script.monkey:1:9: expected next token to be ), got EOF instead\n" +
+				" 1 | puts(1,\n" +
+				"   |        ^\n",
+		},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "script.monkey")
+		if err := os.WriteFile(path, []byte(tt.script), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		Run(append(tt.args, path), strings.NewReader(""), &stdout, &stderr)
+
+		expected := strings.ReplaceAll(tt.expectedStderr, "script.monkey", path)
+		if stderr.String() != expected {
+			t.Errorf("stderr wrong for %q.\nexpected=%q\ngot=     %q", tt.script, expected, stderr.String())
+		}
+	}
+
+	// programs given with -e are on the command line already
+	var stdout, stderr bytes.Buffer
+	Run([]string{"-e", "1 + true"}, strings.NewReader(""), &stdout, &stderr)
+	if expected := "-e:1:3: runtime error: type mismatch: INTEGER + BOOLEAN\n"; stderr.String() != expected {
+		t.Errorf("stderr wrong for -e. expected=%q, got=%q", expected, stderr.String())
+	}
+
+	// an error without a position still shows the calls it happened inside of
+	stderr.Reset()
+	errObj := &object.Error{Message: "boom", Trace: []object.Call{{Function: "f", Line: 2, Column: 2}}}
+	printRuntimeError(&stderr, "-e", "let f = fn() { boom() };\nf()", errObj)
+	if expected := "-e: runtime error: boom\n    in f, called at -e:2:2\n"; stderr.String() != expected {
+		t.Errorf("stderr wrong without a position. expected=%q, got=%q", expected, stderr.String())
+	}
+}
+
+func TestScriptArguments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "args.monkey")
+	script := `puts(len(ARGV)); puts(ARGV[0] + "-" + ARGV[1]);`
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{path, "one", "-two"}, {"run", path, "one", "-two"}} {
+		var stderr bytes.Buffer
+		stdout := captureStdout(t, func() {
+			Run(args, strings.NewReader(""), os.Stdout, &stderr)
+		})
+
+		expected := "2\none--two\n"
+		if stdout != expected {
+			t.Errorf("stdout wrong for %q. expected=%q, got=%q (stderr=%q)", args, expected, stdout, stderr.String())
+		}
+	}
+}
+
+func TestRunStdin(t *testing.T) {
+	program := "let add = fn(a, b) {\n  a + b\n};\nputs(add(1, 2));\nadd(3, 4)\n"
+
+	var stderr bytes.Buffer
+	var code int
+	stdout := captureStdout(t, func() {
+		code = Run([]string{}, strings.NewReader(program), os.Stdout, &stderr)
+	})
+
+	if code != EXIT_OK {
+		t.Errorf("exit code wrong. expected=%d, got=%d (stderr=%q)", EXIT_OK, code, stderr.String())
+	}
+	if stdout != "3\n" {
+		t.Errorf("stdout wrong. expected=%q, got=%q", "3\n", stdout)
+	}
+
+	code = Run([]string{}, strings.NewReader("1 +\n  true"), os.Stdout, &stderr)
+	if code != EXIT_RUNTIME_ERROR {
+		t.Errorf("exit code wrong. expected=%d, got=%d", EXIT_RUNTIME_ERROR, code)
+	}
+	if !strings.Contains(stderr.String(), "<stdin>:1:3: runtime error") {
+		t.Errorf("stderr wrong. got=%q", stderr.String())
+	}
+}
+
+func TestRunMissingFile(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := Run([]string{"run", "does-not-exist.monkey"}, strings.NewReader(""), &stdout, &stderr)
+	if code != EXIT_NO_INPUT {
+		t.Errorf("exit code wrong. expected=%d, got=%d", EXIT_NO_INPUT, code)
+	}
+	if !strings.Contains(stderr.String(), "could not read does-not-exist.monkey") {
+		t.Errorf("stderr wrong. got=%q", stderr.String())
+	}
+
+	code = Run([]string{"run"}, strings.NewReader(""), &stdout, &stderr)
+	if code != EXIT_USAGE {
+		t.Errorf("exit code for missing file argument wrong. expected=%d, got=%d", EXIT_USAGE, code)
+	}
+}
+
+func TestMissingPlugin(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := Run([]string{"-plugin", "does-not-exist.so", "-e", "1"}, strings.NewReader(""), &stdout, &stderr)
+	if code != EXIT_UNAVAILABLE {
+		t.Errorf("exit code wrong. expected=%d, got=%d", EXIT_UNAVAILABLE, code)
+	}
+	if !strings.HasPrefix(stderr.String(), "could not load plugin does-not-exist.so: ") || stdout.Len() != 0 {
+		t.Errorf("output wrong. stdout=%q, stderr=%q", stdout.String(), stderr.String())
+	}
+
+	stderr.Reset()
+	t.Setenv(PLUGINS_VARIABLE, "also-missing.so")
+	code = Run([]string{"-e", "1"}, strings.NewReader(""), &stdout, &stderr)
+	if code != EXIT_UNAVAILABLE || !strings.HasPrefix(stderr.String(), "could not load plugin also-missing.so: ") {
+		t.Errorf("plugins from the environment should be loaded. code=%d, stderr=%q", code, stderr.String())
+	}
+}
+
+func TestEvalFlag(t *testing.T) {
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"-e", "puts(1 + 2)"}, 0, "3\n", ""},
+		{[]string{"-e", "1 + 2"}, 0, "3\n", ""},
+		{[]string{"-q", "-e", "1 + 2"}, 0, "", ""},
+		{[]string{"-e", "let x = 1;"}, 0, "", ""},
+		{[]string{"-e", ""}, 0, "", ""},
+		{[]string{"-e", "1 + true"}, EXIT_RUNTIME_ERROR, "", "-e:1:3: runtime error: type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"-e", "let f = fn() { 1 + true };\nf()"}, EXIT_RUNTIME_ERROR, "", "-e:1:18: runtime error: type mismatch: INTEGER + BOOLEAN\n    in f, called at -e:2:2\n"},
+		{[]string{"-max-depth", "5", "-e", "let f = fn(n) { f(n + 1) }; f(0)"}, EXIT_RUNTIME_ERROR, "", "runtime error: maximum recursion depth exceeded: 5 calls"},
+		{[]string{"-engine", "vm", "-max-depth", "5", "-e", "let f = fn(n) { f(n + 1) }; f(0)"}, EXIT_RUNTIME_ERROR, "", "runtime error: maximum recursion depth exceeded: 5 calls"},
+		{[]string{"-engine", "vm", "-max-depth", "50", "-e", "let f = fn(n) { f(n + 1) }; try { f(0) } catch (e) { e[\"message\"] }"}, EXIT_OK, "maximum recursion depth exceeded: 50 calls\n", ""},
+		{[]string{"-engine", "vm", "-e", "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(2000)"}, EXIT_OK, "2000\n", ""},
+		{[]string{"-checked-arithmetic", "-e", "9223372036854775807 + 1"}, EXIT_RUNTIME_ERROR, "", "-e:1:21: runtime error: integer overflow: 9223372036854775807 + 1"},
+		{[]string{"-e", "9223372036854775807 + 1"}, EXIT_OK, "9223372036854775808\n", ""},
+		{[]string{"-strict-booleans", "-e", "if (0) { 1 }"}, EXIT_RUNTIME_ERROR, "", "-e:1:5: runtime error: condition must be BOOLEAN, got INTEGER"},
+		{[]string{"-e", "let = 1"}, EXIT_PARSE_ERROR, "", "-e:1:5: expected next token to be IDENT, got = instead"},
+		{[]string{"-e", "if (true) { puts(1)"}, EXIT_PARSE_ERROR, "", "-e:1:20: expected next token to be }, got EOF instead"},
+		{[]string{"-e", "len(ARGV)"}, EXIT_OK, "0\n", ""},
+		{[]string{"-e", "1; 2"}, EXIT_OK, "2\n", "-e:1:1: warning: statement has no effect"},
+		{[]string{"--strict", "-e", "1; 2"}, EXIT_PARSE_ERROR, "", "-e:1:1: warning: statement has no effect"},
+		{[]string{"-e", "ARGV", "a", "b"}, EXIT_OK, "[a, b]\n", ""},
+		{[]string{"--trace", "-e", "len(\"ab\")"}, EXIT_OK, "2\n", "len => builtin function\nab => ab\nlen(ab) => 2\n"},
+		{[]string{"-unknown"}, EXIT_USAGE, "", "flag provided but not defined"},
+		{[]string{"--engine", "vm", "-e", "let f = fn(x) { x * 2 }; f(21)"}, EXIT_OK, "42\n", ""},
+		{[]string{"--engine=vm", "-e", "ARGV", "a"}, EXIT_OK, "[a]\n", ""},
+		{[]string{"--engine=vm", "-e", "let x = 1;"}, EXIT_OK, "", ""},
+		{[]string{"--engine=vm", "-e", "1 + true"}, EXIT_RUNTIME_ERROR, "", "-e:1:3: runtime error: type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"--engine=vm", "-e", "x"}, EXIT_PARSE_ERROR, "", "-e: compile error: identifier not found: x"},
+		{[]string{"--engine=vm", "--trace", "-e", "1"}, EXIT_USAGE, "", "-e: --trace requires --engine=eval"},
+		{[]string{"--engine=jit", "-e", "1"}, EXIT_USAGE, "", "unknown engine: jit"},
+		{[]string{"-e", "let unless = macro(c, a) { quote(if (!unquote(c)) { unquote(a) }) }; unless(1 > 2, 3)"}, EXIT_OK, "3\n", ""},
+		{[]string{"--engine=vm", "-e", "let unless = macro(c, a) { quote(if (!unquote(c)) { unquote(a) }) }; unless(1 > 2, 3)"}, EXIT_OK, "3\n", ""},
+		{[]string{"-e", "let m = macro() { 1 };\nm()"}, EXIT_RUNTIME_ERROR, "", "-e:2:2: runtime error: macro m returned INTEGER, want QUOTE"},
+	}
+
+	for _, tt := range tests {
+		var stderr bytes.Buffer
+		var code int
+		stdout := captureStdout(t, func() {
+			code = Run(tt.args, strings.NewReader(""), os.Stdout, &stderr)
+		})
+
+		if code != tt.expectedCode {
+			t.Errorf("exit code wrong for %q. expected=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+		if stdout != tt.expectedStdout {
+			t.Errorf("stdout wrong for %q. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout)
+		}
+		if !strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("stderr wrong for %q. expected to contain %q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+// TestEngines runs the same programs with both engines, which must agree on what they
+// print, how they fail and the exit code.
+func TestEngines(t *testing.T) {
+	inputs := []string{
+		"puts(1 + 2); [1, 2].map(fn(x) { x * 2 })",
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)",
+		`let h = {"a": 1}; [h["a"], h["b"] ?? 2, "ab".upper()]`,
+		"let f = fn() { 1 + true };\nf()",
+		`try { throw "oops" } catch (e) { e }`,
+		"let f = fn(n) { f(n + 1) }; try { f(0) } catch (e) { e[\"message\"] }",
+		"let f = fn(n) { f(n + 1) }; f(0)",
+		"9223372036854775807 + 1",
+		"ARGV",
+	}
+
+	run := func(args ...string) (int, string, string) {
+		var stderr bytes.Buffer
+		var code int
+		stdout := captureStdout(t, func() {
+			code = Run(args, strings.NewReader(""), os.Stdout, &stderr)
+		})
+		return code, stdout, stderr.String()
+	}
+
+	for _, input := range inputs {
+		evalCode, evalStdout, evalStderr := run("-engine", "eval", "-max-depth", "100", "-e", input, "a")
+		vmCode, vmStdout, vmStderr := run("-engine", "vm", "-max-depth", "100", "-e", input, "a")
+
+		if evalCode != vmCode || evalStdout != vmStdout || evalStderr != vmStderr {
+			t.Errorf("engines disagree on %q.\neval: %d %q %q\nvm:   %d %q %q",
+				input, evalCode, evalStdout, evalStderr, vmCode, vmStdout, vmStderr)
+		}
+	}
+}
+
+func TestDumpFlags(t *testing.T) {
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			args:           []string{"--dump-tokens", "-e", "x + 1"},
+			expectedStdout: "IDENT      \"x\"\n+          \"+\"\nINT        \"1\"\nEOF        \"\"\n",
+		},
+		{
+			args:           []string{"--dump-tokens", "--format", "sexpr", "-e", "x;"},
+			expectedStdout: "(tokens\n  (\"IDENT\" \"x\")\n  (\";\" \";\")\n  (\"EOF\" \"\"))\n",
+		},
+		{
+			args:           []string{"--dump-tokens", "--format", "json", "-e", "x"},
+			expectedStdout: "[\n  {\n    \"literal\": \"x\",\n    \"type\": \"IDENT\"\n  },\n  {\n    \"literal\": \"\",\n    \"type\": \"EOF\"\n  }\n]\n",
+		},
+		{
+			args:           []string{"--dump-ast", "--format", "sexpr", "-e", "let x = -2;"},
+			expectedStdout: "(Program (Statements ((LetStatement (Name (Identifier (Value \"x\"))) (Value (PrefixExpression (Operator \"-\") (Right (IntegerLiteral (Value 2))))) (Exported false) (Doc \"\")))))\n",
+		},
+		{
+			args:           []string{"--dump-ast", "-e", "f(1)"},
+			expectedStdout: "Program\n  Statements:\n    ExpressionStatement\n      Expression:\n        CallExpression\n          Function:\n            Identifier\n              Value: \"f\"\n          Arguments:\n            IntegerLiteral\n              Value: 1\n          Optional: false\n",
+		},
+		{
+			args:           []string{"--dump-ast", "--format", "json", "-e", "true"},
+			expectedStdout: "{\n  \"node\": \"Program\",\n  \"Statements\": [\n    {\n      \"node\": \"ExpressionStatement\",\n      \"Expression\": {\n        \"node\": \"Boolean\",\n        \"Value\": true\n      }\n    }\n  ]\n}\n",
+		},
+		{
+			args:           []string{"--dump-ast", "--format", "sexpr", "-e", "let = 1"},
+			expectedCode:   EXIT_PARSE_ERROR,
+			expectedStdout: "(Program (Statements ((ExpressionStatement (Expression null)) (ExpressionStatement (Expression (IntegerLiteral (Value 1)))))))\n",
+			expectedStderr: "expected next token to be IDENT",
+		},
+		{
+			args:           []string{"--dump-ast", "--format", "yaml", "-e", "1"},
+			expectedCode:   EXIT_USAGE,
+			expectedStderr: "unknown format: yaml",
+		},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := Run(tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("exit code wrong for %q. expected=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("stdout wrong for %q. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("stderr wrong for %q. expected to contain %q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestFmt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.mk")
+	if err := os.WriteFile(path, []byte("let x=1+2 // three\nputs( x )"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected := "let x = 1 + 2; // three\nputs(x);\n"
+
+	// without -w the formatted program is printed
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"fmt", path}, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+		t.Fatalf("fmt failed with %d: %s", code, stderr.String())
+	}
+	if stdout.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, stdout.String())
+	}
+
+	// with -w the file is rewritten
+	stdout.Reset()
+	if code := Run([]string{"fmt", "-w", path}, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+		t.Fatalf("fmt -w failed with %d: %s", code, stderr.String())
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != expected || stdout.Len() != 0 {
+		t.Errorf("wrong rewrite. expected=%q, got=%q (stdout %q)", expected, content, stdout.String())
+	}
+
+	// stdin is formatted when no files are given
+	stdout.Reset()
+	if code := Run([]string{"fmt"}, strings.NewReader("[1,2]"), &stdout, &stderr); code != EXIT_OK || stdout.String() != "[1, 2];\n" {
+		t.Errorf("wrong stdin result. code=%d, got=%q", code, stdout.String())
+	}
+
+	// a program that does not parse is reported and left alone
+	stderr.Reset()
+	if code := Run([]string{"fmt"}, strings.NewReader("let = 1"), &stdout, &stderr); code != EXIT_PARSE_ERROR {
+		t.Errorf("wrong exit code for a parse error. expected=%d, got=%d", EXIT_PARSE_ERROR, code)
+	}
+	if !strings.Contains(stderr.String(), "<stdin>:1:5: expected next token to be IDENT") {
+		t.Errorf("wrong diagnostics. got=%q", stderr.String())
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "greet.monkey"), []byte(`export let greet = fn(name) { "hello " + name };`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "main.monkey")
+	if err := os.WriteFile(script, []byte(`puts(import("greet.monkey")["greet"](ARGV[0]));`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the module is found next to the script, wherever it runs from
+	var stderr bytes.Buffer
+	stdout := captureStdout(t, func() {
+		Run([]string{script, "monkey"}, strings.NewReader(""), os.Stdout, &stderr)
+	})
+	if stdout != "hello monkey\n" {
+		t.Errorf("stdout wrong. expected=%q, got=%q (stderr=%q)", "hello monkey\n", stdout, stderr.String())
+	}
+
+	var out bytes.Buffer
+	code := Run([]string{"--engine", "vm", script}, strings.NewReader(""), &out, &out)
+	if code != EXIT_PARSE_ERROR || !strings.Contains(out.String(), "import is not supported by the compiler") {
+		t.Errorf("vm should refuse imports. code=%d, output=%q", code, out.String())
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	installed, flagged := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(installed, "where.monkey"), []byte(`export let where = "installed";`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(flagged, "where.monkey"), []byte(`export let where = "flagged";`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MONKEY_PATH", installed)
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-e", `import("where.monkey")["where"]`}, "installed\n"},
+		// -path replaces $MONKEY_PATH
+		{[]string{"-path", flagged, "-e", `import("where.monkey")["where"]`}, "flagged\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := Run(tt.args, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+			t.Errorf("exit code wrong for %q. expected=%d, got=%d (stderr=%q)", tt.args, EXIT_OK, code, stderr.String())
+		}
+		if stdout.String() != tt.expected {
+			t.Errorf("stdout wrong for %q. expected=%q, got=%q", tt.args, tt.expected, stdout.String())
+		}
+	}
+}
+
+func TestAllowExec(t *testing.T) {
+	program := `exec("echo", ["hi"])["stdout"]`
+
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"-allow-exec", "-e", program}, EXIT_OK, "hi\n\n"},
+		{[]string{"-allow-exec", "-engine", "vm", "-e", program}, EXIT_OK, "hi\n\n"},
+		{[]string{"-e", program}, EXIT_RUNTIME_ERROR, ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := Run(tt.args, strings.NewReader(""), &stdout, &stderr); code != tt.code {
+			t.Errorf("exit code wrong for %q. expected=%d, got=%d (stderr=%q)", tt.args, tt.code, code, stderr.String())
+		}
+		if stdout.String() != tt.expected {
+			t.Errorf("stdout wrong for %q. expected=%q, got=%q", tt.args, tt.expected, stdout.String())
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	server := httptest.NewServer(newServer(monkey.Options{Sandbox: true}, 100*time.Millisecond))
+	defer server.Close()
+
+	tests := []struct {
+		body     string
+		status   int
+		expected string
+	}{
+		{`{"source": "puts(\"hi\"); 1 + 1"}`, http.StatusOK, `{"output":"hi\n","value":"2","diagnostics":[]}`},
+		{`{"source": "let x = 1;"}`, http.StatusOK, `{"output":"","value":"","diagnostics":[]}`},
+		{`{"source": "let = 1"}`, http.StatusOK, `{"output":"","value":"","diagnostics":[` +
+			`{"message":"expected next token to be IDENT, got = instead","line":1,"column":5},` +
+			`{"message":"no prefix parse function for = found","line":1,"column":5}]}`},
+		{`{"source": "puts(1); 1 / 0"}`, http.StatusOK, `{"output":"1\n","value":"","diagnostics":[{"message":"division by zero","line":1,"column":12}]}`},
+		{`{"source": "exec(\"ls\", [])"}`, http.StatusOK, `{"output":"","value":"","diagnostics":[{"message":"exec is not available in sandbox mode","line":1,"column":5}]}`},
+		// every program gets the timeout of the server
+		{`{"source": "recv(channel())"}`, http.StatusOK, `{"output":"","value":"","diagnostics":[` +
+			`{"message":"evaluation interrupted: context deadline exceeded","line":1,"column":5}]}`},
+		{`{"source": 1}`, http.StatusBadRequest, "could not decode request: json: cannot unmarshal number into Go struct field evalRequest.source of type string"},
+		{`{"source": "` + strings.Repeat("1", 1<<20) + `"}`, http.StatusRequestEntityTooLarge, "program too large: more than 1048576 bytes"},
+	}
+
+	for _, tt := range tests {
+		response, err := http.Post(server.URL+"/eval", "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("request failed: %s", err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		if response.StatusCode != tt.status {
+			t.Errorf("status wrong for %.40q. expected=%d, got=%d", tt.body, tt.status, response.StatusCode)
+		}
+		if got := strings.TrimSpace(string(body)); got != tt.expected {
+			t.Errorf("body wrong for %.40q. expected=%q, got=%q", tt.body, tt.expected, got)
+		}
+	}
+
+	response, err := http.Get(server.URL + "/eval")
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET should not be allowed. got=%d", response.StatusCode)
+	}
+}
+
+func TestServeOutputLimit(t *testing.T) {
+	server := httptest.NewServer(newServer(monkey.Options{Sandbox: true}, time.Second))
+	defer server.Close()
+
+	// each line takes 1025 bytes, so the 1024th would go past the limit
+	source := `let line = "` + strings.Repeat("x", 1024) + `"; let f = fn(n) { if (n > 0) { puts(line); f(n - 1) } }; f(2000)`
+	body, _ := json.Marshal(evalRequest{Source: source})
+	response, err := http.Post(server.URL+"/eval", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	defer response.Body.Close()
+
+	var result evalResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		t.Fatalf("could not decode response: %s", err)
+	}
+
+	if len(result.Output) != 1023*1025 {
+		t.Errorf("output has wrong length. expected=%d, got=%d", 1023*1025, len(result.Output))
+	}
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].Message != "could not print: output limit exceeded: 1048576 bytes" {
+		t.Errorf("wrong diagnostics. got=%v", result.Diagnostics)
+	}
+}
+
+func TestGet(t *testing.T) {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(gz)
+	content := `export let greeting = "hello from a package";`
+	archive.WriteHeader(&tar.Header{Name: "index.monkey", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	archive.Write([]byte(content))
+	archive.Close()
+	gz.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buffer.Bytes())
+	}))
+	defer server.Close()
+
+	// packages are installed into the working directory
+	t.Chdir(t.TempDir())
+
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"get", server.URL + "/greeting.tar.gz"}, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+		t.Fatalf("get failed with code %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "got 127.0.0.1/greeting sha256:") {
+		t.Errorf("stdout wrong. got=%q", stdout.String())
+	}
+
+	run := func() string {
+		var out bytes.Buffer
+		Run([]string{"-e", `import("127.0.0.1/greeting")["greeting"]`}, strings.NewReader(""), &out, &out)
+		return out.String()
+	}
+	if output := run(); output != "hello from a package\n" {
+		t.Errorf("package not imported. got=%q", output)
+	}
+
+	// without packages, get installs the lockfile
+	if err := os.RemoveAll("monkey_modules"); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := Run([]string{"get"}, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+		t.Fatalf("get of the lockfile failed with code %d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "installed 127.0.0.1/greeting sha256:") {
+		t.Errorf("stdout wrong. got=%q", stdout.String())
+	}
+	if output := run(); output != "hello from a package\n" {
+		t.Errorf("package not reinstalled. got=%q", output)
+	}
+
+	stderr.Reset()
+	if code := Run([]string{"get", "https://"}, strings.NewReader(""), &stdout, &stderr); code != EXIT_USAGE {
+		t.Errorf("exit code wrong for an invalid package. expected=%d, got=%d", EXIT_USAGE, code)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	clean := filepath.Join(dir, "clean.mk")
+	if err := os.WriteFile(clean, []byte("let x = 1; puts(x, ARGV);\nlet y = 2; // check:ignore unused-binding"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.mk")
+	if err := os.WriteFile(broken, []byte("puts(y);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	suspicious := filepath.Join(dir, "suspicious.mk")
+	if err := os.WriteFile(suspicious, []byte("let x = 1;\nlet f = fn(x) { x };\nputs(f(x));"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.mk")
+	if err := os.WriteFile(invalid, []byte("let = 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStderr string
+	}{
+		{[]string{"check", clean}, EXIT_OK, ""},
+		{[]string{"check", clean, broken}, EXIT_CHECK_FAILED, broken + ":1:6: error: identifier not found: y (unbound-identifier)\n"},
+		{[]string{"check", suspicious}, EXIT_OK, suspicious + ":2:12: warning: x shadows the binding at 1:5 (shadowed-binding)\n"},
+		{[]string{"--strict", "check", suspicious}, EXIT_CHECK_FAILED, suspicious + ":2:12: warning: x shadows the binding at 1:5 (shadowed-binding)\n"},
+		{[]string{"check", invalid, broken}, EXIT_PARSE_ERROR, invalid + ":1:5: expected next token to be IDENT, got = instead\n"},
+		{[]string{"check"}, EXIT_USAGE, "usage:"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := Run(tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("exit code wrong for %q. expected=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+		if !strings.HasPrefix(stderr.String(), tt.expectedStderr) {
+			t.Errorf("stderr wrong for %q. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestDoc(t *testing.T) {
+	dir := t.TempDir()
+
+	shapes := filepath.Join(dir, "shapes.monkey")
+	source := `// shapes is not documented by this comment.
+
+/// area returns the area of a rectangle.
+///
+///   area(2, 3) == 6
+export let area = fn(width, height) { width * height };
+
+/// helper is not exported.
+let helper = 1;
+
+export let sides = 4;
+
+/// unless runs the body when the condition is false.
+export let unless = macro(condition, body) { quote(if (!(unquote(condition))) { unquote(body) }) };`
+	if err := os.WriteFile(shapes, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.monkey")
+	if err := os.WriteFile(invalid, []byte("export let = 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			args: []string{"doc", shapes},
+			expectedStdout: "module " + shapes + "\n\narea(width, height)\n    area returns the area of a rectangle.\n\n      area(2, 3) == 6\n" +
+				"\nsides\n\nunless(condition, body)\n    unless runs the body when the condition is false.\n",
+		},
+		{
+			args: []string{"doc", "-format", "markdown", shapes},
+			expectedStdout: "# " + shapes + "\n\n## `area(width, height)`\n\narea returns the area of a rectangle.\n\n  area(2, 3) == 6\n" +
+				"\n## `sides`\n\n## `unless(condition, body)`\n\nunless runs the body when the condition is false.\n",
+		},
+		// modules are found like imports, in the standard library as well
+		{
+			args:           []string{"doc", "std/types"},
+			expectedStdout: "module std/types\n\nis_int(value)\n    is_int reports whether the value is an integer.\n",
+		},
+		{args: []string{"doc", "missing"}, expectedCode: EXIT_NO_INPUT, expectedStderr: "could not find missing: no such module"},
+		{args: []string{"doc", invalid}, expectedCode: EXIT_PARSE_ERROR, expectedStderr: invalid + ":1:12: expected next token to be IDENT, got = instead"},
+		{args: []string{"doc", "-format", "html", shapes}, expectedCode: EXIT_USAGE, expectedStderr: "unknown format: html"},
+		{args: []string{"doc"}, expectedCode: EXIT_USAGE, expectedStderr: "usage: monkey doc"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := Run(tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("exit code wrong for %q. expected=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+		if !strings.HasPrefix(stdout.String(), tt.expectedStdout) {
+			t.Errorf("stdout wrong for %q. expected to start with %q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+		if !strings.HasPrefix(stderr.String(), tt.expectedStderr) {
+			t.Errorf("stderr wrong for %q. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestTestCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	passing := "let add = fn(a, b) { a + b };\nlet test_add = fn() { assert_eq(add(1, 2), 3) };\nlet test_true = fn() { assert(true) };\n"
+	if err := os.WriteFile(filepath.Join(dir, "add_test.monkey"), []byte(passing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// files that do not follow the naming convention are not discovered in directories
+	failing := "let test_sub = fn() {\n  assert_eq(3 - 1, 1)\n};\n"
+	if err := os.WriteFile(filepath.Join(dir, "sub.monkey"), []byte(failing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// tests import modules and run with the options of the command line, as the file does
+	modules := t.TempDir()
+	if err := os.WriteFile(filepath.Join(modules, "double.monkey"), []byte("export let double = fn(x) { x * 2 };"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	imports := filepath.Join(modules, "double_test.monkey")
+	if err := os.WriteFile(imports, []byte(`let test_double = fn() { assert_eq(import("double.monkey")["double"](2), 4) };`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	overflow := filepath.Join(modules, "overflow_test.monkey")
+	if err := os.WriteFile(overflow, []byte("let test_overflow = fn() { 9223372036854775807 + 1 };"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+	}{
+		{
+			[]string{"test", dir},
+			EXIT_OK,
+			filepath.Join(dir, "add_test.monkey") + ": 2 passed, 0 failed\n2 passed, 0 failed\n",
+		},
+		{
+			[]string{"test", "-v", filepath.Join(dir, "sub.monkey")},
+			EXIT_TESTS_FAILED,
+			"FAIL test_sub\n    " + filepath.Join(dir, "sub.monkey") + ":2:12: assertion failed: 2 != 1\n" +
+				filepath.Join(dir, "sub.monkey") + ": 0 passed, 1 failed\n0 passed, 1 failed\n",
+		},
+		{
+			[]string{"test", t.TempDir()},
+			EXIT_OK,
+			"no test files\n",
+		},
+		{
+			[]string{"test", imports},
+			EXIT_OK,
+			imports + ": 1 passed, 0 failed\n1 passed, 0 failed\n",
+		},
+		{
+			[]string{"-checked-arithmetic", "test", overflow},
+			EXIT_TESTS_FAILED,
+			"FAIL test_overflow\n    " + overflow + ":1:48: integer overflow: 9223372036854775807 + 1\n" +
+				overflow + ": 0 passed, 1 failed\n0 passed, 1 failed\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+
+		code := Run(tt.args, strings.NewReader(""), &stdout, &stderr)
+		if code != tt.expectedCode {
+			t.Errorf("exit code wrong for %q. expected=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("stdout wrong for %q. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+	}
+}
+
+func TestBenchCommand(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "add_test.monkey")
+	if err := os.WriteFile(path, []byte("let bench_add = fn() { 1 + 2 };\nlet test_add = fn() { assert(true) };\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"bench", "-benchtime", "1ms", dir}, strings.NewReader(""), &stdout, &stderr)
+	if code != EXIT_OK {
+		t.Fatalf("bench failed with %d: %s", code, stderr.String())
+	}
+
+	// only the benchmark runs, and its timing varies
+	fields := strings.Fields(stdout.String())
+	if len(fields) != 4 || fields[0] != "bench_add" || fields[3] != "ns/op" {
+		t.Errorf("wrong output. got=%q", stdout.String())
+	}
+
+	// the benchmarks run with the options of the command line, as the file does
+	overflow := filepath.Join(t.TempDir(), "overflow_test.monkey")
+	if err := os.WriteFile(overflow, []byte("let bench_overflow = fn() { 9223372036854775807 + 1 };\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	code = Run([]string{"-checked-arithmetic", "bench", "-benchtime", "1ms", overflow}, strings.NewReader(""), &stdout, &stderr)
+	if code != EXIT_RUNTIME_ERROR || !strings.Contains(stderr.String(), "integer overflow") {
+		t.Errorf("benchmark ignored -checked-arithmetic. code=%d, stderr=%q", code, stderr.String())
+	}
+}
+
+func TestDisasm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte(`let x = "a"; x + "b"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"disasm", path}, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+		t.Fatalf("disasm failed with %d: %s", code, stderr.String())
+	}
+
+	expected := `0000 OpConstant 0
+0003 OpSetGlobal 1
+0006 OpGetGlobal 1
+0009 OpConstant 1
+0012 OpAdd
+0013 OpPop
+
+constants:
+0000 STRING "a"
+0001 STRING "b"
+`
+	if stdout.String() != expected {
+		t.Errorf("wrong listing. expected=%q, got=%q", expected, stdout.String())
+	}
+
+	if err := os.WriteFile(path, []byte("let f = fn(a) { a }; f(1)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := Run([]string{"disasm", path}, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+		t.Fatalf("disasm failed with %d: %s", code, stderr.String())
+	}
+
+	expected = `0000 OpClosure 0 0
+0004 OpSetGlobal 1
+0007 OpGetGlobal 1
+0010 OpConstant 1
+0013 OpCall 1
+0015 OpPop
+
+constants:
+0000 FUNCTION locals=1 parameters=1
+    0000 OpGetLocal 0
+    0002 OpReturnValue
+0001 INTEGER 1
+`
+	if stdout.String() != expected {
+		t.Errorf("wrong listing. expected=%q, got=%q", expected, stdout.String())
+	}
+
+	if err := os.WriteFile(path, []byte("y"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	code := Run([]string{"disasm", path}, strings.NewReader(""), &stdout, &stderr)
+	if code != EXIT_PARSE_ERROR || stderr.String() != path+": compile error: identifier not found: y\n" {
+		t.Errorf("wrong compile error. code=%d, stderr=%q", code, stderr.String())
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.monkey")
+	source := `let greet = fn(name) { puts("hello " + name) }; greet(ARGV[0]);`
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"build", path}, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+		t.Fatalf("build failed with %d: %s", code, stderr.String())
+	}
+
+	compiled := filepath.Join(dir, "script.monkeyc")
+	output := captureStdout(t, func() {
+		if code := Run([]string{"run", compiled, "world"}, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+			t.Errorf("running the compiled file failed with %d: %s", code, stderr.String())
+		}
+	})
+	if output != "hello world\n" {
+		t.Errorf("wrong output. expected=%q, got=%q", "hello world\n", output)
+	}
+
+	// -o may follow the file
+	other := filepath.Join(dir, "other.bin")
+	if code := Run([]string{"build", path, "-o", other}, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+		t.Fatalf("build -o failed with %d: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("output file not written: %s", err)
+	}
+
+	// runtime errors in a compiled file name their place in the source it was built from
+	failing := filepath.Join(dir, "failing.monkey")
+	if err := os.WriteFile(failing, []byte("let half = fn(x) {\n  x / 0\n};\nhalf(4);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := Run([]string{"build", failing}, strings.NewReader(""), &stdout, &stderr); code != EXIT_OK {
+		t.Fatalf("build failed with %d: %s", code, stderr.String())
+	}
+	stderr.Reset()
+	failingCompiled := filepath.Join(dir, "failing.monkeyc")
+	expectedError := failingCompiled + ":2:5: runtime error: division by zero\n    in half, called at " + failingCompiled + ":4:5\n"
+	if code := Run([]string{"run", failingCompiled}, strings.NewReader(""), &stdout, &stderr); code != EXIT_RUNTIME_ERROR || stderr.String() != expectedError {
+		t.Errorf("wrong runtime error. code=%d, stderr=%q, want %q", code, stderr.String(), expectedError)
+	}
+
+	// a damaged file is reported instead of being run
+	content, _ := os.ReadFile(compiled)
+	if err := os.WriteFile(compiled, content[:len(content)-3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	code := Run([]string{"run", compiled}, strings.NewReader(""), &stdout, &stderr)
+	if code != EXIT_PARSE_ERROR || stderr.String() != compiled+": truncated bytecode\n" {
+		t.Errorf("wrong error for a truncated file. code=%d, stderr=%q", code, stderr.String())
+	}
+
+	if code := Run([]string{"build"}, strings.NewReader(""), &stdout, &stderr); code != EXIT_USAGE {
+		t.Errorf("build without a file returned %d, want %d", code, EXIT_USAGE)
+	}
+}
+
+// captureStdout runs the function and returns what it wrote to os.Stdout.
+func captureStdout(t *testing.T, function func()) string {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = original }()
+
+	function()
+	writer.Close()
+
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(output)
+}
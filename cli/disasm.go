@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"monkey/object"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DISASM_INDENT indents the instructions of a function below its constant.
+const DISASM_INDENT = "    "
+
+// runDisasm compiles a script and prints its instructions followed by its constants.
+func runDisasm(path string, stdout, stderr io.Writer) int {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "could not read %s: %s\n", path, err)
+		return EXIT_NO_INPUT
+	}
+
+	bytecode, status := compileSource(path, string(content), stderr)
+	if status != EXIT_OK {
+		return status
+	}
+
+	fmt.Fprint(stdout, bytecode.Instructions)
+
+	if len(bytecode.Constants) != 0 {
+		fmt.Fprintln(stdout, "\nconstants:")
+		for i, constant := range bytecode.Constants {
+			// a function is listed with its own instructions, indented below it
+			if fn, ok := constant.(*object.CompiledFunction); ok {
+				fmt.Fprintf(stdout, "%04d %s locals=%d parameters=%d\n", i, constant.Type(), fn.NumLocals, fn.NumParameters)
+				for _, line := range strings.SplitAfter(fn.Instructions.String(), "\n") {
+					if line != "" {
+						fmt.Fprint(stdout, DISASM_INDENT+line)
+					}
+				}
+				continue
+			}
+
+			// quote strings so their whitespace is visible
+			value := constant.Inspect()
+			if str, ok := constant.(*object.String); ok {
+				value = strconv.Quote(str.Value)
+			}
+
+			fmt.Fprintf(stdout, "%04d %s %s\n", i, constant.Type(), value)
+		}
+	}
+
+	return EXIT_OK
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+)
+
+// DOC_USAGE describes the command line of the doc subcommand.
+const DOC_USAGE = `usage: monkey doc [-format text|markdown] <file or module>
+
+prints the documentation of the bindings a module exports, which is the text of the ///
+comments right above their let statements. The module is a file or a module that
+programs import by that name, such as std/list`
+
+// FORMAT_MARKDOWN renders documentation as Markdown, for pages instead of terminals.
+const FORMAT_MARKDOWN = "markdown"
+
+// DOC_INDENT indents the documentation of a binding below its signature.
+const DOC_INDENT = "    "
+
+// exportedBinding is an exported binding as its documentation shows it.
+type exportedBinding struct {
+	signature string
+	doc       string
+}
+
+// runDoc prints the documentation of the exported bindings of a module, in source order.
+func runDoc(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, DOC_USAGE)
+		fmt.Fprintln(stderr, "\nflags:")
+		flags.PrintDefaults()
+	}
+
+	format := flags.String("format", FORMAT_TEXT, "output `format`: text or markdown")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+	if *format != FORMAT_TEXT && *format != FORMAT_MARKDOWN {
+		fmt.Fprintf(stderr, "unknown format: %s\n", *format)
+		return EXIT_USAGE
+	}
+
+	// the module is found like an import from the working directory, without running it
+	name, source, err := loader.Source(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return EXIT_NO_INPUT
+	}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		printDiagnostics(stderr, name, source, p.Diagnostics())
+		return EXIT_PARSE_ERROR
+	}
+
+	bindings := exportedBindings(program)
+	if *format == FORMAT_MARKDOWN {
+		writeMarkdownDoc(stdout, flags.Arg(0), bindings)
+	} else {
+		writeTextDoc(stdout, flags.Arg(0), bindings)
+	}
+
+	return EXIT_OK
+}
+
+// exportedBindings returns the bindings the top level of the program exports.
+func exportedBindings(program *ast.Program) []exportedBinding {
+	var bindings []exportedBinding
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || !let.Exported {
+			continue
+		}
+
+		bindings = append(bindings, exportedBinding{signature: signature(let), doc: let.Doc})
+	}
+
+	return bindings
+}
+
+// signature returns the name of the binding, followed by the parameters of the function
+// or macro it is bound to.
+func signature(let *ast.LetStatement) string {
+	var parameters []*ast.Identifier
+	switch value := let.Value.(type) {
+	case *ast.FunctionLiteral:
+		parameters = value.Parameters
+	case *ast.MacroLiteral:
+		parameters = value.Parameters
+	default:
+		return let.Name.Value
+	}
+
+	names := make([]string, len(parameters))
+	for i, parameter := range parameters {
+		names[i] = parameter.Value
+	}
+
+	return let.Name.Value + "(" + strings.Join(names, ", ") + ")"
+}
+
+// writeTextDoc writes the documentation for a terminal, indenting the text of each
+// binding below its signature.
+func writeTextDoc(out io.Writer, name string, bindings []exportedBinding) {
+	fmt.Fprintf(out, "module %s\n", name)
+
+	for _, binding := range bindings {
+		fmt.Fprintf(out, "\n%s\n", binding.signature)
+		if binding.doc == "" {
+			continue
+		}
+
+		for _, line := range strings.Split(binding.doc, "\n") {
+			if line != "" {
+				line = DOC_INDENT + line
+			}
+			fmt.Fprintln(out, line)
+		}
+	}
+}
+
+// writeMarkdownDoc writes the documentation as Markdown, with a heading for each
+// binding above its text, which can use Markdown itself.
+func writeMarkdownDoc(out io.Writer, name string, bindings []exportedBinding) {
+	fmt.Fprintf(out, "# %s\n", name)
+
+	for _, binding := range bindings {
+		fmt.Fprintf(out, "\n## `%s`\n", binding.signature)
+		if binding.doc != "" {
+			fmt.Fprintf(out, "\n%s\n", binding.doc)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// formats accepted by --format
+const (
+	FORMAT_TEXT  = "text"
+	FORMAT_JSON  = "json"
+	FORMAT_SEXPR = "sexpr"
+)
+
+// treeNode is a format-neutral view of an AST node used by the dumpers.
+type treeNode struct {
+	kind   string
+	fields []treeField
+}
+
+// treeField is a named child of a treeNode. The value is a *treeNode, a []interface{},
+// a string, an int64, a bool, or nil.
+type treeField struct {
+	name  string
+	value interface{}
+}
+
+// dumpTokens writes every token of the source in the given format.
+func dumpTokens(out io.Writer, source, format string) error {
+	l := lexer.New(source)
+
+	var tokens []token.Token
+	for tok := l.NextToken(); ; tok = l.NextToken() {
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	switch format {
+	case FORMAT_TEXT:
+		for _, tok := range tokens {
+			fmt.Fprintf(out, "%-10s %q\n", tok.Type, tok.Literal)
+		}
+	case FORMAT_JSON:
+		entries := make([]map[string]string, len(tokens))
+		for i, tok := range tokens {
+			entries[i] = map[string]string{"type": tok.Type.String(), "literal": tok.Literal}
+		}
+
+		encoded, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(encoded))
+	case FORMAT_SEXPR:
+		io.WriteString(out, "(tokens")
+		for _, tok := range tokens {
+			fmt.Fprintf(out, "\n  (%s %s)", strconv.Quote(tok.Type.String()), strconv.Quote(tok.Literal))
+		}
+		io.WriteString(out, ")\n")
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	return nil
+}
+
+// dumpAST parses the source and writes the resulting tree in the given format.
+func dumpAST(out io.Writer, source, format string) ([]parser.Diagnostic, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	tree := toTree(reflect.ValueOf(program))
+
+	switch format {
+	case FORMAT_TEXT:
+		writeText(out, tree, 0)
+	case FORMAT_JSON:
+		io.WriteString(out, toJSON(tree, 0)+"\n")
+	case FORMAT_SEXPR:
+		io.WriteString(out, toSexpr(tree)+"\n")
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+
+	return p.Diagnostics(), nil
+}
+
+// toTree converts an AST value into its format-neutral view, dropping the tokens.
+func toTree(value reflect.Value) interface{} {
+	switch value.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if value.IsNil() {
+			return nil
+		}
+		if value.Kind() == reflect.Interface {
+			return toTree(value.Elem())
+		}
+
+		element := value.Elem()
+		node := &treeNode{kind: element.Type().Name()}
+		for i := 0; i < element.NumField(); i++ {
+			field := element.Type().Field(i)
+			if field.Type == reflect.TypeOf(token.Token{}) || !field.IsExported() {
+				continue
+			}
+			node.fields = append(node.fields, treeField{name: field.Name, value: toTree(element.Field(i))})
+		}
+		return node
+	case reflect.Slice:
+		items := make([]interface{}, value.Len())
+		for i := range items {
+			items[i] = toTree(value.Index(i))
+		}
+		return items
+	case reflect.String:
+		return value.String()
+	case reflect.Int, reflect.Int64:
+		return value.Int()
+	case reflect.Bool:
+		return value.Bool()
+	default:
+		return fmt.Sprintf("%v", value.Interface())
+	}
+}
+
+// writeText writes the tree as an indented outline.
+func writeText(out io.Writer, value interface{}, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	switch value := value.(type) {
+	case *treeNode:
+		fmt.Fprintf(out, "%s%s\n", indent, value.kind)
+		for _, field := range value.fields {
+			switch child := field.value.(type) {
+			case *treeNode, []interface{}:
+				fmt.Fprintf(out, "%s  %s:\n", indent, field.name)
+				writeText(out, child, depth+2)
+			default:
+				fmt.Fprintf(out, "%s  %s: %s\n", indent, field.name, scalarString(child))
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			writeText(out, item, depth)
+		}
+	default:
+		fmt.Fprintf(out, "%s%s\n", indent, scalarString(value))
+	}
+}
+
+// toJSON renders the tree as indented JSON, keeping the fields in declaration order.
+func toJSON(value interface{}, depth int) string {
+	indent := strings.Repeat("  ", depth)
+
+	switch value := value.(type) {
+	case *treeNode:
+		output := "{\n" + indent + "  \"node\": " + strconv.Quote(value.kind)
+		for _, field := range value.fields {
+			output += ",\n" + indent + "  " + strconv.Quote(field.name) + ": " + toJSON(field.value, depth+1)
+		}
+		return output + "\n" + indent + "}"
+	case []interface{}:
+		if len(value) == 0 {
+			return "[]"
+		}
+		output := "[\n"
+		for i, item := range value {
+			if i != 0 {
+				output += ",\n"
+			}
+			output += indent + "  " + toJSON(item, depth+1)
+		}
+		return output + "\n" + indent + "]"
+	case string:
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	default:
+		return scalarString(value)
+	}
+}
+
+// toSexpr renders the tree as a single s-expression.
+func toSexpr(value interface{}) string {
+	switch value := value.(type) {
+	case *treeNode:
+		output := "(" + value.kind
+		for _, field := range value.fields {
+			output += " (" + field.name + " " + toSexpr(field.value) + ")"
+		}
+		return output + ")"
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = toSexpr(item)
+		}
+		return "(" + strings.Join(items, " ") + ")"
+	default:
+		return scalarString(value)
+	}
+}
+
+// scalarString renders a leaf value of the tree.
+func scalarString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(value)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
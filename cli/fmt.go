@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/format"
+	"os"
+)
+
+// FMT_USAGE describes the command line of the fmt subcommand.
+const FMT_USAGE = `usage: monkey fmt [-w] [files...]
+
+formats the files, or stdin when no files are given, in the canonical style`
+
+// runFmt formats the given files, printing the result or, with -w, rewriting the files in place.
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, FMT_USAGE)
+		fmt.Fprintln(stderr, "\nflags:")
+		flags.PrintDefaults()
+	}
+
+	write := flags.Bool("w", false, "write the result back to the files instead of printing it")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	files := flags.Args()
+
+	// without files format stdin, which has nowhere to be written back to
+	if len(files) == 0 {
+		if *write {
+			flags.Usage()
+			return EXIT_USAGE
+		}
+
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "could not read <stdin>: %s\n", err)
+			return EXIT_NO_INPUT
+		}
+
+		return formatSource("<stdin>", string(content), stdout, stderr)
+	}
+
+	// keep going after a bad file so every problem is reported at once
+	status := EXIT_OK
+	for _, path := range files {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "could not read %s: %s\n", path, err)
+			status = EXIT_NO_INPUT
+			continue
+		}
+
+		if !*write {
+			if code := formatSource(path, string(content), stdout, stderr); code != EXIT_OK {
+				status = code
+			}
+			continue
+		}
+
+		formatted, diagnostics := format.Source(string(content))
+		if len(diagnostics) != 0 {
+			printDiagnostics(stderr, path, string(content), diagnostics)
+			status = EXIT_PARSE_ERROR
+			continue
+		}
+
+		// leave files that are already formatted untouched
+		if formatted == string(content) {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+			fmt.Fprintf(stderr, "could not write %s: %s\n", path, err)
+			status = EXIT_NO_INPUT
+		}
+	}
+
+	return status
+}
+
+// formatSource prints the formatted source to stdout, reporting parse errors to stderr.
+func formatSource(name, source string, stdout, stderr io.Writer) int {
+	formatted, diagnostics := format.Source(source)
+	if len(diagnostics) != 0 {
+		printDiagnostics(stderr, name, source, diagnostics)
+		return EXIT_PARSE_ERROR
+	}
+
+	io.WriteString(stdout, formatted)
+	return EXIT_OK
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/module"
+)
+
+// GET_USAGE describes the command line of the get subcommand.
+const GET_USAGE = `usage: monkey get [packages...]
+
+fetches each package, a git repository such as github.com/user/pkg, optionally followed by
+@ and a branch or tag, or the URL of a .tar.gz tarball, into monkey_modules, where imports
+find it by name, and records its version in monkey.lock. without packages, installs every
+package of monkey.lock at the version recorded there`
+
+// runGet installs packages into the modules directory of the working directory and
+// records them in its lockfile.
+func runGet(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, GET_USAGE)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+
+	locked, err := module.ReadLockfile(module.LOCKFILE)
+	if err != nil {
+		fmt.Fprintf(stderr, "could not read %s: %s\n", module.LOCKFILE, err)
+		return EXIT_PARSE_ERROR
+	}
+
+	// without packages the lockfile is installed as it is
+	if flags.NArg() == 0 {
+		for _, pkg := range locked {
+			if _, err := module.Get(pkg, module.MODULES_DIR); err != nil {
+				fmt.Fprintln(stderr, err)
+				return EXIT_UNAVAILABLE
+			}
+			fmt.Fprintf(stdout, "installed %s %s\n", pkg.Name, pkg.Version)
+		}
+		return EXIT_OK
+	}
+
+	packages := make([]module.Package, flags.NArg())
+	for i, source := range flags.Args() {
+		pkg, err := module.ParsePackage(source)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return EXIT_USAGE
+		}
+		packages[i] = pkg
+	}
+
+	for _, pkg := range packages {
+		pkg, err := module.Get(pkg, module.MODULES_DIR)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return EXIT_UNAVAILABLE
+		}
+		fmt.Fprintf(stdout, "got %s %s\n", pkg.Name, pkg.Version)
+
+		locked = lock(locked, pkg)
+		if err := module.WriteLockfile(module.LOCKFILE, locked); err != nil {
+			fmt.Fprintf(stderr, "could not write %s: %s\n", module.LOCKFILE, err)
+			return EXIT_CANT_CREATE
+		}
+	}
+
+	return EXIT_OK
+}
+
+// lock records the package in the locked packages, in place of the package of the same name.
+func lock(locked []module.Package, pkg module.Package) []module.Package {
+	for i := range locked {
+		if locked[i].Name == pkg.Name {
+			locked[i] = pkg
+			return locked
+		}
+	}
+
+	return append(locked, pkg)
+}
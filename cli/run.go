@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/repl"
+	"monkey/token"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// exit codes, following the BSD sysexits conventions
+const (
+	EXIT_OK            = 0
+	EXIT_CHECK_FAILED  = 1  // monkey check found problems in the program
+	EXIT_TESTS_FAILED  = 1  // monkey test had a failing test
+	EXIT_USAGE         = 64 // the command line was malformed
+	EXIT_PARSE_ERROR   = 65 // the program could not be parsed
+	EXIT_NO_INPUT      = 66 // the program file could not be read
+	EXIT_UNAVAILABLE   = 69 // a plugin could not be loaded
+	EXIT_RUNTIME_ERROR = 70 // the program failed while running
+	EXIT_CANT_CREATE   = 73 // an output file could not be written
+)
+
+// runConfig controls how a program is run.
+type runConfig struct {
+	printResult bool   // print the value of the program to stdout
+	trace       bool   // write an evaluation trace to stderr
+	engine      string // repl.ENGINE_EVAL or repl.ENGINE_VM
+	strict      bool   // fail programs the parser warns about instead of running them
+	file        string // the path of the script, empty for -e and stdin
+	source      string // the source shown under errors, empty for -e, which is at hand
+}
+
+// runFile reads a script and runs it with the given arguments, reporting problems to stderr.
+func runFile(path string, arguments []string, config runConfig, stdout, stderr io.Writer) int {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "could not read %s: %s\n", path, err)
+		return EXIT_NO_INPUT
+	}
+
+	// files written by monkey build skip the parser and run on the virtual machine
+	if compiler.IsSerialized(content) {
+		return runCompiled(path, content, arguments, config, stderr)
+	}
+
+	config.file, config.source = path, string(content)
+	return runSource(path, string(content), arguments, config, stdout, stderr)
+}
+
+// runStdin reads a whole program from the input and runs it once.
+func runStdin(stdin io.Reader, config runConfig, stdout, stderr io.Writer) int {
+	content, err := io.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "could not read <stdin>: %s\n", err)
+		return EXIT_NO_INPUT
+	}
+
+	config.source = string(content)
+	return runSource("<stdin>", config.source, nil, config, stdout, stderr)
+}
+
+// runSource parses and evaluates a program in a fresh environment where the arguments are
+// bound to ARGV. Problems are reported to stderr prefixed with the name of the source.
+func runSource(name, source string, arguments []string, config runConfig, stdout, stderr io.Writer) int {
+	// parse the whole program before running any of it
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		printDiagnostics(stderr, name, config.source, p.Diagnostics())
+		return EXIT_PARSE_ERROR
+	}
+
+	// warnings only stop the program when they are taken as errors
+	printDiagnostics(stderr, name, config.source, p.Warnings())
+	if config.strict && len(p.Warnings()) != 0 {
+		return EXIT_PARSE_ERROR
+	}
+
+	program, errObj := expandMacros(program)
+	if errObj != nil {
+		printRuntimeError(stderr, name, config.source, errObj)
+		return EXIT_RUNTIME_ERROR
+	}
+
+	if config.engine == repl.ENGINE_VM {
+		return runProgramOnVM(name, program, arguments, config, stdout, stderr)
+	}
+
+	env := object.NewEnvironment()
+	env.Set("ARGV", argumentsArray(arguments))
+
+	options := fileOptions(config.file)
+	if config.trace {
+		options.Trace = stderr
+	}
+
+	evaluated := evaluator.EvalWithOptions(context.Background(), program, env, options)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		printRuntimeError(stderr, name, config.source, errObj)
+		return EXIT_RUNTIME_ERROR
+	}
+
+	if config.printResult && evaluated != nil && evaluated != evaluator.NULL {
+		fmt.Fprintln(stdout, evaluated.Inspect())
+	}
+
+	return EXIT_OK
+}
+
+// expandMacros takes the macro definitions out of the program and returns it with
+// the calls to them expanded, or the error of the first macro that failed.
+func expandMacros(program *ast.Program) (*ast.Program, *object.Error) {
+	env := object.NewEnvironment()
+	evaluator.DefineMacros(program, env)
+
+	expanded, errObj := evaluator.ExpandMacros(program, env)
+	if errObj != nil {
+		return nil, errObj
+	}
+
+	return expanded.(*ast.Program), nil
+}
+
+// loader imports the modules of every program the command runs, so that each module
+// is evaluated once, however many programs and tests import it.
+var loader = module.NewLoader()
+
+// fileOptions configures the evaluation of the program in the file like the modules it
+// imports, relative to it. Programs that are not files pass an empty path.
+func fileOptions(path string) evaluator.Options {
+	options := loader.Options
+	options.Importer = loader
+	options.File = path
+	return options
+}
+
+// argumentsArray converts the command-line arguments into an array of strings.
+func argumentsArray(arguments []string) *object.Array {
+	elements := make([]object.Object, len(arguments))
+	for i, argument := range arguments {
+		elements[i] = &object.String{Value: argument}
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+// printDiagnostics reports parse errors or warnings, each prefixed with the name of the source.
+// The lines of the source are shown under them, unless it is empty.
+func printDiagnostics(stderr io.Writer, name, source string, diagnostics []parser.Diagnostic) {
+	for _, diagnostic := range diagnostics {
+		fmt.Fprintf(stderr, "%s:%s\n", name, diagnostic)
+		printSnippet(stderr, source, diagnostic.Line, diagnostic.Column)
+	}
+}
+
+// printRuntimeError reports an uncaught runtime error, with its position when it is known
+// and the stack trace of the calls it happened inside of. The source is shown as it is
+// by printDiagnostics.
+func printRuntimeError(stderr io.Writer, name, source string, errObj *object.Error) {
+	// an error without a position still has the calls it propagated out of
+	if errObj.Line == 0 {
+		fmt.Fprintf(stderr, "%s: runtime error: %s\n", name, errObj.Message)
+	} else {
+		fmt.Fprintf(stderr, "%s:%d:%d: runtime error: %s\n", name, errObj.Line, errObj.Column, errObj.Message)
+		printSnippet(stderr, source, errObj.Line, errObj.Column)
+	}
+	for _, line := range errObj.TraceLines(func(line, column int) string { return fmt.Sprintf("%s:%d:%d", name, line, column) }) {
+		fmt.Fprintf(stderr, "    %s\n", line)
+	}
+}
+
+// printSnippet shows the line of the source at the position after its number, with the
+// token there underlined, as far as the line goes. Nothing is shown for an empty source
+// or a line outside of it.
+func printSnippet(stderr io.Writer, source string, line, column int) {
+	if source == "" || line < 1 || column < 1 {
+		return
+	}
+
+	start := 0
+	for i := 1; i < line; i++ {
+		next := strings.IndexByte(source[start:], '\n')
+		if next < 0 {
+			return
+		}
+		start += next + 1
+	}
+	text, _, _ := strings.Cut(source[start:], "\n")
+	text = strings.TrimSuffix(text, "\r")
+
+	// the end of the input can be placed a column past the end of the last line
+	column = min(column, len(text)+1)
+
+	// the token is read again to find where it ends, an error at the end of the input
+	// getting a single caret
+	width := 1
+	offset := start + column - 1
+	l := lexer.NewAt(source, lexer.Position{Offset: offset, Line: line, Column: column})
+	if tok := l.NextToken(); tok.Type != token.EOF && tok.Line == line && tok.Column == column {
+		width = max(utf8.RuneCountInString(source[offset:min(l.Offset(), start+len(text))]), 1)
+	}
+
+	// the caret lines up with the token below tabs as well as spaces
+	var indent strings.Builder
+	for _, char := range text[:column-1] {
+		if char == '\t' {
+			indent.WriteByte('\t')
+		} else {
+			indent.WriteByte(' ')
+		}
+	}
+
+	number := strconv.Itoa(line)
+	fmt.Fprintf(stderr, " %s | %s\n", number, text)
+	fmt.Fprintf(stderr, " %s | %s^%s\n", strings.Repeat(" ", len(number)), indent.String(), strings.Repeat("~", width-1))
+}
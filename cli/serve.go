@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"monkey"
+	"monkey/evaluator"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SERVE_USAGE describes the command line of the serve subcommand.
+const SERVE_USAGE = `usage: monkey serve [-addr address] [-timeout duration]
+
+serves a scratchpad that runs programs sent to POST /eval as JSON, {"source": "..."},
+in sandbox mode and answers with what they printed, the value of their last statement
+and the problems found parsing or running them, {"output", "value", "diagnostics"}`
+
+// limits of every program the server runs, besides its timeout
+const (
+	SERVE_MAX_SOURCE = 1 << 20
+	SERVE_MAX_MEMORY = 64 << 20
+	SERVE_MAX_OUTPUT = 1 << 20
+)
+
+// evalRequest is the body of a request to run a program.
+type evalRequest struct {
+	Source string `json:"source"`
+}
+
+// evalResponse is the body of the response to a program that was run, or failed to parse.
+type evalResponse struct {
+	Output      string          `json:"output"`
+	Value       string          `json:"value"`
+	Diagnostics []*monkey.Error `json:"diagnostics"`
+}
+
+// runServe serves programs over HTTP until the server fails.
+func runServe(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, SERVE_USAGE)
+		fmt.Fprintln(stderr, "\nflags:")
+		flags.PrintDefaults()
+	}
+
+	addr := flags.String("addr", ":8080", "listen on the `address`")
+	timeout := flags.Duration("timeout", 5*time.Second, "stop each program that runs for longer than the `duration`")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return EXIT_USAGE
+	}
+
+	// the flags of the language apply to every program, which the sandbox confines
+	options := monkey.Options{
+		MaxDepth:          loader.Options.MaxDepth,
+		CheckedArithmetic: loader.Options.CheckedArithmetic,
+		StrictBooleans:    loader.Options.StrictBooleans,
+		MaxMemory:         SERVE_MAX_MEMORY,
+		Sandbox:           true,
+	}
+
+	fmt.Fprintf(stdout, "serving on %s\n", *addr)
+	if err := http.ListenAndServe(*addr, newServer(options, *timeout)); err != nil {
+		fmt.Fprintln(stderr, err)
+		return EXIT_UNAVAILABLE
+	}
+
+	return EXIT_OK
+}
+
+// newServer returns the handler of the routes of the server, which runs programs with
+// the options.
+func newServer(options monkey.Options, timeout time.Duration) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /eval", func(w http.ResponseWriter, r *http.Request) {
+		serveEval(w, r, options, timeout)
+	})
+
+	return mux
+}
+
+// serveEval runs the program of the request in a fresh interpreter, stopping it once
+// the timeout passes or the client goes away.
+func serveEval(w http.ResponseWriter, r *http.Request, options monkey.Options, timeout time.Duration) {
+	var request evalRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, SERVE_MAX_SOURCE))
+	if err := decoder.Decode(&request); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("program too large: more than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "could not decode request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	output := &syncBuffer{limit: SERVE_MAX_OUTPUT}
+	options.Output = output
+	interp := monkey.NewWithOptions(options)
+	value, err := interp.EvalContext(ctx, request.Source)
+
+	response := evalResponse{Output: output.String(), Diagnostics: []*monkey.Error{}}
+	if err != nil {
+		response.Diagnostics = monkey.Errors(err)
+	} else if value != evaluator.NULL {
+		response.Value = value.Inspect()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoded, _ := json.Marshal(response)
+	w.Write(append(encoded, '\n'))
+}
+
+// syncBuffer is a buffer that the spawned tasks of a program can print to at once.
+// Writes that would take it past its limit fail, which fails the print of the program.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+	limit  int
+}
+
+func (buffer *syncBuffer) Write(p []byte) (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	if buffer.buffer.Len()+len(p) > buffer.limit {
+		return 0, fmt.Errorf("output limit exceeded: %d bytes", buffer.limit)
+	}
+	return buffer.buffer.Write(p)
+}
+
+func (buffer *syncBuffer) String() string {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buffer.String()
+}
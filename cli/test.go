@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TEST_USAGE describes the command line of the test subcommand.
+const TEST_USAGE = `usage: monkey test [-v] [files or directories...]
+
+runs every test_ function of the given files, and of the *_test.monkey files found
+in the given directories or the current one`
+
+// TEST_FILE_SUFFIX marks the files that monkey test discovers in directories.
+const TEST_FILE_SUFFIX = "_test.monkey"
+
+// TEST_FUNCTION_PREFIX marks the top-level functions that are run as tests.
+const TEST_FUNCTION_PREFIX = "test_"
+
+// testSummary counts the results of the tests run so far.
+type testSummary struct {
+	passed int
+	failed int
+}
+
+// runTests discovers and runs the tests, printing a summary for each file and a total.
+func runTests(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, TEST_USAGE)
+		fmt.Fprintln(stderr, "\nflags:")
+		flags.PrintDefaults()
+	}
+
+	verbose := flags.Bool("v", false, "print every test as it passes, not only the failures")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := testFiles(paths)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return EXIT_NO_INPUT
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(stdout, "no test files")
+		return EXIT_OK
+	}
+
+	total := testSummary{}
+	status := EXIT_OK
+	for _, file := range files {
+		summary, code := runTestFile(file, *verbose, stdout)
+		total.passed += summary.passed
+		total.failed += summary.failed
+
+		// a file that cannot run at all is worse than a failing test
+		if code != EXIT_OK && (status == EXIT_OK || status == EXIT_TESTS_FAILED) {
+			status = code
+		}
+	}
+
+	fmt.Fprintf(stdout, "%d passed, %d failed\n", total.passed, total.failed)
+	return status
+}
+
+// testFiles expands the paths into the test files to run. Files are taken as they
+// are, while directories are searched for files ending in TEST_FILE_SUFFIX.
+func testFiles(paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", path, err)
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.HasSuffix(file, TEST_FILE_SUFFIX) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", path, err)
+		}
+	}
+
+	return files, nil
+}
+
+// runTestFile runs the tests of one file, each in a fresh evaluation of the file so
+// that no test can see what another one left behind.
+func runTestFile(path string, verbose bool, stdout io.Writer) (testSummary, int) {
+	summary := testSummary{}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stdout, "FAIL %s\n    could not read %s: %s\n", path, path, err)
+		return summary, EXIT_NO_INPUT
+	}
+
+	l := lexer.New(string(content))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		fmt.Fprintf(stdout, "FAIL %s\n", path)
+		for _, diagnostic := range p.Diagnostics() {
+			fmt.Fprintf(stdout, "    %s:%s\n", path, diagnostic)
+		}
+		return summary, EXIT_PARSE_ERROR
+	}
+
+	program, errObj := expandMacros(program)
+	if errObj != nil {
+		fmt.Fprintf(stdout, "FAIL %s\n    %s\n", path, testError(path, errObj))
+		return summary, EXIT_RUNTIME_ERROR
+	}
+
+	// the tests run with the options of the file, so they import and fail as it does
+	options := fileOptions(path)
+	for _, name := range functionNames(program, TEST_FUNCTION_PREFIX) {
+		env := object.NewEnvironment()
+		env.Set("ARGV", argumentsArray(nil))
+
+		// the file itself has to run before its tests can be called
+		if errObj, ok := evaluator.EvalWithOptions(context.Background(), program, env, options).(*object.Error); ok {
+			fmt.Fprintf(stdout, "FAIL %s\n    %s\n", path, testError(path, errObj))
+			return summary, EXIT_RUNTIME_ERROR
+		}
+
+		function, _ := env.Get(name)
+		result := evaluator.NewCaller(context.Background(), options)(function)
+		if errObj, ok := result.(*object.Error); ok {
+			summary.failed++
+			fmt.Fprintf(stdout, "FAIL %s\n    %s\n", name, testError(path, errObj))
+			continue
+		}
+
+		summary.passed++
+		if verbose {
+			fmt.Fprintf(stdout, "PASS %s\n", name)
+		}
+	}
+
+	fmt.Fprintf(stdout, "%s: %d passed, %d failed\n", path, summary.passed, summary.failed)
+
+	if summary.failed != 0 {
+		return summary, EXIT_TESTS_FAILED
+	}
+	return summary, EXIT_OK
+}
+
+// functionNames returns, in source order, the names starting with the prefix that are bound
+// to function literals at the top level of the program.
+func functionNames(program *ast.Program, prefix string) []string {
+	var names []string
+	seen := map[string]bool{}
+
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, prefix) || seen[let.Name.Value] {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); !ok {
+			continue
+		}
+
+		seen[let.Name.Value] = true
+		names = append(names, let.Name.Value)
+	}
+
+	return names
+}
+
+// testError formats a failure with its position in the test file when it is known.
+func testError(path string, errObj *object.Error) string {
+	if errObj.Line == 0 {
+		return fmt.Sprintf("%s: %s", path, errObj.Message)
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %s", path, errObj.Line, errObj.Column, errObj.Message)
+}
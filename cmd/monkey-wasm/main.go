@@ -0,0 +1,116 @@
+//go:build js && wasm
+
+// Command monkey-wasm runs the interpreter in a browser, for playgrounds that embed the
+// REPL without a server. It defines a global function for pages to call:
+//
+//	MonkeyEval(src) -> {output, value, errors}
+//
+// where output is what the program printed, value is the value of its last statement,
+// empty if it is null, and errors are the problems found while parsing or running it,
+// each as {message, line, column}. Successive calls share their bindings, like the
+// lines of the REPL, until MonkeyReset() starts over.
+//
+// Build it with the wasm_exec.js of the same Go release, which pages load first:
+//
+//	GOOS=js GOARCH=wasm go build -o monkey.wasm ./cmd/monkey-wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+package main
+
+import (
+	"bytes"
+	"errors"
+	"monkey"
+	"monkey/evaluator"
+	"sync"
+	"syscall/js"
+)
+
+// limits of every call, since a program runs while the page waits for it, on a stack
+// the browser keeps smaller than that of Go programs
+const (
+	MAX_STEPS  = 10_000_000
+	MAX_DEPTH  = 1_000
+	MAX_MEMORY = 64 << 20
+)
+
+// interp runs the programs of the page, keeping what they bind between calls.
+var interp = newInterp()
+
+// output collects what the program of a call prints.
+var output = &syncBuffer{}
+
+func main() {
+	js.Global().Set("MonkeyEval", js.FuncOf(monkeyEval))
+	js.Global().Set("MonkeyReset", js.FuncOf(monkeyReset))
+
+	// the functions are called for as long as the page is open
+	select {}
+}
+
+// newInterp creates an interpreter in sandbox mode, which leaves out what a page cannot
+// do anyway, such as reading files, printing to the output of the calls.
+func newInterp() *monkey.Interp {
+	return monkey.NewWithOptions(monkey.Options{
+		MaxSteps:  MAX_STEPS,
+		MaxDepth:  MAX_DEPTH,
+		MaxMemory: MAX_MEMORY,
+		Sandbox:   true,
+		Output:    output,
+	})
+}
+
+// monkeyEval runs the source given and returns its result as a JavaScript object.
+func monkeyEval(this js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return result("", "", errors.New("MonkeyEval takes the source of a program as a string"))
+	}
+
+	output.Reset()
+	value, err := interp.Eval(args[0].String())
+
+	inspected := ""
+	if err == nil && value != evaluator.NULL {
+		inspected = value.Inspect()
+	}
+	return result(output.String(), inspected, err)
+}
+
+// monkeyReset forgets what the programs run so far have bound.
+func monkeyReset(this js.Value, args []js.Value) any {
+	interp = newInterp()
+	return nil
+}
+
+// result returns the object MonkeyEval returns, with the problems err is made of.
+func result(printed, value string, err error) map[string]any {
+	errs := []any{}
+	for _, problem := range monkey.Errors(err) {
+		errs = append(errs, map[string]any{"message": problem.Message, "line": problem.Line, "column": problem.Column})
+	}
+
+	return map[string]any{"output": printed, "value": value, "errors": errs}
+}
+
+// syncBuffer is a buffer that spawned tasks can print to at once.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *syncBuffer) Write(p []byte) (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buffer.Write(p)
+}
+
+func (buffer *syncBuffer) String() string {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buffer.String()
+}
+
+func (buffer *syncBuffer) Reset() {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	buffer.buffer.Reset()
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"monkey/cli"
+	"os"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
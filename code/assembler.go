@@ -0,0 +1,83 @@
+package code
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Assemble encodes instructions written one per line as an opcode name followed by its
+// operands, e.g. `OpConstant 2`. Blank lines and `//` comments are ignored, as is a
+// leading offset, so the listings of Instructions.String can be assembled again.
+func Assemble(source string) (Instructions, error) {
+	instructions := Instructions{}
+
+	for i, line := range strings.Split(source, "\n") {
+		// drop the comment and any leading offset
+		if comment := strings.Index(line, "//"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 0 && isOffset(fields[0]) {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		instruction, err := assembleInstruction(fields[0], fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+		instructions = append(instructions, instruction...)
+	}
+
+	return instructions, nil
+}
+
+// assembleInstruction encodes a single instruction from its opcode name and operands.
+func assembleInstruction(name string, arguments []string) ([]byte, error) {
+	op, ok := opcodeNamed(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown opcode %s", name)
+	}
+
+	definition := definitions[op]
+	if len(arguments) != len(definition.OperandWidths) {
+		return nil, fmt.Errorf("%s expects %d operands, got %d", name, len(definition.OperandWidths), len(arguments))
+	}
+
+	operands := make([]int, len(arguments))
+	for i, argument := range arguments {
+		operand, err := strconv.Atoi(argument)
+		if err != nil {
+			return nil, fmt.Errorf("operand %s of %s is not a number", argument, name)
+		}
+
+		// an operand must fit in its width instead of silently wrapping around
+		width := definition.OperandWidths[i]
+		if operand < 0 || operand >= 1<<(8*width) {
+			return nil, fmt.Errorf("operand %d of %s does not fit in %d bytes", operand, name, width)
+		}
+		operands[i] = operand
+	}
+
+	return Make(op, operands...), nil
+}
+
+// opcodeNamed returns the opcode with the given name.
+func opcodeNamed(name string) (Opcode, bool) {
+	for op, definition := range definitions {
+		if definition.Name == name {
+			return op, true
+		}
+	}
+
+	return 0, false
+}
+
+// isOffset reports whether the field is an instruction offset rather than an opcode.
+func isOffset(field string) bool {
+	_, err := strconv.Atoi(field)
+	return err == nil
+}
@@ -0,0 +1,265 @@
+package code
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Instructions is a sequence of encoded instructions, each an opcode followed by its operands.
+type Instructions []byte
+
+// String lists the instructions one per line, each with its offset, name, and operands.
+func (instructions Instructions) String() string {
+	var output strings.Builder
+
+	i := 0
+	for i < len(instructions) {
+		definition, err := Lookup(instructions[i])
+		if err != nil {
+			fmt.Fprintf(&output, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(definition, instructions[i+1:])
+		fmt.Fprintf(&output, "%04d %s\n", i, instructions.formatInstruction(definition, operands))
+
+		i += 1 + read
+	}
+
+	return output.String()
+}
+
+// formatInstruction formats an instruction as its name followed by its operands.
+func (instructions Instructions) formatInstruction(definition *Definition, operands []int) string {
+	operandCount := len(definition.OperandWidths)
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	output := definition.Name
+	for _, operand := range operands {
+		output += " " + strconv.Itoa(operand)
+	}
+
+	return output
+}
+
+// Opcode identifies an instruction.
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	// arithmetic and comparison pop two operands and push the result
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpGreaterThanOrEqual
+	OpLessThanOrEqual
+
+	// prefix operators replace the top of the stack
+	OpMinus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	// jumps take an absolute offset into the instructions
+	OpJumpNotTruthy
+	OpJump
+	OpJumpNotNull // leaves the value on top of the stack when it jumps, and pops it otherwise
+	OpJumpNull    // jumps when the value on top of the stack is null, never popping it
+
+	// comparisons fused with a conditional jump by the optimizer pop two operands
+	// and jump unless the comparison holds
+	OpJumpNotEqual
+	OpJumpEqual
+	OpJumpNotGreaterThan
+	OpJumpNotLessThan
+	OpJumpNotGreaterThanOrEqual
+	OpJumpNotLessThanOrEqual
+
+	// superinstructions chosen by the optimizer push a local combined with a constant,
+	// taking the index of the local and of the constant
+	OpGetLocalConstantAdd
+	OpGetLocalConstantSub
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetBuiltin
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+
+	// closures take the constant of their function and the number of free values to capture
+	OpClosure
+	OpCurrentClosure
+
+	OpArray
+	OpHash // takes the number of keys and values, which alternate on the stack
+	OpIndex
+	OpSlice // takes the start and end above the sliced object, null where left out
+
+	// takes the constant of the name of the method of the object on top of the stack,
+	// which it replaces with the method bound to it
+	OpMethod
+
+	// replaces the function on top of the stack with a task calling it without arguments
+	OpSpawn
+
+	// takes the number of channels on top of the stack, which it replaces with the value
+	// received from the first one ready, going on at the OpJump of that channel among
+	// those that follow it, one for each channel in order
+	OpSelect
+
+	// a try takes the offset of its handler, where an instruction that fails before the
+	// OpEndTry goes on with the error it caught on the stack
+	OpTry
+	OpEndTry
+
+	// calls take the number of arguments, which sit on the stack above the function
+	OpCall
+	OpReturnValue
+	OpReturn // returns from a function without a value, leaving null
+)
+
+// Definition describes an opcode for humans and for decoding its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int // the width in bytes of each operand
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:                  {"OpConstant", []int{2}},
+	OpPop:                       {"OpPop", []int{}},
+	OpAdd:                       {"OpAdd", []int{}},
+	OpSub:                       {"OpSub", []int{}},
+	OpMul:                       {"OpMul", []int{}},
+	OpDiv:                       {"OpDiv", []int{}},
+	OpMod:                       {"OpMod", []int{}},
+	OpEqual:                     {"OpEqual", []int{}},
+	OpNotEqual:                  {"OpNotEqual", []int{}},
+	OpGreaterThan:               {"OpGreaterThan", []int{}},
+	OpLessThan:                  {"OpLessThan", []int{}},
+	OpGreaterThanOrEqual:        {"OpGreaterThanOrEqual", []int{}},
+	OpLessThanOrEqual:           {"OpLessThanOrEqual", []int{}},
+	OpMinus:                     {"OpMinus", []int{}},
+	OpBang:                      {"OpBang", []int{}},
+	OpTrue:                      {"OpTrue", []int{}},
+	OpFalse:                     {"OpFalse", []int{}},
+	OpNull:                      {"OpNull", []int{}},
+	OpJumpNotTruthy:             {"OpJumpNotTruthy", []int{2}},
+	OpJump:                      {"OpJump", []int{2}},
+	OpJumpNotNull:               {"OpJumpNotNull", []int{2}},
+	OpJumpNull:                  {"OpJumpNull", []int{2}},
+	OpJumpNotEqual:              {"OpJumpNotEqual", []int{2}},
+	OpJumpEqual:                 {"OpJumpEqual", []int{2}},
+	OpJumpNotGreaterThan:        {"OpJumpNotGreaterThan", []int{2}},
+	OpJumpNotLessThan:           {"OpJumpNotLessThan", []int{2}},
+	OpJumpNotGreaterThanOrEqual: {"OpJumpNotGreaterThanOrEqual", []int{2}},
+	OpJumpNotLessThanOrEqual:    {"OpJumpNotLessThanOrEqual", []int{2}},
+	OpGetLocalConstantAdd:       {"OpGetLocalConstantAdd", []int{1, 2}},
+	OpGetLocalConstantSub:       {"OpGetLocalConstantSub", []int{1, 2}},
+	OpGetGlobal:                 {"OpGetGlobal", []int{2}},
+	OpSetGlobal:                 {"OpSetGlobal", []int{2}},
+	OpGetBuiltin:                {"OpGetBuiltin", []int{1}},
+	OpGetLocal:                  {"OpGetLocal", []int{1}},
+	OpSetLocal:                  {"OpSetLocal", []int{1}},
+	OpGetFree:                   {"OpGetFree", []int{1}},
+	OpClosure:                   {"OpClosure", []int{2, 1}},
+	OpCurrentClosure:            {"OpCurrentClosure", []int{}},
+	OpArray:                     {"OpArray", []int{2}},
+	OpHash:                      {"OpHash", []int{2}},
+	OpIndex:                     {"OpIndex", []int{}},
+	OpSlice:                     {"OpSlice", []int{}},
+	OpMethod:                    {"OpMethod", []int{2}},
+	OpSpawn:                     {"OpSpawn", []int{}},
+	OpSelect:                    {"OpSelect", []int{1}},
+	OpTry:                       {"OpTry", []int{2}},
+	OpEndTry:                    {"OpEndTry", []int{}},
+	OpCall:                      {"OpCall", []int{1}},
+	OpReturnValue:               {"OpReturnValue", []int{}},
+	OpReturn:                    {"OpReturn", []int{}},
+}
+
+// Lookup returns the definition of an opcode.
+func Lookup(op byte) (*Definition, error) {
+	definition, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return definition, nil
+}
+
+// Make encodes an instruction from its opcode and operands. It returns an empty
+// instruction for an unknown opcode.
+func Make(op Opcode, operands ...int) []byte {
+	definition, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	// the opcode takes one byte and each operand its defined width
+	length := 1
+	for _, width := range definition.OperandWidths {
+		length += width
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, operand := range operands {
+		width := definition.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
+		case 1:
+			instruction[offset] = byte(operand)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction following its opcode, returning
+// them together with the number of bytes they took.
+func ReadOperands(definition *Definition, instructions Instructions) ([]int, int) {
+	operands := make([]int, len(definition.OperandWidths))
+	offset := 0
+
+	for i, width := range definition.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(instructions[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(instructions[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 decodes a two byte operand.
+func ReadUint16(instructions Instructions) uint16 {
+	return binary.BigEndian.Uint16(instructions)
+}
+
+// ReadUint8 decodes a one byte operand.
+func ReadUint8(instructions Instructions) uint8 {
+	return uint8(instructions[0])
+}
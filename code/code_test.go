@@ -0,0 +1,201 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetGlobal, []int{258}, []byte{byte(OpGetGlobal), 1, 2}},
+		{OpGetBuiltin, []int{255}, []byte{byte(OpGetBuiltin), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpGetLocalConstantAdd, []int{255, 65534}, []byte{byte(OpGetLocalConstantAdd), 255, 255, 254}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Fatalf("instruction has wrong length. expected=%d, got=%d", len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != b {
+				t.Errorf("wrong byte at pos %d. expected=%d, got=%d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpJump, []int{12}, 2},
+		{OpGetBuiltin, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+		{OpGetLocalConstantSub, []int{255, 65535}, 3},
+		{OpPop, []int{}, 0},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		definition, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q", err)
+		}
+
+		operandsRead, n := ReadOperands(definition, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. expected=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, expected := range tt.operands {
+			if operandsRead[i] != expected {
+				t.Errorf("operand wrong. expected=%d, got=%d", expected, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestLookupUndefined(t *testing.T) {
+	if _, err := Lookup(255); err == nil || err.Error() != "opcode 255 undefined" {
+		t.Errorf("expected an error for an undefined opcode. got=%v", err)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	source := `
+// push two constants and add them
+OpConstant 1
+0003 OpConstant 65535
+OpAdd // the offset above is ignored
+OpPop
+`
+
+	instructions, err := Assemble(source)
+	if err != nil {
+		t.Fatalf("assembler error: %s", err)
+	}
+
+	expected := Instructions{}
+	for _, instruction := range [][]byte{
+		Make(OpConstant, 1),
+		Make(OpConstant, 65535),
+		Make(OpAdd),
+		Make(OpPop),
+	} {
+		expected = append(expected, instruction...)
+	}
+
+	if string(instructions) != string(expected) {
+		t.Errorf("wrong instructions. expected=%v, got=%v", expected, instructions)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"OpNope", "line 1: unknown opcode OpNope"},
+		{"OpPop\nOpConstant", "line 2: OpConstant expects 1 operands, got 0"},
+		{"OpAdd 1", "line 1: OpAdd expects 0 operands, got 1"},
+		{"OpJump x", "line 1: operand x of OpJump is not a number"},
+		{"OpJump 65536", "line 1: operand 65536 of OpJump does not fit in 2 bytes"},
+		{"OpGetBuiltin 256", "line 1: operand 256 of OpGetBuiltin does not fit in 1 bytes"},
+	}
+
+	for _, tt := range tests {
+		_, err := Assemble(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpJumpNotTruthy, 12),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpConstant 2
+0004 OpConstant 65535
+0007 OpJumpNotTruthy 12
+0010 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, instruction := range instructions {
+		concatted = append(concatted, instruction...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+	}
+
+	// a listing can be assembled back into the same instructions
+	assembled, err := Assemble(concatted.String())
+	if err != nil {
+		t.Fatalf("assembler error: %s", err)
+	}
+	if assembled.String() != expected {
+		t.Errorf("listing did not round trip. got=%q", assembled.String())
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	var sourceMap SourceMap
+	sourceMap = sourceMap.Add(0, 1, 1)
+	sourceMap = sourceMap.Add(3, 1, 1) // the position already in effect
+	sourceMap = sourceMap.Add(5, 2, 4)
+	sourceMap = sourceMap.Add(9, 3, 2)
+	sourceMap = sourceMap.Add(9, 3, 7) // written over
+	sourceMap = sourceMap.Add(12, 2, 4)
+
+	expected := SourceMap{{0, 1, 1}, {5, 2, 4}, {9, 3, 7}, {12, 2, 4}}
+	if len(sourceMap) != len(expected) {
+		t.Fatalf("wrong mappings. want=%v, got=%v", expected, sourceMap)
+	}
+	for i, mapping := range expected {
+		if sourceMap[i] != mapping {
+			t.Errorf("wrong mapping %d. want=%v, got=%v", i, mapping, sourceMap[i])
+		}
+	}
+
+	tests := []struct {
+		offset int
+		line   int
+		column int
+	}{
+		{0, 1, 1},
+		{4, 1, 1},
+		{5, 2, 4},
+		{11, 3, 7},
+		{40, 2, 4},
+	}
+
+	for _, tt := range tests {
+		line, column := sourceMap.Lookup(tt.offset)
+		if line != tt.line || column != tt.column {
+			t.Errorf("wrong position at %d. want=%d:%d, got=%d:%d", tt.offset, tt.line, tt.column, line, column)
+		}
+	}
+
+	if line, column := (SourceMap{}).Lookup(0); line != 0 || column != 0 {
+		t.Errorf("empty map placed an instruction at %d:%d", line, column)
+	}
+}
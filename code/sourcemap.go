@@ -0,0 +1,45 @@
+package code
+
+import "sort"
+
+// Mapping places the instructions from the offset on, up to the next mapping, at a line
+// and a column of the source, both starting at 1.
+type Mapping struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// SourceMap maps instructions back to the positions of the expressions they were compiled
+// from, so that errors while running them can name their place in the source. Its
+// mappings are ordered by offset.
+type SourceMap []Mapping
+
+// Add maps the instructions from the offset on to the line and column, in place of the
+// mappings at and after the offset, which belonged to instructions written over. It
+// leaves out a mapping to the position already in effect.
+func (sourceMap SourceMap) Add(offset, line, column int) SourceMap {
+	for len(sourceMap) != 0 && sourceMap[len(sourceMap)-1].Offset >= offset {
+		sourceMap = sourceMap[:len(sourceMap)-1]
+	}
+
+	if len(sourceMap) != 0 {
+		last := sourceMap[len(sourceMap)-1]
+		if last.Line == line && last.Column == column {
+			return sourceMap
+		}
+	}
+
+	return append(sourceMap, Mapping{Offset: offset, Line: line, Column: column})
+}
+
+// Lookup returns the line and column of the instruction at the offset, or zeros if no
+// mapping covers it.
+func (sourceMap SourceMap) Lookup(offset int) (int, int) {
+	i := sort.Search(len(sourceMap), func(i int) bool { return sourceMap[i].Offset > offset })
+	if i == 0 {
+		return 0, 0
+	}
+
+	return sourceMap[i-1].Line, sourceMap[i-1].Column
+}
@@ -0,0 +1,742 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+)
+
+// MAX_SELECT_CASES is the most cases a select expression can have, as many as the
+// operand of OpSelect counts.
+const MAX_SELECT_CASES = 255
+
+// MAX_CONSTANTS and MAX_GLOBALS are the most constants and global bindings a program can
+// have, as many as the two byte operands of OpConstant and OpGetGlobal can number.
+const (
+	MAX_CONSTANTS = 1 << 16
+	MAX_GLOBALS   = 1 << 16
+)
+
+// MAX_LOCALS is the most local bindings a function can have, as many as the one byte
+// operand of OpGetLocal can number, and MAX_FREE_VARIABLES and MAX_ARGUMENTS are the most
+// values a closure can capture and a call can pass, as many as the one byte operands of
+// OpClosure and OpCall count.
+const (
+	MAX_LOCALS         = 1 << 8
+	MAX_FREE_VARIABLES = 1<<8 - 1
+	MAX_ARGUMENTS      = 1<<8 - 1
+)
+
+// Bytecode is the output of the compiler that the virtual machine runs.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+
+	// SourceMap places the instructions of the program in its source, as the compiled
+	// functions in the constants place theirs
+	SourceMap code.SourceMap
+}
+
+// EmittedInstruction remembers an instruction written by the compiler so it can be revisited.
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function being compiled, or of the
+// program itself at the outermost scope.
+type CompilationScope struct {
+	instructions code.Instructions
+	sourceMap    code.SourceMap
+
+	// the last two instructions, so a trailing OpPop can be removed again
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+// Compiler turns an AST into bytecode.
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	// a scope is entered for every function literal
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// position is where the errors of the instructions being emitted are located, the
+	// token of the node being compiled
+	position token.Token
+
+	// err is the first error of an instruction emitted with an operand too large for it,
+	// which Compile returns once the node being compiled is done
+	err error
+}
+
+// New creates a compiler with an empty constant pool and a symbol table holding only the builtins.
+func New() *Compiler {
+	return NewWithState(NewGlobalSymbolTable(), []object.Object{})
+}
+
+// NewGlobalSymbolTable creates a global symbol table with the builtin functions defined,
+// numbered in the order of evaluator.BuiltinNames.
+func NewGlobalSymbolTable() *SymbolTable {
+	symbolTable := NewSymbolTable()
+	for i, name := range evaluator.BuiltinNames() {
+		symbolTable.DefineBuiltin(i, name)
+	}
+
+	return symbolTable
+}
+
+// NewWithState creates a compiler that continues from the symbol table and constants of
+// an earlier compilation, so globals defined by one REPL input are seen by the next.
+func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	mainScope := CompilationScope{instructions: code.Instructions{}}
+
+	return &Compiler{
+		constants:   constants,
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// Bytecode returns the instructions and constants compiled so far.
+func (compiler *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: compiler.currentInstructions(),
+		Constants:    compiler.constants,
+		SourceMap:    compiler.scopes[compiler.scopeIndex].sourceMap,
+	}
+}
+
+// Compile compiles the node and its children.
+func (compiler *Compiler) Compile(node ast.Node) (err error) {
+	// the instructions of the node are placed at it, and those of its children at them
+	outer := compiler.position
+	if tok := positionOf(node); tok.Line != 0 {
+		compiler.position = tok
+	}
+	defer func() {
+		compiler.position = outer
+		if err == nil {
+			err = compiler.err
+		}
+	}()
+
+	switch node := node.(type) {
+	// statements
+	case *ast.Program:
+		for _, statement := range node.Statements {
+			if err := compiler.Compile(statement); err != nil {
+				return err
+			}
+		}
+	case *ast.ExpressionStatement:
+		if err := compiler.Compile(node.Expression); err != nil {
+			return err
+		}
+		// the value of an expression statement is not used, so it must not pile up on the stack
+		compiler.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			if err := compiler.Compile(statement); err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		// the value is compiled before the name is bound, as the evaluator does, except
+		// that a function may refer to itself by the name it is bound to
+		if function, ok := node.Value.(*ast.FunctionLiteral); ok {
+			if err := compiler.compileFunctionLiteral(function, node.Name.Value); err != nil {
+				return err
+			}
+		} else if err := compiler.Compile(node.Value); err != nil {
+			return err
+		}
+		symbol := compiler.define(node.Name.Value)
+		if symbol.Scope == GLOBAL_SCOPE {
+			compiler.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			compiler.emit(code.OpSetLocal, symbol.Index)
+		}
+	case *ast.ReturnStatement:
+		if err := compiler.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		compiler.emit(code.OpReturnValue)
+
+	// expressions
+	case *ast.IntegerLiteral:
+		integer := object.NewInteger(node.Value)
+		compiler.emit(code.OpConstant, compiler.addConstant(integer))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		compiler.emit(code.OpConstant, compiler.addConstant(str))
+	case *ast.BytesLiteral:
+		data := &object.Bytes{Value: []byte(node.Value)}
+		compiler.emit(code.OpConstant, compiler.addConstant(data))
+	case *ast.Boolean:
+		if node.Value {
+			compiler.emit(code.OpTrue)
+		} else {
+			compiler.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		if err := compiler.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			compiler.emit(code.OpBang)
+		case "-":
+			compiler.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.SpawnExpression:
+		if err := compiler.Compile(node.Function); err != nil {
+			return err
+		}
+		compiler.emit(code.OpSpawn)
+	case *ast.InfixExpression:
+		if node.Operator == "??" {
+			return compiler.compileCoalesceExpression(node)
+		}
+
+		// operands are evaluated from left to right, as the evaluator does
+		if err := compiler.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := compiler.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			compiler.emit(code.OpAdd)
+		case "-":
+			compiler.emit(code.OpSub)
+		case "*":
+			compiler.emit(code.OpMul)
+		case "/":
+			compiler.emit(code.OpDiv)
+		case "%":
+			compiler.emit(code.OpMod)
+		case "==":
+			compiler.emit(code.OpEqual)
+		case "!=":
+			compiler.emit(code.OpNotEqual)
+		case ">":
+			compiler.emit(code.OpGreaterThan)
+		case "<":
+			compiler.emit(code.OpLessThan)
+		case ">=":
+			compiler.emit(code.OpGreaterThanOrEqual)
+		case "<=":
+			compiler.emit(code.OpLessThanOrEqual)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.IfExpression:
+		return compiler.compileIfExpression(node)
+	case *ast.TryExpression:
+		return compiler.compileTryExpression(node)
+	case *ast.SelectExpression:
+		return compiler.compileSelectExpression(node)
+	case *ast.Identifier:
+		symbol, ok := compiler.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("%s", evaluator.NotFoundMessage(node.Value, compiler.symbolTable.Names()))
+		}
+		compiler.loadSymbol(symbol)
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			if err := compiler.Compile(element); err != nil {
+				return err
+			}
+		}
+		compiler.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := compiler.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := compiler.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		compiler.emit(code.OpHash, 2*len(node.Pairs))
+	case *ast.IndexExpression:
+		if err := compiler.Compile(node.Left); err != nil {
+			return err
+		}
+		jumpNullPosition := compiler.emitOptional(node.Optional)
+		if err := compiler.Compile(node.Index); err != nil {
+			return err
+		}
+		compiler.emit(code.OpIndex)
+		compiler.patchOptional(jumpNullPosition)
+	case *ast.SliceExpression:
+		if err := compiler.Compile(node.Left); err != nil {
+			return err
+		}
+		jumpNullPosition := compiler.emitOptional(node.Optional)
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				compiler.emit(code.OpNull)
+				continue
+			}
+			if err := compiler.Compile(bound); err != nil {
+				return err
+			}
+		}
+		compiler.emit(code.OpSlice)
+		compiler.patchOptional(jumpNullPosition)
+	case *ast.FunctionLiteral:
+		return compiler.compileFunctionLiteral(node, "")
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macros can only be defined by top-level let statements")
+	case *ast.CallExpression:
+		// quoting needs the syntax tree at runtime, which only the evaluator keeps
+		if function, ok := node.Function.(*ast.Identifier); ok && function.Value == evaluator.QUOTE {
+			return fmt.Errorf("%s is not supported by the compiler", evaluator.QUOTE)
+		}
+
+		// modules are evaluated by the evaluator when imported, which compiled code cannot call on
+		if function, ok := node.Function.(*ast.Identifier); ok && function.Value == evaluator.IMPORT {
+			return fmt.Errorf("%s is not supported by the compiler", evaluator.IMPORT)
+		}
+		if err := compiler.Compile(node.Function); err != nil {
+			return err
+		}
+		jumpNullPosition := compiler.emitOptional(node.Optional)
+		for _, argument := range node.Arguments {
+			if err := compiler.Compile(argument); err != nil {
+				return err
+			}
+		}
+		compiler.emitCall(len(node.Arguments))
+		compiler.patchOptional(jumpNullPosition)
+	case *ast.MethodCallExpression:
+		if err := compiler.Compile(node.Receiver); err != nil {
+			return err
+		}
+		name := &object.String{Value: node.Method.Value}
+		compiler.emit(code.OpMethod, compiler.addConstant(name))
+		for _, argument := range node.Arguments {
+			if err := compiler.Compile(argument); err != nil {
+				return err
+			}
+		}
+		compiler.emitCall(len(node.Arguments))
+	}
+
+	return nil
+}
+
+// compileIfExpression compiles a conditional into jumps around its blocks. Both
+// branches leave a value on the stack, null if a block or the alternative is missing.
+func (compiler *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := compiler.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// the jump target is patched once the consequence has been compiled, and a condition
+	// that is not a boolean fails at the condition
+	position := compiler.position
+	compiler.position = ast.StartToken(node.Condition)
+	jumpNotTruthyPosition := compiler.emit(code.OpJumpNotTruthy, 9999)
+	compiler.position = position
+
+	if err := compiler.compileBranch(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPosition := compiler.emit(code.OpJump, 9999)
+	compiler.changeOperand(jumpNotTruthyPosition, len(compiler.currentInstructions()))
+
+	if node.Alternative == nil {
+		compiler.emit(code.OpNull)
+	} else if err := compiler.compileBranch(node.Alternative); err != nil {
+		return err
+	}
+
+	compiler.changeOperand(jumpPosition, len(compiler.currentInstructions()))
+
+	return nil
+}
+
+// compileCoalesceExpression compiles a ?? b so that b is only evaluated when a is null,
+// which the jump over it pops.
+func (compiler *Compiler) compileCoalesceExpression(node *ast.InfixExpression) error {
+	if err := compiler.Compile(node.Left); err != nil {
+		return err
+	}
+
+	// the jump target is patched once the right operand has been compiled
+	jumpNotNullPosition := compiler.emit(code.OpJumpNotNull, 9999)
+
+	if err := compiler.Compile(node.Right); err != nil {
+		return err
+	}
+
+	compiler.changeOperand(jumpNotNullPosition, len(compiler.currentInstructions()))
+
+	return nil
+}
+
+// compileTryExpression compiles the body of a try expression between OpTry and OpEndTry,
+// followed by the handler, which binds the error the virtual machine leaves on the stack.
+func (compiler *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	// the handler offset is patched once the body has been compiled
+	tryPosition := compiler.emit(code.OpTry, 9999)
+
+	if err := compiler.compileBranch(node.Body); err != nil {
+		return err
+	}
+
+	compiler.emit(code.OpEndTry)
+	jumpPosition := compiler.emit(code.OpJump, 9999)
+	compiler.changeOperand(tryPosition, len(compiler.currentInstructions()))
+
+	symbol := compiler.define(node.Parameter.Value)
+	if symbol.Scope == GLOBAL_SCOPE {
+		compiler.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		compiler.emit(code.OpSetLocal, symbol.Index)
+	}
+
+	if err := compiler.compileBranch(node.Handler); err != nil {
+		return err
+	}
+
+	compiler.changeOperand(jumpPosition, len(compiler.currentInstructions()))
+
+	return nil
+}
+
+// compileSelectExpression compiles the channels of the cases followed by OpSelect and
+// its table of jumps to the bodies, each of which binds or discards the value received.
+func (compiler *Compiler) compileSelectExpression(node *ast.SelectExpression) error {
+	if len(node.Cases) > MAX_SELECT_CASES {
+		return fmt.Errorf("too many select cases: %d, want at most %d", len(node.Cases), MAX_SELECT_CASES)
+	}
+
+	for _, selectCase := range node.Cases {
+		if err := compiler.Compile(selectCase.Channel); err != nil {
+			return err
+		}
+	}
+	compiler.emit(code.OpSelect, len(node.Cases))
+
+	// the jumps are patched once the bodies they go to have been compiled
+	casePositions := make([]int, len(node.Cases))
+	for i := range node.Cases {
+		casePositions[i] = compiler.emit(code.OpJump, 9999)
+	}
+
+	// a select without cases never goes on, but its value still has a place on the stack
+	if len(node.Cases) == 0 {
+		compiler.emit(code.OpNull)
+		return nil
+	}
+
+	endPositions := make([]int, len(node.Cases))
+	for i, selectCase := range node.Cases {
+		compiler.changeOperand(casePositions[i], len(compiler.currentInstructions()))
+
+		if selectCase.Name == nil {
+			compiler.emit(code.OpPop)
+		} else {
+			symbol := compiler.define(selectCase.Name.Value)
+			if symbol.Scope == GLOBAL_SCOPE {
+				compiler.emit(code.OpSetGlobal, symbol.Index)
+			} else {
+				compiler.emit(code.OpSetLocal, symbol.Index)
+			}
+		}
+
+		// compileBranch would take the OpPop of an empty body for the value of the body
+		if len(selectCase.Body.Statements) == 0 {
+			compiler.emit(code.OpNull)
+		} else if err := compiler.compileBranch(selectCase.Body); err != nil {
+			return err
+		}
+		endPositions[i] = compiler.emit(code.OpJump, 9999)
+	}
+
+	for _, position := range endPositions {
+		compiler.changeOperand(position, len(compiler.currentInstructions()))
+	}
+
+	return nil
+}
+
+// compileBranch compiles a block of an if or try expression so that it leaves its value
+// on the stack.
+func (compiler *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if err := compiler.Compile(block); err != nil {
+		return err
+	}
+
+	// the value of the last expression is the value of the block
+	if compiler.lastInstructionIs(code.OpPop) {
+		compiler.removeLastPop()
+	} else if !compiler.lastInstructionIs(code.OpReturnValue) {
+		compiler.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// compileFunctionLiteral compiles the body of a function in a scope of its own and emits
+// a closure over it. A function bound by a let statement passes the name it is bound to.
+func (compiler *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	compiler.enterScope()
+
+	if name != "" {
+		compiler.symbolTable.DefineFunctionName(name)
+	}
+
+	// parameters are the first locals, set by the caller before the body runs
+	for _, parameter := range node.Parameters {
+		compiler.define(parameter.Value)
+	}
+
+	if err := compiler.Compile(node.Body); err != nil {
+		return err
+	}
+
+	// the value of the last expression is returned, and an empty body returns null
+	if compiler.lastInstructionIs(code.OpPop) {
+		compiler.replaceLastPopWithReturn()
+	}
+	if !compiler.lastInstructionIs(code.OpReturnValue) {
+		compiler.emit(code.OpReturn)
+	}
+
+	freeSymbols := compiler.symbolTable.FreeSymbols
+	numLocals := compiler.symbolTable.numDefinitions
+	instructions, sourceMap := compiler.leaveScope()
+
+	// the captured values are pushed from the enclosing scope, where they are still in reach
+	if len(freeSymbols) > MAX_FREE_VARIABLES {
+		compiler.fail("too many free variables: %d, want at most %d", len(freeSymbols), MAX_FREE_VARIABLES)
+	}
+	for _, symbol := range freeSymbols {
+		compiler.loadSymbol(symbol)
+	}
+
+	compiledFunction := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          name,
+		SourceMap:     sourceMap,
+	}
+	compiler.emit(code.OpClosure, compiler.addConstant(compiledFunction), len(freeSymbols))
+
+	return nil
+}
+
+// loadSymbol emits the instruction that pushes the value of the symbol from where its scope keeps it.
+func (compiler *Compiler) loadSymbol(symbol Symbol) {
+	switch symbol.Scope {
+	case GLOBAL_SCOPE:
+		compiler.emit(code.OpGetGlobal, symbol.Index)
+	case LOCAL_SCOPE:
+		compiler.emit(code.OpGetLocal, symbol.Index)
+	case BUILTIN_SCOPE:
+		compiler.emit(code.OpGetBuiltin, symbol.Index)
+	case FREE_SCOPE:
+		compiler.emit(code.OpGetFree, symbol.Index)
+	case FUNCTION_SCOPE:
+		compiler.emit(code.OpCurrentClosure)
+	}
+}
+
+// positionOf returns the token the errors of the node are located at, as the evaluator
+// locates them: the operator of an operation or a call, and the start of other nodes.
+func positionOf(node ast.Node) token.Token {
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		return node.Token
+	case *ast.InfixExpression:
+		return node.Token
+	case *ast.IndexExpression:
+		return node.Token
+	case *ast.SliceExpression:
+		return node.Token
+	case *ast.CallExpression:
+		return node.Token
+	case *ast.MethodCallExpression:
+		return node.Token
+	}
+
+	return ast.StartToken(node)
+}
+
+// addConstant adds an object to the constant pool and returns its index, failing the
+// compilation once there are more constants than MAX_CONSTANTS.
+func (compiler *Compiler) addConstant(obj object.Object) int {
+	compiler.constants = append(compiler.constants, obj)
+	if len(compiler.constants) > MAX_CONSTANTS {
+		compiler.fail("too many constants: %d, want at most %d", len(compiler.constants), MAX_CONSTANTS)
+	}
+
+	return len(compiler.constants) - 1
+}
+
+// define binds the name in the current scope like SymbolTable.Define, failing the
+// compilation once there are more global bindings than MAX_GLOBALS or more local ones
+// than MAX_LOCALS.
+func (compiler *Compiler) define(name string) Symbol {
+	symbol := compiler.symbolTable.Define(name)
+	if symbol.Scope == GLOBAL_SCOPE && symbol.Index >= MAX_GLOBALS {
+		compiler.fail("too many global bindings: %d, want at most %d", symbol.Index+1, MAX_GLOBALS)
+	}
+	if symbol.Scope == LOCAL_SCOPE && symbol.Index >= MAX_LOCALS {
+		compiler.fail("too many local bindings: %d, want at most %d", symbol.Index+1, MAX_LOCALS)
+	}
+
+	return symbol
+}
+
+// emitCall emits the call of the function and arguments on the stack, failing the
+// compilation if there are more arguments than MAX_ARGUMENTS.
+func (compiler *Compiler) emitCall(arguments int) {
+	if arguments > MAX_ARGUMENTS {
+		compiler.fail("too many arguments: %d, want at most %d", arguments, MAX_ARGUMENTS)
+	}
+
+	compiler.emit(code.OpCall, arguments)
+}
+
+// fail records the error of an instruction that cannot be emitted as it should be,
+// unless an earlier one was recorded. The instructions are still written, so that the
+// positions of those after them stay right until Compile returns the error.
+func (compiler *Compiler) fail(format string, a ...interface{}) {
+	if compiler.err == nil {
+		compiler.err = fmt.Errorf(format, a...)
+	}
+}
+
+// checkOperands fails the compilation if an operand does not fit in its width, which
+// code.Make would silently cut down to a different one.
+func (compiler *Compiler) checkOperands(op code.Opcode, operands []int) {
+	definition, err := code.Lookup(byte(op))
+	if err != nil {
+		return
+	}
+
+	for i, operand := range operands {
+		width := definition.OperandWidths[i]
+		if operand < 0 || operand >= 1<<(8*width) {
+			compiler.fail("operand %d of %s does not fit in %d bytes", operand, definition.Name, width)
+		}
+	}
+}
+
+// emit writes an instruction and returns its position.
+func (compiler *Compiler) emit(op code.Opcode, operands ...int) int {
+	compiler.checkOperands(op, operands)
+	instruction := code.Make(op, operands...)
+
+	scope := &compiler.scopes[compiler.scopeIndex]
+	position := len(scope.instructions)
+	scope.instructions = append(scope.instructions, instruction...)
+	scope.sourceMap = scope.sourceMap.Add(position, compiler.position.Line, compiler.position.Column)
+
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{Opcode: op, Position: position}
+
+	return position
+}
+
+// currentInstructions returns the instructions of the current scope.
+func (compiler *Compiler) currentInstructions() code.Instructions {
+	return compiler.scopes[compiler.scopeIndex].instructions
+}
+
+// enterScope starts compiling a function, with a symbol table enclosed by the current one.
+func (compiler *Compiler) enterScope() {
+	compiler.scopes = append(compiler.scopes, CompilationScope{instructions: code.Instructions{}})
+	compiler.scopeIndex++
+
+	compiler.symbolTable = NewEnclosedSymbolTable(compiler.symbolTable)
+}
+
+// leaveScope finishes compiling a function and returns its instructions and their source map.
+func (compiler *Compiler) leaveScope() (code.Instructions, code.SourceMap) {
+	instructions := compiler.currentInstructions()
+	sourceMap := compiler.scopes[compiler.scopeIndex].sourceMap
+
+	compiler.scopes = compiler.scopes[:len(compiler.scopes)-1]
+	compiler.scopeIndex--
+
+	compiler.symbolTable = compiler.symbolTable.Outer
+
+	return instructions, sourceMap
+}
+
+// lastInstructionIs reports whether the last instruction written has the opcode.
+func (compiler *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(compiler.currentInstructions()) == 0 {
+		return false
+	}
+
+	return compiler.scopes[compiler.scopeIndex].lastInstruction.Opcode == op
+}
+
+// removeLastPop removes the last instruction, which must be an OpPop.
+func (compiler *Compiler) removeLastPop() {
+	scope := &compiler.scopes[compiler.scopeIndex]
+
+	scope.instructions = scope.instructions[:scope.lastInstruction.Position]
+	scope.lastInstruction = scope.previousInstruction
+}
+
+// replaceLastPopWithReturn turns the OpPop of a function's last expression into an
+// OpReturnValue, so the function returns the value instead of discarding it.
+func (compiler *Compiler) replaceLastPopWithReturn() {
+	position := compiler.scopes[compiler.scopeIndex].lastInstruction.Position
+	compiler.replaceInstruction(position, code.Make(code.OpReturnValue))
+
+	compiler.scopes[compiler.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// replaceInstruction overwrites the instruction at the position with one of the same length.
+func (compiler *Compiler) replaceInstruction(position int, instruction []byte) {
+	copy(compiler.currentInstructions()[position:], instruction)
+}
+
+// emitOptional emits the jump of an optional index or call, which skips the rest of it
+// when the receiver on the stack is null, leaving the null as its value. It returns the
+// position of the jump, or -1 if the expression is not optional.
+func (compiler *Compiler) emitOptional(optional bool) int {
+	if !optional {
+		return -1
+	}
+
+	// the jump target is patched once the rest of the expression has been compiled
+	return compiler.emit(code.OpJumpNull, 9999)
+}
+
+// patchOptional points the jump that emitOptional emitted, if any, past the expression.
+func (compiler *Compiler) patchOptional(position int) {
+	if position >= 0 {
+		compiler.changeOperand(position, len(compiler.currentInstructions()))
+	}
+}
+
+// changeOperand rewrites the operand of the instruction at the position.
+func (compiler *Compiler) changeOperand(position int, operand int) {
+	op := code.Opcode(compiler.currentInstructions()[position])
+	compiler.checkOperands(op, []int{operand})
+	compiler.replaceInstruction(position, code.Make(op, operand))
+}
@@ -0,0 +1,1262 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 ?? 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJumpNotNull, 9),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let f = 1; f?(2)",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpJumpNull, 17),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[].len()",
+			expectedConstants: []interface{}{"len"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpMethod, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let f = 1; spawn f",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSpawn),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "7 % 2",
+			expectedConstants: []interface{}{7, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "2 / 1 * 3",
+			expectedConstants: []interface{}{2, 1, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDiv),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1 - 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSub),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the operands keep their order so errors and side effects match the evaluator
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2; 1 >= 2",
+			expectedConstants: []interface{}{1, 2, 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThanOrEqual),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpGreaterThanOrEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "!(true != false)",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpFalse),
+				code.Make(code.OpNotEqual),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 } else { 20 }",
+			expectedConstants: []interface{}{10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpNull),
+				// 0005
+				code.Make(code.OpJump, 9),
+				// 0008
+				code.Make(code.OpNull),
+				// 0009
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; let two = one; two;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// rebinding a name reuses its slot
+			input:             "let x = 1; let x = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStringsArraysAndIndexes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, 2][0]",
+			expectedConstants: []interface{}{1, 2, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "{}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `{1: 2, "a": 3 + 4}["a"]`,
+			expectedConstants: []interface{}{1, 2, "a", 3, 4, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpAdd),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"monkey"[1:]`,
+			expectedConstants: []interface{}{"monkey", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "return 1;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "try { 1 } catch (e) { e }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 10),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpJump, 16),
+				// 0010
+				code.Make(code.OpSetGlobal, 0),
+				// 0013
+				code.Make(code.OpGetGlobal, 0),
+				// 0016
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSelectExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let a = 1; let b = 2; select { v = a => v, b => {} }",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpConstant, 1),
+				// 0009
+				code.Make(code.OpSetGlobal, 1),
+				// 0012
+				code.Make(code.OpGetGlobal, 0),
+				// 0015
+				code.Make(code.OpGetGlobal, 1),
+				// 0018
+				code.Make(code.OpSelect, 2),
+				// 0020
+				code.Make(code.OpJump, 26),
+				// 0023
+				code.Make(code.OpJump, 35),
+				// 0026
+				code.Make(code.OpSetGlobal, 2),
+				// 0029
+				code.Make(code.OpGetGlobal, 2),
+				// 0032
+				code.Make(code.OpJump, 40),
+				// 0035
+				code.Make(code.OpPop),
+				// 0036
+				code.Make(code.OpNull),
+				// 0037
+				code.Make(code.OpJump, 40),
+				// 0040
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "select {}",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpSelect, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	lenIndex := builtinIndex(t, "len")
+
+	tests := []compilerTestCase{
+		{
+			input:             "len",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, lenIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a global of the same name shadows the builtin
+			input:             "let len = 1; len",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GLOBAL_SCOPE, Index: 0},
+		"b": {Name: "b", Scope: GLOBAL_SCOPE, Index: 1},
+		"c": {Name: "c", Scope: LOCAL_SCOPE, Index: 0},
+		"d": {Name: "d", Scope: LOCAL_SCOPE, Index: 1},
+		"e": {Name: "e", Scope: LOCAL_SCOPE, Index: 0},
+		"f": {Name: "f", Scope: LOCAL_SCOPE, Index: 1},
+	}
+
+	global := NewSymbolTable()
+	firstLocal := NewEnclosedSymbolTable(global)
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+
+	tests := []struct {
+		table *SymbolTable
+		name  string
+	}{
+		{global, "a"},
+		{global, "b"},
+		{firstLocal, "c"},
+		{firstLocal, "d"},
+		{secondLocal, "e"},
+		{secondLocal, "f"},
+		// defining a name again reuses its slot
+		{global, "a"},
+		{firstLocal, "c"},
+	}
+
+	for _, tt := range tests {
+		if symbol := tt.table.Define(tt.name); symbol != expected[tt.name] {
+			t.Errorf("wrong symbol for %s. expected=%+v, got=%+v", tt.name, expected[tt.name], symbol)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("b")
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.DefineFunctionName("self")
+	secondLocal.Define("c")
+	secondLocal.Define("d")
+
+	tests := []struct {
+		table    *SymbolTable
+		expected []Symbol
+		free     []Symbol
+	}{
+		{
+			global,
+			[]Symbol{
+				{Name: "a", Scope: GLOBAL_SCOPE, Index: 0},
+				{Name: "len", Scope: BUILTIN_SCOPE, Index: 0},
+			},
+			[]Symbol{},
+		},
+		{
+			firstLocal,
+			[]Symbol{
+				{Name: "a", Scope: GLOBAL_SCOPE, Index: 0},
+				{Name: "len", Scope: BUILTIN_SCOPE, Index: 0},
+				{Name: "b", Scope: LOCAL_SCOPE, Index: 0},
+				{Name: "c", Scope: LOCAL_SCOPE, Index: 1},
+			},
+			[]Symbol{},
+		},
+		{
+			// b is captured from the enclosing function, while c is shadowed
+			secondLocal,
+			[]Symbol{
+				{Name: "a", Scope: GLOBAL_SCOPE, Index: 0},
+				{Name: "len", Scope: BUILTIN_SCOPE, Index: 0},
+				{Name: "self", Scope: FUNCTION_SCOPE, Index: 0},
+				{Name: "b", Scope: FREE_SCOPE, Index: 0},
+				{Name: "c", Scope: LOCAL_SCOPE, Index: 0},
+				{Name: "d", Scope: LOCAL_SCOPE, Index: 1},
+			},
+			[]Symbol{
+				{Name: "b", Scope: LOCAL_SCOPE, Index: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, expected := range tt.expected {
+			symbol, ok := tt.table.Resolve(expected.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", expected.Name)
+				continue
+			}
+			if symbol != expected {
+				t.Errorf("wrong symbol for %s. expected=%+v, got=%+v", expected.Name, expected, symbol)
+			}
+		}
+
+		if len(tt.table.FreeSymbols) != len(tt.free) {
+			t.Errorf("wrong number of free symbols. expected=%d, got=%d", len(tt.free), len(tt.table.FreeSymbols))
+			continue
+		}
+		for i, expected := range tt.free {
+			if tt.table.FreeSymbols[i] != expected {
+				t.Errorf("wrong free symbol. expected=%+v, got=%+v", expected, tt.table.FreeSymbols[i])
+			}
+		}
+	}
+
+	if _, ok := secondLocal.Resolve("missing"); ok {
+		t.Errorf("name missing resolved, but is not defined")
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn() { return 5 + 10 }",
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the last expression is returned without a return statement
+			input: "fn() { 1; 2 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let f = fn(a, b) { a; b }; f(1, 2);",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "len([])",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, builtinIndex(t, "len")),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLocalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let num = 55; fn() { num }",
+			expectedConstants: []interface{}{
+				55,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a local shadows the global of the same name without touching it
+			input: "let a = 1; fn() { let a = 2; let b = a; b }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { fn(b) { a + b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a value captured two levels up is passed down through the middle function
+			input: "fn(a) { fn(b) { fn(c) { a + b + c } } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetFree, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 2),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "let countDown = fn(x) { countDown(x - 1); }; countDown(1);",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a local function refers to itself without capturing its own binding
+			input: "fn() { let countDown = fn(x) { countDown(x - 1); }; countDown(1); }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSerialization(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse(`let f = fn(a) { let b = "x"; a + b }; f("y"); -9000000000; b"\x00\xff"`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	var buffer bytes.Buffer
+	if _, err := bytecode.WriteTo(&buffer); err != nil {
+		t.Fatalf("WriteTo failed: %s", err)
+	}
+	if !IsSerialized(buffer.Bytes()) {
+		t.Fatalf("serialized bytecode not recognized")
+	}
+
+	read, err := ReadBytecode(bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadBytecode failed: %s", err)
+	}
+
+	if err := testInstructions([]code.Instructions{bytecode.Instructions}, read.Instructions); err != nil {
+		t.Errorf("instructions changed: %s", err)
+	}
+	if !reflect.DeepEqual(read.SourceMap, bytecode.SourceMap) {
+		t.Errorf("source map changed. want=%v, got=%v", bytecode.SourceMap, read.SourceMap)
+	}
+	if len(read.Constants) != len(bytecode.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(bytecode.Constants), len(read.Constants))
+	}
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			readFn, ok := read.Constants[i].(*object.CompiledFunction)
+			if !ok || readFn.NumLocals != fn.NumLocals || readFn.NumParameters != fn.NumParameters || readFn.Name != fn.Name ||
+				readFn.Instructions.String() != fn.Instructions.String() || !reflect.DeepEqual(readFn.SourceMap, fn.SourceMap) {
+				t.Errorf("constant %d changed. want=%+v, got=%+v", i, fn, read.Constants[i])
+			}
+			continue
+		}
+		if read.Constants[i].Inspect() != constant.Inspect() {
+			t.Errorf("constant %d changed. want=%s, got=%s", i, constant.Inspect(), read.Constants[i].Inspect())
+		}
+	}
+
+	serialized := buffer.Bytes()
+	errors := []struct {
+		input    []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a compiled monkey program"},
+		{serialized[:len(serialized)-1], "truncated bytecode"},
+		{append([]byte(BYTECODE_MAGIC), 0, 99), "unsupported bytecode version 99, want 20"},
+	}
+
+	for _, tt := range errors {
+		_, err := ReadBytecode(bytes.NewReader(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	input := "let f = fn(x) {\n  x - 1\n};\nf(2) + -f(3)"
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	// the operators and calls are placed at their tokens, the rest where their expressions start
+	expected := code.SourceMap{
+		{Offset: 0, Line: 1, Column: 1},  // OpClosure, OpSetGlobal
+		{Offset: 7, Line: 4, Column: 1},  // OpGetGlobal f
+		{Offset: 10, Line: 4, Column: 3}, // OpConstant 2
+		{Offset: 13, Line: 4, Column: 2}, // OpCall
+		{Offset: 15, Line: 4, Column: 9}, // OpGetGlobal f
+		{Offset: 18, Line: 4, Column: 11},
+		{Offset: 21, Line: 4, Column: 10},
+		{Offset: 23, Line: 4, Column: 8}, // OpMinus
+		{Offset: 24, Line: 4, Column: 6}, // OpAdd
+		{Offset: 25, Line: 4, Column: 1}, // OpPop
+	}
+	if !reflect.DeepEqual(bytecode.SourceMap, expected) {
+		t.Errorf("wrong source map.\nwant=%v\ngot= %v", expected, bytecode.SourceMap)
+	}
+
+	fn := bytecode.Constants[1].(*object.CompiledFunction)
+	if fn.Name != "f" {
+		t.Errorf("wrong function name. want=%q, got=%q", "f", fn.Name)
+	}
+	if line, column := fn.SourceMap.Lookup(len(fn.Instructions) - 2); line != 2 || column != 5 {
+		t.Errorf("subtraction placed wrong. want=2:5, got=%d:%d", line, column)
+	}
+
+	// the optimizer moves the map along, placing a superinstruction at its arithmetic
+	optimized := Optimize(bytecode).Constants[1].(*object.CompiledFunction)
+	if optimized.Instructions[0] != byte(code.OpGetLocalConstantSub) {
+		t.Fatalf("function not optimized. got=%s", optimized.Instructions)
+	}
+	if line, column := optimized.SourceMap.Lookup(0); line != 2 || column != 5 {
+		t.Errorf("superinstruction placed wrong. want=2:5, got=%d:%d", line, column)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			// only the value of the last statement is needed
+			input: "1; 2",
+			expected: `
+			OpConstant 1
+			OpPop`,
+		},
+		{
+			input: "if (1 < 2) { 10 }",
+			expected: `
+			0000 OpConstant 0
+			0003 OpConstant 1
+			0006 OpJumpNotLessThan 15
+			0009 OpConstant 2
+			0012 OpJump 16
+			0015 OpNull
+			0016 OpPop`,
+		},
+		{
+			input: "if (1 >= 2) { 10 }; if (1 <= 2) { 20 }",
+			expected: `
+			0000 OpConstant 0
+			0003 OpConstant 1
+			0006 OpJumpNotGreaterThanOrEqual 15
+			0009 OpConstant 2
+			0012 OpJump 16
+			0015 OpNull
+			0016 OpPop
+			0017 OpConstant 3
+			0020 OpConstant 4
+			0023 OpJumpNotLessThanOrEqual 32
+			0026 OpConstant 5
+			0029 OpJump 33
+			0032 OpNull
+			0033 OpPop`,
+		},
+		{
+			// the jump out of the inner conditional goes straight past the outer one
+			input: "if (true) { if (false) { 1 } else { 2 } } else { 3 }; 4",
+			expected: `
+			0000 OpTrue
+			0001 OpJumpNotTruthy 20
+			0004 OpFalse
+			0005 OpJumpNotTruthy 14
+			0008 OpConstant 0
+			0011 OpJump 23
+			0014 OpConstant 1
+			0017 OpJump 23
+			0020 OpConstant 2
+			0023 OpPop
+			0024 OpConstant 3
+			0027 OpPop`,
+		},
+		{
+			// a popped value that a jump lands on is kept
+			input: "if (true) { 1 } else { 2 }; 3",
+			expected: `
+			0000 OpTrue
+			0001 OpJumpNotTruthy 10
+			0004 OpConstant 0
+			0007 OpJump 13
+			0010 OpConstant 1
+			0013 OpPop
+			0014 OpConstant 2
+			0017 OpPop`,
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		expected, err := code.Assemble(tt.expected)
+		if err != nil {
+			t.Fatalf("assembler error: %s", err)
+		}
+
+		optimized := Optimize(compiler.Bytecode())
+		if err := testInstructions([]code.Instructions{expected}, optimized.Instructions); err != nil {
+			t.Errorf("wrong optimization of %q: %s", tt.input, err)
+		}
+	}
+
+	// functions in the constants are optimized too
+	compiler := New()
+	if err := compiler.Compile(parse("fn(x) { x; if (x == 1) { 2 } }")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected, err := code.Assemble(`
+	0000 OpGetLocal 0
+	0002 OpConstant 0
+	0005 OpJumpNotEqual 14
+	0008 OpConstant 1
+	0011 OpJump 15
+	0014 OpNull
+	0015 OpReturnValue`)
+	if err != nil {
+		t.Fatalf("assembler error: %s", err)
+	}
+
+	optimized := Optimize(compiler.Bytecode())
+	if err := testConstants([]interface{}{1, 2, []code.Instructions{expected}}, optimized.Constants); err != nil {
+		t.Errorf("function not optimized: %s", err)
+	}
+
+	// locals combined with constants become superinstructions, unless a jump lands inside them
+	superinstructionTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input: "fn(n) { (n - 1) * (n + 2) }",
+			expected: `
+			0000 OpGetLocalConstantSub 0 0
+			0004 OpGetLocalConstantAdd 0 1
+			0008 OpMul
+			0009 OpReturnValue`,
+		},
+		{
+			input: "fn(n) { (if (n) { n } else { n }) + 1 }",
+			expected: `
+			0000 OpGetLocal 0
+			0002 OpJumpNotTruthy 10
+			0005 OpGetLocal 0
+			0007 OpJump 12
+			0010 OpGetLocal 0
+			0012 OpConstant 0
+			0015 OpAdd
+			0016 OpReturnValue`,
+		},
+	}
+
+	for _, tt := range superinstructionTests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		expected, err := code.Assemble(tt.expected)
+		if err != nil {
+			t.Fatalf("assembler error: %s", err)
+		}
+
+		optimized := Optimize(compiler.Bytecode())
+		fn := optimized.Constants[len(optimized.Constants)-1].(*object.CompiledFunction)
+		if err := testInstructions([]code.Instructions{expected}, fn.Instructions); err != nil {
+			t.Errorf("wrong optimization of %q: %s", tt.input, err)
+		}
+	}
+}
+
+func TestCompilerScopes(t *testing.T) {
+	compiler := New()
+	global := compiler.symbolTable
+
+	compiler.emit(code.OpMul)
+
+	compiler.enterScope()
+	if compiler.scopeIndex != 1 {
+		t.Fatalf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 1)
+	}
+	if compiler.symbolTable.Outer != global {
+		t.Errorf("compiler did not enclose symbolTable")
+	}
+
+	compiler.emit(code.OpSub)
+	if len(compiler.currentInstructions()) != 1 {
+		t.Errorf("instructions length wrong. got=%d", len(compiler.currentInstructions()))
+	}
+
+	compiler.leaveScope()
+	if compiler.scopeIndex != 0 {
+		t.Errorf("scopeIndex wrong. got=%d, want=%d", compiler.scopeIndex, 0)
+	}
+	if compiler.symbolTable != global {
+		t.Errorf("compiler did not restore global symbol table")
+	}
+
+	compiler.emit(code.OpAdd)
+	if len(compiler.currentInstructions()) != 2 {
+		t.Errorf("instructions length wrong. got=%d", len(compiler.currentInstructions()))
+	}
+	if !compiler.lastInstructionIs(code.OpAdd) || compiler.scopes[0].previousInstruction.Opcode != code.OpMul {
+		t.Errorf("last instructions of the main scope were not kept")
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x", "identifier not found: x"},
+		{"let x = x;", "identifier not found: x"},
+		{"fn() { a }", "identifier not found: a"},
+		{"let total = 1; fn(count) { count + totl }", "identifier not found: totl — did you mean total?"},
+		{"fn(count) { fn() { cuont } }", "identifier not found: cuont — did you mean count?"},
+		{"quote(1 + 2)", "quote is not supported by the compiler"},
+		{`import("math.monkey")`, "import is not supported by the compiler"},
+		{"fn() { macro() { 1 } }", "macros can only be defined by top-level let statements"},
+		{"select {" + strings.Repeat("c => 1, ", 255) + "c => 1 }", "too many select cases: 256, want at most 255"},
+		// operands that do not fit in their width fail instead of wrapping around
+		{strings.Repeat("1;", MAX_CONSTANTS+1), "too many constants: 65537, want at most 65536"},
+		{named("let x%s = [];", MAX_GLOBALS+1), "too many global bindings: 65537, want at most 65536"},
+		{"fn() { " + named("let x%s = [];", MAX_LOCALS+1) + " }", "too many local bindings: 257, want at most 256"},
+		{"fn(" + strings.TrimSuffix(named("x%s, ", MAX_LOCALS+1), ", ") + ") { 1 }", "too many local bindings: 257, want at most 256"},
+		{
+			"fn() { " + named("let x%s = [];", 256) + " fn() { [" + named("x%s, ", 256) + "1] } }",
+			"too many free variables: 256, want at most 255",
+		},
+		{"len(" + strings.Repeat("1, ", MAX_ARGUMENTS) + "1)", "too many arguments: 256, want at most 255"},
+		{"[].map(" + strings.Repeat("1, ", MAX_ARGUMENTS) + "1)", "too many arguments: 256, want at most 255"},
+		{"let x = true; if (x) {" + strings.Repeat("true;", 33000) + "}", "operand 66012 of OpJumpNotTruthy does not fit in 2 bytes"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// named repeats the format n times, each with a name of its own, made of letters only
+// as identifiers are.
+func named(format string, n int) string {
+	var out strings.Builder
+	for i := 0; i < n; i++ {
+		name := ""
+		for number := i; ; number /= 26 {
+			name += string(rune('a' + number%26))
+			if number < 26 {
+				break
+			}
+		}
+		fmt.Fprintf(&out, format, name)
+	}
+
+	return out.String()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		if err := testConstants(tt.expectedConstants, bytecode.Constants); err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := code.Instructions{}
+	for _, instruction := range expected {
+		concatted = append(concatted, instruction...)
+	}
+
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q", concatted, actual)
+	}
+
+	for i, b := range concatted {
+		if actual[i] != b {
+			return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q", i, concatted, actual)
+		}
+	}
+
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. want=%d, got=%d", len(expected), len(actual))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d wrong. want=%d, got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				return fmt.Errorf("constant %d wrong. want=%q, got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d not a function. got=%T (%+v)", i, actual[i], actual[i])
+			}
+			if err := testInstructions(constant, fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d wrong: %s", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func builtinIndex(t *testing.T, name string) int {
+	t.Helper()
+
+	for i, builtin := range evaluator.BuiltinNames() {
+		if builtin == name {
+			return i
+		}
+	}
+
+	t.Fatalf("builtin %s not found", name)
+	return 0
+}
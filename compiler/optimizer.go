@@ -0,0 +1,338 @@
+package compiler
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+// fusedJumps maps the comparisons that can be fused with a following OpJumpNotTruthy
+// to the jump that replaces both.
+var fusedJumps = map[code.Opcode]code.Opcode{
+	code.OpEqual:              code.OpJumpNotEqual,
+	code.OpNotEqual:           code.OpJumpEqual,
+	code.OpGreaterThan:        code.OpJumpNotGreaterThan,
+	code.OpLessThan:           code.OpJumpNotLessThan,
+	code.OpGreaterThanOrEqual: code.OpJumpNotGreaterThanOrEqual,
+	code.OpLessThanOrEqual:    code.OpJumpNotLessThanOrEqual,
+}
+
+// superinstructions maps the arithmetic that can be fused with the OpGetLocal and
+// OpConstant before it to the instruction that replaces all three.
+var superinstructions = map[code.Opcode]code.Opcode{
+	code.OpAdd: code.OpGetLocalConstantAdd,
+	code.OpSub: code.OpGetLocalConstantSub,
+}
+
+// pushes are the instructions that only push a value, so a push immediately popped again does nothing.
+var pushes = map[code.Opcode]bool{
+	code.OpConstant:       true,
+	code.OpTrue:           true,
+	code.OpFalse:          true,
+	code.OpNull:           true,
+	code.OpGetGlobal:      true,
+	code.OpGetLocal:       true,
+	code.OpGetBuiltin:     true,
+	code.OpGetFree:        true,
+	code.OpCurrentClosure: true,
+}
+
+// instruction is a decoded instruction, remembering where it was before the optimization
+// and where in the source it came from.
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	offset   int
+	removed  bool
+
+	line   int
+	column int
+}
+
+// Optimize returns the bytecode with the peephole optimizations applied to the program and
+// to every compiled function in the constants. The bytecode given is left unchanged.
+func Optimize(bytecode *Bytecode) *Bytecode {
+	constants := make([]object.Object, len(bytecode.Constants))
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			instructions, sourceMap := optimize(fn.Instructions, fn.SourceMap)
+			constant = &object.CompiledFunction{
+				Instructions:  instructions,
+				NumLocals:     fn.NumLocals,
+				NumParameters: fn.NumParameters,
+				Name:          fn.Name,
+				SourceMap:     sourceMap,
+			}
+		}
+		constants[i] = constant
+	}
+
+	instructions, sourceMap := optimize(bytecode.Instructions, bytecode.SourceMap)
+	return &Bytecode{Instructions: instructions, Constants: constants, SourceMap: sourceMap}
+}
+
+// optimize rewrites the instructions until none of the patterns are left: jumps to
+// unconditional jumps go straight to the final target, comparisons followed by
+// OpJumpNotTruthy are fused, and values pushed only to be popped are never pushed.
+// Finally a local combined with a constant, as in n - 1, becomes a single instruction.
+// The source map is moved along with the instructions.
+func optimize(instructions code.Instructions, sourceMap code.SourceMap) (code.Instructions, code.SourceMap) {
+	decoded, ok := decode(instructions, sourceMap)
+	if !ok {
+		// leave anything undecodable to the virtual machine to report
+		return instructions, sourceMap
+	}
+
+	for changed := true; changed; {
+		changed = collapseJumpChains(decoded)
+		changed = fuseComparisons(decoded) || changed
+		changed = removeUnusedPushes(decoded) || changed
+		retarget(decoded, len(instructions))
+	}
+	fuseSuperinstructions(decoded)
+
+	return encode(decoded, len(instructions))
+}
+
+// collapseJumpChains points every jump that lands on an OpJump at where that jump goes.
+func collapseJumpChains(decoded []*instruction) bool {
+	byOffset := map[int]*instruction{}
+	for _, ins := range decoded {
+		if !ins.removed {
+			byOffset[ins.offset] = ins
+		}
+	}
+
+	changed := false
+	for _, ins := range decoded {
+		if ins.removed || !isJump(ins.op) {
+			continue
+		}
+
+		// a chain longer than the instructions is a loop of jumps, left as it is
+		target := ins.operands[0]
+		for steps := 0; steps < len(decoded); steps++ {
+			next, ok := byOffset[target]
+			if !ok || next.op != code.OpJump || next.operands[0] == target {
+				break
+			}
+			target = next.operands[0]
+		}
+
+		if target != ins.operands[0] {
+			ins.operands[0] = target
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// fuseComparisons replaces a comparison followed by OpJumpNotTruthy with a single jump.
+func fuseComparisons(decoded []*instruction) bool {
+	targets := jumpTargets(decoded)
+	changed := false
+
+	for i := 0; i < len(decoded); i++ {
+		ins := decoded[i]
+		fused, ok := fusedJumps[ins.op]
+		if ins.removed || !ok {
+			continue
+		}
+
+		// code jumping to the OpJumpNotTruthy still expects it to be there
+		next := nextInstruction(decoded, i)
+		if next < 0 {
+			continue
+		}
+		if jump := decoded[next]; jump.op != code.OpJumpNotTruthy || targets[jump.offset] {
+			continue
+		}
+
+		ins.op = fused
+		ins.operands = []int{decoded[next].operands[0]}
+		decoded[next].removed = true
+		changed = true
+	}
+
+	return changed
+}
+
+// removeUnusedPushes removes the pushes that are immediately popped. The last OpPop is
+// kept, since its value is the value of the program.
+func removeUnusedPushes(decoded []*instruction) bool {
+	targets := jumpTargets(decoded)
+	changed := false
+
+	for i := 0; i < len(decoded); i++ {
+		ins := decoded[i]
+		if ins.removed || !pushes[ins.op] {
+			continue
+		}
+
+		// code jumping to the OpPop has a value of its own to discard
+		next := nextInstruction(decoded, i)
+		if next < 0 || nextInstruction(decoded, next) < 0 {
+			continue
+		}
+		if pop := decoded[next]; pop.op != code.OpPop || targets[pop.offset] {
+			continue
+		}
+
+		ins.removed = true
+		decoded[next].removed = true
+		changed = true
+	}
+
+	return changed
+}
+
+// fuseSuperinstructions replaces an OpGetLocal followed by an OpConstant and an
+// arithmetic operator with a single instruction taking both operands.
+func fuseSuperinstructions(decoded []*instruction) {
+	targets := jumpTargets(decoded)
+
+	for i := 0; i < len(decoded); i++ {
+		ins := decoded[i]
+		if ins.removed || ins.op != code.OpGetLocal {
+			continue
+		}
+
+		// code jumping into the middle of the sequence still expects its instructions
+		constant := nextInstruction(decoded, i)
+		if constant < 0 || decoded[constant].op != code.OpConstant || targets[decoded[constant].offset] {
+			continue
+		}
+		operator := nextInstruction(decoded, constant)
+		if operator < 0 || targets[decoded[operator].offset] {
+			continue
+		}
+		fused, ok := superinstructions[decoded[operator].op]
+		if !ok {
+			continue
+		}
+
+		// the arithmetic is what can fail, so the fused instruction is placed at it
+		ins.op = fused
+		ins.operands = []int{ins.operands[0], decoded[constant].operands[0]}
+		ins.line, ins.column = decoded[operator].line, decoded[operator].column
+		decoded[constant].removed = true
+		decoded[operator].removed = true
+	}
+}
+
+// retarget points the jumps landing on a removed instruction at the next instruction left,
+// so every target is an instruction that is still there or the end of the instructions.
+func retarget(decoded []*instruction, length int) {
+	byOffset := map[int]int{}
+	for i, ins := range decoded {
+		byOffset[ins.offset] = i
+	}
+
+	for _, ins := range decoded {
+		if ins.removed || !isJump(ins.op) {
+			continue
+		}
+
+		i, ok := byOffset[ins.operands[0]]
+		if !ok || !decoded[i].removed {
+			continue
+		}
+
+		if next := nextInstruction(decoded, i); next < 0 {
+			ins.operands[0] = length
+		} else {
+			ins.operands[0] = decoded[next].offset
+		}
+	}
+}
+
+// decode splits the instructions into their opcodes and operands, each placed in the
+// source by the source map. It fails on an undefined opcode.
+func decode(instructions code.Instructions, sourceMap code.SourceMap) ([]*instruction, bool) {
+	decoded := []*instruction{}
+
+	for offset := 0; offset < len(instructions); {
+		definition, err := code.Lookup(instructions[offset])
+		if err != nil {
+			return nil, false
+		}
+
+		operands, read := code.ReadOperands(definition, instructions[offset+1:])
+		line, column := sourceMap.Lookup(offset)
+		decoded = append(decoded, &instruction{op: code.Opcode(instructions[offset]), operands: operands, offset: offset, line: line, column: column})
+
+		offset += 1 + read
+	}
+
+	return decoded, true
+}
+
+// encode writes the remaining instructions and their source map, moving every jump target
+// to where the instruction it pointed at ended up. A removed target becomes the next
+// instruction left.
+func encode(decoded []*instruction, length int) (code.Instructions, code.SourceMap) {
+	// the offset every old offset moves to, including the end of the instructions
+	moved := map[int]int{}
+	newOffset := 0
+	for _, ins := range decoded {
+		moved[ins.offset] = newOffset
+		if !ins.removed {
+			newOffset += len(code.Make(ins.op, ins.operands...))
+		}
+	}
+	moved[length] = newOffset
+
+	encoded := code.Instructions{}
+	var sourceMap code.SourceMap
+	for _, ins := range decoded {
+		if ins.removed {
+			continue
+		}
+
+		sourceMap = sourceMap.Add(len(encoded), ins.line, ins.column)
+
+		operands := ins.operands
+		if isJump(ins.op) {
+			operands = []int{moved[operands[0]]}
+		}
+		encoded = append(encoded, code.Make(ins.op, operands...)...)
+	}
+
+	return encoded, sourceMap
+}
+
+// jumpTargets returns the offsets that the remaining jumps land on.
+func jumpTargets(decoded []*instruction) map[int]bool {
+	targets := map[int]bool{}
+	for _, ins := range decoded {
+		if !ins.removed && isJump(ins.op) {
+			targets[ins.operands[0]] = true
+		}
+	}
+
+	return targets
+}
+
+// nextInstruction returns the index of the first instruction after the index that has
+// not been removed, or -1 if there is none.
+func nextInstruction(decoded []*instruction, index int) int {
+	for i := index + 1; i < len(decoded); i++ {
+		if !decoded[i].removed {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isJump reports whether the operand of the opcode is an offset into the instructions.
+func isJump(op code.Opcode) bool {
+	switch op {
+	case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNotNull, code.OpJumpNull, code.OpTry,
+		code.OpJumpNotEqual, code.OpJumpEqual, code.OpJumpNotGreaterThan, code.OpJumpNotLessThan,
+		code.OpJumpNotGreaterThanOrEqual, code.OpJumpNotLessThanOrEqual:
+		return true
+	}
+
+	return false
+}
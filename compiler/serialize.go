@@ -0,0 +1,262 @@
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/code"
+	"monkey/object"
+)
+
+// BYTECODE_MAGIC starts every serialized program, so compiled files can be told apart from source.
+const BYTECODE_MAGIC = "\x00monkeyc"
+
+// BYTECODE_VERSION is the version of the serialized format. It has to change whenever the
+// format or the numbering of the opcodes or builtins changes, since old files would no
+// longer run correctly.
+const BYTECODE_VERSION = 20
+
+// tags of the constants in a serialized program
+const (
+	CONSTANT_INTEGER  byte = 1
+	CONSTANT_STRING   byte = 2
+	CONSTANT_FUNCTION byte = 3
+	CONSTANT_BYTES    byte = 4
+)
+
+// errTruncated is returned when a serialized program ends before it is complete.
+var errTruncated = errors.New("truncated bytecode")
+
+// IsSerialized reports whether the content starts like a serialized program.
+func IsSerialized(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(BYTECODE_MAGIC))
+}
+
+// WriteTo serializes the bytecode: the magic and the version, then the instructions and
+// their source map, then the constants, each starting with a tag for its type. Numbers
+// are big endian.
+func (bytecode *Bytecode) WriteTo(w io.Writer) (int64, error) {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(BYTECODE_MAGIC)
+	binary.Write(&buffer, binary.BigEndian, uint16(BYTECODE_VERSION))
+
+	writeInstructions(&buffer, bytecode.Instructions)
+	writeSourceMap(&buffer, bytecode.SourceMap)
+
+	binary.Write(&buffer, binary.BigEndian, uint32(len(bytecode.Constants)))
+	for _, constant := range bytecode.Constants {
+		if err := writeConstant(&buffer, constant); err != nil {
+			return 0, err
+		}
+	}
+
+	return buffer.WriteTo(w)
+}
+
+// writeInstructions writes the length of the instructions followed by the instructions.
+func writeInstructions(buffer *bytes.Buffer, instructions code.Instructions) {
+	binary.Write(buffer, binary.BigEndian, uint32(len(instructions)))
+	buffer.Write(instructions)
+}
+
+// writeSourceMap writes the number of mappings followed by the offset, the line and the
+// column of each.
+func writeSourceMap(buffer *bytes.Buffer, sourceMap code.SourceMap) {
+	binary.Write(buffer, binary.BigEndian, uint32(len(sourceMap)))
+	for _, mapping := range sourceMap {
+		binary.Write(buffer, binary.BigEndian, uint32(mapping.Offset))
+		binary.Write(buffer, binary.BigEndian, uint32(mapping.Line))
+		binary.Write(buffer, binary.BigEndian, uint32(mapping.Column))
+	}
+}
+
+// writeConstant writes the tag of the constant followed by its value.
+func writeConstant(buffer *bytes.Buffer, constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		buffer.WriteByte(CONSTANT_INTEGER)
+		binary.Write(buffer, binary.BigEndian, constant.Value)
+	case *object.String:
+		buffer.WriteByte(CONSTANT_STRING)
+		binary.Write(buffer, binary.BigEndian, uint32(len(constant.Value)))
+		buffer.WriteString(constant.Value)
+	case *object.Bytes:
+		buffer.WriteByte(CONSTANT_BYTES)
+		binary.Write(buffer, binary.BigEndian, uint32(len(constant.Value)))
+		buffer.Write(constant.Value)
+	case *object.CompiledFunction:
+		buffer.WriteByte(CONSTANT_FUNCTION)
+		binary.Write(buffer, binary.BigEndian, uint16(constant.NumLocals))
+		binary.Write(buffer, binary.BigEndian, uint16(constant.NumParameters))
+		binary.Write(buffer, binary.BigEndian, uint32(len(constant.Name)))
+		buffer.WriteString(constant.Name)
+		writeInstructions(buffer, constant.Instructions)
+		writeSourceMap(buffer, constant.SourceMap)
+	default:
+		return fmt.Errorf("cannot serialize constant of type %s", constant.Type())
+	}
+
+	return nil
+}
+
+// ReadBytecode deserializes a program written by Bytecode.WriteTo.
+func ReadBytecode(r io.Reader) (*Bytecode, error) {
+	reader := bufio.NewReader(r)
+
+	magic := make([]byte, len(BYTECODE_MAGIC))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != BYTECODE_MAGIC {
+		return nil, errors.New("not a compiled monkey program")
+	}
+
+	var version uint16
+	if err := binary.Read(reader, binary.BigEndian, &version); err != nil {
+		return nil, errTruncated
+	}
+	if version != BYTECODE_VERSION {
+		return nil, fmt.Errorf("unsupported bytecode version %d, want %d", version, BYTECODE_VERSION)
+	}
+
+	instructions, err := readInstructions(reader)
+	if err != nil {
+		return nil, err
+	}
+	sourceMap, err := readSourceMap(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var count uint32
+	if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+		return nil, errTruncated
+	}
+
+	constants := []object.Object{}
+	for i := uint32(0); i < count; i++ {
+		constant, err := readConstant(reader)
+		if err != nil {
+			return nil, err
+		}
+		constants = append(constants, constant)
+	}
+
+	return &Bytecode{Instructions: instructions, Constants: constants, SourceMap: sourceMap}, nil
+}
+
+// readInstructions reads instructions written by writeInstructions.
+func readInstructions(reader *bufio.Reader) (code.Instructions, error) {
+	var length uint32
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, errTruncated
+	}
+
+	instructions, err := readBytes(reader, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return instructions, nil
+}
+
+// readSourceMap reads a source map written by writeSourceMap.
+func readSourceMap(reader *bufio.Reader) (code.SourceMap, error) {
+	var count uint32
+	if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+		return nil, errTruncated
+	}
+
+	// the mappings are read one at a time, without trusting the count before they are there
+	var sourceMap code.SourceMap
+	for i := uint32(0); i < count; i++ {
+		var fields [3]uint32
+		if err := binary.Read(reader, binary.BigEndian, &fields); err != nil {
+			return nil, errTruncated
+		}
+		sourceMap = append(sourceMap, code.Mapping{Offset: int(fields[0]), Line: int(fields[1]), Column: int(fields[2])})
+	}
+
+	return sourceMap, nil
+}
+
+// readBytes reads exactly length bytes, without trusting the length before they are there.
+func readBytes(reader *bufio.Reader, length uint32) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(reader, int64(length)))
+	if err != nil || len(content) != int(length) {
+		return nil, errTruncated
+	}
+
+	return content, nil
+}
+
+// readConstant reads a constant written by writeConstant.
+func readConstant(reader *bufio.Reader) (object.Object, error) {
+	tag, err := reader.ReadByte()
+	if err != nil {
+		return nil, errTruncated
+	}
+
+	switch tag {
+	case CONSTANT_INTEGER:
+		var value int64
+		if err := binary.Read(reader, binary.BigEndian, &value); err != nil {
+			return nil, errTruncated
+		}
+		return object.NewInteger(value), nil
+	case CONSTANT_STRING:
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return nil, errTruncated
+		}
+		value, err := readBytes(reader, length)
+		if err != nil {
+			return nil, err
+		}
+		return &object.String{Value: string(value)}, nil
+	case CONSTANT_BYTES:
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return nil, errTruncated
+		}
+		value, err := readBytes(reader, length)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Bytes{Value: value}, nil
+	case CONSTANT_FUNCTION:
+		var numLocals, numParameters uint16
+		if err := binary.Read(reader, binary.BigEndian, &numLocals); err != nil {
+			return nil, errTruncated
+		}
+		if err := binary.Read(reader, binary.BigEndian, &numParameters); err != nil {
+			return nil, errTruncated
+		}
+		var nameLength uint32
+		if err := binary.Read(reader, binary.BigEndian, &nameLength); err != nil {
+			return nil, errTruncated
+		}
+		name, err := readBytes(reader, nameLength)
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := readInstructions(reader)
+		if err != nil {
+			return nil, err
+		}
+		sourceMap, err := readSourceMap(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     int(numLocals),
+			NumParameters: int(numParameters),
+			Name:          string(name),
+			SourceMap:     sourceMap,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown constant tag %d", tag)
+	}
+}
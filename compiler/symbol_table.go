@@ -0,0 +1,148 @@
+package compiler
+
+import "sort"
+
+// SymbolScope tells where the value of a symbol is stored.
+type SymbolScope string
+
+const (
+	GLOBAL_SCOPE   SymbolScope = "GLOBAL"   // the globals store of the virtual machine
+	LOCAL_SCOPE    SymbolScope = "LOCAL"    // a slot of the current call frame
+	BUILTIN_SCOPE  SymbolScope = "BUILTIN"  // the builtin functions
+	FREE_SCOPE     SymbolScope = "FREE"     // a value captured by the current closure
+	FUNCTION_SCOPE SymbolScope = "FUNCTION" // the closure being executed, for recursion
+)
+
+// Symbol is a name resolved to where its value is stored.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable maps the names of one scope to their symbols. Function bodies get a
+// table enclosed by the table of the code around them.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// FreeSymbols are the symbols of enclosing functions used by this one, in the
+	// order their values are captured, as they were resolved in the outer table
+	FreeSymbols []Symbol
+}
+
+// NewSymbolTable creates an empty global symbol table.
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: map[string]Symbol{}, FreeSymbols: []Symbol{}}
+}
+
+// NewEnclosedSymbolTable creates an empty symbol table for a function nested in the outer scope.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	symbolTable := NewSymbolTable()
+	symbolTable.Outer = outer
+
+	return symbolTable
+}
+
+// Copy returns a copy of the table sharing its enclosing tables, so definitions can be
+// tried out and thrown away again.
+func (symbolTable *SymbolTable) Copy() *SymbolTable {
+	copied := &SymbolTable{
+		Outer:          symbolTable.Outer,
+		store:          make(map[string]Symbol, len(symbolTable.store)),
+		numDefinitions: symbolTable.numDefinitions,
+		FreeSymbols:    append([]Symbol{}, symbolTable.FreeSymbols...),
+	}
+	for name, symbol := range symbolTable.store {
+		copied.store[name] = symbol
+	}
+
+	return copied
+}
+
+// Define binds the name to the next free slot of the scope, shadowing any binding of the
+// same name in an enclosing scope. Defining a name again in the same scope reuses its slot,
+// so code compiled earlier sees the new value just as the evaluator's environments do.
+func (symbolTable *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := symbolTable.store[name]; ok && (symbol.Scope == GLOBAL_SCOPE || symbol.Scope == LOCAL_SCOPE) {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: symbolTable.numDefinitions}
+	if symbolTable.Outer == nil {
+		symbol.Scope = GLOBAL_SCOPE
+	} else {
+		symbol.Scope = LOCAL_SCOPE
+	}
+
+	symbolTable.store[name] = symbol
+	symbolTable.numDefinitions++
+
+	return symbol
+}
+
+// Names returns the names this table and the ones enclosing it resolve, those of the
+// innermost first, each table's in sorted order.
+func (symbolTable *SymbolTable) Names() []string {
+	var names []string
+	for table := symbolTable; table != nil; table = table.Outer {
+		local := make([]string, 0, len(table.store))
+		for name := range table.store {
+			local = append(local, name)
+		}
+
+		sort.Strings(local)
+		names = append(names, local...)
+	}
+
+	return names
+}
+
+// DefineBuiltin binds the name to the builtin function with the given index.
+func (symbolTable *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BUILTIN_SCOPE, Index: index}
+	symbolTable.store[name] = symbol
+
+	return symbol
+}
+
+// DefineFunctionName binds the name of the function being compiled, so its body can call itself.
+func (symbolTable *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: FUNCTION_SCOPE, Index: 0}
+	symbolTable.store[name] = symbol
+
+	return symbol
+}
+
+// Resolve returns the symbol bound to the name in this scope or an enclosing one. A local
+// of an enclosing function is turned into a free symbol of this one, to be captured.
+func (symbolTable *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := symbolTable.store[name]
+	if ok || symbolTable.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = symbolTable.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+
+	// globals and builtins are reachable from anywhere
+	if symbol.Scope == GLOBAL_SCOPE || symbol.Scope == BUILTIN_SCOPE {
+		return symbol, ok
+	}
+
+	return symbolTable.defineFree(symbol), true
+}
+
+// defineFree records a symbol of an enclosing function as captured by this one.
+func (symbolTable *SymbolTable) defineFree(original Symbol) Symbol {
+	symbolTable.FreeSymbols = append(symbolTable.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FREE_SCOPE, Index: len(symbolTable.FreeSymbols) - 1}
+	symbolTable.store[original.Name] = symbol
+
+	return symbol
+}
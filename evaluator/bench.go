@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"monkey/object"
+	"time"
+)
+
+// BENCH_TIME is how long the bench builtin runs a function for at least.
+const BENCH_TIME = time.Second
+
+// MAX_BENCH_ITERATIONS caps the number of calls a benchmark makes, however fast the function is.
+const MAX_BENCH_ITERATIONS = 1_000_000_000
+
+// benchTime is the duration used by the bench builtin, shortened by the tests.
+var benchTime = BENCH_TIME
+
+// bench runs the function given after the name of the benchmark through the engine
+// running the program, so that it counts against the limits of the run and stops when
+// the run is cancelled, and prints how long each call took.
+func bench(out io.Writer, call object.Caller, args []object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newError("first argument to `bench` must be STRING, got %s", args[0].Type())
+	}
+
+	iterations, perCall, err := Benchmark(call, args[1], benchTime)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(out, FormatBenchmark(name.Value, iterations, perCall)); err != nil {
+		return newError("could not print: %s", err)
+	}
+
+	return NULL
+}
+
+// Benchmark calls the function without arguments with the caller repeatedly, growing the
+// number of calls until they take at least the given duration. It returns the number of
+// calls of the last round and the time each took, or the first error the function returned.
+func Benchmark(call object.Caller, function object.Object, duration time.Duration) (int, time.Duration, *object.Error) {
+	iterations := 1
+
+	for {
+		start := time.Now()
+		for i := 0; i < iterations; i++ {
+			if err, ok := call(function).(*object.Error); ok {
+				return 0, 0, err
+			}
+		}
+		elapsed := time.Since(start)
+
+		if elapsed >= duration || iterations >= MAX_BENCH_ITERATIONS {
+			return iterations, elapsed / time.Duration(iterations), nil
+		}
+
+		iterations = nextIterations(iterations, elapsed, duration)
+	}
+}
+
+// nextIterations predicts how many calls will fill the duration, overshooting a little so
+// the next round is likely the last, while never growing more than a hundredfold at once.
+func nextIterations(iterations int, elapsed, duration time.Duration) int {
+	next := iterations * 100
+	if elapsed > 0 {
+		predicted := int(int64(iterations) * int64(duration) / int64(elapsed) * 6 / 5)
+		if predicted < next {
+			next = predicted
+		}
+	}
+
+	if next <= iterations {
+		next = iterations + 1
+	}
+	if next > MAX_BENCH_ITERATIONS {
+		next = MAX_BENCH_ITERATIONS
+	}
+
+	return next
+}
+
+// FormatBenchmark formats a benchmark result as a line of name, calls, and time per call.
+func FormatBenchmark(name string, iterations int, perCall time.Duration) string {
+	return fmt.Sprintf("%-24s %12d %14d ns/op", name, iterations, perCall.Nanoseconds())
+}
@@ -0,0 +1,674 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/object"
+	"monkey/token"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MAX_BUILTINS is the number of builtin functions the one byte operand of the compiler can number.
+const MAX_BUILTINS = 256
+
+// timeLayouts names the layouts of the time package that format_time accepts by name.
+var timeLayouts = map[string]string{
+	"RFC3339":  time.RFC3339,
+	"RFC1123":  time.RFC1123,
+	"DateTime": time.DateTime,
+	"DateOnly": time.DateOnly,
+	"TimeOnly": time.TimeOnly,
+	"Kitchen":  time.Kitchen,
+}
+
+// started is the moment the clock builtin counts from.
+var started = time.Now()
+
+// builtins maps the names of the builtin functions to their implementations.
+var builtins = map[string]*object.Builtin{
+	"len": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.String:
+				return object.NewInteger(int64(utf8.RuneCountInString(arg.Value)))
+			case *object.Bytes:
+				return object.NewInteger(int64(len(arg.Value)))
+			case *object.Array:
+				return object.NewInteger(int64(len(arg.Elements)))
+			case *object.Hash:
+				return object.NewInteger(int64(len(arg.Pairs)))
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"first": {
+		Fn: func(args ...object.Object) object.Object {
+			array, errObj := arrayArgument("first", args)
+			if errObj != nil {
+				return errObj
+			}
+
+			if len(array.Elements) == 0 {
+				return NULL
+			}
+			return array.Elements[0]
+		},
+	},
+	"last": {
+		Fn: func(args ...object.Object) object.Object {
+			array, errObj := arrayArgument("last", args)
+			if errObj != nil {
+				return errObj
+			}
+
+			if len(array.Elements) == 0 {
+				return NULL
+			}
+			return array.Elements[len(array.Elements)-1]
+		},
+	},
+	"rest": {
+		Fn: func(args ...object.Object) object.Object {
+			array, errObj := arrayArgument("rest", args)
+			if errObj != nil {
+				return errObj
+			}
+
+			if len(array.Elements) == 0 {
+				return NULL
+			}
+			return copyElements(array.Elements[1:])
+		},
+	},
+	"pop": {
+		Fn: func(args ...object.Object) object.Object {
+			array, errObj := arrayArgument("pop", args)
+			if errObj != nil {
+				return errObj
+			}
+
+			if len(array.Elements) == 0 {
+				return NULL
+			}
+			return copyElements(array.Elements[:len(array.Elements)-1])
+		},
+	},
+	"push": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			array, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+			}
+
+			return copyElements(array.Elements, args[1])
+		},
+	},
+	"concat": {
+		Fn: func(args ...object.Object) object.Object {
+			var elements []object.Object
+			for _, arg := range args {
+				array, ok := arg.(*object.Array)
+				if !ok {
+					return newError("argument to `concat` must be ARRAY, got %s", arg.Type())
+				}
+				elements = append(elements, array.Elements...)
+			}
+
+			return copyElements(elements)
+		},
+	},
+	"map": {
+		HigherOrderFn: func(call object.Caller, args ...object.Object) object.Object {
+			array, function, errObj := callbackArguments("map", args, 2)
+			if errObj != nil {
+				return errObj
+			}
+
+			mapped := make([]object.Object, len(array.Elements))
+			for i, element := range array.Elements {
+				result := call(function, element)
+				if isError(result) {
+					return result
+				}
+				mapped[i] = result
+			}
+
+			return &object.Array{Elements: mapped}
+		},
+	},
+	"filter": {
+		HigherOrderFn: func(call object.Caller, args ...object.Object) object.Object {
+			array, function, errObj := callbackArguments("filter", args, 2)
+			if errObj != nil {
+				return errObj
+			}
+
+			kept := []object.Object{}
+			for _, element := range array.Elements {
+				result := call(function, element)
+				if isError(result) {
+					return result
+				}
+				if isTruthy(result) {
+					kept = append(kept, element)
+				}
+			}
+
+			return &object.Array{Elements: kept}
+		},
+	},
+	"reduce": {
+		HigherOrderFn: func(call object.Caller, args ...object.Object) object.Object {
+			array, function, errObj := callbackArguments("reduce", args, 3)
+			if errObj != nil {
+				return errObj
+			}
+
+			accumulated := args[1]
+			for _, element := range array.Elements {
+				accumulated = call(function, accumulated, element)
+				if isError(accumulated) {
+					return accumulated
+				}
+			}
+
+			return accumulated
+		},
+	},
+	"sort": {
+		HigherOrderFn: func(call object.Caller, args ...object.Object) object.Object {
+			if len(args) == 1 {
+				array, ok := args[0].(*object.Array)
+				if !ok {
+					return newError("first argument to `sort` must be ARRAY, got %s", args[0].Type())
+				}
+				return sortElements(array.Elements)
+			}
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+
+			array, comparator, errObj := callbackArguments("sort", args, 2)
+			if errObj != nil {
+				return errObj
+			}
+			return sortByComparator(array.Elements, comparator, call)
+		},
+	},
+	"int": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+			case *object.BigInteger:
+				if !arg.Value.IsInt64() {
+					return newError("cannot convert %s to INTEGER: out of range", arg.Inspect())
+				}
+				return object.NewInteger(arg.Value.Int64())
+			case *object.Boolean:
+				if arg.Value {
+					return object.NewInteger(1)
+				}
+				return object.NewInteger(0)
+			case *object.String:
+				value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+				if errors.Is(err, strconv.ErrRange) {
+					return newError("cannot convert %q to INTEGER: out of range", arg.Value)
+				}
+				if err != nil {
+					return newError("cannot convert %q to INTEGER", arg.Value)
+				}
+				return object.NewInteger(value)
+			default:
+				return newError("cannot convert %s to INTEGER", args[0].Type())
+			}
+		},
+	},
+	"big": {
+		Fn: bigBuiltin,
+	},
+	"str": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if str, ok := args[0].(*object.String); ok {
+				return str
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
+	"bool": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			return nativeBoolToBooleanObject(isTruthy(args[0]))
+		},
+	},
+	"type": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			return &object.String{Value: string(args[0].Type())}
+		},
+	},
+	"now": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+
+			return object.NewInteger(time.Now().UnixMilli())
+		},
+	},
+	"clock": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+
+			// the monotonic clock is not affected by changes to the time of day
+			return object.NewInteger(time.Since(started).Milliseconds())
+		},
+	},
+	"sleep": {
+		// sleeping stops when the run is cancelled, as waiting on a channel does
+		ContextFn: func(ctx context.Context, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			ms, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `sleep` must be INTEGER, got %s", args[0].Type())
+			}
+
+			timer := time.NewTimer(time.Duration(ms.Value) * time.Millisecond)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+				return NULL
+			case <-ctx.Done():
+				return newFatalError("evaluation interrupted: %s", ctx.Err())
+			}
+		},
+	},
+	"format_time": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			ms, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("first argument to `format_time` must be INTEGER, got %s", args[0].Type())
+			}
+			layout, ok := args[1].(*object.String)
+			if !ok {
+				return newError("second argument to `format_time` must be STRING, got %s", args[1].Type())
+			}
+
+			// layouts are written as the reference time of the time package is, or named
+			value := layout.Value
+			if named, ok := timeLayouts[value]; ok {
+				value = named
+			}
+			return &object.String{Value: time.UnixMilli(ms.Value).Format(value)}
+		},
+	},
+	"json_parse":     {Fn: jsonParse},
+	"json_stringify": {Fn: jsonStringify},
+	"to_bytes":       {Fn: toBytes},
+	"to_string":      {Fn: toString},
+	"hex_encode":     {Fn: hexEncode},
+	"hex_decode":     {Fn: hexDecode},
+	"keys":           {Fn: hashKeys},
+	"values":         {Fn: hashValues},
+	"has_key":        {Fn: hashHasKey},
+	"delete":         {Fn: hashDelete},
+	"merge":          {Fn: hashMerge},
+	"freeze":         {Fn: freeze},
+	"is_frozen":      {Fn: isFrozen},
+	"clone":          {Fn: clone},
+	"error":          {Fn: errorValue},
+	"throw":          {Fn: throw},
+	"exec":           {ContextFn: execCommand},
+	"channel":        {Fn: newChannel},
+	"send":           {ContextFn: channelSend},
+	"recv":           {ContextFn: channelReceive},
+	"close":          {Fn: channelClose},
+	"timeout":        {Fn: timeout},
+	"puts": {
+		Fn: func(args ...object.Object) object.Object {
+			return puts(os.Stdout, args)
+		},
+	},
+	"printf": {
+		Fn: func(args ...object.Object) object.Object {
+			return printf(os.Stdout, args)
+		},
+	},
+	"bench": {
+		HigherOrderFn: func(call object.Caller, args ...object.Object) object.Object {
+			return bench(os.Stdout, call, args)
+		},
+	},
+	"format": {
+		Fn: func(args ...object.Object) object.Object {
+			formatted, errObj := formatArguments("format", args)
+			if errObj != nil {
+				return errObj
+			}
+
+			return &object.String{Value: formatted}
+		},
+	},
+	"assert": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+
+			if isTruthy(args[0]) {
+				return NULL
+			}
+
+			// the message is optional
+			if len(args) == 2 {
+				return newError("assertion failed: %s", args[1].Inspect())
+			}
+			return newError("assertion failed")
+		},
+	},
+	"assert_eq": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+
+			if !objectsEqual(args[0], args[1]) {
+				return newError("assertion failed: %s != %s", args[0].Inspect(), args[1].Inspect())
+			}
+
+			return NULL
+		},
+	},
+}
+
+// sideEffects names the builtins that reach outside of the program, such as by writing
+// output, waiting for time to pass, or running commands, which sandboxed programs cannot use.
+var sideEffects = map[string]bool{
+	"puts":   true,
+	"printf": true,
+	"sleep":  true,
+	"exec":   true,
+	"bench":  true,
+}
+
+// printers are the builtins that print, each of which is given where to print to.
+var printers = map[string]func(out io.Writer, args []object.Object) object.Object{
+	"puts":   puts,
+	"printf": printf,
+}
+
+// puts prints each argument on a line of its own.
+func puts(out io.Writer, args []object.Object) object.Object {
+	for _, arg := range args {
+		if _, err := fmt.Fprintln(out, arg.Inspect()); err != nil {
+			return newError("could not print: %s", err)
+		}
+	}
+
+	return NULL
+}
+
+// printf prints the format string with its placeholders replaced by the values.
+func printf(out io.Writer, args []object.Object) object.Object {
+	formatted, errObj := formatArguments("printf", args)
+	if errObj != nil {
+		return errObj
+	}
+
+	if _, err := fmt.Fprint(out, formatted); err != nil {
+		return newError("could not print: %s", err)
+	}
+
+	return NULL
+}
+
+// arrayArgument returns the only argument of a builtin that takes an array.
+func arrayArgument(name string, args []object.Object) (*object.Array, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	return array, nil
+}
+
+// callbackArguments returns the array a higher-order builtin takes first and the
+// function it takes last, out of the number of arguments it takes.
+func callbackArguments(name string, args []object.Object, want int) (*object.Array, object.Object, *object.Error) {
+	if len(args) != want {
+		return nil, nil, newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, nil, newError("first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	function := args[want-1]
+	switch function.(type) {
+	case *object.Function, *object.Closure, *object.Builtin:
+		return array, function, nil
+	default:
+		return nil, nil, newError("last argument to `%s` must be a function, got %s", name, function.Type())
+	}
+}
+
+// sortElements returns a new array of the elements in ascending order, which have to be
+// all integers or all strings.
+func sortElements(elements []object.Object) object.Object {
+	sorted := copyElements(elements)
+	if len(elements) == 0 {
+		return sorted
+	}
+
+	elementType := elements[0].Type()
+	if elementType != object.INTEGER_OBJ && elementType != object.STRING_OBJ {
+		return newError("cannot sort %s without a comparator", elementType)
+	}
+	for _, element := range elements {
+		if element.Type() != elementType {
+			return newError("cannot sort %s and %s without a comparator", elementType, element.Type())
+		}
+	}
+
+	sort.SliceStable(sorted.Elements, func(i, j int) bool {
+		if elementType == object.INTEGER_OBJ {
+			return sorted.Elements[i].(*object.Integer).Value < sorted.Elements[j].(*object.Integer).Value
+		}
+		return sorted.Elements[i].(*object.String).Value < sorted.Elements[j].(*object.String).Value
+	})
+
+	return sorted
+}
+
+// sortByComparator returns a new array of the elements ordered by the comparator, which is
+// called with two elements and returns whether the first goes before the second, either as
+// a boolean or as an integer that is negative when it does, like a - b for ascending
+// integers. Equal elements keep their order. The first error of the comparator is returned.
+func sortByComparator(elements []object.Object, comparator object.Object, call object.Caller) object.Object {
+	sorted := copyElements(elements)
+
+	var errObj object.Object
+	sort.SliceStable(sorted.Elements, func(i, j int) bool {
+		if errObj != nil {
+			return false
+		}
+
+		result := call(comparator, sorted.Elements[i], sorted.Elements[j])
+		if isError(result) {
+			errObj = result
+			return false
+		}
+		if integer, ok := result.(*object.Integer); ok {
+			return integer.Value < 0
+		}
+		return isTruthy(result)
+	})
+	if errObj != nil {
+		return errObj
+	}
+
+	return sorted
+}
+
+// copyElements returns a new array of the elements followed by the extra ones. Arrays are
+// never changed in place, so the builtins return new arrays that share no elements slice.
+func copyElements(elements []object.Object, extra ...object.Object) *object.Array {
+	copied := make([]object.Object, len(elements), len(elements)+len(extra))
+	copy(copied, elements)
+
+	return &object.Array{Elements: append(copied, extra...)}
+}
+
+// LookupBuiltinWith returns the builtin function with the name as the options make it
+// available: exec fails when called unless they allow it, and the builtins with side
+// effects fail in sandbox mode, as LookupSandboxedBuiltin describes. The builtins that
+// print write to the output of the options if it is set, even in sandbox mode, since
+// then only the host sees what they print, and so does bench outside of it.
+func LookupBuiltinWith(name string, options Options) (*object.Builtin, bool) {
+	if printer, ok := printers[name]; ok && options.Output != nil {
+		return &object.Builtin{
+			Fn: func(args ...object.Object) object.Object {
+				return printer(options.Output, args)
+			},
+		}, true
+	}
+	if options.Sandbox {
+		return LookupSandboxedBuiltin(name)
+	}
+	if name == "bench" && options.Output != nil {
+		return &object.Builtin{
+			HigherOrderFn: func(call object.Caller, args ...object.Object) object.Object {
+				return bench(options.Output, call, args)
+			},
+		}, true
+	}
+	if name == "exec" && !options.AllowExec {
+		return failingBuiltin("exec is not enabled"), true
+	}
+
+	return LookupBuiltin(name)
+}
+
+// LookupSandboxedBuiltin returns the builtin function with the name like LookupBuiltin,
+// except that a builtin with side effects is replaced by one that fails when called,
+// so that sandboxed programs still compile and run up to the call.
+func LookupSandboxedBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	if !ok || !sideEffects[name] {
+		return builtin, ok
+	}
+
+	return failingBuiltin(name + " is not available in sandbox mode"), true
+}
+
+// failingBuiltin returns a builtin that fails with the message whenever it is called,
+// in place of one that is left out.
+func failingBuiltin(message string) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			return newError("%s", message)
+		},
+	}
+}
+
+// RegisterBuiltin adds a builtin function for every program to call, so that Go packages
+// can extend the language, typically from their init functions. It has to be called
+// before any program is compiled or run, and fails if the name is taken or is not an
+// identifier. Builtins are numbered by name, so bytecode written by monkey build only
+// runs where the same builtins are registered.
+func RegisterBuiltin(name string, builtin *object.Builtin) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("cannot register builtin %q: not an identifier", name)
+	}
+	if _, ok := builtins[name]; ok {
+		return fmt.Errorf("cannot register builtin %s: already defined", name)
+	}
+	if len(builtins) >= MAX_BUILTINS {
+		return fmt.Errorf("cannot register builtin %s: too many builtins", name)
+	}
+
+	builtins[name] = builtin
+	return nil
+}
+
+// isIdentifier reports whether the lexer reads the name as a single identifier.
+func isIdentifier(name string) bool {
+	if name == "" || token.LookupIdent(name) != token.IDENT {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		char := name[i]
+		if !('a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || char == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsBuiltin reports whether the name refers to a builtin function.
+func IsBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok
+}
+
+// BuiltinNames returns the names of the builtin functions in sorted order, which is the
+// order the compiler numbers them in.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// LookupBuiltin returns the builtin function with the name.
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
@@ -0,0 +1,134 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/hex"
+	"monkey/object"
+	"strings"
+	"unicode/utf8"
+)
+
+// toBytes converts a string to the bytes of its UTF-8 encoding, or an array of integers
+// from 0 to 255 to the bytes they stand for.
+func toBytes(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.String:
+		return &object.Bytes{Value: []byte(arg.Value)}
+	case *object.Bytes:
+		return arg
+	case *object.Array:
+		data := make([]byte, len(arg.Elements))
+		for i, element := range arg.Elements {
+			integer, ok := element.(*object.Integer)
+			if !ok || integer.Value < 0 || integer.Value > 255 {
+				return newError("elements of `to_bytes` must be INTEGER from 0 to 255, got %s", element.Inspect())
+			}
+			data[i] = byte(integer.Value)
+		}
+		return &object.Bytes{Value: data}
+	default:
+		return newError("argument to `to_bytes` must be STRING or ARRAY, got %s", args[0].Type())
+	}
+}
+
+// toString decodes bytes as UTF-8 into a string, failing on bytes that are not UTF-8.
+func toString(args ...object.Object) object.Object {
+	data, errObj := bytesArgument("to_string", args)
+	if errObj != nil {
+		return errObj
+	}
+
+	if !utf8.Valid(data.Value) {
+		return newError("cannot convert %s to STRING: not UTF-8", data.Inspect())
+	}
+
+	return &object.String{Value: string(data.Value)}
+}
+
+// hexEncode returns the bytes as a string of two lowercase hex digits for each.
+func hexEncode(args ...object.Object) object.Object {
+	data, errObj := bytesArgument("hex_encode", args)
+	if errObj != nil {
+		return errObj
+	}
+
+	return &object.String{Value: hex.EncodeToString(data.Value)}
+}
+
+// hexDecode returns the bytes a string of hex digits, two for each byte, stands for.
+func hexDecode(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `hex_decode` must be STRING, got %s", args[0].Type())
+	}
+
+	data, err := hex.DecodeString(str.Value)
+	if err != nil {
+		return newError("cannot decode %q as hex: %s", str.Value, strings.TrimPrefix(err.Error(), "encoding/hex: "))
+	}
+
+	return &object.Bytes{Value: data}
+}
+
+// bytesArgument returns the only argument of a builtin that takes bytes.
+func bytesArgument(name string, args []object.Object) (*object.Bytes, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	data, ok := args[0].(*object.Bytes)
+	if !ok {
+		return nil, newError("argument to `%s` must be BYTES, got %s", name, args[0].Type())
+	}
+
+	return data, nil
+}
+
+// evalBytesInfixExpression evaluates an infix operator applied to two bytes, which are
+// joined by + and ordered like strings.
+func evalBytesInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := left.(*object.Bytes).Value
+	rightValue := right.(*object.Bytes).Value
+
+	switch operator {
+	case "+":
+		return &object.Bytes{Value: append(bytes.Clone(leftValue), rightValue...)}
+	case "<":
+		return nativeBoolToBooleanObject(bytes.Compare(leftValue, rightValue) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(bytes.Compare(leftValue, rightValue) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(bytes.Compare(leftValue, rightValue) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(bytes.Compare(leftValue, rightValue) >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(bytes.Equal(leftValue, rightValue))
+	case "!=":
+		return nativeBoolToBooleanObject(!bytes.Equal(leftValue, rightValue))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalBytesIndexExpression returns the byte at the index as an integer, or null if the
+// index is out of range. A negative index counts from the end.
+func evalBytesIndexExpression(data, index object.Object) object.Object {
+	value := data.(*object.Bytes).Value
+	position := index.(*object.Integer).Value
+
+	if position < 0 {
+		position += int64(len(value))
+	}
+	if position < 0 || position >= int64(len(value)) {
+		return NULL
+	}
+
+	return object.NewInteger(int64(value[position]))
+}
@@ -0,0 +1,163 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"monkey/ast"
+	"monkey/object"
+	"time"
+)
+
+// MAX_CHANNEL_CAPACITY is the most values a channel can hold, which Go allocates room
+// for up front.
+const MAX_CHANNEL_CAPACITY = 1 << 20
+
+// newChannel creates a channel that holds up to the capacity of values it is given, or
+// none if it has no capacity, in which case every send waits for a receive.
+func newChannel(args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	if len(args) == 0 {
+		return object.NewChannel(0)
+	}
+
+	capacity, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("argument to `channel` must be INTEGER, got %s", args[0].Type())
+	}
+	if capacity.Value < 0 || capacity.Value > MAX_CHANNEL_CAPACITY {
+		return newError("capacity of channel must be from 0 to %d, got %d", MAX_CHANNEL_CAPACITY, capacity.Value)
+	}
+
+	return object.NewChannel(int(capacity.Value))
+}
+
+// channelSend waits until a channel takes a value and returns null. The value is isolated
+// like the function of a spawned task, so a function sent to another task does not share
+// the bindings of the one that sent it.
+func channelSend(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	channel, ok := args[0].(*object.Channel)
+	if !ok {
+		return newError("first argument to `send` must be CHANNEL, got %s", args[0].Type())
+	}
+
+	value := (&isolation{
+		environments: map[*object.Environment]*object.Environment{},
+		objects:      map[object.Object]object.Object{},
+	}).object(args[1])
+
+	if err := channel.Send(ctx, value); err != nil {
+		return channelError(ctx, err)
+	}
+	return NULL
+}
+
+// channelReceive waits for a value of a channel and returns it, or null once the channel
+// is closed and holds no more values.
+func channelReceive(ctx context.Context, args ...object.Object) object.Object {
+	channel, errObj := channelArgument("recv", args)
+	if errObj != nil {
+		return errObj
+	}
+
+	value, ok, err := channel.Receive(ctx)
+	if err != nil {
+		return channelError(ctx, err)
+	}
+	if !ok {
+		return NULL
+	}
+	return value
+}
+
+// channelClose closes a channel, after which sending on it fails and receiving from it
+// gives the values it still holds, then null.
+func channelClose(args ...object.Object) object.Object {
+	channel, errObj := channelArgument("close", args)
+	if errObj != nil {
+		return errObj
+	}
+
+	if !channel.Close() {
+		return newError("close of closed channel")
+	}
+	return NULL
+}
+
+// timeout returns a channel that is closed once the milliseconds have passed, for a
+// select to stop waiting on the others. Unlike sleep it waits only as long as the run
+// may, so sandboxed programs can use it.
+func timeout(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	ms, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("argument to `timeout` must be INTEGER, got %s", args[0].Type())
+	}
+
+	channel := object.NewChannel(0)
+	time.AfterFunc(time.Duration(ms.Value)*time.Millisecond, func() { channel.Close() })
+	return channel
+}
+
+// evalSelectExpression waits for the first of the channels of the cases to give a value
+// or be closed, and evaluates the body of its case with the value bound to the name of
+// the case like a let statement would bind it, or null if the channel was closed. The
+// channels are evaluated in order before any is waited on.
+func (evaluation *evaluation) evalSelectExpression(expression *ast.SelectExpression, env *object.Environment) object.Object {
+	channels := make([]*object.Channel, len(expression.Cases))
+	for i, selectCase := range expression.Cases {
+		evaluated := evaluation.eval(selectCase.Channel, env)
+		if isError(evaluated) {
+			return evaluated
+		}
+
+		channel, ok := evaluated.(*object.Channel)
+		if !ok {
+			return locate(newError("select case must be CHANNEL, got %s", evaluated.Type()), ast.StartToken(selectCase.Channel))
+		}
+		channels[i] = channel
+	}
+
+	index, value, ok, err := object.Select(evaluation.ctx, channels)
+	if err != nil {
+		return channelError(evaluation.ctx, err)
+	}
+	if !ok {
+		value = NULL
+	}
+
+	selectCase := expression.Cases[index]
+	if selectCase.Name != nil {
+		env.SetSlot(selectCase.Name.Slot(), selectCase.Name.Value, value)
+	}
+	return evaluation.eval(selectCase.Body, env)
+}
+
+// channelError returns the error of a send or receive that failed, which is fatal if
+// the run was cancelled while it waited.
+func channelError(ctx context.Context, err error) *object.Error {
+	if errors.Is(err, object.ErrClosedChannel) {
+		return newError("%s", err)
+	}
+	return newFatalError("evaluation interrupted: %s", ctx.Err())
+}
+
+// channelArgument returns the only argument of a builtin that takes a channel.
+func channelArgument(name string, args []object.Object) (*object.Channel, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	channel, ok := args[0].(*object.Channel)
+	if !ok {
+		return nil, newError("argument to `%s` must be CHANNEL, got %s", name, args[0].Type())
+	}
+
+	return channel, nil
+}
@@ -0,0 +1,89 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// evalFunctionLiteral makes a function of the literal that captures the bindings it uses
+// from the environment, as the compiler captures its free variables.
+//
+// A function that uses a name bound nowhere yet, such as one bound by a later let
+// statement of the same block, keeps the whole environment to find it in when called.
+func (evaluation *evaluation) evalFunctionLiteral(node *ast.FunctionLiteral, env *object.Environment) object.Object {
+	names := evaluation.freeNames(node)
+
+	captured := env
+	if !evaluation.usesUnboundName(names, "", env) {
+		captured = env.Capture(names)
+	}
+
+	return evaluation.allocate(&object.Function{Parameters: node.Parameters, Body: node.Body, Env: captured, Locals: node.Locals()})
+}
+
+// nameFunction lets a function made of the literal, which a let statement binds to the
+// name, call itself by it, capturing only what it uses if its name was all it kept the
+// whole environment for.
+func (evaluation *evaluation) nameFunction(function *object.Function, node *ast.FunctionLiteral, name string, env *object.Environment) {
+	if function.Env == env {
+		names := evaluation.freeNames(node)
+		if evaluation.usesUnboundName(names, name, env) {
+			return
+		}
+		function.Env = env.Capture(names)
+	}
+
+	// the captured environment is the function's own, so binding it there changes nothing else
+	if function.Env != env {
+		function.Env.Set(name, function)
+	}
+}
+
+// usesUnboundName reports whether one of the names the function uses is not bound yet,
+// apart from its own name, the builtins and the special forms.
+func (evaluation *evaluation) usesUnboundName(names []string, self string, env *object.Environment) bool {
+	for _, name := range names {
+		if name == self || name == QUOTE || name == UNQUOTE || name == IMPORT {
+			continue
+		}
+		if _, ok := env.Get(name); ok {
+			continue
+		}
+		if _, ok := builtins[name]; ok {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
+
+// freeNames returns the names the body of the function uses other than its parameters,
+// which its nested functions use too, remembering them for the next time the literal
+// is evaluated. Names the body binds itself are included, which only costs a lookup.
+func (evaluation *evaluation) freeNames(node *ast.FunctionLiteral) []string {
+	if names, ok := evaluation.functionNames[node]; ok {
+		return names
+	}
+
+	parameters := map[string]bool{}
+	for _, parameter := range node.Parameters {
+		parameters[parameter.Value] = true
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	ast.Inspect(node.Body, func(node ast.Node) bool {
+		if identifier, ok := node.(*ast.Identifier); ok && !parameters[identifier.Value] && !seen[identifier.Value] {
+			seen[identifier.Value] = true
+			names = append(names, identifier.Value)
+		}
+		return true
+	})
+
+	if evaluation.functionNames == nil {
+		evaluation.functionNames = map[*ast.FunctionLiteral][]string{}
+	}
+	evaluation.functionNames[node] = names
+	return names
+}
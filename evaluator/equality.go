@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"bytes"
+	"monkey/object"
+)
+
+// comparison is a pair of arrays or hashes being compared, so that comparing one that
+// contains itself ends.
+type comparison struct {
+	a, b object.Object
+}
+
+// objectsEqual reports whether two objects have the same value: integers of either size
+// by value, strings and bytes by content, and arrays and hashes element by element,
+// however deep.
+func objectsEqual(a, b object.Object) bool {
+	return deepEqual(a, b, nil)
+}
+
+// deepEqual compares two objects like objectsEqual, skipping the pairs of arrays and
+// hashes that are being compared already. The set of them is made by the first pair.
+func deepEqual(a, b object.Object, comparing map[comparison]bool) bool {
+	if isInteger(a) && isInteger(b) {
+		if a, ok := a.(*object.Integer); ok {
+			if b, ok := b.(*object.Integer); ok {
+				return a.Value == b.Value
+			}
+		}
+		return bigInteger(a).Cmp(bigInteger(b)) == 0
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Bytes:
+		return bytes.Equal(a.Value, b.(*object.Bytes).Value)
+	case *object.Array:
+		other := b.(*object.Array)
+		if a == other {
+			return true
+		}
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+
+		// a pair met again inside itself is equal if everything else about it is
+		if comparing == nil {
+			comparing = map[comparison]bool{}
+		}
+		if comparing[comparison{a, other}] {
+			return true
+		}
+		comparing[comparison{a, other}] = true
+
+		for i := range a.Elements {
+			if !deepEqual(a.Elements[i], other.Elements[i], comparing) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		other := b.(*object.Hash)
+		if a == other {
+			return true
+		}
+		if len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+
+		if comparing == nil {
+			comparing = map[comparison]bool{}
+		}
+		if comparing[comparison{a, other}] {
+			return true
+		}
+		comparing[comparison{a, other}] = true
+
+		for key, pair := range a.Pairs {
+			otherPair, ok := other.Pairs[key]
+			if !ok || !deepEqual(pair.Value, otherPair.Value, comparing) {
+				return false
+			}
+		}
+		return true
+	default:
+		// booleans and null are singletons, and functions are only equal to themselves
+		return a == b
+	}
+}
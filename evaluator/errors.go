@@ -0,0 +1,73 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+// ERROR_MESSAGE and ERROR_DATA are the keys of the hashes that stand for errors, as the
+// error builtin makes them and catch binds them.
+const (
+	ERROR_MESSAGE = "message"
+	ERROR_DATA    = "data"
+)
+
+// newErrorValue returns the hash that stands for an error with the message and data.
+func newErrorValue(message string, data object.Object) *object.Hash {
+	pairs := map[object.HashKey]object.HashPair{}
+	for key, value := range map[string]object.Object{ERROR_MESSAGE: &object.String{Value: message}, ERROR_DATA: data} {
+		str := &object.String{Value: key}
+		pairs[str.HashKey()] = object.HashPair{Key: str, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// errorValue makes an error that programs can throw, from a message and optional data
+// of any kind, defaulting to null.
+func errorValue(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	message, ok := args[0].(*object.String)
+	if !ok {
+		return newError("first argument to `error` must be STRING, got %s", args[0].Type())
+	}
+
+	data := object.Object(NULL)
+	if len(args) == 2 {
+		data = args[1]
+	}
+
+	return newErrorValue(message.Value, data)
+}
+
+// throw fails with the value, which the nearest try catches as it is. Uncaught, the
+// program fails with the message of an error made by the error builtin, or with the
+// value itself if it is not one.
+func throw(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	message := args[0].Inspect()
+	if hash, ok := args[0].(*object.Hash); ok {
+		key := &object.String{Value: ERROR_MESSAGE}
+		if pair, ok := hash.Pairs[key.HashKey()]; ok {
+			if str, ok := pair.Value.(*object.String); ok {
+				message = str.Value
+			}
+		}
+	}
+
+	return &object.Error{Message: message, Value: args[0]}
+}
+
+// CaughtValue returns what catch binds for an error: the value that was thrown, or an
+// error made from the message of an error of the interpreter, such as a bad operand.
+func CaughtValue(errObj *object.Error) object.Object {
+	if errObj.Value != nil {
+		return errObj.Value
+	}
+
+	return newErrorValue(errObj.Message, NULL)
+}
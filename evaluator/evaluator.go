@@ -0,0 +1,928 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+// Booleans and null carry no state, so a single instance of each is shared with
+// the object package, which converts Go values to them.
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+)
+
+// Eval evaluates the given node in the given environment.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, env)
+}
+
+// EvalContext evaluates the given node in the given environment, returning an
+// error object as soon as the context is cancelled.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return EvalWithOptions(ctx, node, env, Options{})
+}
+
+// Options configure an evaluation.
+type Options struct {
+	// Trace receives a line for every node evaluated and the object it produced, when set
+	Trace io.Writer
+
+	// MaxSteps is the number of nodes that can be evaluated, unlimited if zero, by the
+	// program and the tasks it spawns together, as is MaxMemory. The error
+	// of going beyond it can be caught by try, but the steps stay spent, so the handler
+	// fails in turn as soon as it takes a step.
+	MaxSteps int
+
+	// MaxDepth is the number of function calls that can be in progress at once,
+	// DEFAULT_MAX_DEPTH if zero and unlimited if negative. A call beyond it fails
+	// with an error that try can catch.
+	MaxDepth int
+
+	// CheckedArithmetic makes integer arithmetic that overflows fail with an error
+	// instead of producing a big integer. Arithmetic with big integers is unaffected.
+	CheckedArithmetic bool
+
+	// StrictBooleans makes conditions and the operand of ! fail with an error unless they
+	// are booleans, instead of counting every other value as true or false.
+	StrictBooleans bool
+
+	// MaxMemory is the approximate number of bytes of objects that can be allocated,
+	// as estimated by AllocationSize, unlimited if zero. As with MaxSteps, try can catch
+	// the error of going beyond it, after which every allocation fails again.
+	MaxMemory int
+
+	// Sandbox leaves out the builtins with side effects, which fail when called.
+	Sandbox bool
+
+	// Output receives what puts and printf print, in place of standard output, when set.
+	// Spawned tasks print to it too, so it must be safe for concurrent use.
+	Output io.Writer
+
+	// AllowExec lets programs run commands with the exec builtin, which otherwise fails
+	// when called. Sandbox mode leaves it out regardless.
+	AllowExec bool
+
+	// Hooks are called as the evaluation goes, for tools that observe it
+	Hooks Hooks
+
+	// Importer loads the modules the program imports, which it cannot if nil. The tasks
+	// the program spawns go without it.
+	Importer Importer
+
+	// File is the path of the program, against which the importer resolves its
+	// imports. It is empty for programs that do not come from a file.
+	File string
+}
+
+// Hooks observe an evaluation without changing it. Each hook is called only when set.
+type Hooks struct {
+	// OnNodeEnter is called before a node is evaluated.
+	OnNodeEnter func(node ast.Node)
+
+	// OnNodeExit is called after a node is evaluated, with the object it produced,
+	// which is nil for statements without a value.
+	OnNodeExit func(node ast.Node, result object.Object)
+
+	// OnCall is called before a function or builtin is applied to the arguments.
+	OnCall func(function object.Object, arguments []object.Object)
+}
+
+// EvalWithOptions evaluates the given node like EvalContext, configured by the options.
+func EvalWithOptions(ctx context.Context, node ast.Node, env *object.Environment, options Options) object.Object {
+	return newEvaluation(ctx, options).eval(node, env)
+}
+
+// newEvaluation returns the state of an evaluation with the options.
+func newEvaluation(ctx context.Context, options Options) *evaluation {
+	return &evaluation{ctx: ctx, options: options, budget: &Budget{}}
+}
+
+// Apply calls a function or builtin object with the given arguments, as a call expression would.
+func Apply(function object.Object, arguments ...object.Object) object.Object {
+	return NewCaller(context.Background(), Options{})(function, arguments...)
+}
+
+// NewCaller returns a caller that applies functions like Apply, configured by the options
+// as EvalWithOptions is. Its calls make up one evaluation, so they count against the
+// limits of the options together.
+func NewCaller(ctx context.Context, options Options) object.Caller {
+	return newEvaluation(ctx, options).call
+}
+
+// evaluation holds the state of a single call to EvalWithOptions.
+type evaluation struct {
+	ctx     context.Context
+	options Options
+
+	// depth counts the function calls in progress, for indenting the trace
+	depth int
+
+	// what the evaluation and its tasks have used so far, counted against the limits
+	// of the options
+	budget *Budget
+
+	// spawned is set for the evaluations of tasks, which cannot import
+	spawned bool
+
+	// functionNames holds the names each function literal evaluated so far uses
+	functionNames map[*ast.FunctionLiteral][]string
+}
+
+// eval evaluates the given node in the given environment, tracing it if asked to.
+func (evaluation *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
+	if err := evaluation.step(); err != nil {
+		return err
+	}
+
+	hooks := evaluation.options.Hooks
+	if hooks.OnNodeEnter != nil {
+		hooks.OnNodeEnter(node)
+	}
+
+	result := evaluation.evalNode(node, env)
+	if evaluation.options.Trace != nil {
+		evaluation.trace(node, result)
+	}
+	if hooks.OnNodeExit != nil {
+		hooks.OnNodeExit(node, result)
+	}
+
+	return result
+}
+
+// evalNode evaluates the given node in the given environment.
+func (evaluation *evaluation) evalNode(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	// statements
+	case *ast.Program:
+		return evaluation.evalProgram(node, env)
+	case *ast.ExpressionStatement:
+		return evaluation.eval(node.Expression, env)
+	case *ast.BlockStatement:
+		return evaluation.evalBlockStatement(node, env)
+	case *ast.ReturnStatement:
+		value := evaluation.eval(node.ReturnValue, env)
+		if isError(value) {
+			return value
+		}
+		return &object.ReturnValue{Value: value}
+	case *ast.LetStatement:
+		value := evaluation.eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		if literal, ok := node.Value.(*ast.FunctionLiteral); ok {
+			evaluation.nameFunction(value.(*object.Function), literal, node.Name.Value, env)
+		}
+		env.SetSlot(node.Name.Slot(), node.Name.Value, value)
+
+	// expressions
+	case *ast.IntegerLiteral:
+		return evaluation.allocate(object.NewInteger(node.Value))
+	case *ast.StringLiteral:
+		return evaluation.allocate(&object.String{Value: node.Value})
+	case *ast.BytesLiteral:
+		return evaluation.allocate(&object.Bytes{Value: []byte(node.Value)})
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.PrefixExpression:
+		right := evaluation.eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		if evaluation.options.StrictBooleans && node.Operator == "!" {
+			if errObj := CheckBoolean("operand of !", right); errObj != nil {
+				return locate(errObj, node.Token)
+			}
+		}
+		result := evalPrefixExpression(node.Operator, right)
+		if evaluation.options.CheckedArithmetic {
+			result = CheckOverflow(result, node.Operator, right)
+		}
+		return locate(evaluation.allocate(result), node.Token)
+	case *ast.SpawnExpression:
+		return locate(evaluation.evalSpawnExpression(node, env), node.Token)
+	case *ast.InfixExpression:
+		if node.Operator == "??" {
+			return evaluation.evalCoalesceExpression(node, env)
+		}
+
+		left := evaluation.eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := evaluation.eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		result := evalInfixExpression(node.Operator, left, right)
+		if evaluation.options.CheckedArithmetic {
+			result = CheckOverflow(result, node.Operator, left, right)
+		}
+		return locate(evaluation.allocate(result), node.Token)
+	case *ast.IfExpression:
+		return evaluation.evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return evaluation.evalTryExpression(node, env)
+	case *ast.SelectExpression:
+		return evaluation.evalSelectExpression(node, env)
+	case *ast.Identifier:
+		return locate(evaluation.evalIdentifier(node, env), node.Token)
+	case *ast.FunctionLiteral:
+		return evaluation.evalFunctionLiteral(node, env)
+	case *ast.MacroLiteral:
+		// DefineMacros has taken out the macros it could define
+		return locate(newError("macros can only be defined by top-level let statements"), node.Token)
+	case *ast.ArrayLiteral:
+		elements := evaluation.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return evaluation.allocate(&object.Array{Elements: elements})
+	case *ast.HashLiteral:
+		return evaluation.evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		left := evaluation.eval(node.Left, env)
+		if isError(left) || node.Optional && left == NULL {
+			return left
+		}
+		index := evaluation.eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return locate(evalIndexExpression(left, index), node.Token)
+	case *ast.SliceExpression:
+		left := evaluation.eval(node.Left, env)
+		if isError(left) || node.Optional && left == NULL {
+			return left
+		}
+		bounds := []object.Object{NULL, NULL}
+		for i, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				continue
+			}
+			bounds[i] = evaluation.eval(bound, env)
+			if isError(bounds[i]) {
+				return bounds[i]
+			}
+		}
+		return locate(evaluation.allocate(evalSliceExpression(left, bounds[0], bounds[1])), node.Token)
+	case *ast.CallExpression:
+		if isSpecialForm(node, QUOTE) {
+			return locate(evaluation.quote(node, env), node.Token)
+		}
+		if isSpecialForm(node, IMPORT) {
+			return locate(evaluation.importModule(node, env), node.Token)
+		}
+		function := evaluation.eval(node.Function, env)
+		if isError(function) || node.Optional && function == NULL {
+			return function
+		}
+		arguments := evaluation.evalExpressions(node.Arguments, env)
+		if len(arguments) == 1 && isError(arguments[0]) {
+			return arguments[0]
+		}
+		var name string
+		if identifier, ok := node.Function.(*ast.Identifier); ok {
+			name = identifier.Value
+		}
+		return traceCall(evaluation.applyFunction(function, arguments), name, node.Token)
+	case *ast.MethodCallExpression:
+		receiver := evaluation.eval(node.Receiver, env)
+		if isError(receiver) {
+			return receiver
+		}
+		method := evalMethod(receiver, node.Method.Value)
+		if isError(method) {
+			return locate(method, node.Token)
+		}
+		arguments := evaluation.evalExpressions(node.Arguments, env)
+		if len(arguments) == 1 && isError(arguments[0]) {
+			return arguments[0]
+		}
+		return traceCall(evaluation.applyFunction(method, arguments), node.Method.Value, node.Token)
+	}
+
+	return nil
+}
+
+// evalProgram evaluates the statements of a program, unwrapping return values and stopping at errors.
+func (evaluation *evaluation) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		result = evaluation.eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalBlockStatement evaluates the statements of a block, leaving return values wrapped so they keep unwinding.
+func (evaluation *evaluation) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		if err := evaluation.interrupted(); err != nil {
+			return err
+		}
+
+		result = evaluation.eval(statement, env)
+
+		if result != nil {
+			resultType := result.Type()
+			if resultType == object.RETURN_VALUE_OBJ || resultType == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	// an empty block, or one ending in a let statement, has no value of its own
+	if result == nil {
+		return NULL
+	}
+
+	return result
+}
+
+// evalPrefixExpression evaluates a prefix operator applied to the right operand.
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	if host, ok := right.(*object.HostObject); ok {
+		if apply, ok := host.HostType.PrefixOperators[operator]; ok {
+			return apply(right)
+		}
+	}
+
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+// evalBangOperatorExpression negates the truthiness of the operand.
+func evalBangOperatorExpression(right object.Object) object.Object {
+	return nativeBoolToBooleanObject(!isTruthy(right))
+}
+
+// evalMinusPrefixOperatorExpression negates an integer operand.
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		if value, ok := subInt64(0, right.Value); ok {
+			return object.NewInteger(value)
+		}
+		return &object.BigInteger{Value: new(big.Int).Neg(big.NewInt(right.Value))}
+	case *object.BigInteger:
+		return &object.BigInteger{Value: new(big.Int).Neg(right.Value)}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+// evalInfixExpression evaluates an infix operator applied to the left and right operands.
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	// an operator of a host type applies when either operand is of that type
+	for _, operand := range []object.Object{left, right} {
+		if host, ok := operand.(*object.HostObject); ok {
+			if apply, ok := host.HostType.InfixOperators[operator]; ok {
+				return apply(left, right)
+			}
+		}
+	}
+
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	case isInteger(left) && isInteger(right):
+		return evalBigIntegerInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	case left.Type() == object.BYTES_OBJ && right.Type() == object.BYTES_OBJ:
+		return evalBytesInfixExpression(operator, left, right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case operator == "==":
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
+	case operator == "!=":
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalIntegerInfixExpression evaluates an infix operator applied to two integers. The
+// arithmetic that overflows is done again with big integers.
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		if sum, ok := addInt64(leftValue, rightValue); ok {
+			return object.NewInteger(sum)
+		}
+	case "-":
+		if difference, ok := subInt64(leftValue, rightValue); ok {
+			return object.NewInteger(difference)
+		}
+	case "*":
+		if product, ok := mulInt64(leftValue, rightValue); ok {
+			return object.NewInteger(product)
+		}
+	case "/":
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		if quotient, ok := divInt64(leftValue, rightValue); ok {
+			return object.NewInteger(quotient)
+		}
+	case "%":
+		if rightValue == 0 {
+			return newError("modulo by zero")
+		}
+		// the remainder has the sign of the dividend, as division truncates
+		return object.NewInteger(leftValue % rightValue)
+	case "<":
+		return nativeBoolToBooleanObject(leftValue < rightValue)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	return evalBigIntegerInfixExpression(operator, left, right)
+}
+
+// evalStringInfixExpression evaluates an infix operator applied to two strings.
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftValue + rightValue}
+	case "<":
+		// strings are ordered by their code points, as sort orders them
+		return nativeBoolToBooleanObject(leftValue < rightValue)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalIndexExpression evaluates indexing into the left operand.
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
+	case left.Type() == object.BYTES_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalBytesIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return evalModuleIndexExpression(left, index)
+	case isHostObject(left) && index.Type() == object.STRING_OBJ:
+		return evalMethodExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// evalArrayIndexExpression returns the element at the index, or null if the index is out of range.
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	elements := array.(*object.Array).Elements
+	position := index.(*object.Integer).Value
+
+	if position < 0 || position >= int64(len(elements)) {
+		return NULL
+	}
+
+	return elements[position]
+}
+
+// evalStringIndexExpression returns the character at the index as a string, or null if
+// the index is out of range. A negative index counts from the end of the string.
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	characters := []rune(str.(*object.String).Value)
+	position := index.(*object.Integer).Value
+
+	if position < 0 {
+		position += int64(len(characters))
+	}
+	if position < 0 || position >= int64(len(characters)) {
+		return NULL
+	}
+
+	return &object.String{Value: string(characters[position])}
+}
+
+// evalSliceExpression returns the characters of a string or the elements of an array
+// from the start up to the end, which default to the whole of it. Negative bounds count
+// from the end, and bounds out of range are clamped, so a slice is never an error.
+func evalSliceExpression(left, start, end object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.String:
+		characters := []rune(left.Value)
+		from, to, errObj := sliceBounds(len(characters), start, end)
+		if errObj != nil {
+			return errObj
+		}
+		return &object.String{Value: string(characters[from:to])}
+	case *object.Bytes:
+		from, to, errObj := sliceBounds(len(left.Value), start, end)
+		if errObj != nil {
+			return errObj
+		}
+		return &object.Bytes{Value: bytes.Clone(left.Value[from:to])}
+	case *object.Array:
+		from, to, errObj := sliceBounds(len(left.Elements), start, end)
+		if errObj != nil {
+			return errObj
+		}
+		return copyElements(left.Elements[from:to])
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+}
+
+// sliceBounds returns the positions the bounds of a slice stand for in a string or
+// array of the length, where null bounds stand for its start and end.
+func sliceBounds(length int, start, end object.Object) (int, int, *object.Error) {
+	from, errObj := sliceBound(length, start, 0)
+	if errObj != nil {
+		return 0, 0, errObj
+	}
+	to, errObj := sliceBound(length, end, length)
+	if errObj != nil {
+		return 0, 0, errObj
+	}
+
+	return from, max(from, to), nil
+}
+
+// sliceBound returns the position a bound stands for, clamped to the length.
+func sliceBound(length int, bound object.Object, missing int) (int, *object.Error) {
+	if bound == NULL {
+		return missing, nil
+	}
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, newError("slice bounds must be INTEGER, got %s", bound.Type())
+	}
+
+	position := integer.Value
+	if position < 0 {
+		position += int64(length)
+	}
+
+	return int(min(max(position, 0), int64(length))), nil
+}
+
+// evalHashIndexExpression returns the value for the key, or null if the hash has no such key.
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hash.(*object.Hash).Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+// evalModuleIndexExpression returns the binding the module exports under the name.
+func evalModuleIndexExpression(module, index object.Object) object.Object {
+	name := index.(*object.String).Value
+
+	value, ok := module.(*object.Module).Exports[name]
+	if !ok {
+		return newError("module %s does not export %s", module.(*object.Module).Name, name)
+	}
+
+	return value
+}
+
+// evalMethodExpression returns the method of a host object named by the index.
+func evalMethodExpression(host, index object.Object) object.Object {
+	return evalMethod(host, index.(*object.String).Value)
+}
+
+// isHostObject reports whether the object is of a type defined by the host.
+func isHostObject(obj object.Object) bool {
+	_, ok := obj.(*object.HostObject)
+	return ok
+}
+
+// evalTryExpression evaluates the body, and if it fails, the handler with the error bound
+// to the parameter like a let statement would bind it. Fatal errors are not caught.
+func (evaluation *evaluation) evalTryExpression(expression *ast.TryExpression, env *object.Environment) object.Object {
+	evaluated := evaluation.eval(expression.Body, env)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Fatal {
+		return evaluated
+	}
+
+	env.SetSlot(expression.Parameter.Slot(), expression.Parameter.Value, CaughtValue(errObj))
+	return evaluation.eval(expression.Handler, env)
+}
+
+// evalIfExpression evaluates the consequence or alternative depending on the condition.
+func (evaluation *evaluation) evalIfExpression(expression *ast.IfExpression, env *object.Environment) object.Object {
+	condition := evaluation.eval(expression.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if evaluation.options.StrictBooleans {
+		if errObj := CheckBoolean("condition", condition); errObj != nil {
+			return locate(errObj, ast.StartToken(expression.Condition))
+		}
+	}
+
+	if isTruthy(condition) {
+		return evaluation.eval(expression.Consequence, env)
+	} else if expression.Alternative != nil {
+		return evaluation.eval(expression.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+// evalCoalesceExpression evaluates to the left operand of ??, unless it is null, in which
+// case the right operand is evaluated instead.
+func (evaluation *evaluation) evalCoalesceExpression(expression *ast.InfixExpression, env *object.Environment) object.Object {
+	left := evaluation.eval(expression.Left, env)
+	if left != NULL {
+		return left
+	}
+
+	return evaluation.eval(expression.Right, env)
+}
+
+// evalIdentifier looks up the value bound to an identifier.
+func (evaluation *evaluation) evalIdentifier(identifier *ast.Identifier, env *object.Environment) object.Object {
+	if value, ok := env.GetSlot(identifier.Slot(), identifier.Value); ok {
+		return value
+	}
+
+	if builtin, ok := LookupBuiltinWith(identifier.Value, evaluation.options); ok {
+		return builtin
+	}
+
+	// the names a typo could have been meant for are only gathered once it failed
+	return newError("%s", NotFoundMessage(identifier.Value, append(env.Names(), BuiltinNames()...)))
+}
+
+// evalHashLiteral evaluates the keys and values of a hash literal in the order they are
+// written, each key before its value, and makes a hash of them.
+func (evaluation *evaluation) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	keysAndValues := make([]object.Object, 0, 2*len(node.Pairs))
+	for _, pair := range node.Pairs {
+		for _, expression := range []ast.Expression{pair.Key, pair.Value} {
+			evaluated := evaluation.eval(expression, env)
+			if isError(evaluated) {
+				return evaluated
+			}
+			keysAndValues = append(keysAndValues, evaluated)
+		}
+	}
+
+	return evaluation.allocate(locate(NewHash(keysAndValues), node.Token))
+}
+
+// evalExpressions evaluates a list of expressions from left to right, stopping at the first error.
+func (evaluation *evaluation) evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, expression := range expressions {
+		evaluated := evaluation.eval(expression, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// applyFunction calls a function object with the given arguments.
+func (evaluation *evaluation) applyFunction(function object.Object, arguments []object.Object) object.Object {
+	if evaluation.options.Hooks.OnCall != nil {
+		evaluation.options.Hooks.OnCall(function, arguments)
+	}
+
+	if builtin, ok := function.(*object.Builtin); ok {
+		if builtin.HigherOrderFn != nil {
+			return evaluation.allocate(builtin.HigherOrderFn(evaluation.call, arguments...))
+		}
+		if builtin.ContextFn != nil {
+			return evaluation.allocate(builtin.ContextFn(evaluation.ctx, arguments...))
+		}
+		return evaluation.allocate(builtin.Fn(arguments...))
+	}
+
+	fn, ok := function.(*object.Function)
+	if !ok {
+		return newError("not a function: %s", function.Type())
+	}
+
+	// function calls are where runaway recursion spends its time, so check for cancellation here
+	if err := evaluation.interrupted(); err != nil {
+		return err
+	}
+
+	if len(arguments) != len(fn.Parameters) {
+		return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(arguments))
+	}
+
+	if limit := MaxDepth(evaluation.options); limit > 0 && evaluation.depth >= limit {
+		return newError("maximum recursion depth exceeded: %d calls", limit)
+	}
+	if err := evaluation.charge(ENVIRONMENT_SIZE + ELEMENT_SIZE*len(arguments)); err != nil {
+		return err
+	}
+
+	// bind the arguments in the slots of a new environment enclosed by the function's environment
+	extendedEnv := object.NewLocalEnvironment(fn.Env, fn.Locals)
+	for i, parameter := range fn.Parameters {
+		extendedEnv.SetSlot(parameter.Slot(), parameter.Value, arguments[i])
+	}
+
+	evaluation.depth++
+	evaluated := evaluation.eval(fn.Body, extendedEnv)
+	evaluation.depth--
+
+	// unwrap the return value so it does not keep unwinding the caller
+	if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return evaluated
+}
+
+// call applies a function for a builtin that calls back into the program.
+func (evaluation *evaluation) call(function object.Object, args ...object.Object) object.Object {
+	return evaluation.applyFunction(function, args)
+}
+
+// interrupted returns an error object if the evaluation's context has been cancelled.
+func (evaluation *evaluation) interrupted() *object.Error {
+	select {
+	case <-evaluation.ctx.Done():
+		return newFatalError("evaluation interrupted: %s", evaluation.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// locate records the position of the token on an error that does not have one yet, so
+// errors point at the innermost expression that failed.
+func locate(obj object.Object, tok token.Token) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Line == 0 {
+		err.Line = tok.Line
+		err.Column = tok.Column
+	}
+
+	return obj
+}
+
+// traceCall locates an error of a call of the function with the name, empty if it has
+// none, at the call, unless it happened inside the function called and has a position
+// already, in which case the call joins its stack trace.
+func traceCall(result object.Object, name string, call token.Token) object.Object {
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Line == 0 {
+		return locate(result, call)
+	}
+
+	errObj.Trace = append(errObj.Trace, object.Call{Function: name, Line: call.Line, Column: call.Column})
+
+	return errObj
+}
+
+// nativeBoolToBooleanObject converts a Go bool to a Boolean object.
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+// isTruthy reports whether an object counts as true in a condition.
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+// newError creates a new error object with a formatted message.
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// newFatalError creates an error like newError that try cannot catch, for the
+// cancellation of the evaluation, which a program must not be able to get around.
+func newFatalError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Fatal: true}
+}
+
+// isError checks if the given object is an error.
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
+
+// InfixOperation applies an infix operator to two operands, returning an error object
+// if the operator does not support them. The virtual machine uses it to stay in step
+// with the evaluator.
+func InfixOperation(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+// PrefixOperation applies a prefix operator to an operand, returning an error object
+// if the operator does not support it.
+func PrefixOperation(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// IndexOperation indexes the left object, returning an error object if it cannot be indexed.
+func IndexOperation(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// MethodOperation returns the method of the receiver with the name bound to it, returning
+// an error object if it has no such method.
+func MethodOperation(receiver object.Object, name string) object.Object {
+	return evalMethod(receiver, name)
+}
+
+// SliceOperation slices the left object between the bounds, which are null where they
+// are left out, returning an error object if it cannot be sliced.
+func SliceOperation(left, start, end object.Object) object.Object {
+	return evalSliceExpression(left, start, end)
+}
+
+// IsTruthy reports whether an object counts as true in a condition.
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// CheckBoolean returns an error unless the object is a boolean, for the strict mode in
+// which only booleans are true or false. The description says where the object is used.
+func CheckBoolean(description string, obj object.Object) *object.Error {
+	if obj.Type() == object.BOOLEAN_OBJ {
+		return nil
+	}
+
+	return newError("%s must be BOOLEAN, got %s", description, obj.Type())
+}
@@ -0,0 +1,2262 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"17 % 5", 2},
+		{"-17 % 5", -2},
+		{"17 % -5", 2},
+		{"2 + 10 % 4 * 3", 8},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 != 2", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"3 >= 2", true},
+		{"-1 >= -2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == true", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { if (10 > 1) { return true + false; } return 1; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"lenght([])", "identifier not found: lenght — did you mean len?"},
+		{"let counter = 1; countr + 1", "identifier not found: countr — did you mean counter?"},
+		{"fn(value) { valeu }(1)", "identifier not found: valeu — did you mean value?"},
+		{"let f = fn(x) { x }; f(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{"5()", "not a function: INTEGER"},
+		{"5 / 0", "division by zero"},
+		{"5 % (2 - 2)", "modulo by zero"},
+		{"big(5) / 0", "division by zero"},
+		{"big(5) % 0", "modulo by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"value", "len", "length", "puts", "push", "first", "x"}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"lenght", "length"},
+		{"lne", "len"},
+		{"le", "len"},
+		{"pust", "puts"},
+		{"psh", "push"},
+		{"frist", "first"},
+		{"vlaue", "value"},
+		{"Value", "value"},
+		// names that only share some letters are not suggested
+		{"path", ""},
+		{"foobar", ""},
+		{"y", ""},
+		{"xs", "x"},
+	}
+
+	for _, tt := range tests {
+		suggestion, ok := Suggest(tt.name, candidates)
+		if suggestion != tt.expected || ok != (tt.expected != "") {
+			t.Errorf("wrong suggestion for %q. expected=%q, got=%q (%t)", tt.name, tt.expected, suggestion, ok)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"5 + true;", 1, 3},
+		{"let x = 1;\n  -true", 2, 3},
+		{"foobar", 1, 1},
+		{"let f = fn(x) {\n  x + missing\n};\nf(1)", 2, 7},
+		{"let f = fn(x) { x };\nf(1, 2)", 2, 2},
+		{`len(1)`, 1, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Line != tt.expectedLine || errObj.Column != tt.expectedColumn {
+			t.Errorf("wrong position for %q. expected=%d:%d, got=%d:%d",
+				tt.input, tt.expectedLine, tt.expectedColumn, errObj.Line, errObj.Column)
+		}
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"1 + true", nil},
+		{"let f = fn() { 1 + true };\nf()", []string{"in f, called at 2:2"}},
+		{"let inner = fn(x) { x + true };\nlet outer = fn(x) { inner(x) };\nouter(1)", []string{
+			"in inner, called at 2:26",
+			"in outer, called at 3:6",
+		}},
+		{"fn() { 1 + true }()", []string{"in anonymous function, called at 1:18"}},
+		{"let f = fn(x) { x + true };\nmap([1], f)", []string{"in map, called at 2:4"}},
+		{"let f = fn(x) { len(x) };\nf(1)", []string{"in f, called at 2:2"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		lines := errObj.TraceLines(func(line, column int) string { return fmt.Sprintf("%d:%d", line, column) })
+		if strings.Join(lines, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong stack trace for %q. expected=%q, got=%q", tt.input, tt.expected, lines)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	if fn.Body.String() != "(x + 2)" {
+		t.Fatalf("body is not %q. got=%q", "(x + 2)", fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionsWithoutValue(t *testing.T) {
+	tests := []string{
+		"fn() { }()",
+		"fn() { let x = 1; }()",
+		"if (true) { }",
+	}
+
+	for _, input := range tests {
+		testNullObject(t, testEval(input))
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestClosureCaptures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)", "6"},
+		{"let f = fn() { let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5) }; f()", "120"},
+		{`let f = fn() {
+  let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+  let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+  even(10)
+}; f()`, "true"},
+		{"let f = fn() { fn() { later() } }; let later = fn() { 7 }; f()()", "7"},
+		{"let f = fn(len) { fn() { len } }; f(3)()", "3"},
+		// the binding is captured when the function is made, as the compiler does
+		{"let f = fn() { let x = 1; let g = fn() { x }; let x = 2; g() }; f()", "1"},
+		{"let f = fn() { fn() { len([1, 2]) } }; f()()", "2"},
+		{"let f = fn() { fn() { missing } }; f()()", "ERROR: identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestClosuresKeepOnlyWhatTheyUse(t *testing.T) {
+	env := object.NewEnvironment()
+	input := "let make = fn(unused) { let large = [1, 2, 3]; let x = 1; fn() { x } }; let f = make(5);"
+	Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	value, _ := env.Get("f")
+	function, ok := value.(*object.Function)
+	if !ok {
+		t.Fatalf("f is not a function. got=%T", value)
+	}
+	if x, ok := function.Env.Get("x"); !ok || x.Inspect() != "1" {
+		t.Errorf("closure lost the binding of x. got=%v", x)
+	}
+	for _, name := range []string{"large", "unused"} {
+		if _, ok := function.Env.Get(name); ok {
+			t.Errorf("closure keeps %s, which it does not use", name)
+		}
+	}
+	if _, ok := function.Env.Get("make"); !ok {
+		t.Errorf("closure lost the global environment")
+	}
+}
+
+func TestLocalSlots(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = fn(a, b) { let c = a + b; c * 2 }; f(1, 2)", 6},
+		{"let f = fn(a) { let a = a + 1; a }; f(1)", 2},
+		{"let x = 10; let f = fn() { let y = x; let x = 1; y + x }; f()", 11},
+		{"let f = fn(a) { if (a > 0) { let b = a; } b }; f(3)", 3},
+		{"let f = fn() { try { 1 / 0 } catch (e) { len(e[\"message\"]) } }; f()", 16},
+		{"let f = fn(a) { fn(b) { a + b } }; f(1)(2)", 3},
+		{"let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(4)", 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let t = spawn fn() { 1 + 2 }; t.join()", 3},
+		{"let t = spawn fn() { 1 + 2 }; t.join(); t.result()", 3},
+		{"let f = fn(n) { spawn fn() { n * 2 } }; reduce(map([1, 2, 3], f), 0, fn(sum, t) { sum + t.join() })", 12},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; (spawn fn() { fib(15) }).join()", 610},
+		// the task sees the bindings as they were when it was spawned
+		{"let x = 1; let t = spawn fn() { x }; let x = 2; t.join() + x", 3},
+		{"let t = spawn fn() { let y = 1; y }; t.join(); y", "identifier not found: y"},
+		{"(spawn fn() { 1 / 0 }).join()", "division by zero"},
+		{"spawn 1", "cannot spawn INTEGER"},
+		{`(spawn fn() { import("std/list") }).join()`, "import is not available in spawned tasks"},
+		{"(spawn fn(x) { x }).join()", "wrong number of arguments: want=1, got=0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestChannels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let ch = channel(1); send(ch, 5); recv(ch)", 5},
+		{"let ch = channel(); spawn fn() { send(ch, 1 + 2) }; recv(ch)", 3},
+		{"let ch = channel(2); ch.send(1); ch.send(2); ch.recv() * 10 + ch.recv()", 12},
+		{"let ch = channel(); let t = spawn fn() { ch.recv() * 2 }; ch.send(21); t.join()", 42},
+		{`let ch = channel(3);
+		let producer = spawn fn() { map([1, 2, 3], fn(n) { send(ch, n) }); close(ch) };
+		let sum = fn(total) { let n = recv(ch) ?? -1; if (n < 0) { total } else { sum(total + n) } };
+		sum(0)`, 6},
+		// a closed channel still gives the values it holds, then null
+		{"let ch = channel(1); send(ch, 1); close(ch); [recv(ch), recv(ch)]", "[1, null]"},
+		// a function sent to another task does not share the bindings of the sender
+		{"let x = 1; let ch = channel(1); send(ch, fn() { x }); let x = 2; recv(ch)() + x", 3},
+		{"let ch = channel(); close(ch); send(ch, 1)", "send on closed channel"},
+		{"let ch = channel(); close(ch); close(ch)", "close of closed channel"},
+		{"channel(-1)", "capacity of channel must be from 0 to 1048576, got -1"},
+		{`channel("a")`, "argument to `channel` must be INTEGER, got STRING"},
+		{"send(1, 2)", "first argument to `send` must be CHANNEL, got INTEGER"},
+		{"recv([])", "argument to `recv` must be CHANNEL, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestSelectExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = channel(1); let b = channel(1); send(b, 2); select { v = a => v, v = b => v * 10 }", 20},
+		{"let a = channel(); select { v = a => v, timeout(10) => 7 }", 7},
+		{"let a = channel(); spawn fn() { send(a, 5) }; select { v = a => v + 1, timeout(5000) => 0 }", 6},
+		// a closed channel gives null
+		{"let a = channel(); close(a); select { v = a => v ?? 3 }", 3},
+		{"let a = channel(1); send(a, 1); select { a => {} }", "null"},
+		{"let a = channel(1); send(a, 4); let f = fn() { select { x = a => { let y = x * 2; y } } }; f()", 8},
+		{"let a = channel(1); send(a, 1); select { v = a => v }; v", 1},
+		{"let loop = fn(ch, total) { select { v = ch => loop(ch, total + v), timeout(10) => total } }; let ch = channel(3); map([1, 2, 3], fn(n) { ch.send(n) }); loop(ch, 0)", 6},
+		{"select { 1 => 2 }", "select case must be CHANNEL, got INTEGER"},
+		{"select { v = channel() => v, undefined => 1 }", "identifier not found: undefined"},
+		{`timeout("1")`, "argument to `timeout` must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestChannelCancellation(t *testing.T) {
+	for _, input := range []string{"recv(channel())", "select { v = channel() => v }", "select {}"} {
+		program := parser.New(lexer.New(input)).ParseProgram()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		evaluated := EvalContext(ctx, program, object.NewEnvironment())
+		cancel()
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T(%+v)", input, evaluated, evaluated)
+		}
+
+		expected := "evaluation interrupted: context deadline exceeded"
+		if errObj.Message != expected || !errObj.Fatal {
+			t.Errorf("wrong error for %q. expected fatal %q, got=%q (fatal=%t)", input, expected, errObj.Message, errObj.Fatal)
+		}
+	}
+}
+
+func TestSharedBooleansAndNull(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected object.Object
+	}{
+		{"1 < 2", TRUE},
+		{"!true", FALSE},
+		{`"a" == "b"`, FALSE},
+		{"[1] == [1]", TRUE},
+		{"is_frozen([])", FALSE},
+		{"if (false) { 1 }", NULL},
+		{"[1][5]", NULL},
+		{`json_parse("[true, null]")[0]`, TRUE},
+		{`json_parse("[true, null]")[1]`, NULL},
+	}
+
+	for _, tt := range tests {
+		if evaluated := testEval(tt.input); evaluated != tt.expected {
+			t.Errorf("%q did not evaluate to the shared %s. got=%p, want=%p", tt.input, tt.expected.Inspect(), evaluated, tt.expected)
+		}
+	}
+}
+
+func TestPersistentEnvironment(t *testing.T) {
+	env := object.NewEnvironment()
+
+	for _, input := range []string{"let x = 5;", "let double = fn(n) { n * 2 };"} {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		Eval(program, env)
+	}
+
+	program := parser.New(lexer.New("double(x) + 1")).ParseProgram()
+	testIntegerObject(t, Eval(program, env), 11)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, "{}"},
+		{`let two = "two"; {"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6}`,
+			"{4: 4, false: 6, one: 1, three: 3, true: 5, two: 2}"},
+		{`{"a": 1, "a": 2}`, "{a: 2}"},
+		{`{"h": {"a": [1, 2]}}["h"]["a"][1]`, "2"},
+		{`let f = fn(x) { {"x": x} }; f(3)["x"]`, "3"},
+		{`{"f": fn(x) { x * 2 }}["f"](21)`, "42"},
+		// keys and values are evaluated in the order they are written
+		{`let ch = channel(4); let s = fn(x) { send(ch, x); x }; {s(1): s(2), s(3): s(4)}; [recv(ch), recv(ch), recv(ch), recv(ch)]`, "[1, 2, 3, 4]"},
+		{`{[1]: 2}`, "ERROR: unusable as hash key: ARRAY"},
+		{`{"a": 1 + true}`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStringIndexAndSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"monkey"[0]`, "m"},
+		{`"monkey"[5]`, "y"},
+		{`"monkey"[-1]`, "y"},
+		{`"monkey"[-6]`, "m"},
+		{`"monkey"[6]`, nil},
+		{`"monkey"[-7]`, nil},
+		{`"héllo"[1]`, "é"},
+		{`"monkey"[1:4]`, "onk"},
+		{`"monkey"[:3]`, "mon"},
+		{`"monkey"[3:]`, "key"},
+		{`"monkey"[:]`, "monkey"},
+		{`"monkey"[-3:]`, "key"},
+		{`"monkey"[:-3]`, "mon"},
+		{`"monkey"[4:2]`, ""},
+		{`"monkey"[-100:100]`, "monkey"},
+		{`"héllo"[1:3]`, "él"},
+		{`let s = "monkey"; s[1 + 1:len(s) - 1]`, "nke"},
+		{`[1, 2, 3, 4][1:3]`, []int{2, 3}},
+		{`[1, 2, 3, 4][-2:]`, []int{3, 4}},
+		{`[1, 2, 3][5:]`, []int{}},
+		{`"monkey"["m"]`, "ERROR: index operator not supported: STRING"},
+		{`"monkey"["a":]`, "ERROR: slice bounds must be INTEGER, got STRING"},
+		{`5[1:]`, "ERROR: slice operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok || len(array.Elements) != len(expected) {
+				t.Errorf("wrong result for %q. expected=%v, got=%s", tt.input, expected, evaluated.Inspect())
+				continue
+			}
+			for i, element := range expected {
+				testIntegerObject(t, array.Elements[i], int64(element))
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+		{"len([1, 2, 3])", 3},
+		{"len([])", 0},
+		{"[][0]", nil},
+		{"[[1, 2], [3]][0][1]", 2},
+		{"[1, fn(x) { x * 2 }][1](5)", 10},
+		{"[1][true]", "ERROR: index operator not supported: ARRAY"},
+		{"1[0]", "ERROR: index operator not supported: INTEGER"},
+		{"[1, 2] + [3]", "ERROR: unknown operator: ARRAY + ARRAY"},
+		{"-[1]", "ERROR: unknown operator: -ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{1: 5}["1"]`, nil},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`{"foo": 5}[[1]]`, "ERROR: unusable as hash key: ARRAY"},
+		{`{"foo": 5}[fn(x) { x }]`, "ERROR: unusable as hash key: FUNCTION"},
+		{`hash["name"]`, "monkey"},
+		{`hash["tags"][1]`, "b"},
+		{`hash["missing"]`, nil},
+	}
+
+	hash, err := object.FromGo(map[string]any{"name": "monkey", "tags": []any{"a", "b"}})
+	if err != nil {
+		t.Fatalf("FromGo failed: %s", err)
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		env := object.NewEnvironment()
+		env.Set("hash", hash)
+
+		evaluated := Eval(program, env)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestEvalContextCancellation(t *testing.T) {
+	input := `
+let loop = fn(n) { loop(n + 1) };
+loop(0);`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	evaluated := EvalContext(ctx, program, object.NewEnvironment())
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := "evaluation interrupted: context deadline exceeded"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+
+	// the builtins that wait stop waiting too
+	for _, input := range []string{`sleep(60000)`, `exec("sleep", ["60"])`} {
+		program := parser.New(lexer.New(input)).ParseProgram()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		start := time.Now()
+		evaluated := EvalWithOptions(ctx, program, object.NewEnvironment(), Options{AllowExec: true})
+		cancel()
+
+		if evaluated.Inspect() != "ERROR: "+expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", input, expected, evaluated.Inspect())
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("%q ran on for %s after the timeout", input, elapsed)
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { 1 + "a" } catch (e) { e["message"] }`, "type mismatch: INTEGER + STRING"},
+		{`let f = fn(n) { 10 / n }; try { f(0) } catch (e) { e["message"] }`, "division by zero"},
+		{`try { [1][0][0] } catch (e) { e }`, "{data: null, message: index operator not supported: INTEGER}"},
+		{`try { throw(error("boom", [1, 2])) } catch (e) { e["data"] }`, "[1, 2]"},
+		{`try { throw("plain") } catch (e) { e }`, "plain"},
+		{`try { } catch (e) { 2 }`, "null"},
+		{`1 + try { throw(1) } catch (e) { e + 1 }`, "3"},
+		{`let f = fn() { throw(error("deep")) }; let g = fn() { f() }; try { g() } catch (e) { e["message"] }`, "deep"},
+		{`let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f()`, "1"},
+		{`try { throw(1) } catch (e) { try { throw(e + 1) } catch (e) { e * 10 } }`, "20"},
+		{`try { map([1, 0], fn(x) { if (x == 0) { throw("zero") } else { x } }) } catch (e) { e }`, "zero"},
+		{`try { throw(1) } catch (e) { throw(error("again")) }`, "ERROR: again"},
+		{`try { throw(1) } catch (e) { 2 }; e`, "1"},
+		{`throw(error("uncaught", 1))`, "ERROR: uncaught"},
+		{`throw([1])`, "ERROR: [1]"},
+		{`error(1)`, "ERROR: first argument to `error` must be STRING, got INTEGER"},
+		{`error("no data")`, "{data: null, message: no data}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// the limits of an evaluation can be caught
+	program := parser.New(lexer.New(`let f = fn(n) { f(n + 1) }; try { f(0) } catch (e) { 0 }`)).ParseProgram()
+	evaluated := EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{MaxDepth: 20})
+	testIntegerObject(t, evaluated, 0)
+
+	// but the steps stay spent, so the handler fails in turn
+	evaluated = EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{MaxSteps: 50})
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "step limit exceeded: 50 steps" {
+		t.Errorf("expected the step limit to be exceeded again. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		options  Options
+		expected string
+	}{
+		{"let f = fn(n) { f(n + 1) }; f(0)", Options{MaxSteps: 50}, "step limit exceeded: 50 steps"},
+		{"let f = fn(n) { f(n + 1) }; f(0)", Options{MaxDepth: 20}, "maximum recursion depth exceeded: 20 calls"},
+		{"let f = fn(n) { f(n + 1) }; f(0)", Options{}, "maximum recursion depth exceeded: 10000 calls"},
+		{"let f = fn(s) { f(s + s) }; f(\"ab\")", Options{MaxMemory: 4096}, "memory limit exceeded: 4096 bytes"},
+		{"let f = fn(a) { f([a, a]) }; f(1)", Options{MaxMemory: 4096}, "memory limit exceeded: 4096 bytes"},
+		// tasks draw on the budget of the program that spawns them
+		{"let f = fn() { let g = fn(n) { if (n == 0) { 0 } else { g(n - 1) } }; g(50) }; [spawn f].map(fn(t) { t.join() })[0]", Options{MaxSteps: 1000}, ""},
+		{"let f = fn() { let g = fn(n) { if (n == 0) { 0 } else { g(n - 1) } }; g(50) }; [spawn f, spawn f, spawn f, spawn f].map(fn(t) { t.join() })", Options{MaxSteps: 1000}, "step limit exceeded: 1000 steps"},
+		{"let f = fn() { let g = fn(s, n) { if (n == 0) { 0 } else { g(s + \"xxxxxxxxxx\", n - 1) } }; g(\"\", 40) }; [spawn f].map(fn(t) { t.join() })[0]", Options{MaxMemory: 20000}, ""},
+		{"let f = fn() { let g = fn(s, n) { if (n == 0) { 0 } else { g(s + \"xxxxxxxxxx\", n - 1) } }; g(\"\", 40) }; [spawn f, spawn f, spawn f, spawn f].map(fn(t) { t.join() })", Options{MaxMemory: 20000}, "memory limit exceeded: 20000 bytes"},
+		// within the limits the program runs as usual
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(5)", Options{MaxSteps: 200, MaxDepth: 6, MaxMemory: 1024}, ""},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(20000)", Options{MaxDepth: -1}, ""},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithOptions(context.Background(), program, object.NewEnvironment(), tt.options)
+
+		if tt.expected == "" {
+			testIntegerObject(t, evaluated, 0)
+			continue
+		}
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`puts("escaped")`, "puts is not available in sandbox mode"},
+		{`let p = puts; p(1)`, "puts is not available in sandbox mode"},
+		{`sleep(1000)`, "sleep is not available in sandbox mode"},
+		{`exec("true")`, "exec is not available in sandbox mode"},
+		{`printf("{}", 1)`, "printf is not available in sandbox mode"},
+		{`bench("b", fn() { 1 })`, "bench is not available in sandbox mode"},
+		{`len("pure")`, 4},
+		// a binding of the program may still use the name
+		{`let puts = fn(x) { x }; puts(5)`, 5},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{Sandbox: true})
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestHostObjects(t *testing.T) {
+	// money counts cents, and adds up only with money
+	var money *object.HostType
+	money = &object.HostType{
+		Name:    "MONEY",
+		Inspect: func(value any) string { return fmt.Sprintf("$%.2f", float64(value.(int64))/100) },
+		Methods: map[string]object.Method{
+			"cents": func(receiver *object.HostObject, args ...object.Object) object.Object {
+				return &object.Integer{Value: receiver.Value.(int64)}
+			},
+		},
+		InfixOperators: map[string]func(left, right object.Object) object.Object{
+			"+": func(left, right object.Object) object.Object {
+				l, lok := left.(*object.HostObject)
+				r, rok := right.(*object.HostObject)
+				if !lok || !rok {
+					return newError("can only add money to money")
+				}
+				return money.New(l.Value.(int64) + r.Value.(int64))
+			},
+		},
+		PrefixOperators: map[string]func(right object.Object) object.Object{
+			"-": func(right object.Object) object.Object {
+				return money.New(-right.(*object.HostObject).Value.(int64))
+			},
+		},
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"price", "$1.50"},
+		{"price + price", "$3.00"},
+		{"(price + tip)[\"cents\"]()", "175"},
+		{"-tip", "$-0.25"},
+		{"price == price", "true"},
+		{"price == tip", "false"},
+		{"price + 1", "ERROR: can only add money to money"},
+		{"price * price", "ERROR: unknown operator: MONEY * MONEY"},
+		{"price[\"dollars\"]", "ERROR: undefined method dollars for MONEY"},
+		{"tip.cents()", "25"},
+		{"len(price)", "ERROR: argument to `len` not supported, got MONEY"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("price", money.New(int64(150)))
+		env.Set("tip", money.New(int64(25)))
+
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var events []string
+	hooks := Hooks{
+		OnNodeEnter: func(node ast.Node) {
+			events = append(events, fmt.Sprintf("enter %T", node))
+		},
+		OnNodeExit: func(node ast.Node, result object.Object) {
+			events = append(events, fmt.Sprintf("exit %T => %s", node, result.Inspect()))
+		},
+	}
+
+	program := parser.New(lexer.New("1 + 2")).ParseProgram()
+	EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{Hooks: hooks})
+
+	expected := []string{
+		"enter *ast.Program",
+		"enter *ast.ExpressionStatement",
+		"enter *ast.InfixExpression",
+		"enter *ast.IntegerLiteral",
+		"exit *ast.IntegerLiteral => 1",
+		"enter *ast.IntegerLiteral",
+		"exit *ast.IntegerLiteral => 2",
+		"exit *ast.InfixExpression => 3",
+		"exit *ast.ExpressionStatement => 3",
+		"exit *ast.Program => 3",
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("events wrong. expected=%q, got=%q", expected, events)
+	}
+
+	var calls []string
+	hooks = Hooks{
+		OnCall: func(function object.Object, arguments []object.Object) {
+			calls = append(calls, fmt.Sprintf("%s %d", function.Type(), len(arguments)))
+		},
+	}
+
+	program = parser.New(lexer.New(`let f = fn(x, y) { x }; f(len("ab"), 1)`)).ParseProgram()
+	EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{Hooks: hooks})
+
+	if strings.Join(calls, ", ") != "BUILTIN 1, FUNCTION 2" {
+		t.Errorf("calls wrong. got=%q", calls)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	input := "let double = fn(x) { x * 2 }; double(-1)"
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	var trace bytes.Buffer
+	evaluated := EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{Trace: &trace})
+	testIntegerObject(t, evaluated, -2)
+
+	expected := `fn(x)(x * 2) => fn(x) { (x * 2) }
+let double = fn(x)(x * 2);
+double => fn(x) { (x * 2) }
+1 => 1
+(-1) => -1
+  x => -1
+  2 => 2
+  (x * 2) => -2
+double((-1)) => -2
+`
+	if trace.String() != expected {
+		t.Errorf("wrong trace. expected=\n%s\ngot=\n%s", expected, trace.String())
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	evaluated := testEval(`"Hello World!"`)
+
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"Hello" + " " + "World!"`, "Hello World!"},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"ab" > "a"`, true},
+		{`"a" > "a"`, false},
+		{`"a" <= "a"`, true},
+		{`"b" <= "a"`, false},
+		{`"a" >= "ab"`, false},
+		{`"b" >= "ab"`, true},
+		{`"Z" < "a"`, true},
+		{`"é" > "z"`, true},
+		{`"" < "a"`, true},
+		{`"a" < 1`, "type mismatch: STRING < INTEGER"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{`"a" + 1`, "type mismatch: STRING + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, result.Message)
+				}
+			default:
+				t.Errorf("unexpected object. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	// builtins stay registered, so a repeated run finds triple already there
+	if !IsBuiltin("triple") {
+		err := RegisterBuiltin("triple", &object.Builtin{
+			Fn: func(args ...object.Object) object.Object {
+				return &object.Integer{Value: 3 * args[0].(*object.Integer).Value}
+			},
+		})
+		if err != nil {
+			t.Fatalf("RegisterBuiltin returned error: %s", err)
+		}
+	}
+
+	testIntegerObject(t, testEval("triple(len([1, 2]))"), 6)
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"len", "cannot register builtin len: already defined"},
+		{"triple", "cannot register builtin triple: already defined"},
+		{"fn", `cannot register builtin "fn": not an identifier`},
+		{"two words", `cannot register builtin "two words": not an identifier`},
+		{"", `cannot register builtin "": not an identifier`},
+	}
+
+	for _, tt := range tests {
+		err := RegisterBuiltin(tt.name, &object.Builtin{})
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("RegisterBuiltin(%q) error wrong. expected=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`puts()`, nil},
+		{`assert(1 < 2)`, nil},
+		{`assert(1 > 2)`, "assertion failed"},
+		{`assert(false, "math is broken")`, "assertion failed: math is broken"},
+		{`assert()`, "wrong number of arguments. got=0, want=1 or 2"},
+		{`assert_eq([1, "a"], [1, "a"])`, nil},
+		{`assert_eq(1 + 1, 3)`, "assertion failed: 2 != 3"},
+		{`assert_eq(1, "1")`, "assertion failed: 1 != 1"},
+		{`assert_eq([1, 2], [1])`, "assertion failed: [1, 2] != [1]"},
+		{`bench(1, fn() { 1 })`, "first argument to `bench` must be STRING, got INTEGER"},
+		{`bench("fail", fn() { x })`, "identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestArrayBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`first([1, 2, 3])`, "1"},
+		{`first([])`, "null"},
+		{`last([1, 2, 3])`, "3"},
+		{`last([])`, "null"},
+		{`rest([1, 2, 3])`, "[2, 3]"},
+		{`rest(rest([1]))`, "null"},
+		{`pop([1, 2, 3])`, "[1, 2]"},
+		{`pop([])`, "null"},
+		{`push([], 1)`, "[1]"},
+		{`concat([1], [], [2, 3])`, "[1, 2, 3]"},
+		{`concat()`, "[]"},
+		// the builtins return new arrays, leaving their arguments as they were
+		{`let a = [1, 2]; let b = push(a, 3); let c = push(a, 4); [a, b, c]`, "[[1, 2], [1, 2, 3], [1, 2, 4]]"},
+		{`let a = [1, 2, 3]; let b = push(rest(a), 4); [a, b]`, "[[1, 2, 3], [2, 3, 4]]"},
+		{`let a = [1, 2, 3]; let b = push(pop(a), 4); [a, b]`, "[[1, 2, 3], [1, 2, 4]]"},
+		{`first(1)`, "ERROR: argument to `first` must be ARRAY, got INTEGER"},
+		{`rest([1], [2])`, "ERROR: wrong number of arguments. got=2, want=1"},
+		{`push("a", 1)`, "ERROR: argument to `push` must be ARRAY, got STRING"},
+		{`push([1])`, "ERROR: wrong number of arguments. got=1, want=2"},
+		{`concat([1], "a")`, "ERROR: argument to `concat` must be ARRAY, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDeepEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, [2, [3]]] == [1, [2, [3]]]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1] != [1, 2]", true},
+		{"[] == []", true},
+		{`[1] == ["1"]`, false},
+		{"[1] == [big(1)]", true},
+		{"[fn(x) { x }] == [fn(x) { x }]", false},
+		{"let f = fn(x) { x }; [f] == [f]", true},
+		{`json_parse("{\"a\": [1, 2], \"b\": null}") == json_parse("{\"b\": null, \"a\": [1, 2]}")`, true},
+		{`json_parse("{\"a\": [1, 2]}") == json_parse("{\"a\": [1, 3]}")`, false},
+		{`json_parse("{\"a\": 1}") != json_parse("{\"a\": 1, \"b\": 2}")`, true},
+		{`delete(json_parse("{\"a\": 1, \"b\": 2}"), "b") == json_parse("{\"a\": 1}")`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// arrays that contain themselves are compared without recursing forever
+	a, b := &object.Array{}, &object.Array{}
+	a.Elements = []object.Object{&object.Integer{Value: 1}, a}
+	b.Elements = []object.Object{&object.Integer{Value: 1}, b}
+	if !objectsEqual(a, b) {
+		t.Errorf("equal cyclic arrays compared unequal")
+	}
+	b.Elements[0] = &object.Integer{Value: 2}
+	if objectsEqual(a, b) {
+		t.Errorf("different cyclic arrays compared equal")
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"type(9223372036854775807)", "INTEGER"},
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"type(9223372036854775807 + 1)", "BIG_INTEGER"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4611686018427387904 * 4", "18446744073709551616"},
+		{"-1 * (-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(25)", "15511210043330985984000000"},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807"},
+		{"type((9223372036854775807 + 1) - 1)", "BIG_INTEGER"},
+		{`big("123456789012345678901234567890") / 10`, "12345678901234567890123456789"},
+		{"-big(7) / 2", "-3"},
+		{"type(big(1) + 1)", "BIG_INTEGER"},
+		{"big(2) == 2", "true"},
+		{"2 != big(2)", "false"},
+		{"big(3) > 2", "true"},
+		{"big(3) >= 3", "true"},
+		{"9223372036854775807 + 1 <= 9223372036854775807", "false"},
+		{"9223372036854775807 < 9223372036854775807 + 1", "true"},
+		{"int(big(5)) + 1", "6"},
+		{"int(9223372036854775807 + 1)", "ERROR: cannot convert 9223372036854775808 to INTEGER: out of range"},
+		{"big(1) / 0", "ERROR: division by zero"},
+		{`big(" 42 ")`, "42"},
+		{`big("4x")`, `ERROR: cannot convert "4x" to BIG_INTEGER`},
+		{"big(true)", "ERROR: cannot convert BOOLEAN to BIG_INTEGER"},
+		{`big(1) + "a"`, "ERROR: type mismatch: BIG_INTEGER + STRING"},
+		{`json_parse("[123456789012345678901234567890]")[0] + 1`, "123456789012345678901234567891"},
+		{`json_stringify([9223372036854775807 + 1])`, "[9223372036854775808]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "ERROR: integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "ERROR: integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "ERROR: integer overflow: 4611686018427387904 * 2"},
+		{"(-9223372036854775807 - 1) / -1", "ERROR: integer overflow: -9223372036854775808 / -1"},
+		{"let m = -9223372036854775807 - 1; -m", "ERROR: integer overflow: -(-9223372036854775808)"},
+		{"try { 9223372036854775807 * 2 } catch (e) { e[\"message\"] }", "integer overflow: 9223372036854775807 * 2"},
+		{"9223372036854775806 + 1", "9223372036854775807"},
+		{"big(9223372036854775807) + 1", "9223372036854775808"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{CheckedArithmetic: true})
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestCoalesceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 ?? 2", "1"},
+		{"if (false) { 1 } ?? 2", "2"},
+		{"false ?? 2", "false"},
+		{`json_parse("{\"a\": 1}")["b"] ?? 0`, "0"},
+		{"if (false) { 1 } ?? if (false) { 2 } ?? 3", "3"},
+		{"1 ?? missing", "1"},
+		{"if (false) { 1 } ?? missing", "ERROR: identifier not found: missing"},
+		{"missing ?? 1", "ERROR: identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`b"\x00\x01AB\"\\\xff"`, `b"\x00\x01AB\"\\\xff"`},
+		{`len(b"\x00\x01")`, "2"},
+		{`b"AB"[0]`, "65"},
+		{`b"AB"[-1]`, "66"},
+		{`b"AB"[2]`, "null"},
+		{`b"ABCD"[1:3]`, `b"BC"`},
+		{`b"AB" + b"\xff"`, `b"AB\xff"`},
+		{`b"AB" == to_bytes("AB")`, "true"},
+		{`b"AB" != b"ABC"`, "true"},
+		{`b"AB" < b"B"`, "true"},
+		{`b"AB" <= b"AB"`, "true"},
+		{`b"AB" >= b"B"`, "false"},
+		{`b"AB" == "AB"`, "ERROR: type mismatch: BYTES == STRING"},
+		{`b"AB" + "C"`, "ERROR: type mismatch: BYTES + STRING"},
+		{`b"A" - b"B"`, "ERROR: unknown operator: BYTES - BYTES"},
+		{`to_bytes("é")`, `b"\xc3\xa9"`},
+		{`to_bytes([0, 255])`, `b"\x00\xff"`},
+		{`to_bytes([256])`, "ERROR: elements of `to_bytes` must be INTEGER from 0 to 255, got 256"},
+		{`to_bytes(1)`, "ERROR: argument to `to_bytes` must be STRING or ARRAY, got INTEGER"},
+		{`to_string(b"\xc3\xa9")`, "é"},
+		{`to_string(b"\xff")`, `ERROR: cannot convert b"\xff" to STRING: not UTF-8`},
+		{`hex_encode(b"\xde\xad")`, "dead"},
+		{`hex_decode("BEEF")`, `b"\xbe\xef"`},
+		{`hex_decode("abc")`, `ERROR: cannot decode "abc" as hex: odd length hex string`},
+		{`"hi".to_bytes().hex_encode()`, "6869"},
+		{`b"hi".to_string().upper()`, "HI"},
+		{`type(b"")`, "BYTES"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"is_frozen([1])", "false"},
+		{"is_frozen(freeze([1]))", "true"},
+		{"let a = [1, [2]]; freeze(a); [is_frozen(a), is_frozen(a[1])]", "[true, true]"},
+		{`let h = json_parse("{\"a\": [1]}"); freeze(h); [is_frozen(h), is_frozen(h["a"])]`, "[true, true]"},
+		{"let a = freeze([1]); is_frozen(push(a, 2))", "false"},
+		{"let a = freeze([1, 2]); [is_frozen(a[0:1]), a == [1, 2]]", "[false, true]"},
+		{`[is_frozen(1), is_frozen("a"), freeze(1)]`, "[true, true, 1]"},
+		// tasks share arrays, which can be frozen while a task looks at them
+		{"let a = [1, [2]]; let t = spawn fn() { [is_frozen(a), is_frozen(a[1])] }; freeze(a); t.join(); [is_frozen(a), is_frozen(a[1])]", "[true, true]"},
+		{"freeze()", "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"clone([1, [2, 3]])", "[1, [2, 3]]"},
+		{`clone(json_parse("{\"a\": [1]}"))`, "{a: [1]}"},
+		{"let a = freeze([1, [2]]); let b = clone(a); [b == a, is_frozen(b), is_frozen(b[1])]", "[true, false, false]"},
+		{`[clone(1), clone("a"), clone(b"a")]`, `[1, a, b"a"]`},
+		{"clone()", "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestCloneCopiesDeeply(t *testing.T) {
+	// arrays only contain themselves when built by the host, and sharing stays shared
+	inner := &object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}
+	outer := &object.Array{Elements: []object.Object{inner, inner}}
+	outer.Elements = append(outer.Elements, outer)
+
+	copied, ok := clone(outer).(*object.Array)
+	if !ok {
+		t.Fatalf("clone did not return an array. got=%T", copied)
+	}
+	if copied == outer || copied.Elements[0] == inner {
+		t.Errorf("clone shares arrays with the original")
+	}
+	if copied.Elements[0] != copied.Elements[1] {
+		t.Errorf("an array contained twice was copied twice")
+	}
+	if copied.Elements[2] != copied {
+		t.Errorf("an array that contains itself does not contain its copy")
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3].len()", "3"},
+		{`"Hello".upper()`, "HELLO"},
+		{`"Hello".lower().len()`, "5"},
+		{`json_parse("{\"b\": 2, \"a\": 1}").keys()`, "[a, b]"},
+		{`json_parse("{\"a\": 1}").has_key("a")`, "true"},
+		{"[3, 1, 2].sort().push(4)", "[1, 2, 3, 4]"},
+		{"[1, 2, 3].map(fn(x) { x * 2 }).reduce(0, fn(a, x) { a + x })", "12"},
+		{"let len = 5; [1].len() + len", "6"},
+		{`"abc".keys()`, "ERROR: undefined method keys for STRING"},
+		{"5.len()", "ERROR: undefined method len for INTEGER"},
+		{`try { "a".nope() } catch (e) { e["message"] }`, "undefined method nope for STRING"},
+		{`"a".upper(1)`, "ERROR: wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestOptionalChaining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let h = json_parse("{\"a\": [1, 2]}"); h?["a"]?[1]`, "2"},
+		{`let h = json_parse("{\"a\": [1, 2]}"); h["b"]?[1]`, "null"},
+		{`let h = json_parse("{\"a\": [1, 2]}"); h["b"]?[1:]`, "null"},
+		{`len?("abc")`, "3"},
+		{"let none = if (false) { 1 }; none?(missing)", "null"},
+		{"let none = if (false) { 1 }; none?[0][1]", "ERROR: index operator not supported: NULL"},
+		{"let none = if (false) { 1 }; none?[0]?[1] ?? 3", "3"},
+		{"let none = if (false) { 1 }; none[0]", "ERROR: index operator not supported: NULL"},
+		{"let none = if (false) { 1 }; none(1)", "ERROR: not a function: NULL"},
+		{"missing?[0]", "ERROR: identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStrictBooleans(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (1 < 2) { 10 } else { 20 }", "10"},
+		{"if (!(1 > 2)) { 10 }", "10"},
+		{"if (1) { 10 }", "ERROR: condition must be BOOLEAN, got INTEGER"},
+		{`if ("") { 10 }`, "ERROR: condition must be BOOLEAN, got STRING"},
+		{"if (if (false) { 1 }) { 10 }", "ERROR: condition must be BOOLEAN, got NULL"},
+		{"!0", "ERROR: operand of ! must be BOOLEAN, got INTEGER"},
+		{"!![]", "ERROR: operand of ! must be BOOLEAN, got ARRAY"},
+		{`try { if (1) { 10 } } catch (e) { e["message"] }`, "condition must be BOOLEAN, got INTEGER"},
+		{"bool(1)", "true"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{StrictBooleans: true})
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`int("42")`, "42"},
+		{`int(" -7\n")`, "-7"},
+		{`int(5)`, "5"},
+		{`int(true) + int(false)`, "1"},
+		{`int("4x")`, `ERROR: cannot convert "4x" to INTEGER`},
+		{`int("")`, `ERROR: cannot convert "" to INTEGER`},
+		{`int("99999999999999999999")`, `ERROR: cannot convert "99999999999999999999" to INTEGER: out of range`},
+		{`int([1])`, "ERROR: cannot convert ARRAY to INTEGER"},
+		{`str(42) + "!"`, "42!"},
+		{`str("a")`, "a"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`str(true)`, "true"},
+		{`int(str(123)) == 123`, "true"},
+		{`bool(0)`, "true"},
+		{`bool(if (false) { 1 })`, "false"},
+		{`bool(false)`, "false"},
+		{`bool("")`, "true"},
+		{`str()`, "ERROR: wrong number of arguments. got=0, want=1"},
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type(true)`, "BOOLEAN"},
+		{`type(if (false) { 1 })`, "NULL"},
+		{`type([])`, "ARRAY"},
+		{`type(fn() {})`, "FUNCTION"},
+		{`type(len)`, "BUILTIN"},
+		{`type(type(1))`, "STRING"},
+		{`type()`, "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTimeBuiltins(t *testing.T) {
+	before := time.Now().UnixMilli()
+	now := testEval("now()")
+	after := time.Now().UnixMilli()
+	if integer, ok := now.(*object.Integer); !ok || integer.Value < before || integer.Value > after {
+		t.Errorf("now() is not the current time. got=%s, want between %d and %d", now.Inspect(), before, after)
+	}
+
+	elapsed := testEval("let start = clock(); sleep(5); clock() - start")
+	if integer, ok := elapsed.(*object.Integer); !ok || integer.Value < 5 {
+		t.Errorf("clock() did not measure the sleep. got=%s", elapsed.Inspect())
+	}
+
+	timestamp := int64(1700000000123)
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{fmt.Sprintf(`format_time(%d, "2006-01-02 15:04:05.000")`, timestamp), time.UnixMilli(timestamp).Format("2006-01-02 15:04:05.000")},
+		{fmt.Sprintf(`format_time(%d, "RFC3339")`, timestamp), time.UnixMilli(timestamp).Format(time.RFC3339)},
+		{`format_time("now", "RFC3339")`, "ERROR: first argument to `format_time` must be INTEGER, got STRING"},
+		{`format_time(0, 1)`, "ERROR: second argument to `format_time` must be STRING, got INTEGER"},
+		{`sleep("1")`, "ERROR: argument to `sleep` must be INTEGER, got STRING"},
+		{`now(1)`, "ERROR: wrong number of arguments. got=1, want=0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestExecBuiltin(t *testing.T) {
+	tests := []struct {
+		input     string
+		allowExec bool
+		expected  string
+	}{
+		{`exec("sh", ["-c", "echo out; echo err >&2; exit 3"])["stdout"]`, true, "out\n"},
+		{`exec("sh", ["-c", "echo out; echo err >&2; exit 3"])["stderr"]`, true, "err\n"},
+		{`exec("sh", ["-c", "echo out; echo err >&2; exit 3"])["code"]`, true, "3"},
+		{`exec("true")["code"]`, true, "0"},
+		{`exec("true")`, false, "ERROR: exec is not enabled"},
+		{`exec("monkey-no-such-command")`, true, "ERROR: could not run monkey-no-such-command: exec: \"monkey-no-such-command\": executable file not found in $PATH"},
+		{`exec(1)`, true, "ERROR: first argument to `exec` must be STRING, got INTEGER"},
+		{`exec("echo", "a")`, true, "ERROR: second argument to `exec` must be ARRAY, got STRING"},
+		{`exec("echo", [1])`, true, "ERROR: arguments to `exec` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{AllowExec: tt.allowExec})
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestFormatBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`format("x = {} y = {}", 1, "two")`, "x = 1 y = two"},
+		{`format("{}{}", [1, "a"], true)`, "[1, a]true"},
+		{`format("no placeholders")`, "no placeholders"},
+		{`format("{{}} {}", 5)`, "{} 5"},
+		{`format("{} {}", 1)`, "ERROR: format string takes 2 values, got 1"},
+		{`format("{}", 1, 2)`, "ERROR: format string takes 1 values, got 2"},
+		{`format("a { b")`, "ERROR: unmatched { in format string at offset 2, write {{ for the brace itself"},
+		{`format("}")`, "ERROR: unmatched } in format string at offset 0, write }} for the brace itself"},
+		{`format(1)`, "ERROR: first argument to `format` must be STRING, got INTEGER"},
+		{`format()`, "ERROR: wrong number of arguments. got=0, want at least 1"},
+		{`printf("{}")`, "ERROR: format string takes 1 values, got 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestPrintErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`puts(1)`, "ERROR: could not print: closed"},
+		{`printf("{}", 1)`, "ERROR: could not print: closed"},
+		{`try { puts(1) } catch (e) { e["message"] }`, "could not print: closed"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{Output: failingWriter{}})
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("closed")
+}
+
+func TestHashBuiltins(t *testing.T) {
+	hash := `let h = json_parse("{\"b\": 2, \"a\": 1, \"c\": [3]}"); `
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{hash + `keys(h)`, "[a, b, c]"},
+		{hash + `values(h)`, "[1, 2, [3]]"},
+		{`keys(merge())`, "[]"},
+		{hash + `has_key(h, "a")`, "true"},
+		{hash + `has_key(h, "z")`, "false"},
+		{hash + `delete(h, "a")`, "{b: 2, c: [3]}"},
+		{hash + `delete(h, "z")`, "{a: 1, b: 2, c: [3]}"},
+		{hash + `let d = delete(h, "a"); h`, "{a: 1, b: 2, c: [3]}"},
+		{hash + `merge(h, json_parse("{\"a\": 10, \"d\": 4}"))`, "{a: 10, b: 2, c: [3], d: 4}"},
+		{hash + `let m = merge(h); len(delete(m, "a")) + len(h)`, "5"},
+		{`keys([1])`, "ERROR: argument to `keys` must be HASH, got ARRAY"},
+		{`has_key(1, 1)`, "ERROR: first argument to `has_key` must be HASH, got INTEGER"},
+		{hash + `delete(h, [1])`, "ERROR: unusable as hash key: ARRAY"},
+		{hash + `merge(h, 1)`, "ERROR: argument to `merge` must be HASH, got INTEGER"},
+		{hash + `values(h, 1)`, "ERROR: wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse("{\"b\": {\"c\": 2}, \"a\": [1, true, null, \"x\"]}")`, "{a: [1, true, null, x], b: {c: 2}}"},
+		{`json_parse("[1, 2]")[1]`, "2"},
+		{`json_parse(" \"text\" ")`, "text"},
+		{`json_parse("{\"a\": [10]}")["a"][0]`, "10"},
+		{`json_parse("{\"a\": 1}")["missing"]`, "null"},
+		{`json_parse("[1.5]")`, "ERROR: invalid JSON: number 1.5 is not an integer"},
+		{`json_parse("[1,")`, "ERROR: invalid JSON: unexpected EOF"},
+		{`json_parse("1 2")`, "ERROR: invalid JSON: more than one value"},
+		{`json_parse(1)`, "ERROR: argument to `json_parse` must be STRING, got INTEGER"},
+		{`json_stringify([1, "a<b", true, if (false) { 1 }])`, `[1,"a<b",true,null]`},
+		{`json_stringify(json_parse("{\"b\": 1, \"a\": [2]}"))`, `{"a":[2],"b":1}`},
+		{`json_stringify([1, [2]], 2)`, "[\n  1,\n  [\n    2\n  ]\n]"},
+		{`json_stringify([1], "\t")`, "[\n\t1\n]"},
+		{`json_stringify([fn() {}])`, "ERROR: cannot convert FUNCTION to JSON"},
+		{`json_stringify([], [])`, "ERROR: second argument to `json_stringify` must be INTEGER or STRING, got ARRAY"},
+		{`let doc = "{\"list\":[1,2],\"name\":\"monkey\"}"; json_stringify(json_parse(doc)) == doc`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`map(["a", "bc"], len)`, "[1, 2]"},
+		{`let n = 10; map([1, 2], fn(x) { x + n })`, "[11, 12]"},
+		{`map([[1], [2, 3]], fn(a) { map(a, fn(x) { x * x }) })`, "[[1], [4, 9]]"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`filter([1, 2], fn(x) { false })`, "[]"},
+		{`reduce([1, 2, 3], 0, fn(sum, x) { sum + x })`, "6"},
+		{`reduce([], 42, fn(sum, x) { sum + x })`, "42"},
+		{`reduce(["a", "b"], "", fn(s, x) { return x + s; })`, "ba"},
+		{`map([1, "a"], fn(x) { -x })`, "ERROR: unknown operator: -STRING"},
+		{`map([1], fn(a, b) { a })`, "ERROR: wrong number of arguments: want=2, got=1"},
+		{`map(1, fn(x) { x })`, "ERROR: first argument to `map` must be ARRAY, got INTEGER"},
+		{`filter([1], 1)`, "ERROR: last argument to `filter` must be a function, got INTEGER"},
+		{`reduce([1], fn(a, x) { a })`, "ERROR: wrong number of arguments. got=2, want=3"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([])`, "[]"},
+		{`let a = [2, 1]; sort(a); a`, "[2, 1]"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`sort([3, 1, 2], fn(a, b) { a - b })`, "[1, 2, 3]"},
+		{`sort([[2, "b"], [1, "a"], [2, "c"], [1, "d"]], fn(x, y) { x[0] < y[0] })`, "[[1, a], [1, d], [2, b], [2, c]]"},
+		{`sort(["bb", "a", "ccc"], fn(a, b) { len(a) < len(b) })`, "[a, bb, ccc]"},
+		{`sort([1, "a"])`, "ERROR: cannot sort INTEGER and STRING without a comparator"},
+		{`sort([true])`, "ERROR: cannot sort BOOLEAN without a comparator"},
+		{`sort([1, 2], fn(a, b) { a < "b" })`, "ERROR: type mismatch: INTEGER < STRING"},
+		{`sort("abc")`, "ERROR: first argument to `sort` must be ARRAY, got STRING"},
+		{`sort([1], 2)`, "ERROR: last argument to `sort` must be a function, got INTEGER"},
+		{`sort()`, "ERROR: wrong number of arguments. got=0, want=1 or 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// the callbacks count against the limits of the evaluation
+	program := parser.New(lexer.New(`map([1, 2, 3], fn(x) { fn(y) { y }(x) })`)).ParseProgram()
+	evaluated := EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{MaxDepth: 1})
+	if evaluated.Inspect() != "ERROR: maximum recursion depth exceeded: 1 calls" {
+		t.Errorf("callbacks escaped the depth limit. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestBenchLimits(t *testing.T) {
+	defer func(saved time.Duration) { benchTime = saved }(benchTime)
+	benchTime = time.Minute
+
+	// the function benchmarked runs within the limits of the program calling bench
+	program := parser.New(lexer.New(`bench("loop", fn() { 1 + 1 })`)).ParseProgram()
+	evaluated := EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{MaxSteps: 1000})
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "step limit exceeded: 1000 steps" {
+		t.Errorf("bench escaped the step limit. got=%s", evaluated.Inspect())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	evaluated = EvalWithOptions(ctx, program, object.NewEnvironment(), Options{})
+	if errObj, ok := evaluated.(*object.Error); !ok || !strings.HasPrefix(errObj.Message, "evaluation interrupted") {
+		t.Errorf("bench escaped the timeout. got=%s", evaluated.Inspect())
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("bench ran on for %s after the timeout", elapsed)
+	}
+
+	// the result is printed to the output of the options
+	benchTime = time.Millisecond
+	var out bytes.Buffer
+	evaluated = EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{Output: &out})
+	if evaluated != NULL || !strings.HasPrefix(out.String(), "loop ") {
+		t.Errorf("bench did not print to the output. got=%s, output=%q", evaluated.Inspect(), out.String())
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	function := testEval("fn() { 1 + 1 }")
+
+	iterations, perCall, err := Benchmark(Apply, function, time.Millisecond)
+	if err != nil {
+		t.Fatalf("benchmark failed: %s", err.Message)
+	}
+	if iterations < 1 || perCall <= 0 {
+		t.Errorf("wrong benchmark result. iterations=%d, perCall=%s", iterations, perCall)
+	}
+
+	_, _, err = Benchmark(Apply, testEval(`fn() { 1 + "a" }`), time.Millisecond)
+	if err == nil || err.Message != "type mismatch: INTEGER + STRING" {
+		t.Errorf("expected the function's error. got=%v", err)
+	}
+
+	tests := []struct {
+		iterations int
+		elapsed    time.Duration
+		expected   int
+	}{
+		{1, 0, 100},
+		{1, time.Microsecond, 100},
+		{100, 100 * time.Millisecond, 1200},
+		{1000, 2 * time.Second, 1001},
+		{MAX_BENCH_ITERATIONS / 2, 0, MAX_BENCH_ITERATIONS},
+	}
+
+	for _, tt := range tests {
+		next := nextIterations(tt.iterations, tt.elapsed, time.Second)
+		if next != tt.expected {
+			t.Errorf("nextIterations(%d, %s) wrong. expected=%d, got=%d", tt.iterations, tt.elapsed, tt.expected, next)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		{`quote(fn(x) { x * y })`, `fn(x)(x * y)`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote("monkey") + x)`, `(monkey + x)`},
+		{`quote(unquote([1, -2]))`, `[1, -2]`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quotedInfix = quote(4 + 4); quote(unquote(4 + 4) + unquote(quotedInfix))`, `(8 + (4 + 4))`},
+		{`let f = fn(x) { quote(unquote(x) + 1) }; f(1); f(2)`, `(2 + 1)`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote()`, "wrong number of arguments to quote: want=1, got=0"},
+		{`quote(unquote(1, 2))`, "wrong number of arguments to unquote: want=1, got=2"},
+		{`quote(unquote(missing))`, "identifier not found: missing"},
+		{`quote(unquote(fn(x) { x }))`, "cannot unquote FUNCTION"},
+		{`unquote(1)`, "identifier not found: unquote"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameters wrong. got=%v", macro.Parameters)
+	}
+
+	if macro.Body.String() != "(x + y)" {
+		t.Fatalf("body is not %q. got=%q", "(x + y)", macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); }; infixExpression();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); }; reverse(2 + 2, 10 - 5);`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			// macros expand inside functions and in the arguments of other calls
+			`let twice = macro(x) { quote(unquote(x) * 2) }; fn() { len(twice(3)) }`,
+			`fn() { len(3 * 2) }`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("expansion of %q failed: %s", tt.input, err.Message)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro(a) { quote(a) }; m()`, "wrong number of arguments: want=1, got=0"},
+		{`let m = macro() { 1 }; m()`, "macro m returned INTEGER, want QUOTE"},
+		{`let m = macro() { missing }; m()`, "identifier not found: missing"},
+		{`let f = fn() { macro() { 1 } }; f()`, "macros can only be defined by top-level let statements"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, errObj := ExpandMacros(program, env)
+
+		// macros defined anywhere else fail when the program runs
+		if errObj == nil {
+			result, ok := Eval(expanded, object.NewEnvironment()).(*object.Error)
+			if !ok {
+				t.Errorf("no error for %q", tt.input)
+				continue
+			}
+			errObj = result
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestExpandMacrosWithOptions(t *testing.T) {
+	input := `let m = macro() { let f = fn(n) { f(n + 1) + f(n + 1) }; f(0) }; m()`
+	program := testParseProgram(input)
+
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+	_, errObj := ExpandMacrosWithOptions(context.Background(), program, env, Options{MaxSteps: 1000})
+	if errObj == nil || !strings.Contains(errObj.Message, "step limit") {
+		t.Fatalf("macro not stopped by the step limit. got=%v", errObj)
+	}
+}
+
+func TestHygienicMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// the parameter of the macro's function does not capture the t of the caller
+		{
+			`let or = macro(a, b) { quote(fn(t) { if (t) { t } else { unquote(b) } }(unquote(a))) };
+			let t = 5;
+			if (or(false, t) == 5) { 1 } else { 0 }`,
+			1,
+		},
+		// the binding made by the macro does not clobber the tmp of the caller
+		{
+			`let double = macro(x) { quote(if (true) { let tmp = unquote(x); tmp * 2 }) };
+			let tmp = 1;
+			double(3) + tmp`,
+			7,
+		},
+		// the arguments still see the bindings of the caller
+		{
+			`let double = macro(x) { quote(if (true) { let tmp = unquote(x); tmp * 2 }) };
+			let tmp = 4;
+			double(tmp)`,
+			8,
+		},
+		// the same holds for the locals of a function the macro expands in
+		{
+			`let double = macro(x) { quote(if (true) { let tmp = unquote(x); tmp * 2 }) };
+			let f = fn(tmp) { double(3) + tmp };
+			f(1)`,
+			7,
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+
+		macroEnv := object.NewEnvironment()
+		DefineMacros(program, macroEnv)
+		expanded, err := ExpandMacros(program, macroEnv)
+		if err != nil {
+			t.Fatalf("expansion of %q failed: %s", tt.input, err.Message)
+		}
+
+		testIntegerObject(t, Eval(expanded, object.NewEnvironment()), tt.expected)
+	}
+}
+
+func TestGensym(t *testing.T) {
+	program := testParseProgram(`let names = macro() { quote([unquote(gensym()), unquote(gensym())]) }; names()`)
+
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+	expanded, err := ExpandMacros(program, env)
+	if err != nil {
+		t.Fatalf("expansion failed: %s", err.Message)
+	}
+
+	names := expanded.(*ast.Program).Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ArrayLiteral).Elements
+	first, second := names[0].(*ast.Identifier).Value, names[1].(*ast.Identifier).Value
+	if first == second || !strings.HasPrefix(first, "gensym#") || !strings.HasPrefix(second, "gensym#") {
+		t.Errorf("gensym names wrong. got=%q and %q", first, second)
+	}
+
+	// gensym is only there for macros
+	if errObj, ok := testEval(`gensym()`).(*object.Error); !ok || errObj.Message != "identifier not found: gensym" {
+		t.Errorf("gensym available outside of macros. got=%v", testEval(`gensym()`))
+	}
+}
+
+func FuzzEval(f *testing.F) {
+	for _, seed := range []string{
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)",
+		`let m = macro(x) { quote(unquote(x) * 2) }; m(3) + len("abc")`,
+		`try { [1, 2][5].len() } catch (e) { e["message"] } ?? json_parse("[1]")`,
+		"let f = fn(x) { f(x) }; f(1)",
+		`b"\x01" + "a".to_bytes()`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		options := Options{Sandbox: true, MaxSteps: 100000, MaxDepth: 200, MaxMemory: 1 << 24}
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, errObj := ExpandMacrosWithOptions(ctx, program, env, options)
+		if errObj != nil {
+			return
+		}
+
+		EvalWithOptions(ctx, expanded, object.NewEnvironment(), options)
+	})
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testQuoteObject(t *testing.T, input string, obj object.Object, expected string) {
+	t.Helper()
+
+	quote, ok := obj.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote for %q. got=%T (%+v)", input, obj, obj)
+	}
+	if quote.Node == nil {
+		t.Fatalf("quote.Node is nil for %q", input)
+	}
+	if quote.Node.String() != expected {
+		t.Errorf("not equal for %q. got=%q, want=%q", input, quote.Node.String(), expected)
+	}
+}
+
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,65 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"monkey/object"
+	"os/exec"
+)
+
+// execCommand runs a command with the arguments of an optional array of strings and
+// returns a hash of what it wrote to stdout and stderr and its exit code. A command that
+// fails is not an error, only one that cannot be started is. The command is killed when
+// the run is cancelled.
+func execCommand(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newError("first argument to `exec` must be STRING, got %s", args[0].Type())
+	}
+
+	var arguments []string
+	if len(args) == 2 {
+		array, ok := args[1].(*object.Array)
+		if !ok {
+			return newError("second argument to `exec` must be ARRAY, got %s", args[1].Type())
+		}
+		for _, element := range array.Elements {
+			argument, ok := element.(*object.String)
+			if !ok {
+				return newError("arguments to `exec` must be STRING, got %s", element.Type())
+			}
+			arguments = append(arguments, argument.Value)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name.Value, arguments...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	code := 0
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return newFatalError("evaluation interrupted: %s", ctx.Err())
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return newError("could not run %s: %s", name.Value, err)
+		}
+		code = exitErr.ExitCode()
+	}
+
+	result, err := object.FromGo(map[string]any{
+		"stdout": stdout.String(),
+		"stderr": stderr.String(),
+		"code":   code,
+	})
+	if err != nil {
+		return newError("%s", err)
+	}
+	return result
+}
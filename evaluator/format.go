@@ -0,0 +1,53 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"strings"
+)
+
+// formatArguments checks the arguments of a builtin that takes a format string followed
+// by the values for its placeholders, and returns the formatted string.
+func formatArguments(name string, args []object.Object) (string, *object.Error) {
+	if len(args) == 0 {
+		return "", newError("wrong number of arguments. got=0, want at least 1")
+	}
+	template, ok := args[0].(*object.String)
+	if !ok {
+		return "", newError("first argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+
+	return formatString(template.Value, args[1:])
+}
+
+// formatString replaces each {} of the template with the next value, written as puts
+// writes it. {{ and }} stand for the braces themselves. Every value has to fill a
+// placeholder and every placeholder a value.
+func formatString(template string, values []object.Object) (string, *object.Error) {
+	var out strings.Builder
+	placeholders := 0
+
+	for i := 0; i < len(template); i++ {
+		switch {
+		case strings.HasPrefix(template[i:], "{}"):
+			// the placeholders are counted on without values, for the error
+			if placeholders < len(values) {
+				out.WriteString(values[placeholders].Inspect())
+			}
+			placeholders++
+			i++
+		case strings.HasPrefix(template[i:], "{{"), strings.HasPrefix(template[i:], "}}"):
+			out.WriteByte(template[i])
+			i++
+		case template[i] == '{' || template[i] == '}':
+			return "", newError("unmatched %c in format string at offset %d, write %c%c for the brace itself", template[i], i, template[i], template[i])
+		default:
+			out.WriteByte(template[i])
+		}
+	}
+
+	if placeholders != len(values) {
+		return "", newError("format string takes %d values, got %d", placeholders, len(values))
+	}
+
+	return out.String(), nil
+}
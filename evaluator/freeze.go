@@ -0,0 +1,98 @@
+package evaluator
+
+import "monkey/object"
+
+// freeze marks an array or hash and every array and hash inside it as frozen, so that
+// it can be shared as a constant, and returns it. Other values never change anyway.
+func freeze(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	freezeObject(args[0], map[object.Object]bool{})
+	return args[0]
+}
+
+// freezeObject freezes the object and what it contains, stopping at what is frozen
+// already and at what it has visited, which ends the walk through an array or hash that
+// contains itself. What an array or hash contains is frozen before it is, so a task
+// that sees it frozen sees everything inside it frozen too.
+func freezeObject(obj object.Object, visited map[object.Object]bool) {
+	if visited[obj] {
+		return
+	}
+	visited[obj] = true
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		if obj.IsFrozen() {
+			return
+		}
+		for _, element := range obj.Elements {
+			freezeObject(element, visited)
+		}
+		obj.Freeze()
+	case *object.Hash:
+		if obj.IsFrozen() {
+			return
+		}
+		for _, pair := range obj.Pairs {
+			freezeObject(pair.Value, visited)
+		}
+		obj.Freeze()
+	}
+}
+
+// isFrozen reports whether an array or hash has been frozen. Every other value is,
+// since none of them can change.
+func isFrozen(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Array:
+		return nativeBoolToBooleanObject(arg.IsFrozen())
+	case *object.Hash:
+		return nativeBoolToBooleanObject(arg.IsFrozen())
+	default:
+		return TRUE
+	}
+}
+
+// clone returns a deep copy of a value: arrays and hashes are copied along with every
+// array and hash inside them, unfrozen, while other values never change and are shared.
+func clone(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	return cloneObject(args[0], map[object.Object]object.Object{})
+}
+
+// cloneObject copies the object, reusing the copies made so far of the arrays and hashes
+// it contains so that one contained twice, or in itself, is copied once.
+func cloneObject(obj object.Object, copies map[object.Object]object.Object) object.Object {
+	if copied, ok := copies[obj]; ok {
+		return copied
+	}
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		copied := &object.Array{Elements: make([]object.Object, len(obj.Elements))}
+		copies[obj] = copied
+		for i, element := range obj.Elements {
+			copied.Elements[i] = cloneObject(element, copies)
+		}
+		return copied
+	case *object.Hash:
+		copied := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, len(obj.Pairs))}
+		copies[obj] = copied
+		for key, pair := range obj.Pairs {
+			copied.Pairs[key] = object.HashPair{Key: pair.Key, Value: cloneObject(pair.Value, copies)}
+		}
+		return copied
+	default:
+		return obj
+	}
+}
@@ -0,0 +1,166 @@
+package evaluator
+
+import (
+	"bytes"
+	"monkey/object"
+	"sort"
+)
+
+// NewHash makes a hash of keys and the values that follow them, as a hash literal lists
+// them, failing for a key that cannot be hashed. A key given twice maps to its last value.
+// The virtual machine builds the hashes of its literals with it too.
+func NewHash(keysAndValues []object.Object) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", keysAndValues[i].Type())
+		}
+		pairs[key.HashKey()] = object.HashPair{Key: keysAndValues[i], Value: keysAndValues[i+1]}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// hashKeys returns the keys of a hash as an array, in the order of sortedPairs.
+func hashKeys(args ...object.Object) object.Object {
+	hash, errObj := hashArgument("keys", args, 1)
+	if errObj != nil {
+		return errObj
+	}
+
+	pairs := sortedPairs(hash)
+	keys := make([]object.Object, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = pair.Key
+	}
+
+	return &object.Array{Elements: keys}
+}
+
+// hashValues returns the values of a hash as an array, in the order of their keys.
+func hashValues(args ...object.Object) object.Object {
+	hash, errObj := hashArgument("values", args, 1)
+	if errObj != nil {
+		return errObj
+	}
+
+	pairs := sortedPairs(hash)
+	values := make([]object.Object, len(pairs))
+	for i, pair := range pairs {
+		values[i] = pair.Value
+	}
+
+	return &object.Array{Elements: values}
+}
+
+// hashHasKey reports whether a hash has a value for the key.
+func hashHasKey(args ...object.Object) object.Object {
+	hash, errObj := hashArgument("has_key", args, 2)
+	if errObj != nil {
+		return errObj
+	}
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	_, ok = hash.Pairs[key.HashKey()]
+	return nativeBoolToBooleanObject(ok)
+}
+
+// hashDelete returns a new hash with the pairs of a hash but the one of the key, which
+// it need not have.
+func hashDelete(args ...object.Object) object.Object {
+	hash, errObj := hashArgument("delete", args, 2)
+	if errObj != nil {
+		return errObj
+	}
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	deleted := copyPairs(hash)
+	delete(deleted.Pairs, key.HashKey())
+	return deleted
+}
+
+// hashMerge returns a new hash with the pairs of every hash, where the value of a key
+// comes from the last hash that has it.
+func hashMerge(args ...object.Object) object.Object {
+	merged := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+	for _, arg := range args {
+		hash, ok := arg.(*object.Hash)
+		if !ok {
+			return newError("argument to `merge` must be HASH, got %s", arg.Type())
+		}
+		for key, pair := range hash.Pairs {
+			merged.Pairs[key] = pair
+		}
+	}
+
+	return merged
+}
+
+// hashArgument returns the first of the arguments of a builtin that takes a hash
+// followed by the others it wants.
+func hashArgument(name string, args []object.Object, want int) (*object.Hash, *object.Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		if want == 1 {
+			return nil, newError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+		}
+		return nil, newError("first argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+
+	return hash, nil
+}
+
+// copyPairs returns a new hash of the pairs of a hash. Hashes are never changed in
+// place, like arrays, so the builtins return new hashes.
+func copyPairs(hash *object.Hash) *object.Hash {
+	pairs := make(map[object.HashKey]object.HashPair, len(hash.Pairs))
+	for key, pair := range hash.Pairs {
+		pairs[key] = pair
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// sortedPairs returns the pairs of a hash, which have no order of their own, sorted by
+// key so that they come out the same every time: big integers first, then booleans,
+// then bytes, then integers, then strings, each in ascending order.
+func sortedPairs(hash *object.Hash) []object.HashPair {
+	pairs := make([]object.HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i].Key, pairs[j].Key
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+
+		switch a := a.(type) {
+		case *object.Integer:
+			return a.Value < b.(*object.Integer).Value
+		case *object.BigInteger:
+			return a.Value.Cmp(b.(*object.BigInteger).Value) < 0
+		case *object.String:
+			return a.Value < b.(*object.String).Value
+		case *object.Bytes:
+			return bytes.Compare(a.Value, b.(*object.Bytes).Value) < 0
+		case *object.Boolean:
+			return !a.Value && b.(*object.Boolean).Value
+		}
+		return false
+	})
+
+	return pairs
+}
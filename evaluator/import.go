@@ -0,0 +1,50 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/object"
+)
+
+// IMPORT names the special form that loads a module, which the importer of the evaluation finds.
+const IMPORT = "import"
+
+// Importer loads the modules that programs import.
+type Importer interface {
+	// Import returns the module at the path, as imported by the program in the file
+	// given, which is empty for a program that does not come from a file.
+	Import(ctx context.Context, path, file string) (*object.Module, error)
+}
+
+// importModule evaluates the path that the call imports and loads the module there.
+func (evaluation *evaluation) importModule(call *ast.CallExpression, env *object.Environment) object.Object {
+	if len(call.Arguments) != 1 {
+		return newError("wrong number of arguments to %s: want=1, got=%d", IMPORT, len(call.Arguments))
+	}
+
+	path := evaluation.eval(call.Arguments[0], env)
+	if isError(path) {
+		return path
+	}
+	if path.Type() != object.STRING_OBJ {
+		return newError("argument to %s must be STRING, got %s", IMPORT, path.Type())
+	}
+
+	// reading files is a side effect, like those of the builtins a sandbox leaves out
+	if evaluation.options.Sandbox {
+		return newError("%s is not available in sandbox mode", IMPORT)
+	}
+	if evaluation.spawned {
+		return newError("%s is not available in spawned tasks", IMPORT)
+	}
+	if evaluation.options.Importer == nil {
+		return newError("%s is not available without an importer", IMPORT)
+	}
+
+	module, err := evaluation.options.Importer.Import(evaluation.ctx, path.(*object.String).Value, evaluation.options.File)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	return module
+}
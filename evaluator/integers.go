@@ -0,0 +1,140 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"monkey/object"
+	"strings"
+)
+
+// addInt64 returns the sum of two integers and whether it fits in an int64.
+func addInt64(a, b int64) (int64, bool) {
+	sum := a + b
+	// the sum overflowed if it has a sign neither operand has
+	return sum, (a^sum)&(b^sum) >= 0
+}
+
+// subInt64 returns the difference of two integers and whether it fits in an int64.
+func subInt64(a, b int64) (int64, bool) {
+	difference := a - b
+	return difference, (a^b)&(a^difference) >= 0
+}
+
+// mulInt64 returns the product of two integers and whether it fits in an int64.
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+
+	product := a * b
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return product, false
+	}
+	return product, product/b == a
+}
+
+// divInt64 returns the quotient of two integers, the second of which is not zero, and
+// whether it fits in an int64, which it does unless the smallest integer is divided by -1.
+func divInt64(a, b int64) (int64, bool) {
+	if a == math.MinInt64 && b == -1 {
+		return a, false
+	}
+	return a / b, true
+}
+
+// isInteger reports whether the object is an integer of either size.
+func isInteger(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIG_INTEGER_OBJ
+}
+
+// bigInteger returns the value of an integer of either size as a big.Int, which the
+// caller must not change.
+func bigInteger(obj object.Object) *big.Int {
+	if integer, ok := obj.(*object.BigInteger); ok {
+		return integer.Value
+	}
+	return big.NewInt(obj.(*object.Integer).Value)
+}
+
+// evalBigIntegerInfixExpression evaluates an infix operator applied to two integers,
+// either of which can be big, as big integers.
+func evalBigIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := bigInteger(left)
+	rightValue := bigInteger(right)
+
+	switch operator {
+	case "+":
+		return &object.BigInteger{Value: new(big.Int).Add(leftValue, rightValue)}
+	case "-":
+		return &object.BigInteger{Value: new(big.Int).Sub(leftValue, rightValue)}
+	case "*":
+		return &object.BigInteger{Value: new(big.Int).Mul(leftValue, rightValue)}
+	case "/":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		// Quo truncates like the division of integers does
+		return &object.BigInteger{Value: new(big.Int).Quo(leftValue, rightValue)}
+	case "%":
+		if rightValue.Sign() == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.BigInteger{Value: new(big.Int).Rem(leftValue, rightValue)}
+	case "<":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// CheckOverflow returns the result of the operator applied to the operands, unless it is
+// the big integer that arithmetic on integers overflowed into, which is replaced by an
+// error for programs that run without big integers.
+func CheckOverflow(result object.Object, operator string, operands ...object.Object) object.Object {
+	if result.Type() != object.BIG_INTEGER_OBJ {
+		return result
+	}
+	for _, operand := range operands {
+		if operand.Type() != object.INTEGER_OBJ {
+			return result
+		}
+	}
+
+	if len(operands) == 1 {
+		return newError("integer overflow: %s(%s)", operator, operands[0].Inspect())
+	}
+	return newError("integer overflow: %s %s %s", operands[0].Inspect(), operator, operands[1].Inspect())
+}
+
+// bigBuiltin converts an integer or a string of decimal digits to a big integer, which
+// every arithmetic operation it takes part in keeps big.
+func bigBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		return &object.BigInteger{Value: big.NewInt(arg.Value)}
+	case *object.BigInteger:
+		return arg
+	case *object.String:
+		value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+		if !ok {
+			return newError("cannot convert %q to BIG_INTEGER", arg.Value)
+		}
+		return &object.BigInteger{Value: value}
+	default:
+		return newError("cannot convert %s to BIG_INTEGER", args[0].Type())
+	}
+}
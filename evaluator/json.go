@@ -0,0 +1,158 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"monkey/object"
+	"strings"
+)
+
+// jsonParse decodes a JSON document into the objects it describes: objects become hashes
+// with string keys, arrays arrays, and numbers integers, since Monkey has no others, or
+// big integers when they are too large.
+func jsonParse(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `json_parse` must be STRING, got %s", args[0].Type())
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(str.Value))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return newError("invalid JSON: %s", err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return newError("invalid JSON: more than one value")
+	}
+
+	value, err := integers(value)
+	if err != nil {
+		return newError("invalid JSON: %s", err)
+	}
+
+	obj, err := object.FromGo(value)
+	if err != nil {
+		return newError("invalid JSON: %s", err)
+	}
+	return obj
+}
+
+// integers replaces the numbers of a decoded JSON value with integers, failing on any
+// number that is not one.
+func integers(value any) (any, error) {
+	switch value := value.(type) {
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return integer, nil
+		}
+		if integer, ok := new(big.Int).SetString(value.String(), 10); ok {
+			return integer, nil
+		}
+		return nil, fmt.Errorf("number %s is not an integer", value)
+	case []any:
+		for i, element := range value {
+			converted, err := integers(element)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = converted
+		}
+	case map[string]any:
+		for key, element := range value {
+			converted, err := integers(element)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = converted
+		}
+	}
+
+	return value, nil
+}
+
+// jsonStringify encodes an object as JSON, on one line or indented by the number of
+// spaces or the string given second. The keys of hashes have to be strings, and come
+// out sorted.
+func jsonStringify(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	indent := ""
+	if len(args) == 2 {
+		switch arg := args[1].(type) {
+		case *object.Integer:
+			indent = strings.Repeat(" ", int(max(arg.Value, 0)))
+		case *object.String:
+			indent = arg.Value
+		default:
+			return newError("second argument to `json_stringify` must be INTEGER or STRING, got %s", args[1].Type())
+		}
+	}
+
+	value, errObj := jsonValue(args[0])
+	if errObj != nil {
+		return errObj
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(value); err != nil {
+		return newError("cannot convert to JSON: %s", err)
+	}
+
+	return &object.String{Value: strings.TrimSuffix(buffer.String(), "\n")}
+}
+
+// jsonValue converts an object to the Go value that encodes it as JSON.
+func jsonValue(obj object.Object) (any, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.BigInteger:
+		return json.Number(obj.Value.String()), nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Null:
+		return nil, nil
+	case *object.Array:
+		elements := make([]any, len(obj.Elements))
+		for i, element := range obj.Elements {
+			value, errObj := jsonValue(element)
+			if errObj != nil {
+				return nil, errObj
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	case *object.Hash:
+		pairs := make(map[string]any, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return nil, newError("cannot convert %s hash key to JSON, want STRING", pair.Key.Type())
+			}
+			value, errObj := jsonValue(pair.Value)
+			if errObj != nil {
+				return nil, errObj
+			}
+			pairs[key.Value] = value
+		}
+		return pairs, nil
+	default:
+		return nil, newError("cannot convert %s to JSON", obj.Type())
+	}
+}
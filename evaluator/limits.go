@@ -0,0 +1,124 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"sync/atomic"
+)
+
+// the approximate sizes, in bytes, charged against a memory limit
+const (
+	OBJECT_SIZE      = 16 // the header every object is charged, and all an integer needs
+	ELEMENT_SIZE     = 16 // an element of an array, a free value, or a binding
+	HASH_PAIR_SIZE   = 48
+	ENVIRONMENT_SIZE = 48
+)
+
+// DEFAULT_MAX_DEPTH is the number of function calls that can be in progress at once
+// when the options leave it out. Each call takes a few kilobytes of the Go stack, so
+// runaway recursion fails long before it would overflow.
+const DEFAULT_MAX_DEPTH = 10_000
+
+// AllocationSize estimates the bytes a new object takes, not counting the objects it
+// refers to, which are charged when they are made. Booleans, null and small integers
+// are shared, so they take nothing.
+func AllocationSize(obj object.Object) int {
+	switch obj := obj.(type) {
+	case *object.Boolean, *object.Null:
+		return 0
+	case *object.Integer:
+		if object.IsCachedInteger(obj) {
+			return 0
+		}
+		return OBJECT_SIZE
+	case *object.BigInteger:
+		return OBJECT_SIZE + (obj.Value.BitLen()+7)/8
+	case *object.String:
+		return OBJECT_SIZE + len(obj.Value)
+	case *object.Bytes:
+		return OBJECT_SIZE + len(obj.Value)
+	case *object.Array:
+		return OBJECT_SIZE + ELEMENT_SIZE*len(obj.Elements)
+	case *object.Hash:
+		return OBJECT_SIZE + HASH_PAIR_SIZE*len(obj.Pairs)
+	case *object.Closure:
+		return OBJECT_SIZE + ELEMENT_SIZE*len(obj.Free)
+	default:
+		return OBJECT_SIZE
+	}
+}
+
+// Budget counts the steps and memory a program uses, shared by the program and every
+// task it spawns, so that splitting the work across tasks does not get around the limits.
+// It is safe for concurrent use. The virtual machine keeps its runs within one too.
+type Budget struct {
+	steps     atomic.Int64
+	allocated atomic.Int64
+}
+
+// Step counts a step taken, failing once there are more than maxSteps, unless it is zero.
+func (budget *Budget) Step(maxSteps int) *object.Error {
+	if maxSteps <= 0 {
+		return nil
+	}
+
+	if budget.steps.Add(1) > int64(maxSteps) {
+		return newError("step limit exceeded: %d steps", maxSteps)
+	}
+
+	return nil
+}
+
+// Charge adds bytes to the memory allocated so far, failing once it is more than
+// maxMemory, unless it is zero.
+func (budget *Budget) Charge(size, maxMemory int) *object.Error {
+	if maxMemory <= 0 {
+		return nil
+	}
+
+	if budget.allocated.Add(int64(size)) > int64(maxMemory) {
+		return newError("memory limit exceeded: %d bytes", maxMemory)
+	}
+
+	return nil
+}
+
+// step counts a node evaluated, failing once there are more than the limit allows. A try
+// can catch the error, but every step after it fails again, its handler's first one too.
+func (evaluation *evaluation) step() *object.Error {
+	return evaluation.budget.Step(evaluation.options.MaxSteps)
+}
+
+// allocate charges a new object against the memory limit, returning an error in its
+// place once the limit is exceeded. Errors are passed along uncharged.
+func (evaluation *evaluation) allocate(obj object.Object) object.Object {
+	if evaluation.options.MaxMemory <= 0 || isError(obj) {
+		return obj
+	}
+
+	if err := evaluation.charge(AllocationSize(obj)); err != nil {
+		return err
+	}
+
+	return obj
+}
+
+// charge adds bytes to the memory the evaluation has allocated so far, failing once
+// it is more than the limit allows. Memory is never given back, so the limit bounds
+// everything the program allocates rather than what it holds at any one time, and every
+// allocation after a caught error fails again.
+func (evaluation *evaluation) charge(size int) *object.Error {
+	return evaluation.budget.Charge(size, evaluation.options.MaxMemory)
+}
+
+// MaxDepth returns the number of function calls the options let be in progress at once,
+// zero if unlimited. The virtual machine applies it too, so both engines agree.
+func MaxDepth(options Options) int {
+	switch {
+	case options.MaxDepth < 0:
+		return 0
+	case options.MaxDepth == 0:
+		return DEFAULT_MAX_DEPTH
+	default:
+		return options.MaxDepth
+	}
+}
@@ -0,0 +1,197 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"sync/atomic"
+)
+
+// GENSYM names the function that macro bodies call for an identifier no other code uses.
+const GENSYM = "gensym"
+
+// gensyms counts the names made up so far, so every one of them is different. The
+// names contain a # so that they cannot clash with the identifiers of any source.
+var gensyms int64
+
+// gensym makes up a new name, based on the name given.
+func gensym(name string) string {
+	return fmt.Sprintf("%s#%d", name, atomic.AddInt64(&gensyms, 1))
+}
+
+// gensymBuiltin returns a quoted new identifier to macro bodies.
+var gensymBuiltin = &object.Builtin{
+	Fn: func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+
+		name := gensym(GENSYM)
+		return &object.Quote{Node: &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}}
+	},
+}
+
+// DefineMacros binds the macros defined by the top-level let statements of the program
+// in the environment, and removes those statements from the program.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+		literal, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+
+		env.Set(let.Name.Value, &object.Macro{Parameters: literal.Parameters, Body: literal.Body, Env: env})
+	}
+
+	// clear the tail so the removed statements can be collected
+	for i := len(statements); i < len(program.Statements); i++ {
+		program.Statements[i] = nil
+	}
+	program.Statements = statements
+}
+
+// ExpandMacros returns a copy of the program in which every call to a macro bound in
+// the environment is replaced by the code the macro returns. The macro receives its
+// arguments quoted, and has to return a quote. The first macro that fails stops the
+// expansion with its error.
+//
+// Expansion is hygienic: the names that the code of the macro binds, outside of the
+// arguments, are renamed so they can neither capture nor clobber the names of the code
+// around the call. Macro bodies can also call gensym for names of their own.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	return ExpandMacrosWithOptions(context.Background(), program, env, Options{})
+}
+
+// ExpandMacrosWithOptions expands the macros like ExpandMacros, evaluating their bodies
+// with the options, so that the limits of a program cover its macros as well.
+func ExpandMacrosWithOptions(ctx context.Context, program ast.Node, env *object.Environment, options Options) (ast.Node, *object.Error) {
+	evaluation := newEvaluation(ctx, options)
+
+	var err *object.Error
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+		macro, ok := isMacroCall(call, env)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != len(macro.Parameters) {
+			err = locate(newError("wrong number of arguments: want=%d, got=%d", len(macro.Parameters), len(call.Arguments)), call.Token).(*object.Error)
+			return node
+		}
+
+		// the parameters are bound to the unevaluated arguments
+		extendedEnv := object.NewEnclosedEnvironment(macro.Env)
+		extendedEnv.Set(GENSYM, gensymBuiltin)
+		for i, parameter := range macro.Parameters {
+			extendedEnv.Set(parameter.Value, &object.Quote{Node: call.Arguments[i]})
+		}
+
+		evaluated := evaluation.eval(macro.Body, extendedEnv)
+		if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+			evaluated = returnValue.Value
+		}
+		if isError(evaluated) {
+			err = locate(evaluated, call.Token).(*object.Error)
+			return node
+		}
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			err = locate(newError("macro %s returned %s, want %s", call.Function, evaluated.Type(), object.QUOTE_OBJ), call.Token).(*object.Error)
+			return node
+		}
+
+		return hygienic(quote.Node, call.Arguments)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expanded, nil
+}
+
+// isMacroCall returns the macro a call is to, if the function called is an identifier bound to one.
+func isMacroCall(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+// hygienic renames the names bound by the code of a macro expansion, leaving the
+// arguments of the call in it untouched, since they belong to the code around the call.
+func hygienic(expansion ast.Node, arguments []ast.Expression) ast.Node {
+	isArgument := map[ast.Node]bool{}
+	for _, argument := range arguments {
+		isArgument[argument] = true
+	}
+	keep := func(node ast.Node) bool { return isArgument[node] }
+
+	// the names bound by let statements and parameters outside of the arguments
+	renamed := map[string]string{}
+	ast.Inspect(expansion, func(node ast.Node) bool {
+		if keep(node) {
+			return false
+		}
+
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			renamed[node.Name.Value] = ""
+		case *ast.FunctionLiteral:
+			for _, parameter := range node.Parameters {
+				renamed[parameter.Value] = ""
+			}
+		}
+		return true
+	})
+	if len(renamed) == 0 {
+		return expansion
+	}
+	for name := range renamed {
+		renamed[name] = gensym(name)
+	}
+
+	rename := func(identifier *ast.Identifier) *ast.Identifier {
+		name, ok := renamed[identifier.Value]
+		if !ok {
+			return identifier
+		}
+
+		tok := identifier.Token
+		tok.Literal = name
+		return &ast.Identifier{Token: tok, Value: name}
+	}
+
+	return ast.ModifyExcept(expansion, keep, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			return rename(node)
+		case *ast.LetStatement:
+			// the node is already a copy, but its name is not
+			node.Name = rename(node.Name)
+		}
+		return node
+	})
+}
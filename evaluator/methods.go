@@ -0,0 +1,63 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"strings"
+)
+
+// the methods are registered on init since the builtins they call are
+func init() {
+	object.RegisterMethods(object.ARRAY_OBJ, methodsOf(
+		"len", "first", "last", "rest", "push", "pop", "concat", "map", "filter", "reduce", "sort",
+	))
+	object.RegisterMethods(object.STRING_OBJ, methodsOf("len", "to_bytes"))
+	object.RegisterMethods(object.STRING_OBJ, object.MethodTable{
+		"upper": {Fn: stringCase("upper", strings.ToUpper)},
+		"lower": {Fn: stringCase("lower", strings.ToLower)},
+	})
+	object.RegisterMethods(object.BYTES_OBJ, methodsOf("len", "to_string", "hex_encode"))
+	object.RegisterMethods(object.HASH_OBJ, methodsOf(
+		"len", "keys", "values", "has_key", "delete", "merge",
+	))
+	object.RegisterMethods(object.TASK_OBJ, object.MethodTable{
+		"join":   {Fn: taskJoin},
+		"result": {Fn: taskResult},
+	})
+	object.RegisterMethods(object.CHANNEL_OBJ, methodsOf("send", "recv", "close"))
+}
+
+// methodsOf returns a method table of the builtins with the names, which take the
+// object the method is called on first.
+func methodsOf(names ...string) object.MethodTable {
+	methods := make(object.MethodTable, len(names))
+	for _, name := range names {
+		methods[name] = builtins[name]
+	}
+
+	return methods
+}
+
+// stringCase returns a builtin that converts the case of a string with the conversion.
+func stringCase(name string, conversion func(string) string) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		str, ok := args[0].(*object.String)
+		if !ok {
+			return newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+		}
+
+		return &object.String{Value: conversion(str.Value)}
+	}
+}
+
+// evalMethod returns the method of the receiver with the name bound to it.
+func evalMethod(receiver object.Object, name string) object.Object {
+	method, ok := object.LookupMethod(receiver, name)
+	if !ok {
+		return newError("undefined method %s for %s", name, receiver.Type())
+	}
+
+	return method
+}
@@ -0,0 +1,68 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"plugin"
+	"sort"
+	"sync"
+)
+
+// PLUGIN_SYMBOL names the variable through which a Go plugin provides its builtins. It
+// has to be a map[string]object.BuiltinFunction, as in:
+//
+//	package main
+//
+//	var Builtins = map[string]object.BuiltinFunction{
+//		"shout": func(args ...object.Object) object.Object { ... },
+//	}
+//
+// built with go build -buildmode=plugin against the same version of this module.
+const PLUGIN_SYMBOL = "Builtins"
+
+// loadedPlugins holds the paths of the plugins loaded so far, which loading again does not repeat.
+var (
+	loadedPlugins   = map[string]bool{}
+	loadedPluginsMu sync.Mutex
+)
+
+// LoadPlugin opens the Go plugin at the path and registers the builtins it provides,
+// in the order of their names. Like RegisterBuiltin, it has to be called before any
+// program is compiled or run.
+func LoadPlugin(path string) error {
+	loadedPluginsMu.Lock()
+	defer loadedPluginsMu.Unlock()
+
+	if loadedPlugins[path] {
+		return nil
+	}
+
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+
+	symbol, err := p.Lookup(PLUGIN_SYMBOL)
+	if err != nil {
+		return err
+	}
+	functions, ok := symbol.(*map[string]object.BuiltinFunction)
+	if !ok {
+		return fmt.Errorf("%s is %T, want map[string]object.BuiltinFunction", PLUGIN_SYMBOL, symbol)
+	}
+
+	names := make([]string, 0, len(*functions))
+	for name := range *functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := RegisterBuiltin(name, &object.Builtin{Fn: (*functions)[name]}); err != nil {
+			return err
+		}
+	}
+
+	loadedPlugins[path] = true
+	return nil
+}
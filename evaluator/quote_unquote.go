@@ -0,0 +1,110 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+)
+
+// the names of the special forms for metaprogramming, whose arguments are not evaluated first
+const (
+	QUOTE   = "quote"
+	UNQUOTE = "unquote"
+)
+
+// quote returns the expression as a quote without evaluating it, except for the
+// arguments of the unquote calls inside, whose values take the place of the calls.
+func (evaluation *evaluation) quote(call *ast.CallExpression, env *object.Environment) object.Object {
+	if len(call.Arguments) != 1 {
+		return newError("wrong number of arguments to %s: want=1, got=%d", QUOTE, len(call.Arguments))
+	}
+
+	var err *object.Error
+	node := ast.Modify(call.Arguments[0], func(node ast.Node) ast.Node {
+		unquote, ok := node.(*ast.CallExpression)
+		if !ok || !isSpecialForm(unquote, UNQUOTE) || err != nil {
+			return node
+		}
+
+		if len(unquote.Arguments) != 1 {
+			err = locate(newError("wrong number of arguments to %s: want=1, got=%d", UNQUOTE, len(unquote.Arguments)), unquote.Token).(*object.Error)
+			return node
+		}
+
+		value := evaluation.eval(unquote.Arguments[0], env)
+		if isError(value) {
+			err = value.(*object.Error)
+			return node
+		}
+
+		converted, ok := objectToNode(value, unquote.Token)
+		if !ok {
+			err = locate(newError("cannot %s %s", UNQUOTE, value.Type()), unquote.Token).(*object.Error)
+			return node
+		}
+
+		return converted
+	})
+	if err != nil {
+		return err
+	}
+
+	return &object.Quote{Node: node}
+}
+
+// objectToNode converts the value of an unquote back into the expression it stands for,
+// positioned where the unquote was. It fails for values no literal can express.
+func objectToNode(obj object.Object, position token.Token) (ast.Node, bool) {
+	at := func(tokenType token.TokenType, literal string) token.Token {
+		return token.Token{Type: tokenType, Literal: literal, Line: position.Line, Column: position.Column}
+	}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{Token: at(token.INT, strconv.FormatInt(obj.Value, 10)), Value: obj.Value}, true
+	case *object.Boolean:
+		if obj.Value {
+			return &ast.Boolean{Token: at(token.TRUE, "true"), Value: true}, true
+		}
+		return &ast.Boolean{Token: at(token.FALSE, "false"), Value: false}, true
+	case *object.String:
+		return &ast.StringLiteral{Token: at(token.STRING, obj.Value), Value: obj.Value}, true
+	case *object.Bytes:
+		return &ast.BytesLiteral{Token: at(token.BYTES, string(obj.Value)), Value: string(obj.Value)}, true
+	case *object.Array:
+		elements := make([]ast.Expression, len(obj.Elements))
+		for i, element := range obj.Elements {
+			node, ok := objectToNode(element, position)
+			if !ok {
+				return nil, false
+			}
+			elements[i] = node.(ast.Expression)
+		}
+		return &ast.ArrayLiteral{Token: at(token.LBRACKET, "["), Elements: elements}, true
+	case *object.Hash:
+		pairs := make([]*ast.HashLiteralPair, 0, len(obj.Pairs))
+		for _, pair := range sortedPairs(obj) {
+			key, ok := objectToNode(pair.Key, position)
+			if !ok {
+				return nil, false
+			}
+			value, ok := objectToNode(pair.Value, position)
+			if !ok {
+				return nil, false
+			}
+			pairs = append(pairs, &ast.HashLiteralPair{Key: key.(ast.Expression), Value: value.(ast.Expression)})
+		}
+		return &ast.HashLiteral{Token: at(token.LBRACE, "{"), Pairs: pairs}, true
+	case *object.Quote:
+		return obj.Node, true
+	}
+
+	return nil, false
+}
+
+// isSpecialForm reports whether the call is to the special form with the name.
+func isSpecialForm(call *ast.CallExpression, name string) bool {
+	identifier, ok := call.Function.(*ast.Identifier)
+	return ok && identifier.Value == name
+}
@@ -0,0 +1,160 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// evalSpawnExpression starts a task that calls the function without arguments on a
+// goroutine of its own, in an evaluation of its own with the same options but the
+// importer, which need not be safe for concurrent use, so tasks cannot import. The task
+// draws on the budget of the evaluation, so the limits bound the program and its tasks
+// together.
+//
+// The task gets copies of the environments the function can reach, so neither it nor
+// the program sees the bindings the other makes afterwards. Arrays, hashes and the
+// other values are never changed in place, so those are shared.
+func (evaluation *evaluation) evalSpawnExpression(expression *ast.SpawnExpression, env *object.Environment) object.Object {
+	function := evaluation.eval(expression.Function, env)
+	if isError(function) {
+		return function
+	}
+	if _, ok := function.(*object.Function); !ok {
+		return newError("cannot spawn %s", function.Type())
+	}
+
+	isolated := (&isolation{
+		environments: map[*object.Environment]*object.Environment{},
+		objects:      map[object.Object]object.Object{},
+	}).object(function)
+
+	options := evaluation.options
+	options.Importer = nil
+	return object.NewTask(func() object.Object {
+		task := newEvaluation(evaluation.ctx, options)
+		task.budget = evaluation.budget
+		task.spawned = true
+		result := task.applyFunction(isolated, nil)
+		if result == nil {
+			return NULL
+		}
+		return result
+	})
+}
+
+// isolation copies the environments the objects can reach for a task, copying each one
+// and each object that reaches one only once.
+type isolation struct {
+	environments map[*object.Environment]*object.Environment
+	objects      map[object.Object]object.Object
+}
+
+// object returns the object, or a copy of it if it reaches an environment.
+func (isolation *isolation) object(obj object.Object) object.Object {
+	if copied, ok := isolation.objects[obj]; ok {
+		return copied
+	}
+
+	var copied object.Object = obj
+	switch obj := obj.(type) {
+	case *object.Function:
+		function := *obj
+		isolation.objects[obj] = &function
+		function.Env = isolation.environment(obj.Env)
+		return &function
+	case *object.Macro:
+		macro := *obj
+		isolation.objects[obj] = &macro
+		macro.Env = isolation.environment(obj.Env)
+		return &macro
+	case *object.Array:
+		elements := make([]object.Object, len(obj.Elements))
+		changed := false
+		for i, element := range obj.Elements {
+			elements[i] = isolation.object(element)
+			changed = changed || elements[i] != element
+		}
+		if changed {
+			array := &object.Array{Elements: elements}
+			if obj.IsFrozen() {
+				array.Freeze()
+			}
+			copied = array
+		}
+	case *object.Hash:
+		pairs := make(map[object.HashKey]object.HashPair, len(obj.Pairs))
+		changed := false
+		for key, pair := range obj.Pairs {
+			value := isolation.object(pair.Value)
+			pairs[key] = object.HashPair{Key: pair.Key, Value: value}
+			changed = changed || value != pair.Value
+		}
+		if changed {
+			hash := &object.Hash{Pairs: pairs}
+			if obj.IsFrozen() {
+				hash.Freeze()
+			}
+			copied = hash
+		}
+	}
+
+	isolation.objects[obj] = copied
+	return copied
+}
+
+// environment returns a copy of the environment and of those around it, whose bindings
+// are isolated in turn.
+func (isolation *isolation) environment(env *object.Environment) *object.Environment {
+	if env == nil {
+		return nil
+	}
+	if copied, ok := isolation.environments[env]; ok {
+		return copied
+	}
+
+	copied := env.Copy(isolation.environment(env.Outer()))
+	isolation.environments[env] = copied
+	copied.Replace(isolation.object)
+
+	return copied
+}
+
+// taskJoin waits for a task to finish and returns what its function returned, failing
+// with the error of the function if it failed.
+func taskJoin(args ...object.Object) object.Object {
+	task, errObj := taskArgument("join", args)
+	if errObj != nil {
+		return errObj
+	}
+
+	return task.Join()
+}
+
+// taskResult returns what the function of a finished task returned like taskJoin, or
+// null if the task is still running.
+func taskResult(args ...object.Object) object.Object {
+	task, errObj := taskArgument("result", args)
+	if errObj != nil {
+		return errObj
+	}
+
+	result, ok := task.Result()
+	if !ok {
+		return NULL
+	}
+	return result
+}
+
+// taskArgument returns the only argument of a method of tasks.
+func taskArgument(name string, args []object.Object) (*object.Task, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	task, ok := args[0].(*object.Task)
+	if !ok {
+		return nil, newError("argument to `%s` must be TASK, got %s", name, args[0].Type())
+	}
+
+	return task, nil
+}
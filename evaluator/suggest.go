@@ -0,0 +1,67 @@
+package evaluator
+
+// NotFoundMessage describes a name that is not bound, suggesting the candidate that
+// was probably meant instead, if Suggest finds one among the names that are bound.
+func NotFoundMessage(name string, candidates []string) string {
+	message := "identifier not found: " + name
+	if suggestion, ok := Suggest(name, candidates); ok {
+		message += " — did you mean " + suggestion + "?"
+	}
+
+	return message
+}
+
+// Suggest returns the candidate closest to the name in edits, each adding or removing
+// a character or swapping two neighbouring ones, with changing one counting as both
+// removing and adding it, so that names typed short or with letters swapped come
+// before names that merely share some letters. Candidates too far from the name to be
+// a misspelling of it are left out: those needing as many edits as the name has
+// characters, or more than half as many as the longer of the two has. Ties go to the
+// candidate that comes first.
+func Suggest(name string, candidates []string) (string, bool) {
+	best, bestDistance := "", 0
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+
+		distance := editDistance(name, candidate)
+		if distance >= len(name) || 2*distance > max(len(name), len(candidate)) {
+			continue
+		}
+		if best == "" || distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+
+	return best, best != ""
+}
+
+// editDistance returns the number of edits that turn a into b, as Suggest counts them,
+// keeping the last three rows of the table of the distances between their prefixes.
+func editDistance(a, b string) int {
+	previous2 := make([]int, len(b)+1)
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 2
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				current[j] = min(current[j], previous2[j-2]+1)
+			}
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,29 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"strings"
+)
+
+// TRACE_INDENT indents the trace once for every function call in progress.
+const TRACE_INDENT = "  "
+
+// trace writes the node and the object it evaluated to. Nodes are written once they
+// finish, so the operands of an expression come before the expression itself.
+func (evaluation *evaluation) trace(node ast.Node, result object.Object) {
+	switch node.(type) {
+	case *ast.Program, *ast.BlockStatement, *ast.ExpressionStatement:
+		// these only repeat the result of the last node they contain
+		return
+	}
+
+	line := strings.Repeat(TRACE_INDENT, evaluation.depth) + node.String()
+	if result != nil {
+		line += " => " + result.Inspect()
+	}
+
+	// keep one node per line even when a function prints over several
+	fmt.Fprintln(evaluation.options.Trace, strings.ReplaceAll(line, "\n", " "))
+}
@@ -0,0 +1,459 @@
+package format
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+// INDENT is the indentation of one nesting level.
+const INDENT = "  "
+
+// Source parses the source and prints it back in the canonical style. The
+// source is returned unchanged together with the diagnostics if it does not parse.
+func Source(source string) (string, []parser.Diagnostic) {
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		return source, p.Diagnostics()
+	}
+
+	// the parser consumed the whole input, so the lexer has seen every comment
+	printer := &printer{
+		tokens:   tokenize(source),
+		comments: l.Comments(),
+	}
+	printer.statements(program.Statements, printer.tokens[len(printer.tokens)-1])
+
+	return printer.output.String(), nil
+}
+
+// printer writes a program in the canonical style, weaving the comments back in by position.
+type printer struct {
+	output strings.Builder
+	indent int
+
+	// every token of the source, used to find where statements end
+	tokens []token.Token
+
+	// comments that have not been printed yet, in source order
+	comments []token.Token
+
+	// the source line of the last thing printed, or 0 at the start of a block
+	line int
+}
+
+// statements prints a list of statements ending just before the boundary token,
+// which is the closing brace of a block or the end of the input.
+func (printer *printer) statements(statements []ast.Statement, boundary token.Token) {
+	for i, statement := range statements {
+		start := ast.StartToken(statement)
+
+		// the statement ends where the next one, or the enclosing block, begins
+		next := boundary
+		if i+1 < len(statements) {
+			next = ast.StartToken(statements[i+1])
+		}
+		end := printer.lastTokenBefore(next)
+
+		// comments above the statement keep their place
+		printer.commentsBefore(start)
+
+		printer.startLine(start.Line)
+		printer.statement(statement)
+		if printer.needsSemicolon(statement, statements[i+1:]) {
+			printer.write(";")
+		}
+
+		// a comment after the statement on its last line stays at the end of that line
+		if len(printer.comments) != 0 && printer.comments[0].Line == end.Line && before(printer.comments[0], next) {
+			printer.write(" " + printer.comments[0].Literal)
+			printer.comments = printer.comments[1:]
+		}
+		printer.write("\n")
+		printer.line = end.Line
+
+		// comments inside the expression itself cannot be placed, so they follow the statement
+		for len(printer.comments) != 0 && before(printer.comments[0], end) {
+			printer.comment(printer.comments[0])
+		}
+	}
+
+	printer.commentsBefore(boundary)
+}
+
+// statement prints a single statement without its terminating semicolon.
+func (printer *printer) statement(statement ast.Statement) {
+	switch statement := statement.(type) {
+	case *ast.LetStatement:
+		if statement.Exported {
+			printer.write("export ")
+		}
+		printer.write("let " + statement.Name.Value + " = ")
+		printer.expression(statement.Value, parser.LOWEST)
+	case *ast.ReturnStatement:
+		printer.write("return ")
+		printer.expression(statement.ReturnValue, parser.LOWEST)
+	case *ast.ExpressionStatement:
+		printer.expression(statement.Expression, parser.LOWEST)
+	}
+}
+
+// needsSemicolon reports whether the statement must be terminated. Every statement
+// is, except an if, try or select expression that the following statement cannot continue.
+func (printer *printer) needsSemicolon(statement ast.Statement, rest []ast.Statement) bool {
+	expressionStatement, ok := statement.(*ast.ExpressionStatement)
+	if !ok {
+		return true
+	}
+	switch expressionStatement.Expression.(type) {
+	case *ast.IfExpression, *ast.TryExpression, *ast.SelectExpression:
+	default:
+		return true
+	}
+	if len(rest) == 0 {
+		return false
+	}
+
+	// a following call, index, or minus would otherwise apply to the expression
+	next, ok := rest[0].(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	switch leading(next.Expression, parser.LOWEST) {
+	case token.LPAREN, token.LBRACKET, token.MINUS:
+		return true
+	}
+
+	return false
+}
+
+// leading returns the type of the token the expression is printed with first, which
+// can differ from its first token in the source, which may have had parentheses.
+func leading(expression ast.Expression, precedence int) token.TokenType {
+	if precedenceOf(expression) < precedence {
+		return token.LPAREN
+	}
+
+	switch expression := expression.(type) {
+	case *ast.InfixExpression:
+		return leading(expression.Left, parser.Precedence(expression.Token.Type))
+	case *ast.CallExpression:
+		return leading(expression.Function, parser.CALL)
+	case *ast.MethodCallExpression:
+		return leading(expression.Receiver, parser.CALL)
+	case *ast.IndexExpression:
+		return leading(expression.Left, parser.CALL)
+	case *ast.SliceExpression:
+		return leading(expression.Left, parser.CALL)
+	}
+
+	return ast.StartToken(expression).Type
+}
+
+// expression prints an expression, parenthesizing it if it binds less tightly than the context requires.
+func (printer *printer) expression(expression ast.Expression, precedence int) {
+	parenthesize := precedenceOf(expression) < precedence
+	if parenthesize {
+		printer.write("(")
+	}
+
+	switch expression := expression.(type) {
+	case *ast.Identifier:
+		printer.write(expression.Value)
+	case *ast.IntegerLiteral:
+		printer.write(expression.Token.Literal)
+	case *ast.Boolean:
+		printer.write(expression.Token.Literal)
+	case *ast.StringLiteral:
+		printer.write(quote(expression.Value))
+	case *ast.BytesLiteral:
+		printer.write(ast.QuoteBytes([]byte(expression.Value)))
+	case *ast.PrefixExpression:
+		printer.write(expression.Operator)
+		printer.expression(expression.Right, parser.PREFIX)
+	case *ast.SpawnExpression:
+		printer.write("spawn ")
+		printer.expression(expression.Function, parser.PREFIX)
+	case *ast.InfixExpression:
+		// operators are left associative, so a right operand of equal precedence needs parentheses
+		operator := parser.Precedence(expression.Token.Type)
+		printer.expression(expression.Left, operator)
+		printer.write(" " + expression.Operator + " ")
+		printer.expression(expression.Right, operator+1)
+	case *ast.IfExpression:
+		printer.write("if (")
+		printer.expression(expression.Condition, parser.LOWEST)
+		printer.write(") ")
+		printer.block(expression.Consequence)
+		if expression.Alternative != nil {
+			printer.write(" else ")
+			printer.block(expression.Alternative)
+		}
+	case *ast.TryExpression:
+		printer.write("try ")
+		printer.block(expression.Body)
+		printer.write(" catch (" + expression.Parameter.Value + ") ")
+		printer.block(expression.Handler)
+	case *ast.SelectExpression:
+		printer.selectCases(expression.Cases)
+	case *ast.FunctionLiteral:
+		printer.write("fn(")
+		for i, parameter := range expression.Parameters {
+			if i != 0 {
+				printer.write(", ")
+			}
+			printer.write(parameter.Value)
+		}
+		printer.write(") ")
+		printer.block(expression.Body)
+	case *ast.MacroLiteral:
+		printer.write("macro(")
+		for i, parameter := range expression.Parameters {
+			if i != 0 {
+				printer.write(", ")
+			}
+			printer.write(parameter.Value)
+		}
+		printer.write(") ")
+		printer.block(expression.Body)
+	case *ast.CallExpression:
+		printer.expression(expression.Function, parser.CALL)
+		if expression.Optional {
+			printer.write("?")
+		}
+		printer.write("(")
+		printer.expressions(expression.Arguments)
+		printer.write(")")
+	case *ast.MethodCallExpression:
+		printer.expression(expression.Receiver, parser.CALL)
+		printer.write("." + expression.Method.Value + "(")
+		printer.expressions(expression.Arguments)
+		printer.write(")")
+	case *ast.ArrayLiteral:
+		printer.write("[")
+		printer.expressions(expression.Elements)
+		printer.write("]")
+	case *ast.HashLiteral:
+		printer.write("{")
+		for i, pair := range expression.Pairs {
+			if i != 0 {
+				printer.write(", ")
+			}
+			printer.expression(pair.Key, parser.LOWEST)
+			printer.write(": ")
+			printer.expression(pair.Value, parser.LOWEST)
+		}
+		printer.write("}")
+	case *ast.IndexExpression:
+		printer.expression(expression.Left, parser.CALL)
+		if expression.Optional {
+			printer.write("?")
+		}
+		printer.write("[")
+		printer.expression(expression.Index, parser.LOWEST)
+		printer.write("]")
+	case *ast.SliceExpression:
+		printer.expression(expression.Left, parser.CALL)
+		if expression.Optional {
+			printer.write("?")
+		}
+		printer.write("[")
+		if expression.Start != nil {
+			printer.expression(expression.Start, parser.LOWEST)
+		}
+		printer.write(":")
+		if expression.End != nil {
+			printer.expression(expression.End, parser.LOWEST)
+		}
+		printer.write("]")
+	}
+
+	if parenthesize {
+		printer.write(")")
+	}
+}
+
+// expressions prints a comma separated list of expressions.
+func (printer *printer) expressions(expressions []ast.Expression) {
+	for i, expression := range expressions {
+		if i != 0 {
+			printer.write(", ")
+		}
+		printer.expression(expression, parser.LOWEST)
+	}
+}
+
+// selectCases prints the cases of a select expression in braces, each on a line of its
+// own, with a body of a single expression printed without braces.
+func (printer *printer) selectCases(cases []*ast.SelectCase) {
+	if len(cases) == 0 {
+		printer.write("select {}")
+		return
+	}
+
+	printer.write("select {\n")
+	printer.indent++
+	for i, selectCase := range cases {
+		printer.write(strings.Repeat(INDENT, printer.indent))
+		if selectCase.Name != nil {
+			printer.write(selectCase.Name.Value + " = ")
+		}
+		printer.expression(selectCase.Channel, parser.LOWEST)
+		printer.write(" => ")
+
+		// a body that starts with a hash literal would be read back as a block
+		statement, ok := singleExpression(selectCase.Body)
+		if ok && leading(statement.Expression, parser.LOWEST) != token.LBRACE {
+			printer.expression(statement.Expression, parser.LOWEST)
+		} else {
+			printer.block(selectCase.Body)
+		}
+
+		if i+1 < len(cases) {
+			printer.write(",")
+		}
+		printer.write("\n")
+	}
+	printer.indent--
+	printer.write(strings.Repeat(INDENT, printer.indent) + "}")
+}
+
+// singleExpression returns the statement of a block that holds only an expression.
+func singleExpression(block *ast.BlockStatement) (*ast.ExpressionStatement, bool) {
+	if len(block.Statements) != 1 {
+		return nil, false
+	}
+
+	statement, ok := block.Statements[0].(*ast.ExpressionStatement)
+	return statement, ok
+}
+
+// block prints a braced block with its statements indented one level.
+func (printer *printer) block(block *ast.BlockStatement) {
+	// an empty block stays on one line
+	if len(block.Statements) == 0 && (len(printer.comments) == 0 || !before(printer.comments[0], block.Closing)) {
+		printer.write("{}")
+		return
+	}
+
+	printer.write("{\n")
+	printer.indent++
+	printer.line = 0
+
+	printer.statements(block.Statements, block.Closing)
+
+	printer.indent--
+	printer.write(strings.Repeat(INDENT, printer.indent) + "}")
+	printer.line = block.Closing.Line
+}
+
+// commentsBefore prints, each on its own line, the comments that come before the token.
+func (printer *printer) commentsBefore(tok token.Token) {
+	for len(printer.comments) != 0 && before(printer.comments[0], tok) {
+		printer.comment(printer.comments[0])
+	}
+}
+
+// comment prints the comment on its own line and removes it from the pending comments.
+func (printer *printer) comment(comment token.Token) {
+	printer.startLine(comment.Line)
+	printer.write(comment.Literal + "\n")
+	printer.line = comment.Line
+	printer.comments = printer.comments[1:]
+}
+
+// startLine indents a new output line, keeping a single blank line where the source had any.
+func (printer *printer) startLine(line int) {
+	if printer.line != 0 && line > printer.line+1 {
+		printer.write("\n")
+	}
+	printer.write(strings.Repeat(INDENT, printer.indent))
+}
+
+// lastTokenBefore returns the last token of the source that starts before the given one.
+func (printer *printer) lastTokenBefore(tok token.Token) token.Token {
+	var last token.Token
+	for _, candidate := range printer.tokens {
+		if !before(candidate, tok) {
+			break
+		}
+		last = candidate
+	}
+
+	return last
+}
+
+// write appends text to the output.
+func (printer *printer) write(text string) {
+	printer.output.WriteString(text)
+}
+
+// tokenize returns every token of the source, ending with the EOF token.
+func tokenize(source string) []token.Token {
+	l := lexer.New(source)
+
+	var tokens []token.Token
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
+// precedenceOf returns how tightly an expression binds, for deciding on parentheses.
+func precedenceOf(expression ast.Expression) int {
+	switch expression := expression.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(expression.Token.Type)
+	case *ast.PrefixExpression, *ast.SpawnExpression:
+		return parser.PREFIX
+	case *ast.CallExpression, *ast.MethodCallExpression, *ast.IndexExpression, *ast.SliceExpression:
+		return parser.CALL
+	}
+
+	// literals and identifiers never need parentheses
+	return parser.INDEX + 1
+}
+
+// before reports whether token a starts before token b in the source.
+func before(a, b token.Token) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// quote returns the string as a literal that the lexer reads back as the same value,
+// with the control characters other than newlines, tabs and carriage returns as hex.
+func quote(value string) string {
+	var output strings.Builder
+
+	output.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch char := value[i]; char {
+		case '\\', '"':
+			output.WriteByte('\\')
+			output.WriteByte(char)
+		case '\n':
+			output.WriteString(`\n`)
+		case '\t':
+			output.WriteString(`\t`)
+		case '\r':
+			output.WriteString(`\r`)
+		default:
+			if char < ' ' || char == 0x7f {
+				fmt.Fprintf(&output, `\x%02x`, char)
+			} else {
+				output.WriteByte(char)
+			}
+		}
+	}
+	output.WriteByte('"')
+
+	return output.String()
+}
@@ -0,0 +1,373 @@
+package format
+
+import (
+	"fmt"
+	"math/rand"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5+3*  (2-1)", "let x = 5 + 3 * (2 - 1);\n"},
+		{"return  x;", "return x;\n"},
+		{"-a * !b", "-a * !b;\n"},
+		{"(spawn  f) .join()+spawn(g)", "(spawn f).join() + spawn g;\n"},
+		{"(1 - (2 - 3)) - 4", "1 - (2 - 3) - 4;\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"(-a)[0]", "(-a)[0];\n"},
+		{"add(1,2)(3)[4]", "add(1, 2)(3)[4];\n"},
+		{"s[1 :-1]+s[ : 2]+s[x:]", "s[1:-1] + s[:2] + s[x:];\n"},
+		{"try{f()}catch(e){e};1", "try {\n  f();\n} catch (e) {\n  e;\n}\n1;\n"},
+		{"let x=try{1}catch(e){}", "let x = try {\n  1;\n} catch (e) {};\n"},
+		{"select{v=ch=>{v*2},timeout(1)=>{f();0}};-1", "select {\n  v = ch => v * 2,\n  timeout(1) => {\n    f();\n    0;\n  }\n};\n-1;\n"},
+		{"let x=select{}", "let x = select {};\n"},
+		{"select{ch=>({a:1})}", "select {\n  ch => {\n    {a: 1};\n  }\n}\n"},
+		{`"a\"b\n"`, "\"a\\\"b\\n\";\n"},
+		{"[1,2,  [3]]", "[1, 2, [3]];\n"},
+		{`{"a":1,  b:{}}["a"]`, "{\"a\": 1, b: {}}[\"a\"];\n"},
+		{"let h={}", "let h = {};\n"},
+		{"let e = fn(){}", "let e = fn() {};\n"},
+		{"let x = 1; let y = 2;", "let x = 1;\nlet y = 2;\n"},
+		{
+			"let add=fn(a,b){a+b}",
+			"let add = fn(a, b) {\n  a + b;\n};\n",
+		},
+		{
+			"let unless=macro(c,a){quote(if(!unquote(c)){unquote(a)})}",
+			"let unless = macro(c, a) {\n  quote(if (!unquote(c)) {\n    unquote(a);\n  });\n};\n",
+		},
+		{"export  let x=1", "export let x = 1;\n"},
+		{"h?[ \"a\" ]?( 1 ,2)", "h?[\"a\"]?(1, 2);\n"},
+		{"( -a ) . push( 1 ).len()", "(-a).push(1).len();\n"},
+		{`b"\x41\"\x00"`, "b\"A\\\"\\x00\";\n"},
+		{`"\x00\x1b\x41é"`, "\"\\x00\\x1bAé\";\n"},
+		{
+			"if(x>3){puts(\"big\")}else{x}",
+			"if (x > 3) {\n  puts(\"big\");\n} else {\n  x;\n}\n",
+		},
+		{
+			"if (x) { 1 }; -1",
+			"if (x) {\n  1;\n};\n-1;\n",
+		},
+		{
+			"if (x) { 1 }; (try { f } catch (e) { g })(1)",
+			"if (x) {\n  1;\n}\ntry {\n  f;\n} catch (e) {\n  g;\n}(1);\n",
+		},
+		{
+			"if (x) { 1 }; (-a)[0]",
+			"if (x) {\n  1;\n};\n(-a)[0];\n",
+		},
+		{
+			"let x = 1;\n\n\n\nlet y = 2;",
+			"let x = 1;\n\nlet y = 2;\n",
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, diagnostics := Source(tt.input)
+		if len(diagnostics) != 0 {
+			t.Errorf("unexpected diagnostics for %q: %v", tt.input, diagnostics)
+			continue
+		}
+
+		if formatted != tt.expected {
+			t.Errorf("wrong format for %q. expected=%q, got=%q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestSourceKeepsComments(t *testing.T) {
+	input := `// header
+
+let x=5;   // five
+let f=fn(a){
+// inside
+a   // the argument
+// end of body
+};
+// footer`
+
+	expected := `// header
+
+let x = 5; // five
+let f = fn(a) {
+  // inside
+  a; // the argument
+  // end of body
+};
+// footer
+`
+
+	formatted, diagnostics := Source(input)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	if formatted != expected {
+		t.Errorf("wrong format. expected=\n%s\ngot=\n%s", expected, formatted)
+	}
+}
+
+func TestSourceIsIdempotent(t *testing.T) {
+	inputs := []string{
+		"let x=5+3*  (2-1); // trailing\nlet f = fn(a) { if (a) { a } else { -a } }",
+		"// only a comment",
+		"let a = [1, 2][0]; puts(a - (1 - 2))",
+	}
+
+	for _, input := range inputs {
+		once, _ := Source(input)
+		twice, _ := Source(once)
+
+		if once != twice {
+			t.Errorf("formatting is not stable for %q. first=%q, second=%q", input, once, twice)
+		}
+	}
+}
+
+func TestSourceWithParseErrors(t *testing.T) {
+	input := "let = 5;"
+
+	formatted, diagnostics := Source(input)
+	if len(diagnostics) == 0 {
+		t.Fatalf("expected diagnostics for %q", input)
+	}
+
+	if formatted != input {
+		t.Errorf("source was changed despite errors. got=%q", formatted)
+	}
+}
+
+func TestSourceRoundTrip(t *testing.T) {
+	generator := &programGenerator{rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 2000; i++ {
+		testRoundTrip(t, generator.program())
+	}
+}
+
+func FuzzSource(f *testing.F) {
+	generator := &programGenerator{rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 20; i++ {
+		f.Add(generator.program())
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+		testRoundTrip(t, input)
+	})
+}
+
+// testRoundTrip checks that the formatted source parses into the same program as the
+// source, and formats into itself.
+func testRoundTrip(t *testing.T, source string) {
+	t.Helper()
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("source does not parse: %q\n%s", p.Errors(), source)
+	}
+
+	formatted, diagnostics := Source(source)
+	if len(diagnostics) != 0 {
+		t.Fatalf("source does not format: %v\n%s", diagnostics, source)
+	}
+
+	p = parser.New(lexer.New(formatted))
+	reparsed := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("formatted source does not parse: %q\nsource:\n%s\nformatted:\n%s", p.Errors(), source, formatted)
+	}
+	if !ast.Equal(program, reparsed) {
+		t.Fatalf("formatted source parses differently\nsource:\n%s\nformatted:\n%s\nprogram: %s\nreparsed: %s", source, formatted, program, reparsed)
+	}
+
+	if twice, _ := Source(formatted); twice != formatted {
+		t.Fatalf("formatting is not stable\nfirst:\n%s\nsecond:\n%s", formatted, twice)
+	}
+}
+
+// programGenerator writes random programs that parse, in every shape of the grammar
+// and with more parentheses and less spacing than the canonical style.
+type programGenerator struct {
+	rand  *rand.Rand
+	depth int
+}
+
+func (generator *programGenerator) program() string {
+	var output strings.Builder
+	for i := generator.rand.Intn(4); i >= 0; i-- {
+		switch generator.rand.Intn(4) {
+		case 0:
+			output.WriteString("export let " + generator.identifier() + "=" + generator.expression() + ";\n")
+		case 1:
+			output.WriteString("// a comment\n" + generator.statement() + "; // another\n")
+		default:
+			output.WriteString(generator.statement() + ";\n")
+		}
+	}
+
+	return output.String()
+}
+
+func (generator *programGenerator) statement() string {
+	switch generator.rand.Intn(5) {
+	case 0:
+		return "let " + generator.identifier() + " = " + generator.expression()
+	case 1:
+		return "return " + generator.expression()
+	default:
+		return generator.expression()
+	}
+}
+
+func (generator *programGenerator) block() string {
+	statements := make([]string, generator.rand.Intn(3))
+	for i := range statements {
+		statements[i] = generator.statement()
+	}
+
+	return "{ " + strings.Join(statements, "; ") + " }"
+}
+
+func (generator *programGenerator) expression() string {
+	generator.depth++
+	defer func() { generator.depth-- }()
+
+	if generator.depth > 4 {
+		return generator.atom()
+	}
+
+	operators := []string{"+", "-", "*", "/", "%", "<", ">", "<=", ">=", "==", "!=", "??"}
+	switch generator.rand.Intn(18) {
+	case 0:
+		return []string{"-", "!"}[generator.rand.Intn(2)] + generator.expression()
+	case 1, 2:
+		operator := operators[generator.rand.Intn(len(operators))]
+		return generator.expression() + " " + operator + " " + generator.expression()
+	case 3:
+		return "(" + generator.expression() + ")"
+	case 4:
+		return generator.operand() + []string{"(", "?("}[generator.rand.Intn(2)] + generator.expressions() + ")"
+	case 5:
+		return generator.operand() + "." + generator.identifier() + "(" + generator.expressions() + ")"
+	case 6:
+		return generator.operand() + []string{"[", "?["}[generator.rand.Intn(2)] + generator.expression() + "]"
+	case 7:
+		return generator.operand() + "[" + generator.optional() + ":" + generator.optional() + "]"
+	case 8:
+		return "[" + generator.expressions() + "]"
+	case 9:
+		return "fn(" + generator.parameters() + ") " + generator.block()
+	case 10:
+		output := "if (" + generator.expression() + ") " + generator.block()
+		if generator.rand.Intn(2) == 0 {
+			output += " else " + generator.block()
+		}
+		return output
+	case 11:
+		return "try " + generator.block() + " catch (" + generator.identifier() + ") " + generator.block()
+	case 12:
+		return "spawn " + generator.expression()
+	case 13:
+		cases := make([]string, generator.rand.Intn(3))
+		for i := range cases {
+			if generator.rand.Intn(2) == 0 {
+				cases[i] = generator.identifier() + "="
+			}
+			body := generator.block()
+			if generator.rand.Intn(2) == 0 {
+				body = generator.expression()
+				if strings.HasPrefix(body, "{") {
+					body = "(" + body + ")"
+				}
+			}
+			cases[i] += generator.expression() + "=>" + body
+		}
+		return "select {" + strings.Join(cases, ",") + "}"
+	case 14:
+		pairs := make([]string, generator.rand.Intn(3))
+		for i := range pairs {
+			pairs[i] = generator.expression() + ":" + generator.expression()
+		}
+		return "{" + strings.Join(pairs, ",") + "}"
+	default:
+		return generator.atom()
+	}
+}
+
+// operand returns an expression that can be called or indexed as it is.
+func (generator *programGenerator) operand() string {
+	if generator.rand.Intn(2) == 0 {
+		return generator.identifier()
+	}
+	return "(" + generator.expression() + ")"
+}
+
+func (generator *programGenerator) optional() string {
+	if generator.rand.Intn(3) == 0 {
+		return ""
+	}
+	return generator.expression()
+}
+
+func (generator *programGenerator) expressions() string {
+	expressions := make([]string, generator.rand.Intn(3))
+	for i := range expressions {
+		expressions[i] = generator.expression()
+	}
+
+	return strings.Join(expressions, ",")
+}
+
+func (generator *programGenerator) parameters() string {
+	parameters := make([]string, generator.rand.Intn(3))
+	for i := range parameters {
+		parameters[i] = generator.identifier()
+	}
+
+	return strings.Join(parameters, ", ")
+}
+
+func (generator *programGenerator) identifier() string {
+	return []string{"a", "b", "x", "len", "quote", "_tmp"}[generator.rand.Intn(6)]
+}
+
+func (generator *programGenerator) atom() string {
+	switch generator.rand.Intn(6) {
+	case 0:
+		return fmt.Sprint(generator.rand.Intn(1000))
+	case 1:
+		return []string{"true", "false"}[generator.rand.Intn(2)]
+	case 2:
+		return generator.stringLiteral(`"`)
+	case 3:
+		return "b" + generator.stringLiteral(`"`)
+	default:
+		return generator.identifier()
+	}
+}
+
+// stringLiteral returns a literal with escapes and characters that need them.
+func (generator *programGenerator) stringLiteral(quote string) string {
+	pieces := []string{"a", " ", `\n`, `\t`, `\"`, `\\`, `\x00`, `\x7f`, `\xff`, "\x01", "é", `\q`}
+	var output strings.Builder
+	output.WriteString(quote)
+	for i := generator.rand.Intn(5); i > 0; i-- {
+		output.WriteString(pieces[generator.rand.Intn(len(pieces))])
+	}
+	output.WriteString(quote)
+
+	return output.String()
+}
@@ -0,0 +1,141 @@
+// Package highlight classifies the tokens of a program for editors, so that syntax
+// highlighters and the semantic tokens of a language server color programs alike.
+package highlight
+
+import (
+	"monkey/lexer"
+	"monkey/token"
+	"sort"
+)
+
+// Kind is the class of a token, named like the semantic token types of the language
+// server protocol.
+type Kind string
+
+const (
+	KIND_KEYWORD    Kind = "keyword"
+	KIND_IDENTIFIER Kind = "identifier"
+	KIND_NUMBER     Kind = "number"
+	KIND_STRING     Kind = "string"
+	KIND_OPERATOR   Kind = "operator"
+	KIND_COMMENT    Kind = "comment"
+)
+
+// Position is a place in the source, as a byte offset starting at 0 and as a line and
+// a column of bytes starting at 1.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Token is a classified token, which runs from Start up to but not including End and
+// can span lines, as strings do.
+type Token struct {
+	Kind  Kind
+	Start Position
+	End   Position
+}
+
+// kinds maps the token types that are highlighted to their class. Delimiters and
+// illegal characters are left out.
+var kinds = map[token.TokenType]Kind{
+	token.COMMENT:           KIND_COMMENT,
+	token.IDENT:             KIND_IDENTIFIER,
+	token.INT:               KIND_NUMBER,
+	token.STRING:            KIND_STRING,
+	token.BYTES:             KIND_STRING,
+	token.ASSIGN:            KIND_OPERATOR,
+	token.PLUS:              KIND_OPERATOR,
+	token.MINUS:             KIND_OPERATOR,
+	token.BANG:              KIND_OPERATOR,
+	token.ASTERISK:          KIND_OPERATOR,
+	token.SLASH:             KIND_OPERATOR,
+	token.PERCENT:           KIND_OPERATOR,
+	token.LT:                KIND_OPERATOR,
+	token.GT:                KIND_OPERATOR,
+	token.LT_EQ:             KIND_OPERATOR,
+	token.GT_EQ:             KIND_OPERATOR,
+	token.COALESCE:          KIND_OPERATOR,
+	token.OPTIONAL_LPAREN:   KIND_OPERATOR,
+	token.OPTIONAL_LBRACKET: KIND_OPERATOR,
+	token.EQ:                KIND_OPERATOR,
+	token.NOT_EQ:            KIND_OPERATOR,
+	token.ARROW:             KIND_OPERATOR,
+}
+
+// Tokens returns the classified tokens of the source in source order, comments among
+// them. The source does not have to parse.
+func Tokens(source string) []Token {
+	lines := lineStarts(source)
+
+	var tokens []Token
+	l := lexer.New(source)
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+
+		kind, ok := kindOf(tok.Type)
+		if !ok {
+			continue
+		}
+
+		start := offsetOf(lines, tok.Line, tok.Column)
+		tokens = append(tokens, Token{
+			Kind:  kind,
+			Start: Position{Offset: start, Line: tok.Line, Column: tok.Column},
+			End:   positionOf(lines, l.Offset()),
+		})
+	}
+
+	// comments are collected on the side, so they are merged in by where they start
+	for _, comment := range l.Comments() {
+		start := offsetOf(lines, comment.Line, comment.Column)
+		tokens = append(tokens, Token{
+			Kind:  KIND_COMMENT,
+			Start: Position{Offset: start, Line: comment.Line, Column: comment.Column},
+			End:   positionOf(lines, start+len(comment.Literal)),
+		})
+	}
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].Start.Offset < tokens[j].Start.Offset
+	})
+
+	return tokens
+}
+
+// kindOf returns the class of the token type, and false for those not highlighted.
+func kindOf(tokenType token.TokenType) (Kind, bool) {
+	if token.FUNCTION <= tokenType && tokenType < token.TOKEN_TYPES {
+		return KIND_KEYWORD, true
+	}
+
+	kind, ok := kinds[tokenType]
+	return kind, ok
+}
+
+// lineStarts returns the offsets at which the lines of the source start.
+func lineStarts(source string) []int {
+	starts := []int{0}
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+
+	return starts
+}
+
+// offsetOf returns the offset of the line and column.
+func offsetOf(lines []int, line, column int) int {
+	return lines[line-1] + column - 1
+}
+
+// positionOf returns the position at the offset.
+func positionOf(lines []int, offset int) Position {
+	line := sort.Search(len(lines), func(i int) bool { return lines[i] > offset })
+
+	return Position{Offset: offset, Line: line, Column: offset - lines[line-1] + 1}
+}
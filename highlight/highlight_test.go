@@ -0,0 +1,139 @@
+package highlight
+
+import (
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	type span struct {
+		kind   Kind
+		text   string
+		line   int
+		column int
+	}
+
+	tests := []struct {
+		input    string
+		expected []span
+	}{
+		{
+			"let x = 5;",
+			[]span{
+				{KIND_KEYWORD, "let", 1, 1},
+				{KIND_IDENTIFIER, "x", 1, 5},
+				{KIND_OPERATOR, "=", 1, 7},
+				{KIND_NUMBER, "5", 1, 9},
+			},
+		},
+		{
+			"// add\nfn(a, b) { a + b } // sum  \n",
+			[]span{
+				{KIND_COMMENT, "// add", 1, 1},
+				{KIND_KEYWORD, "fn", 2, 1},
+				{KIND_IDENTIFIER, "a", 2, 4},
+				{KIND_IDENTIFIER, "b", 2, 7},
+				{KIND_IDENTIFIER, "a", 2, 12},
+				{KIND_OPERATOR, "+", 2, 14},
+				{KIND_IDENTIFIER, "b", 2, 16},
+				{KIND_COMMENT, "// sum", 2, 20},
+			},
+		},
+		{
+			`puts("say \"hi\"", b"\x00")`,
+			[]span{
+				{KIND_IDENTIFIER, "puts", 1, 1},
+				{KIND_STRING, `"say \"hi\""`, 1, 6},
+				{KIND_STRING, `b"\x00"`, 1, 20},
+			},
+		},
+		{
+			"a ?? b?[0] != true",
+			[]span{
+				{KIND_IDENTIFIER, "a", 1, 1},
+				{KIND_OPERATOR, "??", 1, 3},
+				{KIND_IDENTIFIER, "b", 1, 6},
+				{KIND_OPERATOR, "?[", 1, 7},
+				{KIND_NUMBER, "0", 1, 9},
+				{KIND_OPERATOR, "!=", 1, 12},
+				{KIND_KEYWORD, "true", 1, 15},
+			},
+		},
+		{
+			"select { v = ch => v }",
+			[]span{
+				{KIND_KEYWORD, "select", 1, 1},
+				{KIND_IDENTIFIER, "v", 1, 10},
+				{KIND_OPERATOR, "=", 1, 12},
+				{KIND_IDENTIFIER, "ch", 1, 14},
+				{KIND_OPERATOR, "=>", 1, 17},
+				{KIND_IDENTIFIER, "v", 1, 20},
+			},
+		},
+		{
+			"\"unterminated",
+			[]span{
+				{KIND_STRING, "\"unterminated", 1, 1},
+			},
+		},
+		{
+			"@ x",
+			[]span{
+				{KIND_IDENTIFIER, "x", 1, 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tokens := Tokens(tt.input)
+		if len(tokens) != len(tt.expected) {
+			t.Errorf("%q: wrong number of tokens. expected=%d, got=%d (%+v)", tt.input, len(tt.expected), len(tokens), tokens)
+			continue
+		}
+
+		for i, expected := range tt.expected {
+			tok := tokens[i]
+			text := tt.input[tok.Start.Offset:tok.End.Offset]
+			if tok.Kind != expected.kind || text != expected.text || tok.Start.Line != expected.line || tok.Start.Column != expected.column {
+				t.Errorf("%q: tokens[%d] wrong. expected=%s %q at %d:%d, got=%s %q at %d:%d", tt.input, i,
+					expected.kind, expected.text, expected.line, expected.column,
+					tok.Kind, text, tok.Start.Line, tok.Start.Column)
+			}
+		}
+	}
+}
+
+func TestTokensSpanLines(t *testing.T) {
+	input := "let s = \"one\ntwo\";"
+
+	tokens := Tokens(input)
+	if len(tokens) != 4 {
+		t.Fatalf("wrong number of tokens. expected=4, got=%d", len(tokens))
+	}
+
+	str := tokens[3]
+	expectedStart := Position{Offset: 8, Line: 1, Column: 9}
+	expectedEnd := Position{Offset: 17, Line: 2, Column: 5}
+	if str.Start != expectedStart || str.End != expectedEnd {
+		t.Errorf("string spans wrong. expected=%+v-%+v, got=%+v-%+v", expectedStart, expectedEnd, str.Start, str.End)
+	}
+}
+
+func FuzzTokens(f *testing.F) {
+	for _, seed := range []string{
+		"let add = fn(x, y) { x + y; }; // add",
+		"\"foo\n\\\"bar\" b\"\\x00\" ?? a?[0]",
+		"\"unterminated \\",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		previous := 0
+		for _, tok := range Tokens(input) {
+			if tok.Start.Offset < previous || tok.End.Offset <= tok.Start.Offset || tok.End.Offset > len(input) {
+				t.Fatalf("%q: token %+v out of order or out of range", input, tok)
+			}
+			previous = tok.End.Offset
+		}
+	})
+}
@@ -1,17 +1,52 @@
 package lexer
 
-import "monkey/token"
+import (
+	"monkey/token"
+	"strconv"
+	"strings"
+)
 
 type Lexer struct {
 	input        string
 	position     int
 	readPosition int
 	char         byte
+
+	// line and column of the current character, both starting at 1
+	line   int
+	column int
+
+	// comments skipped so far, kept for tools such as the formatter
+	comments []token.Token
+
+	// names maps the identifiers and keywords read so far to the one copy of each that
+	// their tokens share
+	names map[string]string
+}
+
+// Position is a place in the input before a character, given by its byte offset and
+// by the line and column of the character, both starting at 1.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
 }
 
 // New creates a new lexer instance.
 func New(input string) *Lexer {
-	lexer := &Lexer{input: input}
+	return NewAt(input, Position{Line: 1, Column: 1})
+}
+
+// NewAt creates a lexer that starts reading the input at the position, as though it had
+// read the input before it, so that the tokens it returns are placed in the whole input.
+func NewAt(input string, position Position) *Lexer {
+	lexer := &Lexer{
+		input:        input,
+		readPosition: position.Offset,
+		line:         position.Line,
+		column:       position.Column - 1,
+		names:        map[string]string{},
+	}
 
 	lexer.readChar()
 
@@ -31,6 +66,13 @@ func (lexer *Lexer) peekChar() byte {
 
 // readChar reads the next character in the input and advances the position in the input string.
 func (lexer *Lexer) readChar() {
+	// a new line starts after every newline character
+	if lexer.char == '\n' {
+		lexer.line++
+		lexer.column = 0
+	}
+	lexer.column++
+
 	lexer.char = lexer.peekChar()
 
 	// move the position forward
@@ -40,18 +82,33 @@ func (lexer *Lexer) readChar() {
 
 // NextToken returns the next token in the input.
 func (lexer *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	// skip whitespace
 	lexer.skipWhitespace()
 
+	// remember where the token starts
+	line, column := lexer.line, lexer.column
+
+	tok := lexer.readToken()
+	tok.Line = line
+	tok.Column = column
+
+	return tok
+}
+
+// readToken reads the token starting at the current character.
+func (lexer *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch lexer.char {
 	case '=':
-		// check for equality or assignment
+		// check for equality, an arrow or assignment
 		if lexer.peekChar() == '=' {
 			// read the next character
 			lexer.readChar()
 			tok = token.Token{Type: token.EQ, Literal: "=="}
+		} else if lexer.peekChar() == '>' {
+			lexer.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
 			tok = newToken(token.ASSIGN, lexer.char)
 		}
@@ -72,14 +129,44 @@ func (lexer *Lexer) NextToken() token.Token {
 		tok = newToken(token.SLASH, lexer.char)
 	case '*':
 		tok = newToken(token.ASTERISK, lexer.char)
+	case '%':
+		tok = newToken(token.PERCENT, lexer.char)
+	case '?':
+		switch lexer.peekChar() {
+		case '?':
+			lexer.readChar()
+			tok = token.Token{Type: token.COALESCE, Literal: "??"}
+		case '(':
+			lexer.readChar()
+			tok = token.Token{Type: token.OPTIONAL_LPAREN, Literal: "?("}
+		case '[':
+			lexer.readChar()
+			tok = token.Token{Type: token.OPTIONAL_LBRACKET, Literal: "?["}
+		default:
+			tok = newToken(token.ILLEGAL, lexer.char)
+		}
 	case '<':
-		tok = newToken(token.LT, lexer.char)
+		if lexer.peekChar() == '=' {
+			lexer.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: "<="}
+		} else {
+			tok = newToken(token.LT, lexer.char)
+		}
 	case '>':
-		tok = newToken(token.GT, lexer.char)
+		if lexer.peekChar() == '=' {
+			lexer.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: ">="}
+		} else {
+			tok = newToken(token.GT, lexer.char)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, lexer.char)
 	case ',':
 		tok = newToken(token.COMMA, lexer.char)
+	case ':':
+		tok = newToken(token.COLON, lexer.char)
+	case '.':
+		tok = newToken(token.DOT, lexer.char)
 	case '(':
 		tok = newToken(token.LPAREN, lexer.char)
 	case ')':
@@ -88,11 +175,23 @@ func (lexer *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, lexer.char)
 	case '}':
 		tok = newToken(token.RBRACE, lexer.char)
+	case '[':
+		tok = newToken(token.LBRACKET, lexer.char)
+	case ']':
+		tok = newToken(token.RBRACKET, lexer.char)
+	case '"':
+		tok.Type = token.STRING
+		tok.Literal = lexer.readString()
 	case 0:
 		tok.Type = token.EOF
 		tok.Literal = ""
 	default:
-		if isLetter(lexer.char) {
+		if lexer.char == 'b' && lexer.peekChar() == '"' {
+			// a b right before a string makes a bytes literal
+			lexer.readChar()
+			tok.Type = token.BYTES
+			tok.Literal = lexer.readString()
+		} else if isLetter(lexer.char) {
 			// read the identifier
 			tok.Literal = lexer.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
@@ -112,11 +211,48 @@ func (lexer *Lexer) NextToken() token.Token {
 	return tok
 }
 
-// skipWhitespace skips any whitespace characters in the input.
+// Offset returns the byte offset of the character the lexer is at, which right after
+// NextToken is where the token it returned ends.
+func (lexer *Lexer) Offset() int {
+	return min(lexer.position, len(lexer.input))
+}
+
+// Position returns the position of the character the lexer is at, which right after
+// NextToken is where the token it returned ends.
+func (lexer *Lexer) Position() Position {
+	return Position{Offset: lexer.Offset(), Line: lexer.line, Column: lexer.column}
+}
+
+// Comments returns the comments skipped by the lexer so far, in source order.
+func (lexer *Lexer) Comments() []token.Token {
+	return lexer.comments
+}
+
+// skipWhitespace skips any whitespace characters and comments in the input.
 func (lexer *Lexer) skipWhitespace() {
-	for lexer.char == ' ' || lexer.char == '\t' || lexer.char == '\n' || lexer.char == '\r' {
+	for {
+		switch {
+		case lexer.char == ' ' || lexer.char == '\t' || lexer.char == '\n' || lexer.char == '\r':
+			lexer.readChar()
+		case lexer.char == '/' && lexer.peekChar() == '/':
+			lexer.readComment()
+		default:
+			return
+		}
+	}
+}
+
+// readComment reads a comment running to the end of the line and records it.
+func (lexer *Lexer) readComment() {
+	comment := token.Token{Type: token.COMMENT, Line: lexer.line, Column: lexer.column}
+
+	position := lexer.position
+	for lexer.char != '\n' && lexer.char != 0 {
 		lexer.readChar()
 	}
+
+	comment.Literal = strings.TrimRight(lexer.input[position:lexer.position], " \t\r")
+	lexer.comments = append(lexer.comments, comment)
 }
 
 // newToken creates a new token with the given type and character.
@@ -124,13 +260,22 @@ func newToken(tokenType token.TokenType, char byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(char)}
 }
 
-// readIdentifier reads an identifier from the input.
+// readIdentifier reads an identifier from the input. Every occurrence of a name gets the
+// same string, a copy that does not keep the input alive like a slice of it would.
 func (lexer *Lexer) readIdentifier() string {
 	position := lexer.position
 	for isLetter(lexer.char) {
 		lexer.readChar()
 	}
-	return lexer.input[position:lexer.position]
+
+	name := lexer.input[position:lexer.position]
+	if interned, ok := lexer.names[name]; ok {
+		return interned
+	}
+	name = strings.Clone(name)
+	lexer.names[name] = name
+
+	return name
 }
 
 // readNumber reads a number from the input.
@@ -142,6 +287,53 @@ func (lexer *Lexer) readNumber() string {
 	return lexer.input[position:lexer.position]
 }
 
+// readString reads a double-quoted string from the input, resolving escape sequences,
+// of which \x followed by two hex digits makes any byte.
+func (lexer *Lexer) readString() string {
+	var output []byte
+
+	for {
+		lexer.readChar()
+
+		// stop at the closing quote or at the end of the input
+		if lexer.char == '"' || lexer.char == 0 {
+			break
+		}
+
+		if lexer.char == '\\' {
+			lexer.readChar()
+			switch lexer.char {
+			case 'n':
+				output = append(output, '\n')
+			case 't':
+				output = append(output, '\t')
+			case 'r':
+				output = append(output, '\r')
+			case 'x':
+				// \x takes two hex digits for a byte, or stands for x without them
+				value, err := strconv.ParseUint(lexer.input[lexer.readPosition:min(lexer.readPosition+2, len(lexer.input))], 16, 8)
+				if err != nil {
+					output = append(output, 'x')
+					continue
+				}
+				lexer.readChar()
+				lexer.readChar()
+				output = append(output, byte(value))
+			case 0:
+				return string(output)
+			default:
+				// \" and \\ as well as unknown escapes produce the escaped character
+				output = append(output, lexer.char)
+			}
+			continue
+		}
+
+		output = append(output, lexer.char)
+	}
+
+	return string(output)
+}
+
 // isLetter checks if the given character is a letter.
 func isLetter(char byte) bool {
 	return 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || char == '_'
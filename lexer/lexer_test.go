@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"testing"
+	"unsafe"
 
 	"monkey/token"
 )
@@ -15,7 +16,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/*%5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -26,6 +27,19 @@ if (5 < 10) {
 
 10 == 10;
 10 != 9;
+5 <= 10 >= 5 <=> 5;
+"foobar"
+"foo bar"
+"say \"hi\"\n"
+[1, 2];
+macro(x, y) { x + y; };
+export let
+s[1:]
+try catch spawn select =>= =
+a ?? b ?
+f?(x)?[0]
+s.len()
+b"\x00A\xZ" "\x41" b
 `
 
 	tests := []struct {
@@ -72,6 +86,7 @@ if (5 < 10) {
 		{token.MINUS, "-"},
 		{token.SLASH, "/"},
 		{token.ASTERISK, "*"},
+		{token.PERCENT, "%"},
 		{token.INT, "5"},
 		{token.SEMICOLON, ";"},
 		{token.INT, "5"},
@@ -105,6 +120,70 @@ if (5 < 10) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.INT, "5"},
+		{token.LT_EQ, "<="},
+		{token.INT, "10"},
+		{token.GT_EQ, ">="},
+		{token.INT, "5"},
+		{token.LT_EQ, "<="},
+		{token.GT, ">"},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, "say \"hi\"\n"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.EXPORT, "export"},
+		{token.LET, "let"},
+		{token.IDENT, "s"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COLON, ":"},
+		{token.RBRACKET, "]"},
+		{token.TRY, "try"},
+		{token.CATCH, "catch"},
+		{token.SPAWN, "spawn"},
+		{token.SELECT, "select"},
+		{token.ARROW, "=>"},
+		{token.ASSIGN, "="},
+		{token.ASSIGN, "="},
+		{token.IDENT, "a"},
+		{token.COALESCE, "??"},
+		{token.IDENT, "b"},
+		{token.ILLEGAL, "?"},
+		{token.IDENT, "f"},
+		{token.OPTIONAL_LPAREN, "?("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.OPTIONAL_LBRACKET, "?["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.IDENT, "s"},
+		{token.DOT, "."},
+		{token.IDENT, "len"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.BYTES, "\x00AxZ"},
+		{token.STRING, "A"},
+		{token.IDENT, "b"},
 		{token.EOF, ""},
 	}
 
@@ -124,3 +203,187 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x +\n\t\"y\""
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.PLUS, 2, 5},
+		{token.STRING, 3, 2},
+		{token.EOF, 3, 5},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestNewAt(t *testing.T) {
+	input := "let x = 5;\n  x +\n\t\"y\""
+
+	// a lexer started at a token places the tokens as one reading the whole input does
+	l := NewAt(input, Position{Offset: 11, Line: 2, Column: 1})
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+		expectedEnd    Position
+	}{
+		{token.IDENT, 2, 3, Position{Offset: 14, Line: 2, Column: 4}},
+		{token.PLUS, 2, 5, Position{Offset: 16, Line: 2, Column: 6}},
+		{token.STRING, 3, 2, Position{Offset: 21, Line: 3, Column: 5}},
+		{token.EOF, 3, 5, Position{Offset: 21, Line: 3, Column: 6}},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+		if l.Position() != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%v, got=%v", i, tt.expectedEnd, l.Position())
+		}
+	}
+}
+
+func TestIdentifiersAreInterned(t *testing.T) {
+	input := "let total = total + totals; let total = 1;"
+
+	l := New(input)
+	names := map[string]*byte{}
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type != token.IDENT && tok.Type != token.LET {
+			continue
+		}
+
+		data := unsafe.StringData(tok.Literal)
+		if data == unsafe.StringData(input[tok.Column-1:]) {
+			t.Errorf("%q at column %d shares the memory of the input", tok.Literal, tok.Column)
+		}
+		if previous, ok := names[tok.Literal]; ok && previous != data {
+			t.Errorf("%q at column %d is not the copy of the earlier occurrence", tok.Literal, tok.Column)
+		}
+		names[tok.Literal] = data
+	}
+
+	if len(names) != 3 {
+		t.Errorf("wrong number of names. expected=3, got=%d", len(names))
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// leading\nlet x = 5; // five  \n10 / 2 // end"
+
+	expectedTokens := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.INT, token.SLASH, token.INT, token.EOF,
+	}
+
+	l := New(input)
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+
+	expectedComments := []token.Token{
+		{Type: token.COMMENT, Literal: "// leading", Line: 1, Column: 1},
+		{Type: token.COMMENT, Literal: "// five", Line: 2, Column: 12},
+		{Type: token.COMMENT, Literal: "// end", Line: 3, Column: 8},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+
+	for i, expected := range expectedComments {
+		if comments[i] != expected {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, expected, comments[i])
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`""`, ""},
+		{`"foo bar"`, "foo bar"},
+		{`"a\nb\tc\rd"`, "a\nb\tc\rd"},
+		{`"say \"hi\" \\ bye"`, `say "hi" \ bye`},
+		{`"\x41\x7a"`, "Az"},
+		{`"\xZZ"`, "xZZ"},
+		{`"\q"`, "q"},
+		// an unterminated string runs to the end of the input
+		{`"abc`, "abc"},
+		{`"abc\`, "abc"},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+		if tok.Type != token.STRING {
+			t.Errorf("tokentype wrong for %q. expected=%q, got=%q", tt.input, token.STRING, tok.Type)
+			continue
+		}
+		if tok.Literal != tt.expected {
+			t.Errorf("literal wrong for %q. expected=%q, got=%q", tt.input, tt.expected, tok.Literal)
+		}
+	}
+}
+
+func FuzzNextToken(f *testing.F) {
+	for _, seed := range []string{
+		"let five = 5; let add = fn(x, y) { x + y; };",
+		`"foo\n\"bar\"" b"\x00\xff" // comment`,
+		"a?.b ?? c?[0] ?(1) 10 != 9 == !-5",
+		"\"unterminated \\",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		// every token but the last takes up at least one byte of the input
+		for i := 0; i <= len(input)+1; i++ {
+			tok := l.NextToken()
+			if tok.Type == token.EOF {
+				return
+			}
+			if tok.Line < 1 || tok.Column < 1 {
+				t.Fatalf("token %q at line %d, column %d", tok.Literal, tok.Line, tok.Column)
+			}
+		}
+		t.Fatalf("no EOF after %d tokens of %d bytes", len(input)+2, len(input))
+	})
+}
@@ -0,0 +1,321 @@
+package module
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MODULES_DIR names the directory that packages are installed into, in which imports
+// look for them by name.
+const MODULES_DIR = "monkey_modules"
+
+// LOCKFILE names the file that records the versions of the packages installed next to it.
+const LOCKFILE = "monkey.lock"
+
+// SHA256_PREFIX starts the versions of tarballs, which are the hashes of their contents.
+const SHA256_PREFIX = "sha256:"
+
+// Package is a package of modules that can be fetched from a git repository or a tarball.
+type Package struct {
+	// Name is the path the package is installed at and imported by, such as
+	// github.com/user/pkg.
+	Name string
+
+	// Source is the URL the package is fetched from.
+	Source string
+
+	// Ref is the branch or tag of a git repository to fetch, or its default branch if empty.
+	Ref string
+
+	// Version is the commit of a git repository or the SHA256_PREFIX hash of a tarball,
+	// which has to match when it is not empty.
+	Version string
+}
+
+// isTarball reports whether the package is fetched as a tarball rather than with git.
+func (pkg Package) isTarball() bool {
+	return strings.HasSuffix(pkg.Source, ".tar.gz") || strings.HasSuffix(pkg.Source, ".tgz")
+}
+
+// ParsePackage returns the package at the source, which is a git repository such as
+// github.com/user/pkg, optionally followed by @ and a branch or tag, or the URL of a
+// .tar.gz tarball. Sources without a scheme are fetched over https.
+func ParsePackage(source string) (Package, error) {
+	pkg := Package{Source: source}
+
+	// a ref follows the last element of the path
+	if at := strings.LastIndex(source, "@"); at > strings.LastIndex(source, "/") {
+		pkg.Source, pkg.Ref = source[:at], source[at+1:]
+	}
+	if !strings.Contains(pkg.Source, "://") {
+		pkg.Source = "https://" + pkg.Source
+	}
+
+	u, err := url.Parse(pkg.Source)
+	if err != nil {
+		return Package{}, fmt.Errorf("invalid package %s: %s", source, err)
+	}
+
+	name := u.Path
+	for _, suffix := range []string{".tar.gz", ".tgz", ".git"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	pkg.Name = strings.Trim(path.Join(u.Hostname(), name), "/")
+
+	if pkg.Name == "" || !filepath.IsLocal(filepath.FromSlash(pkg.Name)) {
+		return Package{}, fmt.Errorf("invalid package %s: no name to install it at", source)
+	}
+	if pkg.Ref != "" && pkg.isTarball() {
+		return Package{}, fmt.Errorf("invalid package %s: only git repositories have refs", source)
+	}
+
+	return pkg, nil
+}
+
+// Get fetches the package into the directory named after it in the modules directory,
+// replacing what was there, and returns the package with the version it fetched.
+func Get(pkg Package, modulesDir string) (Package, error) {
+	if err := os.MkdirAll(modulesDir, 0755); err != nil {
+		return pkg, err
+	}
+
+	// the package is fetched next to where it goes, so that it can be moved in place at once
+	tmp, err := os.MkdirTemp(modulesDir, ".get-")
+	if err != nil {
+		return pkg, err
+	}
+	defer os.RemoveAll(tmp)
+
+	fetched := filepath.Join(tmp, "package")
+	if pkg.isTarball() {
+		pkg.Version, err = fetchTarball(pkg, fetched)
+	} else {
+		pkg.Version, err = fetchRepository(pkg, fetched)
+	}
+	if err != nil {
+		return pkg, fmt.Errorf("could not get %s: %s", pkg.Name, err)
+	}
+
+	dest := filepath.Join(modulesDir, filepath.FromSlash(pkg.Name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return pkg, err
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		return pkg, err
+	}
+
+	return pkg, os.Rename(fetched, dest)
+}
+
+// fetchRepository clones the git repository of the package into the directory, at its
+// version if it has one, and returns the commit it checked out. The history is left out.
+func fetchRepository(pkg Package, dir string) (string, error) {
+	args := []string{"clone", "--quiet"}
+	if pkg.Version == "" {
+		args = append(args, "--depth", "1")
+	}
+	if pkg.Ref != "" {
+		args = append(args, "--branch", pkg.Ref)
+	}
+	if err := git(append(args, pkg.Source, dir)...); err != nil {
+		return "", err
+	}
+
+	if pkg.Version != "" {
+		if err := git("-C", dir, "checkout", "--quiet", pkg.Version); err != nil {
+			return "", err
+		}
+	}
+
+	var commit bytes.Buffer
+	cmd := exec.Command("git", "-C", dir, "rev-parse", "HEAD")
+	cmd.Stdout = &commit
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git rev-parse: %s", err)
+	}
+
+	return strings.TrimSpace(commit.String()), os.RemoveAll(filepath.Join(dir, ".git"))
+}
+
+// git runs a git command, failing with what it wrote to stderr.
+func git(args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return fmt.Errorf("git %s: %s", args[0], err)
+	}
+
+	return nil
+}
+
+// fetchTarball downloads the tarball of the package, checks it against the version of
+// the package if it has one, and extracts it into the directory, returning its hash.
+func fetchTarball(pkg Package, dir string) (string, error) {
+	response, err := http.Get(pkg.Source)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", pkg.Source, response.Status)
+	}
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	version := SHA256_PREFIX + hex.EncodeToString(sum[:])
+	if pkg.Version != "" && pkg.Version != version {
+		return "", fmt.Errorf("checksum mismatch: want %s, got %s", pkg.Version, version)
+	}
+
+	return version, extract(content, dir)
+}
+
+// extract writes the files of a gzipped tarball into the directory. A directory that
+// holds everything else, as tarballs of releases have, is left out.
+func extract(content []byte, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		name string
+		mode os.FileMode
+		data []byte
+	}
+	var entries []entry
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("file outside of the package: %s", header.Name)
+		}
+
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{name: name, mode: header.FileInfo().Mode().Perm(), data: data})
+	}
+
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.name
+	}
+	prefix := commonDir(names)
+
+	for _, entry := range entries {
+		target := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(entry.name, prefix)))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, entry.data, entry.mode|0200); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// commonDir returns the first directory of the names, followed by a slash, if every
+// name is in it, or an empty string if not.
+func commonDir(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	first, _, ok := strings.Cut(names[0], "/")
+	if !ok {
+		return ""
+	}
+	for _, name := range names[1:] {
+		if !strings.HasPrefix(name, first+"/") {
+			return ""
+		}
+	}
+
+	return first + "/"
+}
+
+// ReadLockfile returns the packages recorded in the lockfile, or none if there is no file.
+func ReadLockfile(filename string) ([]Package, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var packages []Package
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: want a name, a source, and a version", filename, line)
+		}
+		packages = append(packages, Package{Name: fields[0], Source: fields[1], Version: fields[2]})
+	}
+
+	return packages, scanner.Err()
+}
+
+// WriteLockfile records the packages in the lockfile, sorted by name, one per line with
+// its source and version.
+func WriteLockfile(filename string, packages []Package) error {
+	sorted := append([]Package(nil), packages...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var buffer bytes.Buffer
+	fmt.Fprintln(&buffer, "# written by monkey get: the packages in "+MODULES_DIR+", with their sources and versions")
+	for _, pkg := range sorted {
+		fmt.Fprintf(&buffer, "%s %s %s\n", pkg.Name, pkg.Source, pkg.Version)
+	}
+
+	return os.WriteFile(filename, buffer.Bytes(), 0644)
+}
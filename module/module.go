@@ -0,0 +1,333 @@
+// Package module loads the modules that Monkey programs import.
+//
+// A module is a program in a file of its own. Its top-level let statements that start
+// with export make up the module, which the importing program indexes by name:
+//
+//	// math.monkey
+//	export let square = fn(x) { x * x };
+//
+//	// main.monkey
+//	let math = import("math.monkey");
+//	math["square"](4)
+//
+// A module is looked for next to the file that imports it, then in the MODULES_DIR
+// directories that monkey get installs packages into, from the nearest one up, then in
+// the directories of the search path, and last in the standard library that the loader
+// embeds, whose modules are imported by names such as "std/list". A path without an
+// extension names the file with MODULE_EXTENSION as well, or the INDEX_MODULE of the
+// directory, so that a package is imported by its name.
+package module
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PATH_VARIABLE names the environment variable that lists the directories modules are
+// looked for in, separated like the directories of PATH.
+const PATH_VARIABLE = "MONKEY_PATH"
+
+// MODULE_EXTENSION is the extension of module files, which imports can leave out.
+const MODULE_EXTENSION = ".monkey"
+
+// INDEX_MODULE is the module imported by the path of the directory it is in.
+const INDEX_MODULE = "index" + MODULE_EXTENSION
+
+// STDLIB_PREFIX starts the names of the files of the standard library, which are not
+// in the file system.
+const STDLIB_PREFIX = "stdlib:"
+
+// Loader imports modules from files, evaluating each in an environment of its own.
+// Every file is evaluated once, however often it is imported: the importers after the
+// first share the module it made. A loader is not safe for concurrent use.
+type Loader struct {
+	// Options configure the evaluation of every module. The loader sets the file and
+	// the importer, so that modules import the modules next to them.
+	Options evaluator.Options
+
+	// Path lists the directories searched for the modules that are not next to the
+	// file importing them.
+	Path []string
+
+	// Stdlib holds the modules of the standard library, searched after the path, or
+	// none if it is nil.
+	Stdlib fs.FS
+
+	// modules holds the modules loaded so far by the absolute paths of their files
+	modules map[string]*object.Module
+
+	// loading holds the files whose imports are being evaluated, outermost first
+	loading []file
+}
+
+// file is a module file, named by its absolute path and by the path it was found at.
+// The files of the standard library are named by their path with STDLIB_PREFIX.
+type file struct {
+	absolute string
+	path     string
+}
+
+// NewLoader creates a loader that evaluates modules with the default options, searches
+// the directories of DefaultPath, and then the standard library.
+func NewLoader() *Loader {
+	return &Loader{Path: DefaultPath(), Stdlib: stdlib, modules: map[string]*object.Module{}}
+}
+
+// DefaultPath returns the directories listed in the PATH_VARIABLE environment variable.
+func DefaultPath() []string {
+	return filepath.SplitList(os.Getenv(PATH_VARIABLE))
+}
+
+// Import loads the module at the path, which is relative to the directory of the
+// importing file, or to the working directory for programs that are not files. Errors
+// in the module are reported with the position in its file, and an import of a module
+// that is still loading fails with the chain of imports that leads back to it.
+func (loader *Loader) Import(ctx context.Context, path, importer string) (*object.Module, error) {
+	resolved, err := loader.resolve(path, importer)
+	if err != nil {
+		return nil, fmt.Errorf("could not import %s: %s", path, err)
+	}
+
+	if module, ok := loader.modules[resolved.absolute]; ok {
+		return module, nil
+	}
+
+	// the program that imports the first module is where a cycle can lead back to as well
+	chain := loader.loading
+	if len(chain) == 0 && importer != "" {
+		if root, err := filepath.Abs(importer); err == nil {
+			chain = []file{{absolute: root, path: importer}}
+		}
+	}
+
+	for i, loading := range chain {
+		if loading.absolute == resolved.absolute {
+			return nil, cycleError(append(chain[i:], resolved))
+		}
+	}
+
+	outer := loader.loading
+	loader.loading = append(chain, resolved)
+	defer func() { loader.loading = outer }()
+
+	module, err := loader.load(ctx, path, resolved.path)
+	if err != nil {
+		return nil, err
+	}
+
+	loader.modules[resolved.absolute] = module
+	return module, nil
+}
+
+// load reads and evaluates the module in the file at the resolved path.
+func (loader *Loader) load(ctx context.Context, path, resolved string) (*object.Module, error) {
+	content, err := loader.read(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("could not import %s: %s", path, err)
+	}
+
+	p := parser.New(lexer.New(string(content)))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		diagnostic := p.Diagnostics()[0]
+		return nil, fmt.Errorf("%s:%d:%d: %s", resolved, diagnostic.Line, diagnostic.Column, diagnostic.Message)
+	}
+
+	// a module has macros of its own, as it has bindings of its own
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, errObj := evaluator.ExpandMacros(program, macroEnv)
+	if errObj != nil {
+		return nil, moduleError(resolved, errObj)
+	}
+	program = expanded.(*ast.Program)
+
+	options := loader.Options
+	options.File = resolved
+	options.Importer = loader
+
+	env := object.NewEnvironment()
+	if errObj, ok := evaluator.EvalWithOptions(ctx, program, env, options).(*object.Error); ok {
+		return nil, moduleError(resolved, errObj)
+	}
+
+	return &object.Module{Name: path, Exports: exports(program, env)}, nil
+}
+
+// Source returns the name of the file of the module at the path, which is found as
+// Import finds the modules of programs that are not files, and its source, without
+// evaluating it.
+func (loader *Loader) Source(path string) (string, string, error) {
+	resolved, err := loader.resolve(path, "")
+	if err != nil {
+		return "", "", fmt.Errorf("could not find %s: %s", path, err)
+	}
+
+	content, err := loader.read(resolved.path)
+	if err != nil {
+		return "", "", fmt.Errorf("could not read %s: %s", path, err)
+	}
+
+	return resolved.path, string(content), nil
+}
+
+// read returns the content of the file at the resolved path, in the standard library
+// or the file system.
+func (loader *Loader) read(resolved string) ([]byte, error) {
+	if name, ok := strings.CutPrefix(resolved, STDLIB_PREFIX); ok {
+		return fs.ReadFile(loader.Stdlib, name)
+	}
+
+	return os.ReadFile(resolved)
+}
+
+// resolve finds the file a module is in: next to the importing file, or the working
+// directory for programs that are not files, then in the directories of the path, and
+// then in the standard library. An absolute path is the only place looked at.
+func (loader *Loader) resolve(modulePath, importer string) (file, error) {
+	names := []string{modulePath}
+	if filepath.Ext(modulePath) == "" {
+		names = append(names, modulePath+MODULE_EXTENSION, filepath.Join(modulePath, INDEX_MODULE))
+	}
+
+	if filepath.IsAbs(modulePath) {
+		for _, name := range names {
+			if found, ok := osFile(name); ok {
+				return found, nil
+			}
+		}
+		return file{}, fmt.Errorf("no such module")
+	}
+
+	// the modules of the standard library import the modules next to them in it
+	var dirs []string
+	if stdlibName, ok := strings.CutPrefix(importer, STDLIB_PREFIX); ok {
+		for _, name := range names {
+			if found, ok := loader.stdlibFile(path.Join(path.Dir(stdlibName), filepath.ToSlash(name))); ok {
+				return found, nil
+			}
+		}
+	} else {
+		dirs = append([]string{filepath.Dir(importer)}, packageDirs(importer)...)
+	}
+	dirs = append(dirs, loader.Path...)
+
+	for _, dir := range dirs {
+		for _, name := range names {
+			if found, ok := osFile(filepath.Join(dir, name)); ok {
+				return found, nil
+			}
+		}
+	}
+
+	for _, name := range names {
+		if found, ok := loader.stdlibFile(path.Clean(filepath.ToSlash(name))); ok {
+			return found, nil
+		}
+	}
+
+	searched := dirs
+	if loader.Stdlib != nil {
+		searched = append(searched, "the standard library")
+	}
+	return file{}, fmt.Errorf("no such module in %s", strings.Join(searched, ", "))
+}
+
+// packageDirs returns the MODULES_DIR directories in the directory of the importing
+// file and in the directories above it, the nearest first.
+func packageDirs(importer string) []string {
+	dir, err := filepath.Abs(filepath.Dir(importer))
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+	for {
+		candidate := filepath.Join(dir, MODULES_DIR)
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			dirs = append(dirs, candidate)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dirs
+		}
+		dir = parent
+	}
+}
+
+// osFile returns the file at the path, if there is one in the file system.
+func osFile(path string) (file, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return file{}, false
+	}
+
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return file{}, false
+	}
+
+	return file{absolute: absolute, path: path}, true
+}
+
+// stdlibFile returns the file of the standard library with the name, if there is one.
+func (loader *Loader) stdlibFile(name string) (file, bool) {
+	if loader.Stdlib == nil || !fs.ValidPath(name) {
+		return file{}, false
+	}
+
+	info, err := fs.Stat(loader.Stdlib, name)
+	if err != nil || info.IsDir() {
+		return file{}, false
+	}
+
+	return file{absolute: STDLIB_PREFIX + name, path: STDLIB_PREFIX + name}, true
+}
+
+// cycleError describes a chain of imports that starts and ends with the same file.
+func cycleError(chain []file) error {
+	paths := make([]string, len(chain))
+	for i, link := range chain {
+		paths[i] = link.path
+	}
+
+	return fmt.Errorf("import cycle: %s", strings.Join(paths, " imports "))
+}
+
+// exports collects the values of the bindings the program exports from its environment.
+func exports(program *ast.Program, env *object.Environment) map[string]object.Object {
+	exported := map[string]object.Object{}
+
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || !let.Exported {
+			continue
+		}
+
+		if value, ok := env.Get(let.Name.Value); ok {
+			exported[let.Name.Value] = value
+		}
+	}
+
+	return exported
+}
+
+// moduleError describes a runtime error of a module with its position in the file.
+func moduleError(file string, errObj *object.Error) error {
+	if errObj.Line == 0 {
+		return fmt.Errorf("%s: %s", file, errObj.Message)
+	}
+
+	return fmt.Errorf("%s:%d:%d: %s", file, errObj.Line, errObj.Column, errObj.Message)
+}
@@ -0,0 +1,574 @@
+package module
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestImport(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib/math.monkey":  "let helper = fn(x) { x * x };\nexport let square = fn(x) { helper(x) };\nexport let inner = import(\"inner.monkey\");",
+		"lib/inner.monkey": "export let answer = 42;",
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = import("lib/math.monkey"); m["square"](4)`, "16"},
+		// modules import the modules next to them
+		{`import("lib/math.monkey")["inner"]["answer"]`, "42"},
+		{`import("lib/math.monkey")`, "module(lib/math.monkey)"},
+		{`import("lib/math.monkey")["helper"]`, "ERROR: module lib/math.monkey does not export helper"},
+		{`import(1)`, "ERROR: argument to import must be STRING, got INTEGER"},
+		{`import("a", "b")`, "ERROR: wrong number of arguments to import: want=1, got=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := evalFile(filepath.Join(dir, "main.monkey"), tt.input, NewLoader())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"parse.monkey":   "let x 1;",
+		"runtime.monkey": "let x = 1;\nexport let y = x + true;",
+	})
+	main := filepath.Join(dir, "main.monkey")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import("missing.monkey")`, "could not import missing.monkey: no such module in " + dir + ", the standard library"},
+		{`import("parse.monkey")`, filepath.Join(dir, "parse.monkey") + ":1:7: expected next token to be =, got INT instead"},
+		{`import("runtime.monkey")`, filepath.Join(dir, "runtime.monkey") + ":2:18: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := evalFile(main, tt.input, NewLoader())
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+
+	// imports need an importer, and are a side effect that a sandbox leaves out
+	if evaluated := evalFile(main, `import("parse.monkey")`, nil); evaluated.Inspect() != "ERROR: import is not available without an importer" {
+		t.Errorf("wrong result without an importer. got=%q", evaluated.Inspect())
+	}
+	program := parser.New(lexer.New(`import("parse.monkey")`)).ParseProgram()
+	options := evaluator.Options{Importer: NewLoader(), File: main, Sandbox: true}
+	if evaluated := evaluator.EvalWithOptions(context.Background(), program, object.NewEnvironment(), options); evaluated.Inspect() != "ERROR: import is not available in sandbox mode" {
+		t.Errorf("wrong result in sandbox mode. got=%q", evaluated.Inspect())
+	}
+
+	// the loader is not safe for concurrent use, so tasks use the modules imported for them
+	program = parser.New(lexer.New(`let list = import("std/list"); [(spawn fn() { list["sum"]([1, 2]) }).join(), (spawn fn() { import("std/list") }).join()]`)).ParseProgram()
+	options = evaluator.Options{Importer: NewLoader(), File: main}
+	if evaluated := evaluator.EvalWithOptions(context.Background(), program, object.NewEnvironment(), options); evaluated.Inspect() != "ERROR: import is not available in spawned tasks" {
+		t.Errorf("wrong result in a task. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestImportOnce(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"shared.monkey": "export let answer = 42;",
+		"a.monkey":      "export let shared = import(\"shared.monkey\");",
+		"b.monkey":      "export let shared = import(\"./shared.monkey\");",
+	})
+
+	// count the modules the loader evaluates
+	loader := NewLoader()
+	evaluations := 0
+	loader.Options.Hooks.OnNodeEnter = func(node ast.Node) {
+		if _, ok := node.(*ast.Program); ok {
+			evaluations++
+		}
+	}
+
+	input := `let shared = import("shared.monkey");
+	[shared == import("a.monkey")["shared"], shared == import("b.monkey")["shared"]]`
+	evaluated := evalFile(filepath.Join(dir, "main.monkey"), input, loader)
+	if evaluated.Inspect() != "[true, true]" {
+		t.Errorf("modules were not shared. got=%q", evaluated.Inspect())
+	}
+	if evaluations != 3 {
+		t.Errorf("wrong number of modules evaluated. expected=3, got=%d", evaluations)
+	}
+}
+
+func TestImportCycles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.monkey":    "export let b = import(\"b.monkey\");",
+		"b.monkey":    "export let a = import(\"a.monkey\");",
+		"self.monkey": "export let self = import(\"self.monkey\");",
+		"main.monkey": "",
+	})
+	main := filepath.Join(dir, "main.monkey")
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import("a.monkey")`, path("a.monkey") + ":1:22: " + path("b.monkey") + ":1:22: import cycle: " +
+			path("a.monkey") + " imports " + path("b.monkey") + " imports " + path("a.monkey")},
+		{`import("self.monkey")`, path("self.monkey") + ":1:25: import cycle: " + path("self.monkey") + " imports " + path("self.monkey")},
+		{`import("main.monkey")`, "import cycle: " + main + " imports " + main},
+	}
+
+	for _, tt := range tests {
+		loader := NewLoader()
+		evaluated := evalFile(main, tt.input, loader)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error for %q.\nexpected=%q\ngot=     %q", tt.input, tt.expected, errObj.Message)
+		}
+		if len(loader.loading) != 0 || len(loader.modules) != 0 {
+			t.Errorf("failed import of %q left the loader with %d files loading and %d modules", tt.input, len(loader.loading), len(loader.modules))
+		}
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"project/main.monkey": "",
+		"project/b.monkey":    `export let from = "project";`,
+		"first/a.monkey":      `export let from = "first";`,
+		"second/a.monkey":     `export let from = "second";`,
+		"second/b.monkey":     `export let from = "second";`,
+		"second/c.monkey":     `export let from = "second";`,
+	})
+
+	loader := NewLoader()
+	loader.Path = []string{filepath.Join(dir, "first"), filepath.Join(dir, "second")}
+	loader.Stdlib = fstest.MapFS{
+		"std/c.monkey":      {Data: []byte(`export let from = "stdlib";`)},
+		"std/d.monkey":      {Data: []byte(`export let from = import("e.monkey")["from"];`)},
+		"std/e.monkey":      {Data: []byte(`export let from = "stdlib";`)},
+		"std/broken.monkey": {Data: []byte(`export let x = 1 + true;`)},
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// the directories of the path are searched in order
+		{`import("a.monkey")["from"]`, "first"},
+		// modules next to the importing file come first
+		{`import("b.monkey")["from"]`, "project"},
+		{`import("c.monkey")["from"]`, "second"},
+		{`import("std/c.monkey")["from"]`, "stdlib"},
+		// the modules of the standard library import the modules next to them
+		{`import("std/d.monkey")["from"]`, "stdlib"},
+		{`import("std/c.monkey")`, "module(std/c.monkey)"},
+		{`import("std/broken.monkey")`, "ERROR: stdlib:std/broken.monkey:1:18: type mismatch: INTEGER + BOOLEAN"},
+		{`import("missing.monkey")`, "ERROR: could not import missing.monkey: no such module in " +
+			strings.Join([]string{filepath.Join(dir, "project"), filepath.Join(dir, "first"), filepath.Join(dir, "second"), "the standard library"}, ", ")},
+	}
+
+	for _, tt := range tests {
+		evaluated := evalFile(filepath.Join(dir, "project", "main.monkey"), tt.input, loader)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStdlib(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import("std/list")`, "module(std/list)"},
+		{`import("std/list.monkey")["sum"]([1, 2, 3])`, "6"},
+		{`import("std/list")["reduce"]([1, 2, 3], 10, fn(total, x) { total - x })`, "4"},
+		{`import("std/list")["product"]([2, 3, 4])`, "24"},
+		{`import("std/list")["first"]([])`, "null"},
+		{`import("std/list")["last"]([1, 2, 3])`, "3"},
+		{`import("std/list")["find"]([1, 4, 6], fn(x) { x > 3 })`, "4"},
+		{`import("std/list")["find"]([1, 2], fn(x) { x > 3 })`, "null"},
+		{`import("std/list")["index_of"](["a", "b"], "b")`, "1"},
+		{`import("std/list")["contains"]([1, 2], 3)`, "false"},
+		{`import("std/list")["count"]([1, 5, 7], fn(x) { x > 2 })`, "2"},
+		{`import("std/list")["all"]([2, 4], fn(x) { x > 1 })`, "true"},
+		{`import("std/list")["any"]([2, 4], fn(x) { x > 3 })`, "true"},
+		{`import("std/list")["max"]([3, 9, 2])`, "9"},
+		{`import("std/list")["min"]([3, 9, 2])`, "2"},
+		{`import("std/list")["min"]([])`, "null"},
+		{`import("std/list")["is_empty"]([])`, "true"},
+		{`import("std/list")["map"]([1, 2, 3], fn(x) { x * x })`, "[1, 4, 9]"},
+		{`import("std/list")["filter"]([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`import("std/list")["reverse"]([1, 2, 3])`, "[3, 2, 1]"},
+		{`import("std/list")["sort_by"](["ccc", "a", "bb"], len)`, "[a, bb, ccc]"},
+		{`import("std/list")["range"](2, 5)`, "[2, 3, 4]"},
+		{`import("std/list")["range"](5, 2)`, "[]"},
+		{`import("std/list")["take"]([1, 2, 3], 2)`, "[1, 2]"},
+		{`import("std/list")["take"]([1], 2)`, "[1]"},
+		{`import("std/list")["drop"]([1, 2, 3], 2)`, "[3]"},
+		{`import("std/list")["drop"]([1], 2)`, "[]"},
+		{`import("std/list")["each"]([1, 2], fn(x) { x })`, "null"},
+		{`import("std/string")["repeat"]("ab", 3)`, "ababab"},
+		{`import("std/string")["join"](["a", "b", "c"], ", ")`, "a, b, c"},
+		{`import("std/string")["join"]([], ", ")`, ""},
+		{`import("std/string")["pad_left"]("7", 3, "0")`, "007"},
+		{`import("std/string")["pad_right"]("ab", 4, ".")`, "ab.."},
+		{`import("std/string")["center"]("ab", 7, "*")`, "**ab***"},
+		{`import("std/string")["surround"]("x", "(", ")")`, "(x)"},
+		{`import("std/string")["is_empty"]("")`, "true"},
+		{`let f = import("std/func"); f["compose"](fn(x) { x * 2 }, fn(x) { x + 1 })(3)`, "8"},
+		{`let f = import("std/func"); f["pipe"](fn(x) { x * 2 }, fn(x) { x + 1 })(3)`, "7"},
+		{`let f = import("std/func"); f["flip"](fn(a, b) { a - b })(1, 10)`, "9"},
+		{`let f = import("std/func"); f["partial"](fn(a, b) { a - b }, 10)(1)`, "9"},
+		{`let f = import("std/func"); f["uncurry"](f["curry"](fn(a, b) { a - b }))(10, 1)`, "9"},
+		{`let f = import("std/func"); f["negate"](f["identity"])(true)`, "false"},
+		{`let f = import("std/func"); f["constant"](5)(1)`, "5"},
+		{`let f = import("std/func"); f["times"](3, fn(i) { i })`, "null"},
+		{`let t = import("std/types"); [t["is_int"](1), t["is_int"]("1"), t["is_string"]("1"), t["is_bool"](false)]`, "[true, false, true, true]"},
+		{`let t = import("std/types"); [t["is_null"](if (false) { 1 }), t["is_null"](0), t["is_array"]([]), t["is_hash"]([])]`, "[true, false, true, false]"},
+		{`let t = import("std/types"); [t["is_fn"](fn() {}), t["is_fn"](len), t["is_fn"](1)]`, "[true, true, false]"},
+		{`let m = import("std/math"); [m["abs"](-3), m["abs"](3), m["sign"](-9), m["sign"](0), m["sign"](4)]`, "[3, 3, -1, 0, 1]"},
+		{`let m = import("std/math"); [m["min"](2, -1), m["max"](2, -1)]`, "[-1, 2]"},
+		{`let m = import("std/math"); [m["pow"](2, 10), m["pow"](-3, 3), m["pow"](7, 0), m["pow"](2, -1)]`, "[1024, -27, 1, null]"},
+		{`let m = import("std/math"); map([0, 1, 2, 15, 16, 17, 1000000], m["sqrt"])`, "[0, 1, 1, 3, 4, 4, 1000]"},
+		{`import("std/math")["sqrt"](-4)`, "null"},
+		{`import("std/assert")["equal"]([1, 2], [1, 2])`, "null"},
+		{`import("std/assert")["equal"](1, 2)`, "ERROR: assertion failed: 1 != 2"},
+		{`import("std/assert")["truthy"](0)`, "null"},
+		{`import("std/assert")["falsy"](true)`, "ERROR: assertion failed: expected a falsy value"},
+		{`import("std/assert")["length"]("abc", 3)`, "null"},
+		{`import("std/assert")["empty"]([1])`, "ERROR: assertion failed: expected an empty value"},
+	}
+
+	for _, tt := range tests {
+		evaluated := evalFile("", tt.input, NewLoader())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib/math.monkey": "export let answer = 42;",
+	})
+
+	loader := NewLoader()
+	loader.Path = []string{dir}
+	loader.Stdlib = fstest.MapFS{
+		"std/answer.monkey": {Data: []byte("export let answer = 42;")},
+	}
+
+	tests := []struct {
+		path           string
+		expectedName   string
+		expectedSource string
+	}{
+		{filepath.Join(dir, "lib", "math.monkey"), filepath.Join(dir, "lib", "math.monkey"), "export let answer = 42;"},
+		// the search path and the standard library are searched like for imports
+		{"lib/math", filepath.Join(dir, "lib", "math.monkey"), "export let answer = 42;"},
+		{"std/answer", STDLIB_PREFIX + "std/answer.monkey", "export let answer = 42;"},
+	}
+
+	for _, tt := range tests {
+		name, source, err := loader.Source(tt.path)
+		if err != nil {
+			t.Errorf("Source(%q) failed: %s", tt.path, err)
+			continue
+		}
+		if name != tt.expectedName {
+			t.Errorf("Source(%q) name wrong. expected=%q, got=%q", tt.path, tt.expectedName, name)
+		}
+		if source != tt.expectedSource {
+			t.Errorf("Source(%q) source wrong. expected=%q, got=%q", tt.path, tt.expectedSource, source)
+		}
+	}
+
+	if _, _, err := loader.Source("missing"); err == nil || !strings.HasPrefix(err.Error(), "could not find missing: no such module") {
+		t.Errorf("Source of missing module did not fail as expected, got %v", err)
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	t.Setenv(PATH_VARIABLE, first+string(filepath.ListSeparator)+second)
+
+	path := NewLoader().Path
+	if len(path) != 2 || path[0] != first || path[1] != second {
+		t.Errorf("wrong path from $%s. got=%q", PATH_VARIABLE, path)
+	}
+}
+
+func TestPackageImports(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"project/src/main.monkey":                                  "",
+		"project/monkey_modules/example.com/pkg/index.monkey":      `export let from = "index";`,
+		"project/monkey_modules/example.com/pkg/strings.monkey":    `export let from = "strings";`,
+		"project/src/monkey_modules/example.com/near/index.monkey": `export let from = "near";`,
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// packages are found in the modules directories above the importing file
+		{`import("example.com/pkg")["from"]`, "index"},
+		{`import("example.com/pkg/strings")["from"]`, "strings"},
+		{`import("example.com/near")["from"]`, "near"},
+	}
+
+	for _, tt := range tests {
+		evaluated := evalFile(filepath.Join(dir, "project", "src", "main.monkey"), tt.input, NewLoader())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestParsePackage(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected Package
+	}{
+		{"github.com/user/pkg", Package{Name: "github.com/user/pkg", Source: "https://github.com/user/pkg"}},
+		{"github.com/user/pkg@v1.2", Package{Name: "github.com/user/pkg", Source: "https://github.com/user/pkg", Ref: "v1.2"}},
+		{"https://example.com/user/pkg.git", Package{Name: "example.com/user/pkg", Source: "https://example.com/user/pkg.git"}},
+		{"http://localhost:8080/pkg-1.0.tar.gz", Package{Name: "localhost/pkg-1.0", Source: "http://localhost:8080/pkg-1.0.tar.gz"}},
+	}
+
+	for _, tt := range tests {
+		pkg, err := ParsePackage(tt.source)
+		if err != nil {
+			t.Errorf("ParsePackage(%q) failed: %s", tt.source, err)
+			continue
+		}
+		if pkg != tt.expected {
+			t.Errorf("wrong package for %q. expected=%+v, got=%+v", tt.source, tt.expected, pkg)
+		}
+	}
+
+	errors := map[string]string{
+		"https://":                      "invalid package https://: no name to install it at",
+		"example.com/pkg.tar.gz@v1":     "invalid package example.com/pkg.tar.gz@v1: only git repositories have refs",
+		"https://example.com/../../etc": "invalid package https://example.com/../../etc: no name to install it at",
+	}
+	for source, expected := range errors {
+		if _, err := ParsePackage(source); err == nil || err.Error() != expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", source, expected, err)
+		}
+	}
+}
+
+func TestGetTarball(t *testing.T) {
+	archive := tarball(t, map[string]string{
+		"pkg-1.0/index.monkey":     `export let answer = 42;`,
+		"pkg-1.0/lib/extra.monkey": `export let extra = true;`,
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	pkg, err := ParsePackage(server.URL + "/pkg.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modulesDir := filepath.Join(t.TempDir(), MODULES_DIR)
+
+	got, err := Get(pkg, modulesDir)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	sum := sha256.Sum256(archive)
+	if got.Version != SHA256_PREFIX+hex.EncodeToString(sum[:]) {
+		t.Errorf("wrong version. got=%q", got.Version)
+	}
+
+	// the directory that holds everything is left out
+	content, err := os.ReadFile(filepath.Join(modulesDir, "127.0.0.1", "pkg", "lib", "extra.monkey"))
+	if err != nil || string(content) != `export let extra = true;` {
+		t.Errorf("package not extracted: %q, %v", content, err)
+	}
+
+	// a locked version has to match
+	got.Version = SHA256_PREFIX + "0000"
+	if _, err := Get(got, modulesDir); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch. got=%v", err)
+	}
+}
+
+func TestGetRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repository := writeFiles(t, map[string]string{"index.monkey": `export let version = 1;`})
+	commit := func(message string) {
+		for _, args := range [][]string{{"add", "-A"}, {"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", message}} {
+			if output, err := exec.Command("git", append([]string{"-C", repository}, args...)...).CombinedOutput(); err != nil {
+				t.Fatalf("git %s: %s", args, output)
+			}
+		}
+	}
+	if output, err := exec.Command("git", "init", "--quiet", repository).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %s", output)
+	}
+	commit("first")
+
+	pkg, err := ParsePackage("file://" + repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modulesDir := filepath.Join(t.TempDir(), MODULES_DIR)
+	installed := filepath.Join(modulesDir, filepath.FromSlash(pkg.Name), "index.monkey")
+
+	first, err := Get(pkg, modulesDir)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if len(first.Version) != 40 {
+		t.Errorf("version is not a commit. got=%q", first.Version)
+	}
+	if _, err := os.Stat(filepath.Join(modulesDir, filepath.FromSlash(pkg.Name), ".git")); !os.IsNotExist(err) {
+		t.Errorf("the history of the repository was installed")
+	}
+
+	// the locked version is installed even after the repository moves on
+	if err := os.WriteFile(filepath.Join(repository, "index.monkey"), []byte(`export let version = 2;`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commit("second")
+
+	if _, err := Get(first, modulesDir); err != nil {
+		t.Fatalf("Get of the locked version failed: %s", err)
+	}
+	if content, _ := os.ReadFile(installed); string(content) != `export let version = 1;` {
+		t.Errorf("wrong version installed. got=%q", content)
+	}
+
+	latest, err := Get(pkg, modulesDir)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if latest.Version == first.Version {
+		t.Errorf("the latest commit was not fetched")
+	}
+	if content, _ := os.ReadFile(installed); string(content) != `export let version = 2;` {
+		t.Errorf("wrong version installed. got=%q", content)
+	}
+}
+
+func TestLockfile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), LOCKFILE)
+
+	if packages, err := ReadLockfile(filename); err != nil || packages != nil {
+		t.Errorf("a missing lockfile has packages. got=%v, %v", packages, err)
+	}
+
+	packages := []Package{
+		{Name: "github.com/user/b", Source: "https://github.com/user/b", Version: "abc"},
+		{Name: "example.com/a", Source: "https://example.com/a.tar.gz", Version: "sha256:def"},
+	}
+	if err := WriteLockfile(filename, packages); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadLockfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || read[0] != packages[1] || read[1] != packages[0] {
+		t.Errorf("wrong packages read back. got=%+v", read)
+	}
+
+	if err := os.WriteFile(filename, []byte("# comment\n\nexample.com/a https://example.com/a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLockfile(filename); err == nil || err.Error() != filename+":3: want a name, a source, and a version" {
+		t.Errorf("wrong error for a malformed lockfile. got=%v", err)
+	}
+}
+
+// tarball returns a gzipped tarball of the files, named by their paths.
+func tarball(t *testing.T, files map[string]string) []byte {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(gz)
+
+	for name, content := range files {
+		if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+// writeFiles writes the files, named by their paths, into a new directory and returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// evalFile evaluates the input as if it were the program in the file.
+func evalFile(file, input string, loader *Loader) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	options := evaluator.Options{File: file}
+	if loader != nil {
+		options.Importer = loader
+	}
+
+	return evaluator.EvalWithOptions(context.Background(), program, object.NewEnvironment(), options)
+}
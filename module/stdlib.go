@@ -0,0 +1,11 @@
+package module
+
+import (
+	"embed"
+)
+
+// stdlib holds the modules of the standard library, which are written in Monkey and
+// built into every program that embeds the loader.
+//
+//go:embed std/*.monkey
+var stdlib embed.FS
@@ -0,0 +1,246 @@
+// Package monkey embeds the Monkey programming language in Go programs.
+//
+// An Interp keeps the bindings and macros of the programs it runs, so a host can run
+// a script and then evaluate expressions that use what the script defined:
+//
+//	interp := monkey.New()
+//	if err := interp.Run(script); err != nil {
+//		return err
+//	}
+//	value, err := interp.Eval("handle(request)")
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// Value is a value of a Monkey program, such as an *object.Integer or an *object.Array.
+type Value = object.Object
+
+// Hooks are the callbacks through which profilers, tracers and monitors observe the
+// programs an interpreter runs.
+type Hooks = evaluator.Hooks
+
+// Error is a problem found in a program while parsing or running it.
+type Error struct {
+	Message string `json:"message"`
+
+	// position of the problem in the source, zero if unknown
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (err *Error) Error() string {
+	if err.Line == 0 {
+		return err.Message
+	}
+
+	return fmt.Sprintf("%d:%d: %s", err.Line, err.Column, err.Message)
+}
+
+// Errors returns the problems an error returned by Eval is made of: every problem found
+// while parsing, or the runtime error. Any other error, such as one of Run reading the
+// program, becomes a problem without a position.
+func Errors(err error) []*Error {
+	if err == nil {
+		return nil
+	}
+
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	problems := make([]*Error, len(errs))
+	for i, err := range errs {
+		var problem *Error
+		if !errors.As(err, &problem) {
+			problem = &Error{Message: err.Error()}
+		}
+		problems[i] = problem
+	}
+
+	return problems
+}
+
+// Interp runs Monkey programs in an environment shared by every program it runs.
+type Interp struct {
+	env      *object.Environment
+	macroEnv *object.Environment
+
+	// options configure the evaluation of every program, and of the modules they import
+	options evaluator.Options
+}
+
+// Options configure an interpreter. The limits make it safe to run programs that are
+// not trusted: each call to Eval that goes beyond one fails with a runtime error, and
+// the next call starts counting again. A zero limit is no limit, except for MaxDepth.
+type Options struct {
+	// MaxSteps is the number of nodes of the program that can be evaluated.
+	MaxSteps int
+
+	// MaxDepth is the number of function calls that can be in progress at once,
+	// evaluator.DEFAULT_MAX_DEPTH if zero and unlimited if negative.
+	MaxDepth int
+
+	// CheckedArithmetic makes integer arithmetic that overflows fail with an error
+	// instead of producing a big integer.
+	CheckedArithmetic bool
+
+	// StrictBooleans makes conditions and the operand of ! fail with an error unless they
+	// are booleans.
+	StrictBooleans bool
+
+	// MaxMemory is the approximate number of bytes of values that can be allocated.
+	MaxMemory int
+
+	// Sandbox leaves out the builtins that reach outside of the program, such as puts,
+	// and import, so that only pure computation is available. Functions registered by
+	// the host remain available.
+	Sandbox bool
+
+	// AllowExec lets programs run commands with the exec builtin, which otherwise fails
+	// when called. Sandbox mode leaves it out regardless.
+	AllowExec bool
+
+	// Output receives what puts and printf print, in place of standard output, when set.
+	// Sandbox mode keeps them then, since only the host sees what they print. Programs
+	// can print from spawned tasks, so it must be safe for concurrent use.
+	Output io.Writer
+
+	// Hooks are called as programs run.
+	Hooks Hooks
+}
+
+// New creates an interpreter with an empty environment.
+func New() *Interp {
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions creates an interpreter with an empty environment, configured by the options.
+func NewWithOptions(options Options) *Interp {
+	evaluatorOptions := evaluator.Options{
+		MaxSteps:          options.MaxSteps,
+		MaxDepth:          options.MaxDepth,
+		CheckedArithmetic: options.CheckedArithmetic,
+		StrictBooleans:    options.StrictBooleans,
+		MaxMemory:         options.MaxMemory,
+		Sandbox:           options.Sandbox,
+		AllowExec:         options.AllowExec,
+		Output:            options.Output,
+		Hooks:             options.Hooks,
+	}
+
+	// imported modules are evaluated like the programs themselves, relative to the working directory
+	loader := module.NewLoader()
+	loader.Options = evaluatorOptions
+	evaluatorOptions.Importer = loader
+
+	return &Interp{env: object.NewEnvironment(), macroEnv: object.NewEnvironment(), options: evaluatorOptions}
+}
+
+// Eval runs the source and returns the value of its last statement, which is null if
+// it has none. A program that does not parse returns every problem found, joined, and
+// one that fails while running returns its runtime error. Both are *Error.
+func (interp *Interp) Eval(src string) (Value, error) {
+	return interp.EvalContext(context.Background(), src)
+}
+
+// EvalContext runs the source like Eval, stopping it with a runtime error as soon as
+// the context is cancelled, so a host can put a deadline on scripts it does not trust.
+func (interp *Interp) EvalContext(ctx context.Context, src string) (Value, error) {
+	p := parser.New(lexer.New(src))
+
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		errs := make([]error, len(p.Diagnostics()))
+		for i, diagnostic := range p.Diagnostics() {
+			errs[i] = &Error{Message: diagnostic.Message, Line: diagnostic.Line, Column: diagnostic.Column}
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	evaluator.DefineMacros(program, interp.macroEnv)
+	expanded, errObj := evaluator.ExpandMacrosWithOptions(ctx, program, interp.macroEnv, interp.options)
+	if errObj != nil {
+		return nil, runtimeError(errObj)
+	}
+
+	result := evaluator.EvalWithOptions(ctx, expanded.(*ast.Program), interp.env, interp.options)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, runtimeError(errObj)
+	}
+	if result == nil {
+		return evaluator.NULL, nil
+	}
+
+	return result, nil
+}
+
+// Run reads a whole program and runs it like Eval, discarding its value.
+func (interp *Interp) Run(r io.Reader) error {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = interp.Eval(string(src))
+	return err
+}
+
+// RegisterFunc binds a Go function to the name, for the programs of the interpreter to
+// call like a builtin. A nil value returned becomes null, and an error returned stops
+// the program with the message of the error as its runtime error. The function is given
+// and returns objects; RegisterGoFunc converts them to and from Go values.
+func (interp *Interp) RegisterFunc(name string, fn func(args ...Value) (Value, error)) {
+	interp.env.Set(name, &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			result, err := fn(args...)
+			if err != nil {
+				return &object.Error{Message: err.Error()}
+			}
+			if result == nil {
+				return evaluator.NULL
+			}
+
+			return result
+		},
+	})
+}
+
+// RegisterGoFunc binds a Go function to the name like RegisterFunc, converting the
+// arguments to Go values with object.ToGo and the value returned to an object with
+// object.FromGo. A value that cannot be converted stops the program like an error returned.
+func (interp *Interp) RegisterGoFunc(name string, fn func(args ...any) (any, error)) {
+	interp.RegisterFunc(name, func(args ...Value) (Value, error) {
+		converted := make([]any, len(args))
+		for i, arg := range args {
+			converted[i] = object.ToGo(arg)
+		}
+
+		result, err := fn(converted...)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := object.FromGo(result)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return value, nil
+	})
+}
+
+// runtimeError converts an error object of the evaluator into an *Error.
+func runtimeError(errObj *object.Error) *Error {
+	return &Error{Message: errObj.Message, Line: errObj.Line, Column: errObj.Column}
+}
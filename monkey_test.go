@@ -0,0 +1,344 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey/object"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3"},
+		{`"mon" + "key"`, "monkey"},
+		{"let x = 1;", "null"},
+		{"", "null"},
+		{"[1, 2][1]", "2"},
+		{"let unless = macro(c, a) { quote(if (!unquote(c)) { unquote(a) }) }; unless(false, 5)", "5"},
+	}
+
+	for _, tt := range tests {
+		value, err := New().Eval(tt.input)
+		if err != nil {
+			t.Errorf("Eval(%q) returned error: %s", tt.input, err)
+			continue
+		}
+		if value.Inspect() != tt.expected {
+			t.Errorf("Eval(%q) wrong. expected=%q, got=%q", tt.input, tt.expected, value.Inspect())
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let x 1;\nlet y 2;", "1:7: expected next token to be =, got INT instead\n2:7: expected next token to be =, got INT instead"},
+		{"let m = macro() { 1 }; m()", "1:25: macro m returned INTEGER, want QUOTE"},
+	}
+
+	for _, tt := range tests {
+		_, err := New().Eval(tt.input)
+		if err == nil {
+			t.Errorf("Eval(%q) returned no error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("Eval(%q) error wrong. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+
+		var monkeyErr *Error
+		if !errors.As(err, &monkeyErr) || monkeyErr.Line == 0 {
+			t.Errorf("Eval(%q) error is not a positioned *Error. got=%#v", tt.input, err)
+		}
+
+		// the problems are the lines of the error
+		problems := Errors(err)
+		lines := make([]string, len(problems))
+		for i, problem := range problems {
+			lines[i] = problem.Error()
+		}
+		if strings.Join(lines, "\n") != tt.expected {
+			t.Errorf("Errors(%q) wrong. got=%q", tt.input, lines)
+		}
+	}
+
+	if problems := Errors(fmt.Errorf("read failed")); len(problems) != 1 || *problems[0] != (Error{Message: "read failed"}) {
+		t.Errorf("Errors of another error wrong. got=%v", problems)
+	}
+	if problems := Errors(nil); problems != nil {
+		t.Errorf("Errors(nil) should be nil. got=%v", problems)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := New().EvalContext(ctx, "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(60)")
+
+	var runtimeErr *Error
+	if !errors.As(err, &runtimeErr) || runtimeErr.Message != "evaluation interrupted: context deadline exceeded" {
+		t.Errorf("expected interruption. got=%v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		options  Options
+		input    string
+		expected string
+	}{
+		{Options{MaxSteps: 100}, "let f = fn(n) { f(n + 1) }; f(0)", "1:18: step limit exceeded: 100 steps"},
+		{Options{MaxDepth: 10}, "let f = fn(n) { f(n + 1) }; f(0)", "1:18: maximum recursion depth exceeded: 10 calls"},
+		{Options{MaxMemory: 1000}, "let f = fn(s) { f(s + s) }; f(\"ab\")", "1:21: memory limit exceeded: 1000 bytes"},
+	}
+
+	for _, tt := range tests {
+		interp := NewWithOptions(tt.options)
+
+		_, err := interp.Eval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+
+		// every call starts with the whole budget again
+		value, err := interp.Eval("1 + 1")
+		if err != nil || value.Inspect() != "2" {
+			t.Errorf("limits should reset between calls. got=%v, %v", value, err)
+		}
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	interp := NewWithOptions(Options{Sandbox: true})
+	interp.RegisterFunc("host", func(args ...Value) (Value, error) {
+		return &object.Integer{Value: 1}, nil
+	})
+
+	_, err := interp.Eval(`puts("escaped")`)
+	if err == nil || err.Error() != "1:5: puts is not available in sandbox mode" {
+		t.Errorf("expected sandbox error. got=%v", err)
+	}
+
+	// functions of the host are its own to allow
+	value, err := interp.Eval("host() + len([1])")
+	if err != nil || value.Inspect() != "2" {
+		t.Errorf("host function should be available. got=%v, %v", value, err)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var output strings.Builder
+	interp := NewWithOptions(Options{Sandbox: true, Output: &output})
+
+	// what programs print reaches only the host, so the sandbox keeps it
+	_, err := interp.Eval(`puts("a", 1); printf("{} {}\n", "b", [2])`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "a\n1\nb [2]\n"; output.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, output.String())
+	}
+
+	if _, err := interp.Eval("sleep(1)"); err == nil || err.Error() != "1:6: sleep is not available in sandbox mode" {
+		t.Errorf("expected sandbox error. got=%v", err)
+	}
+}
+
+func TestHostTypes(t *testing.T) {
+	// a connection is a handle the host passes to programs and gets back
+	type connection struct{ queries []string }
+	connectionType := &object.HostType{
+		Name:    "CONNECTION",
+		Inspect: func(value any) string { return "<connection>" },
+		Methods: map[string]object.Method{
+			"query": func(receiver *object.HostObject, args ...object.Object) object.Object {
+				conn := receiver.Value.(*connection)
+				conn.queries = append(conn.queries, args[0].Inspect())
+				return &object.Integer{Value: int64(len(conn.queries))}
+			},
+		},
+	}
+
+	conn := &connection{}
+	interp := New()
+	interp.RegisterFunc("connect", func(args ...Value) (Value, error) {
+		return connectionType.New(conn), nil
+	})
+
+	value, err := interp.Eval(`let db = connect(); db["query"]("select 1"); db["query"]("select 2")`)
+	if err != nil || value.Inspect() != "2" {
+		t.Fatalf("wrong result. got=%v, %v", value, err)
+	}
+	if strings.Join(conn.queries, "; ") != "select 1; select 2" {
+		t.Errorf("queries wrong. got=%q", conn.queries)
+	}
+
+	value, err = interp.Eval("db")
+	if err != nil || object.ToGo(value) != conn || value.Inspect() != "<connection>" {
+		t.Errorf("handle should come back to the host. got=%v, %v", value, err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	// a profiler counting calls to each function
+	calls := map[string]int{}
+	interp := NewWithOptions(Options{Hooks: Hooks{
+		OnCall: func(function Value, arguments []Value) {
+			calls[function.Inspect()]++
+		},
+	}})
+
+	_, err := interp.Eval("let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(3); len([])")
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	if calls["builtin function"] != 1 || len(calls) != 2 {
+		t.Errorf("calls wrong. got=%v", calls)
+	}
+	for function, count := range calls {
+		if function != "builtin function" && count != 4 {
+			t.Errorf("calls to %s wrong. expected=4, got=%d", function, count)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	interp := New()
+
+	// bindings and macros survive from one program to the next
+	script := "let double = fn(x) { x * 2 };\nlet twice = macro(x) { quote(unquote(x) + unquote(x)) };"
+	if err := interp.Run(strings.NewReader(script)); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	value, err := interp.Eval("double(twice(5))")
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	if value.Inspect() != "20" {
+		t.Errorf("value wrong. expected=20, got=%s", value.Inspect())
+	}
+
+	if err := interp.Run(strings.NewReader("missing")); err == nil || err.Error() != "1:1: identifier not found: missing" {
+		t.Errorf("Run error wrong. got=%v", err)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	interp := New()
+
+	var logged []string
+	interp.RegisterFunc("log", func(args ...Value) (Value, error) {
+		for _, arg := range args {
+			logged = append(logged, arg.Inspect())
+		}
+		return nil, nil
+	})
+	interp.RegisterFunc("sum", func(args ...Value) (Value, error) {
+		total := int64(0)
+		for _, arg := range args {
+			integer, ok := arg.(*object.Integer)
+			if !ok {
+				return nil, fmt.Errorf("sum: not an integer: %s", arg.Type())
+			}
+			total += integer.Value
+		}
+		return &object.Integer{Value: total}, nil
+	})
+
+	value, err := interp.Eval(`log("start", 1); let result = sum(1, 2, 3); log(result); result`)
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	if value.Inspect() != "6" {
+		t.Errorf("value wrong. expected=6, got=%s", value.Inspect())
+	}
+	if strings.Join(logged, " ") != "start 1 6" {
+		t.Errorf("logged wrong. got=%q", logged)
+	}
+
+	value, err = interp.Eval("log()")
+	if err != nil || value.Inspect() != "null" {
+		t.Errorf("nil result should be null. got=%v, %v", value, err)
+	}
+
+	// an error from the host fails the program where the function was called
+	_, err = interp.Eval("let x = 1;\nsum(x, \"two\")")
+	if err == nil || err.Error() != "2:4: sum: not an integer: STRING" {
+		t.Errorf("error wrong. got=%v", err)
+	}
+
+	// hosts hand over Go values converted to objects
+	interp.RegisterFunc("config", func(args ...Value) (Value, error) {
+		return object.FromGo(map[string]any{"port": 8080, "hosts": []string{"a", "b"}})
+	})
+	value, err = interp.Eval(`let c = config(); c["port"] + len(c["hosts"]) + len(c)`)
+	if err != nil || value.Inspect() != "8084" {
+		t.Errorf("hash from host wrong. got=%v, %v", value, err)
+	}
+
+	_, err = interp.Eval(`config()[[1]]`)
+	if err == nil || err.Error() != "1:9: unusable as hash key: ARRAY" {
+		t.Errorf("error wrong. got=%v", err)
+	}
+}
+
+func TestRegisterGoFunc(t *testing.T) {
+	interp := New()
+
+	var received []any
+	interp.RegisterGoFunc("describe", func(args ...any) (any, error) {
+		received = args
+		return map[string]any{"count": len(args), "names": []string{"a", "b"}}, nil
+	})
+	interp.RegisterGoFunc("fail", func(args ...any) (any, error) {
+		return nil, fmt.Errorf("failed with %v", args[0])
+	})
+	interp.RegisterGoFunc("leak", func(args ...any) (any, error) {
+		return make(chan int), nil
+	})
+	interp.RegisterGoFunc("nothing", func(args ...any) (any, error) {
+		return nil, nil
+	})
+
+	value, err := interp.Eval(`let d = describe(1, "two", true, [3], {"k": false}); d["count"] + len(d["names"])`)
+	if err != nil || value.Inspect() != "7" {
+		t.Fatalf("result from host wrong. got=%v, %v", value, err)
+	}
+
+	expected := []any{int64(1), "two", true, []any{int64(3)}, map[any]any{"k": false}}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("arguments wrong. expected=%#v, got=%#v", expected, received)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fail(5)`, "1:5: failed with 5"},
+		{`leak()`, "1:5: leak: cannot convert chan int to a Monkey value"},
+	}
+
+	for _, tt := range tests {
+		_, err := interp.Eval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("error wrong for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	value, err = interp.Eval(`nothing()`)
+	if err != nil || value.Inspect() != "null" {
+		t.Errorf("nil result should be null. got=%v, %v", value, err)
+	}
+}
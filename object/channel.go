@@ -0,0 +1,117 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// ErrClosedChannel is the error of sending on a channel that was closed.
+var ErrClosedChannel = errors.New("send on closed channel")
+
+// Channel passes values between tasks, holding up to its capacity of them until they
+// are received. Once closed it takes no more values, and receiving from it gives the
+// values it still holds.
+type Channel struct {
+	Capacity int
+
+	values chan Object
+	closed chan struct{} // closed when the channel is
+
+	mutex    sync.Mutex
+	isClosed bool
+}
+
+// NewChannel creates a channel that holds up to the capacity of values.
+func NewChannel(capacity int) *Channel {
+	return &Channel{Capacity: capacity, values: make(chan Object, capacity), closed: make(chan struct{})}
+}
+
+func (channel *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (channel *Channel) Inspect() string  { return "channel" }
+
+// Send waits until the channel takes the value, failing if it is closed or the context
+// is done first.
+func (channel *Channel) Send(ctx context.Context, value Object) error {
+	select {
+	case <-channel.closed:
+		return ErrClosedChannel
+	default:
+	}
+
+	select {
+	case channel.values <- value:
+		return nil
+	case <-channel.closed:
+		return ErrClosedChannel
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Receive waits for a value of the channel and returns it, or reports false once the
+// channel is closed and holds no more values. It fails if the context is done first.
+func (channel *Channel) Receive(ctx context.Context) (Object, bool, error) {
+	select {
+	case value := <-channel.values:
+		return value, true, nil
+	case <-channel.closed:
+		// the values sent before the channel was closed are still received
+		select {
+		case value := <-channel.values:
+			return value, true, nil
+		default:
+			return nil, false, nil
+		}
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// Close closes the channel, reporting false if it already was.
+func (channel *Channel) Close() bool {
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	if channel.isClosed {
+		return false
+	}
+	channel.isClosed = true
+	close(channel.closed)
+
+	return true
+}
+
+// Select waits for the first of the channels that a value can be received from, or that
+// is closed, and returns its index with what Receive would have returned for it. Of the
+// channels ready at once, one is chosen at random. It fails if the context is done first.
+func Select(ctx context.Context, channels []*Channel) (int, Object, bool, error) {
+	// each channel is waited on for a value and for being closed, and the context last
+	cases := make([]reflect.SelectCase, 0, 2*len(channels)+1)
+	for _, channel := range channels {
+		cases = append(cases,
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(channel.values)},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(channel.closed)},
+		)
+	}
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+
+	chosen, received, _ := reflect.Select(cases)
+	if chosen == len(cases)-1 {
+		return -1, nil, false, ctx.Err()
+	}
+
+	index := chosen / 2
+	if chosen%2 == 0 {
+		return index, received.Interface().(Object), true, nil
+	}
+
+	// the values sent before the channel was closed are still received
+	select {
+	case value := <-channels[index].values:
+		return index, value, true, nil
+	default:
+		return index, nil, false, nil
+	}
+}
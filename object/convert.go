@@ -0,0 +1,145 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// FromGo converts a Go value to the object a Monkey program sees. Integers of every
+// size become integers, a *big.Int a big integer, booleans booleans, strings strings, a
+// []byte bytes, nil null, and other slices, arrays and maps are converted element by element into arrays and hashes. Objects
+// are returned as they are.
+//
+// Monkey has no floating point numbers, so a float converts only if it holds a whole
+// number. Values that have no counterpart, such as structs and functions, are errors.
+func FromGo(value any) (Object, error) {
+	if value == nil {
+		return NULL, nil
+	}
+	if obj, ok := value.(Object); ok {
+		return obj, nil
+	}
+	if integer, ok := value.(*big.Int); ok {
+		if integer == nil {
+			return NULL, nil
+		}
+		return &BigInteger{Value: new(big.Int).Set(integer)}, nil
+	}
+
+	if data, ok := value.([]byte); ok {
+		if data == nil {
+			return NULL, nil
+		}
+		return &Bytes{Value: bytes.Clone(data)}, nil
+	}
+
+	v := reflect.ValueOf(value)
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewInteger(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("cannot convert %d: too large for an integer", v.Uint())
+		}
+		return NewInteger(int64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, fmt.Errorf("cannot convert %v: not a whole number that fits an integer", f)
+		}
+		return NewInteger(int64(f)), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			element, err := FromGo(v.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			elements[i] = element
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+
+		pairs := make(map[HashKey]HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := FromGo(iter.Key().Interface())
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+			hashable, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("key %v: unusable as hash key: %s", iter.Key(), key.Type())
+			}
+
+			element, err := FromGo(iter.Value().Interface())
+			if err != nil {
+				return nil, fmt.Errorf("value of key %v: %w", iter.Key(), err)
+			}
+			pairs[hashable.HashKey()] = HashPair{Key: key, Value: element}
+		}
+		return &Hash{Pairs: pairs}, nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return FromGo(v.Elem().Interface())
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to a Monkey value", value)
+}
+
+// ToGo converts an object to the plain Go value it holds: an int64, *big.Int, bool,
+// string, []byte, []any or map[any]any, with the elements of arrays and hashes converted in
+// turn, nil for null, or the value a host object wraps. Objects without a Go
+// counterpart, such as functions, are returned as they are.
+func ToGo(obj Object) any {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value
+	case *BigInteger:
+		return new(big.Int).Set(obj.Value)
+	case *Boolean:
+		return obj.Value
+	case *String:
+		return obj.Value
+	case *Bytes:
+		return bytes.Clone(obj.Value)
+	case *Null:
+		return nil
+	case *Array:
+		elements := make([]any, len(obj.Elements))
+		for i, element := range obj.Elements {
+			elements[i] = ToGo(element)
+		}
+		return elements
+	case *Hash:
+		pairs := make(map[any]any, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs[ToGo(pair.Key)] = ToGo(pair.Value)
+		}
+		return pairs
+	case *HostObject:
+		return obj.Value
+	}
+
+	return obj
+}
@@ -0,0 +1,191 @@
+package object
+
+import (
+	"monkey/ast"
+	"sort"
+)
+
+// Environment stores the bindings visible to the code being evaluated. The bindings of
+// the program and the REPL live in a map, while those of a function call live in the
+// slots of the function's locals, with a map only for names a macro bound in it.
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+
+	locals *ast.Locals
+	slots  []Object // the values of the locals, nil until bound
+}
+
+// NewEnvironment creates a new, empty environment.
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+// NewEnclosedEnvironment creates a new environment nested inside the given outer environment.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	environment := NewEnvironment()
+	environment.outer = outer
+
+	return environment
+}
+
+// NewLocalEnvironment creates the environment of a call to a function with the locals,
+// nested inside the environment of the function. Without locals it is an enclosed one.
+func NewLocalEnvironment(outer *Environment, locals *ast.Locals) *Environment {
+	if locals == nil {
+		return NewEnclosedEnvironment(outer)
+	}
+
+	return &Environment{outer: outer, locals: locals, slots: make([]Object, len(locals.Names))}
+}
+
+// Get looks up a binding, falling back to the outer environments if it is not found.
+func (environment *Environment) Get(name string) (Object, bool) {
+	value, ok := environment.local(name)
+	if !ok && environment.outer != nil {
+		value, ok = environment.outer.Get(name)
+	}
+
+	return value, ok
+}
+
+// GetSlot looks up the binding of the name in its slot, which is only a hint, falling
+// back to Get if the slot is not the name's or not bound yet.
+func (environment *Environment) GetSlot(slot int, name string) (Object, bool) {
+	if slot < len(environment.slots) && environment.locals.Names[slot] == name {
+		if value := environment.slots[slot]; value != nil {
+			return value, true
+		}
+	}
+
+	return environment.Get(name)
+}
+
+// Set binds a value to a name in this environment.
+func (environment *Environment) Set(name string, value Object) Object {
+	if environment.locals != nil {
+		if slot, ok := environment.locals.Slot(name); ok {
+			environment.slots[slot] = value
+			return value
+		}
+	}
+
+	if environment.store == nil {
+		environment.store = make(map[string]Object)
+	}
+	environment.store[name] = value
+	return value
+}
+
+// SetSlot binds a value to the name in its slot, which is only a hint, falling back to
+// Set if the slot is not the name's.
+func (environment *Environment) SetSlot(slot int, name string, value Object) Object {
+	if slot < len(environment.slots) && environment.locals.Names[slot] == name {
+		environment.slots[slot] = value
+		return value
+	}
+
+	return environment.Set(name, value)
+}
+
+// local looks up a binding in this environment only.
+func (environment *Environment) local(name string) (Object, bool) {
+	if environment.locals != nil {
+		if slot, ok := environment.locals.Slot(name); ok && environment.slots[slot] != nil {
+			return environment.slots[slot], true
+		}
+	}
+
+	value, ok := environment.store[name]
+	return value, ok
+}
+
+// Names returns the names bound in this environment and the ones enclosing it, those of
+// the innermost first, each environment's in sorted order.
+func (environment *Environment) Names() []string {
+	var names []string
+	for env := environment; env != nil; env = env.outer {
+		var local []string
+		if env.locals != nil {
+			for slot, name := range env.locals.Names {
+				if env.slots[slot] != nil {
+					local = append(local, name)
+				}
+			}
+		}
+		for name := range env.store {
+			local = append(local, name)
+		}
+
+		sort.Strings(local)
+		names = append(names, local...)
+	}
+
+	return names
+}
+
+// Outer returns the environment that encloses this one, or nil if none does.
+func (environment *Environment) Outer() *Environment {
+	return environment.outer
+}
+
+// Copy returns an environment with the bindings of this one, enclosed by the outer one.
+func (environment *Environment) Copy(outer *Environment) *Environment {
+	copied := &Environment{outer: outer, locals: environment.locals}
+	if environment.store != nil {
+		copied.store = make(map[string]Object, len(environment.store))
+		for name, value := range environment.store {
+			copied.store[name] = value
+		}
+	}
+	if environment.slots != nil {
+		copied.slots = append([]Object(nil), environment.slots...)
+	}
+
+	return copied
+}
+
+// Replace binds each name bound in this environment to what replace returns for its value.
+func (environment *Environment) Replace(replace func(Object) Object) {
+	for name, value := range environment.store {
+		environment.store[name] = replace(value)
+	}
+	for slot, value := range environment.slots {
+		if value != nil {
+			environment.slots[slot] = replace(value)
+		}
+	}
+}
+
+// Outermost returns the environment that encloses this one and every other, which
+// holds the bindings of the whole program or module and lives as long as it does.
+func (environment *Environment) Outermost() *Environment {
+	for environment.outer != nil {
+		environment = environment.outer
+	}
+
+	return environment
+}
+
+// Capture returns an environment for a function defined in this one that uses the
+// names, holding only the bindings this environment has of them outside of the
+// outermost environment, which it encloses. A function that keeps the environment
+// it was defined in would keep every binding around it alive instead.
+func (environment *Environment) Capture(names []string) *Environment {
+	outermost := environment.Outermost()
+	if environment == outermost {
+		return environment
+	}
+
+	captured := NewEnclosedEnvironment(outermost)
+	for _, name := range names {
+		for env := environment; env != outermost; env = env.outer {
+			if value, ok := env.local(name); ok {
+				captured.store[name] = value
+				break
+			}
+		}
+	}
+
+	return captured
+}
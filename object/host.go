@@ -0,0 +1,67 @@
+package object
+
+import (
+	"fmt"
+)
+
+// Method is a function of a host type, called with the object it was looked up on.
+type Method func(receiver *HostObject, args ...Object) Object
+
+// HostType describes a type of object defined by the Go program that embeds Monkey, so
+// that it can hand values such as database connections to programs as opaque handles.
+// Programs call the methods with a dot, as in conn.query("select 1"), or reach them by
+// indexing an object with their name, and apply the operators as they would to any value.
+type HostType struct {
+	// Name is the type of the objects, as error messages report it.
+	Name ObjectType
+
+	// Inspect describes the value of an object, or the type and value are printed if nil.
+	Inspect func(value any) string
+
+	// Methods maps names to the methods of the objects.
+	Methods map[string]Method
+
+	// InfixOperators maps operators such as + to what they do when either operand is an
+	// object of the type. The operators not in it work as for other values: == and !=
+	// compare identity, and the rest fail.
+	InfixOperators map[string]func(left, right Object) Object
+
+	// PrefixOperators maps the operators - and ! to what they do to an object of the type.
+	PrefixOperators map[string]func(right Object) Object
+}
+
+// New wraps a Go value in an object of the type.
+func (hostType *HostType) New(value any) *HostObject {
+	return &HostObject{HostType: hostType, Value: value}
+}
+
+// HostObject is an object of a type defined by the host, holding a Go value that
+// Monkey programs can pass around and use only through the type.
+type HostObject struct {
+	HostType *HostType
+	Value    any
+}
+
+func (hostObject *HostObject) Type() ObjectType { return hostObject.HostType.Name }
+func (hostObject *HostObject) Inspect() string {
+	if hostObject.HostType.Inspect != nil {
+		return hostObject.HostType.Inspect(hostObject.Value)
+	}
+
+	return fmt.Sprintf("%s(%v)", hostObject.HostType.Name, hostObject.Value)
+}
+
+// Method returns the method with the name bound to the object as a builtin, which
+// programs can call like any other function.
+func (hostObject *HostObject) Method(name string) (*Builtin, bool) {
+	method, ok := hostObject.HostType.Methods[name]
+	if !ok {
+		return nil, false
+	}
+
+	return &Builtin{
+		Fn: func(args ...Object) Object {
+			return method(hostObject, args...)
+		},
+	}, true
+}
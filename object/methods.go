@@ -0,0 +1,62 @@
+package object
+
+import "context"
+
+// MethodTable maps the names of the methods of a type to the builtins they call, which
+// take the object the method is called on as their first argument.
+type MethodTable map[string]*Builtin
+
+// methodTables maps types of objects to their methods, as the engines register them.
+var methodTables = map[ObjectType]MethodTable{}
+
+// RegisterMethods adds the methods to those of the objects of the type, in place of
+// methods of the same names.
+func RegisterMethods(objectType ObjectType, methods MethodTable) {
+	table, ok := methodTables[objectType]
+	if !ok {
+		table = MethodTable{}
+		methodTables[objectType] = table
+	}
+
+	for name, builtin := range methods {
+		table[name] = builtin
+	}
+}
+
+// LookupMethod returns the method with the name bound to the receiver as a builtin,
+// which programs can call like any other function. The methods of host objects come
+// from their type.
+func LookupMethod(receiver Object, name string) (*Builtin, bool) {
+	if hostObject, ok := receiver.(*HostObject); ok {
+		return hostObject.Method(name)
+	}
+
+	builtin, ok := methodTables[receiver.Type()][name]
+	if !ok {
+		return nil, false
+	}
+
+	return bind(builtin, receiver), true
+}
+
+// bind returns a builtin that calls the builtin with the receiver before its arguments.
+func bind(builtin *Builtin, receiver Object) *Builtin {
+	bound := &Builtin{}
+	if builtin.Fn != nil {
+		bound.Fn = func(args ...Object) Object {
+			return builtin.Fn(append([]Object{receiver}, args...)...)
+		}
+	}
+	if builtin.HigherOrderFn != nil {
+		bound.HigherOrderFn = func(call Caller, args ...Object) Object {
+			return builtin.HigherOrderFn(call, append([]Object{receiver}, args...)...)
+		}
+	}
+	if builtin.ContextFn != nil {
+		bound.ContextFn = func(ctx context.Context, args ...Object) Object {
+			return builtin.ContextFn(ctx, append([]Object{receiver}, args...)...)
+		}
+	}
+
+	return bound
+}
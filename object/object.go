@@ -0,0 +1,451 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"monkey/ast"
+	"monkey/code"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	BIG_INTEGER_OBJ  = "BIG_INTEGER"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	STRING_OBJ       = "STRING"
+	BYTES_OBJ        = "BYTES"
+	BUILTIN_OBJ      = "BUILTIN"
+	ARRAY_OBJ        = "ARRAY"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
+	HASH_OBJ         = "HASH"
+	MODULE_OBJ       = "MODULE"
+	TASK_OBJ         = "TASK"
+	CHANNEL_OBJ      = "CHANNEL"
+)
+
+// Booleans and null carry no state, so a single instance of each is shared.
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// Object represents a value produced by evaluating the AST.
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+// Integer represents an integer value.
+type Integer struct {
+	Value int64
+}
+
+func (integer *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (integer *Integer) Inspect() string  { return strconv.FormatInt(integer.Value, 10) }
+func (integer *Integer) HashKey() HashKey {
+	return HashKey{Type: integer.Type(), Value: uint64(integer.Value)}
+}
+
+// MIN_CACHED_INTEGER and MAX_CACHED_INTEGER bound the integers NewInteger shares, which
+// counters, indexes and lengths mostly fall between.
+const (
+	MIN_CACHED_INTEGER = -128
+	MAX_CACHED_INTEGER = 1024
+)
+
+// cachedIntegers holds the shared integers from MIN_CACHED_INTEGER up.
+var cachedIntegers = func() []Integer {
+	integers := make([]Integer, MAX_CACHED_INTEGER-MIN_CACHED_INTEGER+1)
+	for i := range integers {
+		integers[i].Value = int64(i + MIN_CACHED_INTEGER)
+	}
+	return integers
+}()
+
+// NewInteger returns an integer of the value, shared with every other integer of the
+// value if it is a small one. Integers are never changed, so they can be shared like
+// the booleans.
+func NewInteger(value int64) *Integer {
+	if value >= MIN_CACHED_INTEGER && value <= MAX_CACHED_INTEGER {
+		return &cachedIntegers[value-MIN_CACHED_INTEGER]
+	}
+
+	return &Integer{Value: value}
+}
+
+// IsCachedInteger reports whether the integer is one of those NewInteger shares.
+func IsCachedInteger(integer *Integer) bool {
+	return integer.Value >= MIN_CACHED_INTEGER && integer.Value <= MAX_CACHED_INTEGER &&
+		integer == &cachedIntegers[integer.Value-MIN_CACHED_INTEGER]
+}
+
+// BigInteger represents an integer of any size. Integer arithmetic that overflows
+// produces one, and so does arithmetic with one.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (integer *BigInteger) Type() ObjectType { return BIG_INTEGER_OBJ }
+func (integer *BigInteger) Inspect() string  { return integer.Value.String() }
+
+// HashKey returns the key of the integer of the same value when there is one, so that
+// either finds the same pair.
+func (integer *BigInteger) HashKey() HashKey {
+	if integer.Value.IsInt64() {
+		return (&Integer{Value: integer.Value.Int64()}).HashKey()
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(integer.Value.String()))
+
+	return HashKey{Type: integer.Type(), Value: h.Sum64()}
+}
+
+// Boolean represents a boolean value.
+type Boolean struct {
+	Value bool
+}
+
+func (boolean *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (boolean *Boolean) Inspect() string  { return strconv.FormatBool(boolean.Value) }
+func (boolean *Boolean) HashKey() HashKey {
+	var value uint64
+	if boolean.Value {
+		value = 1
+	}
+
+	return HashKey{Type: boolean.Type(), Value: value}
+}
+
+// Null represents the absence of a value.
+type Null struct{}
+
+func (null *Null) Type() ObjectType { return NULL_OBJ }
+func (null *Null) Inspect() string  { return "null" }
+
+// ReturnValue wraps the value of a return statement while it unwinds the block statements.
+type ReturnValue struct {
+	Value Object
+}
+
+func (returnValue *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (returnValue *ReturnValue) Inspect() string  { return returnValue.Value.Inspect() }
+
+// Error represents a runtime error encountered during evaluation.
+type Error struct {
+	Message string
+
+	// position of the expression that failed, zero if unknown
+	Line   int
+	Column int
+
+	// Value is what the program threw, which catch binds in place of the error, or
+	// nil for the errors of the interpreter itself
+	Value Object
+
+	// Fatal errors, such as those of a cancelled run, end the program even inside a try
+	Fatal bool
+
+	// Trace holds the calls the error propagated out of, innermost first
+	Trace []Call
+}
+
+// Call is a function call that was in progress when an error happened.
+type Call struct {
+	// Function is the name the function was called by, or empty if it was called
+	// without one, as fn(x) { x }(1) is
+	Function string
+
+	// position of the call
+	Line   int
+	Column int
+}
+
+// MAX_TRACE_LINES is the number of calls a stack trace describes. Deeper traces, as of
+// runaway recursion, keep the innermost and outermost calls.
+const MAX_TRACE_LINES = 20
+
+// TraceLines describes the calls of the stack trace, innermost first, each followed by
+// its position as the function writes it.
+func (err *Error) TraceLines(position func(line, column int) string) []string {
+	var lines []string
+	for i, call := range err.Trace {
+		if len(err.Trace) > MAX_TRACE_LINES && i == MAX_TRACE_LINES/2 {
+			lines = append(lines, fmt.Sprintf("... %d more calls", len(err.Trace)-MAX_TRACE_LINES))
+		}
+		if len(err.Trace) > MAX_TRACE_LINES && i >= MAX_TRACE_LINES/2 && i < len(err.Trace)-MAX_TRACE_LINES/2 {
+			continue
+		}
+
+		name := call.Function
+		if name == "" {
+			name = "anonymous function"
+		}
+		lines = append(lines, fmt.Sprintf("in %s, called at %s", name, position(call.Line, call.Column)))
+	}
+
+	return lines
+}
+
+func (err *Error) Type() ObjectType { return ERROR_OBJ }
+func (err *Error) Inspect() string  { return "ERROR: " + err.Message }
+
+// Error returns the message, so that the virtual machine can fail with the error itself.
+func (err *Error) Error() string { return err.Message }
+
+// Function represents a user-defined function together with the environment it closes over.
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	Locals     *ast.Locals // the locals the environments of its calls hold in slots
+}
+
+func (function *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (function *Function) Inspect() string {
+	var output string
+
+	output = "fn("
+
+	for i, parameter := range function.Parameters {
+		if i != 0 {
+			output += ", "
+		}
+
+		output += parameter.String()
+	}
+
+	output += ") {\n" + function.Body.String() + "\n}"
+
+	return output
+}
+
+// CompiledFunction represents a function compiled to bytecode. Its type is FUNCTION
+// like the evaluator's functions, so both engines describe values the same way.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int // the number of local bindings, parameters included
+	NumParameters int
+
+	// Name is the name the function was bound to by a let statement, if any, which
+	// stack traces show
+	Name string
+
+	// SourceMap places the instructions in the source, for the errors they fail with
+	SourceMap code.SourceMap
+}
+
+func (compiledFunction *CompiledFunction) Type() ObjectType { return FUNCTION_OBJ }
+func (compiledFunction *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", compiledFunction)
+}
+
+// Closure represents a compiled function together with the values it captured from
+// the functions around it. Every function is wrapped in a closure at runtime.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (closure *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (closure *Closure) Inspect() string  { return fmt.Sprintf("Closure[%p]", closure) }
+
+// String represents a string value.
+type String struct {
+	Value string
+}
+
+func (str *String) Type() ObjectType { return STRING_OBJ }
+func (str *String) Inspect() string  { return str.Value }
+func (str *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(str.Value))
+
+	return HashKey{Type: str.Type(), Value: h.Sum64()}
+}
+
+// Bytes represents binary data, which unlike a string need not be text.
+type Bytes struct {
+	Value []byte
+}
+
+func (bytes *Bytes) Type() ObjectType { return BYTES_OBJ }
+func (bytes *Bytes) Inspect() string  { return ast.QuoteBytes(bytes.Value) }
+func (bytes *Bytes) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(bytes.Value)
+
+	return HashKey{Type: bytes.Type(), Value: h.Sum64()}
+}
+
+// BuiltinFunction is the signature of functions implemented in Go and callable from Monkey.
+type BuiltinFunction func(args ...Object) Object
+
+// Caller calls a function of the program with the arguments, as the engine running the
+// program does, and returns its result or an error.
+type Caller func(function Object, args ...Object) Object
+
+// Builtin represents a function implemented in Go.
+type Builtin struct {
+	Fn BuiltinFunction
+
+	// HigherOrderFn is called in place of Fn if it is set, with a caller of the engine
+	// running the program, for builtins that call the functions they are given.
+	HigherOrderFn func(call Caller, args ...Object) Object
+
+	// ContextFn is called in place of Fn if it is set, with the context of the run, for
+	// builtins that wait and have to stop when the run is cancelled.
+	ContextFn func(ctx context.Context, args ...Object) Object
+}
+
+func (builtin *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (builtin *Builtin) Inspect() string  { return "builtin function" }
+
+// Array represents an ordered list of values.
+type Array struct {
+	Elements []Object
+
+	// frozen is set by freeze, after which the array must never change. Tasks share
+	// arrays, so it is set and read atomically.
+	frozen atomic.Bool
+}
+
+// Freeze marks the array as frozen.
+func (array *Array) Freeze() { array.frozen.Store(true) }
+
+// IsFrozen reports whether the array has been frozen.
+func (array *Array) IsFrozen() bool { return array.frozen.Load() }
+
+func (array *Array) Type() ObjectType { return ARRAY_OBJ }
+func (array *Array) Inspect() string {
+	var output string
+
+	output = "["
+
+	for i, element := range array.Elements {
+		if i != 0 {
+			output += ", "
+		}
+
+		output += element.Inspect()
+	}
+
+	output += "]"
+
+	return output
+}
+
+// Quote holds a piece of the AST that quote left unevaluated.
+type Quote struct {
+	Node ast.Node
+}
+
+func (quote *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (quote *Quote) Inspect() string  { return "QUOTE(" + quote.Node.String() + ")" }
+
+// Macro represents a macro together with the environment it was defined in. Its body
+// runs on the unevaluated arguments before the program is evaluated.
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (macro *Macro) Type() ObjectType { return MACRO_OBJ }
+func (macro *Macro) Inspect() string {
+	var output string
+
+	output = "macro("
+
+	for i, parameter := range macro.Parameters {
+		if i != 0 {
+			output += ", "
+		}
+
+		output += parameter.String()
+	}
+
+	output += ") {\n" + macro.Body.String() + "\n}"
+
+	return output
+}
+
+// HashKey identifies the value of a hash key, so that equal keys find the same pair.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by the objects that can be used as hash keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
+// HashPair holds a key of a hash, which the hash key alone cannot give back, with its value.
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash represents a map from hashable keys to values.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+
+	// frozen is set by freeze, after which the hash must never change. Tasks share
+	// hashes, so it is set and read atomically.
+	frozen atomic.Bool
+}
+
+// Freeze marks the hash as frozen.
+func (hash *Hash) Freeze() { hash.frozen.Store(true) }
+
+// IsFrozen reports whether the hash has been frozen.
+func (hash *Hash) IsFrozen() bool { return hash.frozen.Load() }
+
+func (hash *Hash) Type() ObjectType { return HASH_OBJ }
+func (hash *Hash) Inspect() string {
+	pairs := make([]string, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	// the pairs have no order of their own, so they are sorted to print the same every time
+	sort.Strings(pairs)
+
+	var output string
+
+	output = "{"
+
+	for i, pair := range pairs {
+		if i != 0 {
+			output += ", "
+		}
+
+		output += pair
+	}
+
+	output += "}"
+
+	return output
+}
+
+// Module represents an imported program, through the bindings it exports.
+type Module struct {
+	Name    string
+	Exports map[string]Object
+}
+
+func (module *Module) Type() ObjectType { return MODULE_OBJ }
+func (module *Module) Inspect() string  { return "module(" + module.Name + ")" }
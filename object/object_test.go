@@ -0,0 +1,287 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{int8(-3), "-3"},
+		{uint16(7), "7"},
+		{float64(2), "2"},
+		{true, "true"},
+		{"monkey", "monkey"},
+		{[]byte("hi\x00"), `b"hi\x00"`},
+		{[]byte(nil), "null"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]any{1, "two", []bool{false}}, "[1, two, [false]]"},
+		{map[string]int{"b": 2, "a": 1}, "{a: 1, b: 2}"},
+		{map[int][]int{1: {1}}, "{1: [1]}"},
+		{[]int(nil), "null"},
+		{&Integer{Value: 5}, "5"},
+		{new(big.Int).Lsh(big.NewInt(1), 64), "18446744073709551616"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.value)
+		if err != nil {
+			t.Errorf("FromGo(%#v) returned error: %s", tt.value, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) wrong. expected=%q, got=%q", tt.value, tt.expected, obj.Inspect())
+		}
+	}
+
+	// the booleans and null converted are the shared ones
+	if obj, _ := FromGo(false); obj != FALSE {
+		t.Errorf("false is not the FALSE singleton. got=%p", obj)
+	}
+	if obj, _ := FromGo(nil); obj != NULL {
+		t.Errorf("nil is not the NULL singleton. got=%p", obj)
+	}
+}
+
+func TestFromGoErrors(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{1.5, "cannot convert 1.5: not a whole number that fits an integer"},
+		{uint64(1 << 63), "cannot convert 9223372036854775808: too large for an integer"},
+		{struct{}{}, "cannot convert struct {} to a Monkey value"},
+		{[]any{1, 2.5}, "element 1: cannot convert 2.5: not a whole number that fits an integer"},
+		{map[string]func(){"f": nil}, "value of key f: cannot convert func() to a Monkey value"},
+	}
+
+	for _, tt := range tests {
+		_, err := FromGo(tt.value)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("FromGo(%#v) error wrong. expected=%q, got=%v", tt.value, tt.expected, err)
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		expected any
+	}{
+		{&Integer{Value: 5}, int64(5)},
+		{&BigInteger{Value: big.NewInt(5)}, big.NewInt(5)},
+		{TRUE, true},
+		{&String{Value: "monkey"}, "monkey"},
+		{&Bytes{Value: []byte{0, 1}}, []byte{0, 1}},
+		{NULL, nil},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &Array{Elements: []Object{FALSE}}}}, []any{int64(1), []any{false}}},
+		{(&HostType{Name: "HANDLE"}).New(7), 7},
+	}
+
+	for _, tt := range tests {
+		if got := ToGo(tt.obj); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ToGo(%s) wrong. expected=%#v, got=%#v", tt.obj.Inspect(), tt.expected, got)
+		}
+	}
+
+	// maps survive the round trip
+	hash, err := FromGo(map[string]any{"name": "monkey", "tags": []string{"book"}})
+	if err != nil {
+		t.Fatalf("FromGo returned error: %s", err)
+	}
+	expected := map[any]any{"name": "monkey", "tags": []any{"book"}}
+	if got := ToGo(hash); !reflect.DeepEqual(got, expected) {
+		t.Errorf("ToGo(%s) wrong. expected=%#v, got=%#v", hash.Inspect(), expected, got)
+	}
+
+	// objects without a Go counterpart are returned as they are
+	builtin := &Builtin{}
+	if got := ToGo(builtin); got != builtin {
+		t.Errorf("ToGo(builtin) wrong. got=%#v", got)
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+	if hello1.HashKey() == diff.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+	if (&Integer{Value: 1}).HashKey() == TRUE.HashKey() {
+		t.Errorf("objects of different types have same hash keys")
+	}
+
+	if (&BigInteger{Value: big.NewInt(7)}).HashKey() != (&Integer{Value: 7}).HashKey() {
+		t.Errorf("big integer has a different hash key than the integer of its value")
+	}
+	large, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	if (&BigInteger{Value: large}).HashKey() != (&BigInteger{Value: new(big.Int).Set(large)}).HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+}
+
+func TestHostObject(t *testing.T) {
+	handle := &HostType{
+		Name: "HANDLE",
+		Methods: map[string]Method{
+			"id": func(receiver *HostObject, args ...Object) Object {
+				return &Integer{Value: int64(receiver.Value.(int))}
+			},
+		},
+	}
+
+	obj := handle.New(7)
+	if obj.Type() != "HANDLE" || obj.Inspect() != "HANDLE(7)" {
+		t.Errorf("host object wrong. type=%s, inspect=%q", obj.Type(), obj.Inspect())
+	}
+
+	method, ok := obj.Method("id")
+	if !ok {
+		t.Fatalf("method id not found")
+	}
+	if result := method.Fn(); result.Inspect() != "7" {
+		t.Errorf("method result wrong. got=%s", result.Inspect())
+	}
+	if _, ok := obj.Method("close"); ok {
+		t.Errorf("method close should not exist")
+	}
+}
+
+func TestNewInteger(t *testing.T) {
+	tests := []struct {
+		value  int64
+		shared bool
+	}{
+		{0, true},
+		{MIN_CACHED_INTEGER, true},
+		{MAX_CACHED_INTEGER, true},
+		{MIN_CACHED_INTEGER - 1, false},
+		{MAX_CACHED_INTEGER + 1, false},
+		{-1 << 63, false},
+	}
+
+	for _, tt := range tests {
+		a, b := NewInteger(tt.value), NewInteger(tt.value)
+		if a.Value != tt.value {
+			t.Errorf("NewInteger(%d) has value %d", tt.value, a.Value)
+		}
+		if (a == b) != tt.shared || IsCachedInteger(a) != tt.shared {
+			t.Errorf("NewInteger(%d) shared wrong. expected=%t, same=%t, cached=%t", tt.value, tt.shared, a == b, IsCachedInteger(a))
+		}
+	}
+
+	if IsCachedInteger(&Integer{Value: 1}) {
+		t.Errorf("an integer made without NewInteger is not cached")
+	}
+}
+
+func TestLookupMethod(t *testing.T) {
+	RegisterMethods("PAIR", MethodTable{
+		"swap": {Fn: func(args ...Object) Object {
+			return &Array{Elements: []Object{args[2], args[1]}}
+		}},
+	})
+
+	receiver := &Array{}
+	if _, ok := LookupMethod(receiver, "swap"); ok {
+		t.Errorf("method swap should not exist for ARRAY")
+	}
+
+	pair := &HostType{Name: "PAIR"}
+	if _, ok := LookupMethod(pair.New(nil), "swap"); ok {
+		t.Errorf("methods of host objects should come from their type")
+	}
+
+	RegisterMethods(ARRAY_OBJ, MethodTable{
+		"swap": {Fn: func(args ...Object) Object {
+			return &Array{Elements: []Object{args[2], args[1], args[0]}}
+		}},
+	})
+	method, ok := LookupMethod(receiver, "swap")
+	if !ok {
+		t.Fatalf("method swap not found")
+	}
+	if result := method.Fn(&Integer{Value: 1}, &Integer{Value: 2}); result.Inspect() != "[2, 1, []]" {
+		t.Errorf("method result wrong. got=%s", result.Inspect())
+	}
+}
+
+func TestChannel(t *testing.T) {
+	ctx := context.Background()
+	channel := NewChannel(2)
+
+	for _, value := range []int64{1, 2} {
+		if err := channel.Send(ctx, &Integer{Value: value}); err != nil {
+			t.Fatalf("send failed: %s", err)
+		}
+	}
+	if !channel.Close() {
+		t.Fatalf("channel not closed")
+	}
+	if channel.Close() {
+		t.Errorf("channel closed twice")
+	}
+	if err := channel.Send(ctx, &Integer{Value: 3}); err != ErrClosedChannel {
+		t.Errorf("send on closed channel did not fail. got=%v", err)
+	}
+
+	// the values sent before the channel was closed are received in order
+	for _, expected := range []string{"1", "2"} {
+		value, ok, err := channel.Receive(ctx)
+		if err != nil || !ok || value.Inspect() != expected {
+			t.Errorf("wrong value received. expected=%s, got=%v (ok=%t, err=%v)", expected, value, ok, err)
+		}
+	}
+	if _, ok, err := channel.Receive(ctx); ok || err != nil {
+		t.Errorf("drained channel gave a value. ok=%t, err=%v", ok, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := NewChannel(0).Receive(cancelled); err != context.Canceled {
+		t.Errorf("receive did not stop when cancelled. got=%v", err)
+	}
+	if err := NewChannel(0).Send(cancelled, NULL); err != context.Canceled {
+		t.Errorf("send did not stop when cancelled. got=%v", err)
+	}
+}
+
+func TestTraceLines(t *testing.T) {
+	position := func(line, column int) string { return fmt.Sprintf("%d:%d", line, column) }
+
+	err := &Error{Trace: []Call{{Function: "f", Line: 1, Column: 2}, {Line: 3, Column: 4}}}
+	expected := []string{"in f, called at 1:2", "in anonymous function, called at 3:4"}
+	if lines := err.TraceLines(position); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("trace lines wrong. expected=%q, got=%q", expected, lines)
+	}
+
+	err = &Error{}
+	for i := 1; i <= MAX_TRACE_LINES+5; i++ {
+		err.Trace = append(err.Trace, Call{Function: "f", Line: i, Column: 1})
+	}
+	lines := err.TraceLines(position)
+	if len(lines) != MAX_TRACE_LINES+1 {
+		t.Fatalf("wrong number of trace lines. expected=%d, got=%d", MAX_TRACE_LINES+1, len(lines))
+	}
+	if lines[MAX_TRACE_LINES/2] != "... 5 more calls" {
+		t.Errorf("elided calls wrong. got=%q", lines[MAX_TRACE_LINES/2])
+	}
+	if last := lines[len(lines)-1]; last != fmt.Sprintf("in f, called at %d:1", MAX_TRACE_LINES+5) {
+		t.Errorf("outermost call wrong. got=%q", last)
+	}
+}
@@ -0,0 +1,38 @@
+package object
+
+// Task is a function running on a goroutine of its own, which a spawn expression starts.
+// Its result is what the function returns, an error if it fails.
+type Task struct {
+	done   chan struct{}
+	result Object
+}
+
+// NewTask starts running the function on a goroutine of its own.
+func NewTask(run func() Object) *Task {
+	task := &Task{done: make(chan struct{})}
+	go func() {
+		defer close(task.done)
+		task.result = run()
+	}()
+
+	return task
+}
+
+func (task *Task) Type() ObjectType { return TASK_OBJ }
+func (task *Task) Inspect() string  { return "task" }
+
+// Join waits for the task to finish and returns its result.
+func (task *Task) Join() Object {
+	<-task.done
+	return task.result
+}
+
+// Result returns the result of the task, if it has finished.
+func (task *Task) Result() (Object, bool) {
+	select {
+	case <-task.done:
+		return task.result, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MAX_DIAGNOSTICS is how many diagnostics are reported unless another limit is set, past
+// which the errors of a badly broken source only bury the first ones, the ones to fix.
+const MAX_DIAGNOSTICS = 20
+
+// Severity tells whether a problem makes the source fail or is only suspicious.
+type Severity string
+
+const (
+	SEVERITY_ERROR   Severity = "error"
+	SEVERITY_WARNING Severity = "warning"
+)
+
+// Diagnostic describes a problem found while parsing and where in the source it was found.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	Line     int
+	Column   int
+}
+
+// String formats the diagnostic as line:column: message, with the severity before the
+// message of a warning.
+func (diagnostic Diagnostic) String() string {
+	if diagnostic.Severity == SEVERITY_WARNING {
+		return fmt.Sprintf("%d:%d: %s: %s", diagnostic.Line, diagnostic.Column, diagnostic.Severity, diagnostic.Message)
+	}
+
+	return fmt.Sprintf("%d:%d: %s", diagnostic.Line, diagnostic.Column, diagnostic.Message)
+}
+
+// report returns the diagnostics of the severity as they are reported: sorted by
+// position, without exact duplicates, and cut off after the limit, MAX_DIAGNOSTICS if
+// zero and unlimited if negative, with a diagnostic in place of the others that counts
+// them.
+func report(diagnostics []Diagnostic, severity Severity, limit int) []Diagnostic {
+	if limit == 0 {
+		limit = MAX_DIAGNOSTICS
+	}
+
+	reported := make([]Diagnostic, 0, len(diagnostics))
+	seen := make(map[Diagnostic]bool, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == severity && !seen[diagnostic] {
+			seen[diagnostic] = true
+			reported = append(reported, diagnostic)
+		}
+	}
+
+	// diagnostics at the same position keep the order they were found in
+	sort.SliceStable(reported, func(i, j int) bool {
+		if reported[i].Line != reported[j].Line {
+			return reported[i].Line < reported[j].Line
+		}
+		return reported[i].Column < reported[j].Column
+	})
+
+	if limit > 0 && len(reported) > limit {
+		first := reported[limit]
+		reported = append(reported[:limit], Diagnostic{
+			Severity: severity,
+			Message:  fmt.Sprintf("too many %ss, %d more not shown", severity, len(reported)-limit),
+			Line:     first.Line,
+			Column:   first.Column,
+		})
+	}
+
+	return reported
+}
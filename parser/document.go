@@ -0,0 +1,280 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+// Edit replaces the bytes of a source from Start up to End with Text.
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Document is a source kept parsed while it is edited, as editors need. An edit only
+// reparses the top level statements it touches and keeps the others, moving those
+// after it to their new place in the source.
+type Document struct {
+	source      string
+	program     *ast.Program
+	diagnostics []Diagnostic
+	warnings    []Diagnostic
+	statements  []documentStatement
+
+	// diagnosticLimit is how many diagnostics are reported, as for a parser
+	diagnosticLimit int
+}
+
+// documentStatement is a top level statement of a document, which was parsed from the
+// source between the end of the statement before it, taking in the comments above it,
+// and the end of its own last token.
+type documentStatement struct {
+	statement   ast.Statement // nil for a statement that failed to parse
+	diagnostics []Diagnostic
+	end         lexer.Position
+
+	// lookahead is where the token after the statement ends, which the parser read to
+	// find where the statement ends, so that an edit up to there can change it
+	lookahead int
+
+	// lastLine is the line of the last token, after which the doc comments of the next
+	// statement start
+	lastLine int
+
+	// lines is how many lines the tokens of the statement have yet to be moved down by,
+	// which waits for the program to be asked for, as moving them is the slow part of
+	// an edit
+	lines int
+
+	// gaveUp is set on the statement the parser gave up in, which is the last one
+	gaveUp bool
+}
+
+// ParseDocument parses the source of a document.
+func ParseDocument(source string) *Document {
+	document := &Document{source: source}
+	document.statements, _ = parseStatements(source, lexer.Position{Line: 1, Column: 1}, 0, nil)
+	document.collect()
+
+	return document
+}
+
+// Source returns the source of the document, with the edits applied.
+func (document *Document) Source() string {
+	return document.source
+}
+
+// Program returns the program parsed from the source of the document.
+func (document *Document) Program() *ast.Program {
+	for i := range document.statements {
+		document.statements[i].moveTokens(textMove{})
+	}
+
+	return document.program
+}
+
+// LimitDiagnostics sets how many diagnostics the document reports, as for a parser.
+func (document *Document) LimitDiagnostics(limit int) {
+	document.diagnosticLimit = limit
+	document.collect()
+}
+
+// Diagnostics returns the errors encountered parsing the source of the document, as a
+// parser reports them.
+func (document *Document) Diagnostics() []Diagnostic {
+	return document.diagnostics
+}
+
+// Warnings returns the suspicious code found parsing the source of the document, as a
+// parser reports it.
+func (document *Document) Warnings() []Diagnostic {
+	return document.warnings
+}
+
+// Edit applies the edit to the source of the document and reparses the statements it
+// touches, which leaves the program and the diagnostics as they would be had the whole
+// source been parsed again. The statements after the edit are moved in place, so the
+// programs returned before the edit should not be used after it.
+func (document *Document) Edit(edit Edit) error {
+	if edit.Start < 0 || edit.End < edit.Start || edit.End > len(document.source) {
+		return fmt.Errorf("edit of %d-%d is outside the %d bytes of the source", edit.Start, edit.End, len(document.source))
+	}
+	old := document.source
+	document.source = old[:edit.Start] + edit.Text + old[edit.End:]
+
+	// reparsing starts at the end of the statement before the first one the edit
+	// touches, which an edit up to the end of the token after it does
+	first := sort.Search(len(document.statements), func(i int) bool {
+		return document.statements[i].lookahead >= edit.Start || document.statements[i].gaveUp
+	})
+	start, previousLine := lexer.Position{Line: 1, Column: 1}, 0
+	if first > 0 {
+		start, previousLine = document.statements[first-1].end, document.statements[first-1].lastLine
+	}
+
+	move := textMove{
+		from: advance(start, old[start.Offset:edit.End]),
+		to:   advance(start, document.source[start.Offset:edit.Start+len(edit.Text)]),
+	}
+
+	// once a statement reparsed ends past the edit where an old one ended, the source
+	// after it is the same as before, so the statements after that one are kept
+	rest := document.statements[first:]
+	reparsed, resumed := parseStatements(document.source, start, previousLine, func(parsed documentStatement) bool {
+		if parsed.end.Offset < move.to.Offset {
+			return false
+		}
+
+		offset := parsed.end.Offset - (move.to.Offset - move.from.Offset)
+		for len(rest) > 0 && rest[0].end.Offset < offset {
+			rest = rest[1:]
+		}
+
+		return len(rest) > 0 && !rest[0].gaveUp && rest[0].end.Offset == offset &&
+			rest[0].end.Line-rest[0].lastLine == parsed.end.Line-parsed.lastLine
+	})
+
+	statements := make([]documentStatement, 0, len(document.statements)+len(reparsed))
+	statements = append(statements, document.statements[:first]...)
+	statements = append(statements, reparsed...)
+
+	if resumed {
+		previous := rest[0].end
+		for _, kept := range rest[1:] {
+			// the columns of a statement on the line the edit ended on move as well,
+			// while those below it only move down or up with the lines
+			if previous.Line == move.from.Line {
+				kept.moveTokens(move)
+			} else {
+				kept.lines += move.to.Line - move.from.Line
+			}
+			kept.moveDiagnostics(move)
+			previous = kept.end
+
+			kept.end = move.position(kept.end)
+			kept.lookahead += move.to.Offset - move.from.Offset
+			kept.lastLine = move.position(lexer.Position{Line: kept.lastLine}).Line
+			statements = append(statements, kept)
+		}
+	}
+
+	document.statements = statements
+	document.collect()
+
+	return nil
+}
+
+// collect gathers the program, the diagnostics and the warnings of the document from its
+// statements.
+func (document *Document) collect() {
+	document.program = &ast.Program{Statements: []ast.Statement{}}
+
+	var diagnostics []Diagnostic
+	for _, statement := range document.statements {
+		if statement.statement != nil {
+			document.program.Statements = append(document.program.Statements, statement.statement)
+		}
+		diagnostics = append(diagnostics, statement.diagnostics...)
+	}
+	document.diagnostics = report(diagnostics, SEVERITY_ERROR, document.diagnosticLimit)
+	document.warnings = report(diagnostics, SEVERITY_WARNING, document.diagnosticLimit)
+}
+
+// moveTokens moves the tokens of the statement down by the lines they have yet to move
+// and then by the edit, which an empty edit leaves where they are.
+func (statement *documentStatement) moveTokens(move textMove) {
+	if statement.statement == nil || statement.lines == 0 && move == (textMove{}) {
+		return
+	}
+
+	lines := statement.lines
+	ast.MoveTokens(statement.statement, func(tok token.Token) token.Token {
+		if tok.Line == 0 {
+			return tok
+		}
+
+		moved := move.position(lexer.Position{Line: tok.Line + lines, Column: tok.Column})
+		tok.Line, tok.Column = moved.Line, moved.Column
+		return tok
+	})
+	statement.lines = 0
+}
+
+// moveDiagnostics moves the diagnostics of the statement by the edit.
+func (statement *documentStatement) moveDiagnostics(move textMove) {
+	for i, diagnostic := range statement.diagnostics {
+		moved := move.position(lexer.Position{Line: diagnostic.Line, Column: diagnostic.Column})
+		statement.diagnostics[i].Line, statement.diagnostics[i].Column = moved.Line, moved.Column
+	}
+}
+
+// parseStatements parses the top level statements of the source from the position on,
+// after a token on the previous line, until the end of the source or a statement for
+// which stop returns true, reporting whether it stopped.
+func parseStatements(source string, start lexer.Position, previousLine int, stop func(documentStatement) bool) ([]documentStatement, bool) {
+	parser := New(lexer.NewAt(source, start))
+	parser.previousLine = previousLine
+
+	var statements []documentStatement
+	for parser.currentToken.Type != token.EOF {
+		before := len(parser.diagnostics)
+		statement := parser.parseStatement()
+
+		parsed := documentStatement{
+			statement:   statement,
+			diagnostics: parser.diagnostics[before:len(parser.diagnostics):len(parser.diagnostics)],
+			end:         parser.currentEnd,
+			lookahead:   parser.peekEnd.Offset,
+			lastLine:    parser.currentToken.Line,
+			gaveUp:      parser.gaveUp,
+		}
+		statements = append(statements, parsed)
+		if !parsed.gaveUp && stop != nil && stop(parsed) {
+			return statements, true
+		}
+
+		parser.nextToken()
+	}
+
+	return statements, false
+}
+
+// textMove is how an edit moves the positions after it, taking the place where it
+// ended in the old source to the end of the text it put in.
+type textMove struct {
+	from lexer.Position
+	to   lexer.Position
+}
+
+// position returns where the position after the edit moves to. Tokens made up by the
+// parser, which have no line, stay where they are.
+func (move textMove) position(position lexer.Position) lexer.Position {
+	if position.Line == 0 {
+		return position
+	}
+	if position.Line == move.from.Line {
+		position.Column += move.to.Column - move.from.Column
+	}
+	position.Line += move.to.Line - move.from.Line
+	position.Offset += move.to.Offset - move.from.Offset
+
+	return position
+}
+
+// advance returns the position after the text, which starts at the position.
+func advance(position lexer.Position, text string) lexer.Position {
+	position.Offset += len(text)
+	if newlines := strings.Count(text, "\n"); newlines > 0 {
+		position.Line += newlines
+		position.Column = len(text) - strings.LastIndexByte(text, '\n')
+	} else {
+		position.Column += len(text)
+	}
+
+	return position
+}
@@ -6,30 +6,51 @@ import (
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
+// MAX_NESTING is the depth of the expressions nested inside each other, each operand
+// of an infix expression counting as a level, beyond which the parser gives up.
+const MAX_NESTING = 10000
+
+// DOC_COMMENT starts the comments that document the let statements below them.
+const DOC_COMMENT = "///"
+
 // Define the precedence of the operators.
 const (
 	_ int = iota
 	LOWEST
+	COALESCE    // ??
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
-var precedences = map[token.TokenType]int{
+// precedences are the precedences of the token types used as infix operators, with
+// zero for the others.
+var precedences = [token.TOKEN_TYPES]int{
+	token.COALESCE: COALESCE,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
 	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+
+	token.OPTIONAL_LPAREN:   CALL,
+	token.OPTIONAL_LBRACKET: INDEX,
+	token.DOT:               INDEX,
 }
 
 // Define the prefix and infix parse functions.
@@ -40,14 +61,36 @@ type (
 
 // Parser represents the parser.
 type Parser struct {
-	lexer  *lexer.Lexer
-	errors []string
+	lexer       *lexer.Lexer
+	diagnostics []Diagnostic
+
+	// diagnosticLimit is how many diagnostics are reported. It is MAX_DIAGNOSTICS if
+	// zero and unlimited if negative.
+	diagnosticLimit int
 
 	currentToken token.Token
 	peekToken    token.Token
 
-	prefixParseFns map[token.TokenType]prefixParseFn
-	infixParseFns  map[token.TokenType]infixParseFn
+	// currentEnd and peekEnd are where the current and peek tokens end, which divide
+	// a document into its statements
+	currentEnd lexer.Position
+	peekEnd    lexer.Position
+
+	// previousLine is the line of the token before the current one, after which the
+	// doc comments of a statement starting with the current token are
+	previousLine int
+
+	// the parse functions are indexed by token type, which is cheaper than a map
+	prefixParseFns [token.TOKEN_TYPES]prefixParseFn
+	infixParseFns  [token.TOKEN_TYPES]infixParseFn
+
+	// blocks counts the blocks being parsed, which are not at the top level
+	blocks int
+
+	// depth counts the expressions being parsed inside each other, and gaveUp is set
+	// once there are too many, after which the rest of the input is not parsed
+	depth  int
+	gaveUp bool
 }
 
 // registerPrefix registers a prefix parse function for a token type.
@@ -63,31 +106,45 @@ func (parser *Parser) registerInfix(tokenType token.TokenType, function infixPar
 // New creates a new parser instance.
 func New(lexer *lexer.Lexer) *Parser {
 	parser := &Parser{
-		lexer:  lexer,
-		errors: []string{},
+		lexer:       lexer,
+		diagnostics: []Diagnostic{},
 	}
 
-	parser.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	parser.registerPrefix(token.IDENT, parser.parseIdentifier)
 	parser.registerPrefix(token.INT, parser.parseIntegerLiteral)
+	parser.registerPrefix(token.STRING, parser.parseStringLiteral)
+	parser.registerPrefix(token.BYTES, parser.parseBytesLiteral)
 	parser.registerPrefix(token.BANG, parser.parsePrefixExpression)
 	parser.registerPrefix(token.MINUS, parser.parsePrefixExpression)
 	parser.registerPrefix(token.TRUE, parser.parseBoolean)
 	parser.registerPrefix(token.FALSE, parser.parseBoolean)
 	parser.registerPrefix(token.LPAREN, parser.parseGroupedExpression)
 	parser.registerPrefix(token.IF, parser.parseIfExpression)
+	parser.registerPrefix(token.TRY, parser.parseTryExpression)
+	parser.registerPrefix(token.SPAWN, parser.parseSpawnExpression)
+	parser.registerPrefix(token.SELECT, parser.parseSelectExpression)
 	parser.registerPrefix(token.FUNCTION, parser.parseFunctionLiteral)
+	parser.registerPrefix(token.MACRO, parser.parseMacroLiteral)
+	parser.registerPrefix(token.LBRACKET, parser.parseArrayLiteral)
+	parser.registerPrefix(token.LBRACE, parser.parseHashLiteral)
 
-	parser.infixParseFns = make(map[token.TokenType]infixParseFn)
 	parser.registerInfix(token.PLUS, parser.parseInfixExpression)
 	parser.registerInfix(token.MINUS, parser.parseInfixExpression)
 	parser.registerInfix(token.SLASH, parser.parseInfixExpression)
 	parser.registerInfix(token.ASTERISK, parser.parseInfixExpression)
+	parser.registerInfix(token.PERCENT, parser.parseInfixExpression)
+	parser.registerInfix(token.COALESCE, parser.parseInfixExpression)
 	parser.registerInfix(token.EQ, parser.parseInfixExpression)
 	parser.registerInfix(token.NOT_EQ, parser.parseInfixExpression)
 	parser.registerInfix(token.LT, parser.parseInfixExpression)
 	parser.registerInfix(token.GT, parser.parseInfixExpression)
+	parser.registerInfix(token.LT_EQ, parser.parseInfixExpression)
+	parser.registerInfix(token.GT_EQ, parser.parseInfixExpression)
 	parser.registerInfix(token.LPAREN, parser.parseCallExpression)
+	parser.registerInfix(token.LBRACKET, parser.parseIndexExpression)
+	parser.registerInfix(token.OPTIONAL_LPAREN, parser.parseCallExpression)
+	parser.registerInfix(token.OPTIONAL_LBRACKET, parser.parseIndexExpression)
+	parser.registerInfix(token.DOT, parser.parseMethodCallExpression)
 
 	// read two tokens, so currentToken and peekToken are both set
 	parser.nextToken()
@@ -96,21 +153,88 @@ func New(lexer *lexer.Lexer) *Parser {
 	return parser
 }
 
-// Errors returns the list of errors encountered during parsing.
+// LimitDiagnostics sets how many diagnostics the parser reports, MAX_DIAGNOSTICS if zero
+// and unlimited if negative.
+func (parser *Parser) LimitDiagnostics(limit int) {
+	parser.diagnosticLimit = limit
+}
+
+// Errors returns the messages of the errors encountered during parsing, as Diagnostics
+// reports them.
 func (parser *Parser) Errors() []string {
-	return parser.errors
+	diagnostics := parser.Diagnostics()
+	messages := make([]string, len(diagnostics))
+	for i, diagnostic := range diagnostics {
+		messages[i] = diagnostic.Message
+	}
+
+	return messages
+}
+
+// Diagnostics returns the errors encountered during parsing together with their
+// positions, in the order of their positions, each once and no more of them than the
+// limit, after which a last one tells how many more there were.
+func (parser *Parser) Diagnostics() []Diagnostic {
+	return report(parser.diagnostics, SEVERITY_ERROR, parser.diagnosticLimit)
+}
+
+// Warnings returns the suspicious code found during parsing, which still parsed, as
+// Diagnostics reports the errors.
+func (parser *Parser) Warnings() []Diagnostic {
+	return report(parser.diagnostics, SEVERITY_WARNING, parser.diagnosticLimit)
+}
+
+// addError records an error found at the given token, unless the parser gave up, which
+// makes every token after the one it gave up at an error.
+func (parser *Parser) addError(tok token.Token, format string, a ...interface{}) {
+	parser.addDiagnostic(SEVERITY_ERROR, tok, format, a...)
+}
+
+// addWarning records a warning about the code at the given token, as addError does.
+func (parser *Parser) addWarning(tok token.Token, format string, a ...interface{}) {
+	parser.addDiagnostic(SEVERITY_WARNING, tok, format, a...)
+}
+
+// addDiagnostic records a diagnostic of the severity at the given token.
+func (parser *Parser) addDiagnostic(severity Severity, tok token.Token, format string, a ...interface{}) {
+	if parser.gaveUp {
+		return
+	}
+
+	parser.diagnostics = append(parser.diagnostics, Diagnostic{
+		Severity: severity,
+		Message:  fmt.Sprintf(format, a...),
+		Line:     tok.Line,
+		Column:   tok.Column,
+	})
 }
 
 // peekError appends an error message to the list of errors.
 func (parser *Parser) peekError(token token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", token, parser.peekToken.Type)
-	parser.errors = append(parser.errors, msg)
+	parser.addError(parser.peekToken, "expected next token to be %s, got %s instead", token, parser.peekToken.Type)
 }
 
 // nextToken advances the currentToken and peekToken.
 func (parser *Parser) nextToken() {
+	parser.previousLine = parser.currentToken.Line
 	parser.currentToken = parser.peekToken
+	parser.currentEnd = parser.peekEnd
+	if parser.gaveUp {
+		return
+	}
 	parser.peekToken = parser.lexer.NextToken()
+	parser.peekEnd = parser.lexer.Position()
+}
+
+// giveUp stops parsing with an error at the current token, as though the input ended
+// there, which unwinds the expressions being parsed without more errors.
+func (parser *Parser) giveUp(format string, a ...interface{}) {
+	parser.addError(parser.currentToken, format, a...)
+	parser.gaveUp = true
+
+	end := token.Token{Type: token.EOF, Line: parser.currentToken.Line, Column: parser.currentToken.Column}
+	parser.currentToken = end
+	parser.peekToken = end
 }
 
 // ParseProgram parses the program.
@@ -137,9 +261,22 @@ func (parser *Parser) ParseProgram() *ast.Program {
 
 // parseStatement parses a statement.
 func (parser *Parser) parseStatement() ast.Statement {
+	// failed statements are returned as a plain nil, not a nil pointer wrapped in the interface
 	switch parser.currentToken.Type {
 	case token.LET:
-		return parser.parseLetStatement()
+		doc := parser.docComment()
+		if statement := parser.parseLetStatement(); statement != nil {
+			statement.Doc = doc
+			return statement
+		}
+		return nil
+	case token.EXPORT:
+		doc := parser.docComment()
+		if statement := parser.parseExportStatement(); statement != nil {
+			statement.Doc = doc
+			return statement
+		}
+		return nil
 	case token.RETURN:
 		return parser.parseReturnStatement()
 	default:
@@ -147,8 +284,58 @@ func (parser *Parser) parseStatement() ast.Statement {
 	}
 }
 
+// docComment returns the text of the /// comments on the lines right above the current
+// token, without their slashes and the space after them, or an empty string if there
+// are none. Comments that follow code on their line, or start with more slashes, are
+// not doc comments.
+func (parser *Parser) docComment() string {
+	// the lexer has read the peek token, so the comments before it are skipped
+	comments := parser.lexer.Comments()
+	end := len(comments)
+	for end > 0 && !commentBefore(comments[end-1], parser.currentToken) {
+		end--
+	}
+
+	start, line := end, parser.currentToken.Line
+	for start > 0 {
+		comment := comments[start-1]
+		if comment.Line != line-1 || comment.Line <= parser.previousLine || !isDocComment(comment.Literal) {
+			break
+		}
+		start--
+		line--
+	}
+
+	lines := make([]string, 0, end-start)
+	for _, comment := range comments[start:end] {
+		text := strings.TrimPrefix(comment.Literal, DOC_COMMENT)
+		lines = append(lines, strings.TrimPrefix(text, " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// isDocComment reports whether the text of the comment starts with exactly three slashes.
+func isDocComment(literal string) bool {
+	return strings.HasPrefix(literal, DOC_COMMENT) && !strings.HasPrefix(literal, DOC_COMMENT+"/")
+}
+
+// commentBefore reports whether the comment starts before the token.
+func commentBefore(comment, tok token.Token) bool {
+	return comment.Line < tok.Line || comment.Line == tok.Line && comment.Column < tok.Column
+}
+
 // parseExpression parses an expression.
 func (parser *Parser) parseExpression(precedence int) ast.Expression {
+	// give up before expressions nested too deeply overflow the stack, here or in the
+	// engines that walk the tree
+	if parser.depth >= MAX_NESTING {
+		parser.giveUp("expressions nested more than %d deep", MAX_NESTING)
+		return nil
+	}
+	parser.depth++
+	defer func(depth int) { parser.depth = depth }(parser.depth - 1)
+
 	// get the prefix parse function for the current token
 	prefix := parser.prefixParseFns[parser.currentToken.Type]
 	if prefix == nil {
@@ -170,7 +357,8 @@ func (parser *Parser) parseExpression(precedence int) ast.Expression {
 		// advance the tokens
 		parser.nextToken()
 
-		// parse the infix expression
+		// parse the infix expression, which nests the left one a level deeper
+		parser.depth++
 		left = infix(left)
 	}
 
@@ -210,6 +398,26 @@ func (parser *Parser) parseLetStatement() *ast.LetStatement {
 	return statement
 }
 
+// parseExportStatement parses a let statement that starts with export, which only
+// the top level of a program can have.
+func (parser *Parser) parseExportStatement() *ast.LetStatement {
+	if parser.blocks > 0 {
+		parser.addError(parser.currentToken, "export is only allowed at the top level")
+	}
+
+	// check if the next token starts a let statement
+	if !parser.expectPeek(token.LET) {
+		return nil
+	}
+
+	statement := parser.parseLetStatement()
+	if statement != nil {
+		statement.Exported = true
+	}
+
+	return statement
+}
+
 // parseReturnStatement parses a return statement.
 func (parser *Parser) parseReturnStatement() *ast.ReturnStatement {
 	// create the return statement
@@ -243,10 +451,33 @@ func (parser *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 		parser.nextToken()
 	}
 
+	// the value of the last statement of a program or a block is its result, while the
+	// value of any other is thrown away
+	last := parser.peekTokenIs(token.EOF) || parser.peekTokenIs(token.RBRACE)
+	if !last && hasNoEffect(statement.Expression) {
+		parser.addWarning(statement.Token, "statement has no effect")
+	}
+
 	// return the expression statement
 	return statement
 }
 
+// hasNoEffect reports whether evaluating the expression can do nothing but produce its
+// value: a literal, a name, or the negation or comparison of those, which cannot fail.
+func hasNoEffect(expression ast.Expression) bool {
+	switch expression := expression.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.BytesLiteral, *ast.Boolean, *ast.FunctionLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return expression.Operator == "!" && hasNoEffect(expression.Right)
+	case *ast.InfixExpression:
+		return (expression.Operator == "==" || expression.Operator == "!=") &&
+			hasNoEffect(expression.Left) && hasNoEffect(expression.Right)
+	default:
+		return false
+	}
+}
+
 // parseIdentifier parses an identifier.
 func (parser *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}
@@ -260,8 +491,7 @@ func (parser *Parser) parseIntegerLiteral() ast.Expression {
 	// parse the integer value
 	value, err := strconv.ParseInt(parser.currentToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", parser.currentToken.Literal)
-		parser.errors = append(parser.errors, msg)
+		parser.addError(parser.currentToken, "could not parse %q as integer", parser.currentToken.Literal)
 		return nil
 	}
 	literal.Value = value
@@ -270,6 +500,16 @@ func (parser *Parser) parseIntegerLiteral() ast.Expression {
 	return literal
 }
 
+// parseBytesLiteral parses a bytes literal.
+func (parser *Parser) parseBytesLiteral() ast.Expression {
+	return &ast.BytesLiteral{Token: parser.currentToken, Value: parser.currentToken.Literal}
+}
+
+// parseStringLiteral parses a string literal.
+func (parser *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: parser.currentToken, Value: parser.currentToken.Literal}
+}
+
 // parsePrefixExpression parses a prefix expression.
 func (parser *Parser) parsePrefixExpression() ast.Expression {
 	// create the prefix expression
@@ -288,6 +528,22 @@ func (parser *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+// parseSpawnExpression parses a spawn expression, whose function binds like the operand
+// of a prefix operator.
+func (parser *Parser) parseSpawnExpression() ast.Expression {
+	// create the spawn expression
+	expression := &ast.SpawnExpression{Token: parser.currentToken}
+
+	// advance the tokens
+	parser.nextToken()
+
+	// parse the function
+	expression.Function = parser.parseExpression(PREFIX)
+
+	// return the spawn expression
+	return expression
+}
+
 // parseInfixExpression parses an infix expression.
 func (parser *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	// create the infix expression
@@ -332,6 +588,118 @@ func (parser *Parser) parseGroupedExpression() ast.Expression {
 	return expression
 }
 
+// parseTryExpression parses a try expression and its catch clause.
+func (parser *Parser) parseTryExpression() ast.Expression {
+	// create the try expression
+	expression := &ast.TryExpression{Token: parser.currentToken}
+
+	// check if the next token is a left brace
+	if !parser.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// parse the body
+	expression.Body = parser.parseBlockStatement()
+
+	// the catch clause names the error
+	if !parser.expectPeek(token.CATCH) || !parser.expectPeek(token.LPAREN) || !parser.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Parameter = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}
+	if !parser.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	// check if the next token is a left brace
+	if !parser.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// parse the handler
+	expression.Handler = parser.parseBlockStatement()
+
+	// return the try expression
+	return expression
+}
+
+// parseSelectExpression parses a select expression and its cases, which are separated
+// by commas.
+func (parser *Parser) parseSelectExpression() ast.Expression {
+	// create the select expression
+	expression := &ast.SelectExpression{Token: parser.currentToken, Cases: []*ast.SelectCase{}}
+
+	// check if the next token is a left brace
+	if !parser.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// a select without cases waits forever
+	if parser.peekTokenIs(token.RBRACE) {
+		parser.nextToken()
+		return expression
+	}
+
+	// parse each case
+	for {
+		parser.nextToken()
+
+		selectCase := parser.parseSelectCase()
+		if selectCase == nil {
+			return nil
+		}
+		expression.Cases = append(expression.Cases, selectCase)
+
+		if !parser.peekTokenIs(token.COMMA) {
+			break
+		}
+		parser.nextToken()
+	}
+
+	// check if the next token is a right brace
+	if !parser.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	// return the select expression
+	return expression
+}
+
+// parseSelectCase parses a case of a select expression, whose body is a block or a
+// single expression.
+func (parser *Parser) parseSelectCase() *ast.SelectCase {
+	selectCase := &ast.SelectCase{}
+
+	// the value received can be bound to a name
+	if parser.currentTokenIs(token.IDENT) && parser.peekTokenIs(token.ASSIGN) {
+		selectCase.Name = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}
+		parser.nextToken()
+		parser.nextToken()
+	}
+
+	// parse the channel
+	selectCase.Channel = parser.parseExpression(LOWEST)
+
+	// check if the next token is an arrow
+	if !parser.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	// advance the tokens
+	parser.nextToken()
+
+	// parse the body, making a block of a single expression
+	if parser.currentTokenIs(token.LBRACE) {
+		selectCase.Body = parser.parseBlockStatement()
+	} else {
+		start := parser.currentToken
+		statement := &ast.ExpressionStatement{Token: start, Expression: parser.parseExpression(LOWEST)}
+		selectCase.Body = &ast.BlockStatement{Token: start, Statements: []ast.Statement{statement}}
+	}
+
+	// return the select case
+	return selectCase
+}
+
 // parseIfExpression parses an if expression.
 func (parser *Parser) parseIfExpression() ast.Expression {
 	// create the if expression
@@ -400,21 +768,52 @@ func (parser *Parser) parseFunctionLiteral() ast.Expression {
 	// parse the body
 	literal.Body = parser.parseBlockStatement()
 
+	// give the locals of the function their slots
+	ast.ResolveLocals(literal)
+
 	// return the function literal
 	return literal
 }
 
+// parseMacroLiteral parses a macro literal, which is written like a function literal.
+func (parser *Parser) parseMacroLiteral() ast.Expression {
+	// create the macro literal
+	literal := &ast.MacroLiteral{Token: parser.currentToken}
+
+	// check if the next token is a left parenthesis
+	if !parser.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	// parse the parameters
+	literal.Parameters = parser.parseFunctionParameters()
+
+	// check if the next token is a left brace
+	if !parser.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// parse the body
+	literal.Body = parser.parseBlockStatement()
+
+	// return the macro literal
+	return literal
+}
+
 // parseBlockStatement parses a block statement.
 func (parser *Parser) parseBlockStatement() *ast.BlockStatement {
 	// create the block statement
 	block := &ast.BlockStatement{Token: parser.currentToken}
 	block.Statements = []ast.Statement{}
 
+	parser.blocks++
+	defer func() { parser.blocks-- }()
+
 	// advance the tokens
 	parser.nextToken()
 
-	// parse each statement in the block until a right brace is found
-	for !parser.currentTokenIs(token.RBRACE) {
+	// parse each statement in the block until a right brace or the end of the input is found
+	for !parser.currentTokenIs(token.RBRACE) && !parser.currentTokenIs(token.EOF) {
 		// parse the statement
 		statement := parser.parseStatement()
 
@@ -424,6 +823,10 @@ func (parser *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		parser.nextToken()
 	}
+	if parser.currentTokenIs(token.EOF) {
+		parser.addError(parser.currentToken, "expected next token to be %s, got EOF instead", token.RBRACE)
+	}
+	block.Closing = parser.currentToken
 
 	// return the block statement
 	return block
@@ -471,46 +874,183 @@ func (parser *Parser) parseFunctionParameters() []*ast.Identifier {
 func (parser *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	// create the call expression
 	expression := &ast.CallExpression{Token: parser.currentToken, Function: function}
-	expression.Arguments = parser.parseCallArguments()
+	expression.Optional = parser.currentTokenIs(token.OPTIONAL_LPAREN)
+	expression.Arguments = parser.parseExpressionList(token.RPAREN)
 
 	// return the call expression
 	return expression
 }
 
-// parseCallArguments parses the arguments of a call expression.
-func (parser *Parser) parseCallArguments() []ast.Expression {
-	// create the list of arguments
-	arguments := []ast.Expression{}
+// parseMethodCallExpression parses a call of a method of the receiver, which has to be
+// called right where it is named.
+func (parser *Parser) parseMethodCallExpression(receiver ast.Expression) ast.Expression {
+	// create the method call expression
+	expression := &ast.MethodCallExpression{Token: parser.currentToken, Receiver: receiver}
 
-	// check if the next token is a right parenthesis
-	if parser.peekTokenIs(token.RPAREN) {
+	// parse the name of the method
+	if !parser.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Method = &ast.Identifier{Token: parser.currentToken, Value: parser.currentToken.Literal}
+
+	// parse the arguments
+	if !parser.expectPeek(token.LPAREN) {
+		return nil
+	}
+	expression.Arguments = parser.parseExpressionList(token.RPAREN)
+
+	// return the method call expression
+	return expression
+}
+
+// parseArrayLiteral parses an array literal.
+func (parser *Parser) parseArrayLiteral() ast.Expression {
+	// create the array literal
+	array := &ast.ArrayLiteral{Token: parser.currentToken}
+	array.Elements = parser.parseExpressionList(token.RBRACKET)
+
+	// return the array literal
+	return array
+}
+
+// parseHashLiteral parses a hash literal, whose pairs are separated by commas and each
+// of whose keys is followed by a colon and its value.
+func (parser *Parser) parseHashLiteral() ast.Expression {
+	// create the hash literal
+	hash := &ast.HashLiteral{Token: parser.currentToken, Pairs: []*ast.HashLiteralPair{}}
+
+	// check if the hash is empty
+	if parser.peekTokenIs(token.RBRACE) {
 		parser.nextToken()
-		return arguments
+		return hash
+	}
+
+	// loop while pairs are found
+	for {
+		// parse the key
+		parser.nextToken()
+		key := parser.parseExpression(LOWEST)
+
+		// check if the next token is a colon
+		if !parser.expectPeek(token.COLON) {
+			return nil
+		}
+
+		// parse the value
+		parser.nextToken()
+		value := parser.parseExpression(LOWEST)
+		if key == nil || value == nil {
+			return nil
+		}
+		hash.Pairs = append(hash.Pairs, &ast.HashLiteralPair{Key: key, Value: value})
+
+		// the pairs are separated by commas
+		if !parser.peekTokenIs(token.COMMA) {
+			break
+		}
+		parser.nextToken()
+	}
+
+	// check if the next token is a right brace
+	if !parser.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	// return the hash literal
+	return hash
+}
+
+// parseIndexExpression parses an index expression, or its slice form if a colon
+// separates two bounds, either of which can be left out.
+func (parser *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	// create the index expression
+	expression := &ast.IndexExpression{Token: parser.currentToken, Left: left}
+	expression.Optional = parser.currentTokenIs(token.OPTIONAL_LBRACKET)
+
+	// advance the tokens
+	parser.nextToken()
+
+	// a slice can leave out its start
+	if parser.currentTokenIs(token.COLON) {
+		return parser.parseSliceExpression(expression.Token, left, nil)
+	}
+
+	// parse the index
+	expression.Index = parser.parseExpression(LOWEST)
+
+	if parser.peekTokenIs(token.COLON) {
+		parser.nextToken()
+		return parser.parseSliceExpression(expression.Token, left, expression.Index)
+	}
+
+	// check if the next token is a right bracket
+	if !parser.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	// return the index expression
+	return expression
+}
+
+// parseSliceExpression parses the end of a slice expression, from its colon on.
+func (parser *Parser) parseSliceExpression(bracket token.Token, left, start ast.Expression) ast.Expression {
+	// create the slice expression
+	expression := &ast.SliceExpression{Token: bracket, Left: left, Start: start}
+	expression.Optional = bracket.Type == token.OPTIONAL_LBRACKET
+
+	// a slice can leave out its end
+	if parser.peekTokenIs(token.RBRACKET) {
+		parser.nextToken()
+		return expression
+	}
+
+	// parse the end
+	parser.nextToken()
+	expression.End = parser.parseExpression(LOWEST)
+
+	// check if the next token is a right bracket
+	if !parser.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	// return the slice expression
+	return expression
+}
+
+// parseExpressionList parses a comma-separated list of expressions up to the end token.
+func (parser *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	// create the list of expressions
+	expressions := []ast.Expression{}
+
+	// check if the next token is the end token
+	if parser.peekTokenIs(end) {
+		parser.nextToken()
+		return expressions
 	}
 
 	// advance the tokens
 	parser.nextToken()
 
-	// parse the first argument
-	arguments = append(arguments, parser.parseExpression(LOWEST))
+	// parse the first expression
+	expressions = append(expressions, parser.parseExpression(LOWEST))
 
-	// loop while arguments are found
+	// loop while expressions are found
 	for parser.peekTokenIs(token.COMMA) {
 		// advance the tokens
 		parser.nextToken()
 		parser.nextToken()
 
-		// parse the argument
-		arguments = append(arguments, parser.parseExpression(LOWEST))
+		// parse the expression
+		expressions = append(expressions, parser.parseExpression(LOWEST))
 	}
 
-	// check if the next token is a right parenthesis
-	if !parser.expectPeek(token.RPAREN) {
+	// check if the next token is the end token
+	if !parser.expectPeek(end) {
 		return nil
 	}
 
-	// return the list of arguments
-	return arguments
+	// return the list of expressions
+	return expressions
 }
 
 // currentTokenIs checks if the current token is of the given type.
@@ -534,24 +1074,25 @@ func (parser *Parser) expectPeek(tokenType token.TokenType) bool {
 	}
 }
 
-// peekPrecedence returns the precedence of the peek token.
-func (parser *Parser) peekPrecedence() int {
-	if precedence, ok := precedences[parser.peekToken.Type]; ok {
+// Precedence returns the precedence of the token type when it is used as an infix operator.
+func Precedence(tokenType token.TokenType) int {
+	if precedence := precedences[tokenType]; precedence != 0 {
 		return precedence
 	}
 	return LOWEST
 }
 
+// peekPrecedence returns the precedence of the peek token.
+func (parser *Parser) peekPrecedence() int {
+	return Precedence(parser.peekToken.Type)
+}
+
 // currentPrecedence returns the precedence of the current token.
 func (parser *Parser) currentPrecedence() int {
-	if precedence, ok := precedences[parser.currentToken.Type]; ok {
-		return precedence
-	}
-	return LOWEST
+	return Precedence(parser.currentToken.Type)
 }
 
 // noPrefixParseFnError appends an error message to the list of errors.
 func (parser *Parser) noPrefixParseFnError(tokenType token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", tokenType)
-	parser.errors = append(parser.errors, msg)
+	parser.addError(parser.currentToken, "no prefix parse function for %s found", tokenType)
 }
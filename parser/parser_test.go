@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -41,6 +43,93 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestExportStatements(t *testing.T) {
+	input := "export let x = 5;\nlet y = x;"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	for i, expected := range []bool{true, false} {
+		stmt := program.Statements[i]
+		if !testLetStatement(t, stmt, []string{"x", "y"}[i]) {
+			return
+		}
+		if stmt.(*ast.LetStatement).Exported != expected {
+			t.Errorf("statement %d Exported wrong. expected=%t", i, expected)
+		}
+	}
+	if program.String() != "export let x = 5;let y = x;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { export let x = 1; }", "1:8: export is only allowed at the top level"},
+		{"export 5;", "1:8: expected next token to be LET, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].String() != tt.expected {
+			t.Errorf("diagnostics wrong for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/// The answer.\nlet x = 42;", "The answer."},
+		{"/// Adds two numbers.\n///\n///   add(1, 2)\nexport let add = fn(a, b) { a + b };", "Adds two numbers.\n\n  add(1, 2)"},
+		{"// not a doc comment\nlet x = 1;", ""},
+		{"//// a separator\nlet x = 1;", ""},
+		{"/// detached\n\nlet x = 1;", ""},
+		{"// ordinary\n/// documented\nlet x = 1;", "documented"},
+		{"let y = 2; /// about y\nlet x = 1;", ""},
+		{"let x = 1; /// trailing", ""},
+		{"/// the function\nlet f = fn() {\n  /// inner\n  let y = 1;\n  y\n};", "the function"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var let *ast.LetStatement
+		for _, statement := range program.Statements {
+			if statement, ok := statement.(*ast.LetStatement); ok && statement.Name.Value != "y" {
+				let = statement
+			}
+		}
+		if let == nil {
+			t.Fatalf("%q: no let statement", tt.input)
+		}
+		if let.Doc != tt.expected {
+			t.Errorf("%q: Doc wrong. expected=%q, got=%q", tt.input, tt.expected, let.Doc)
+		}
+	}
+
+	// the let statements in blocks are documented as well
+	p := New(lexer.New("let f = fn() {\n  /// inner\n  let y = 1;\n  y\n};"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	body := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body
+	if doc := body.Statements[0].(*ast.LetStatement).Doc; doc != "inner" {
+		t.Errorf("Doc of inner let wrong. expected=%q, got=%q", "inner", doc)
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -139,6 +228,64 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestBytesLiteralExpression(t *testing.T) {
+	input := `b"\x00\xffA";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.BytesLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.BytesLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "\x00\xffA" {
+		t.Errorf("literal.Value not %q. got=%q", "\x00\xffA", literal.Value)
+	}
+	if literal.String() != `b"\x00\xffA"` {
+		t.Errorf("literal.String() not %q. got=%q", `b"\x00\xffA"`, literal.String())
+	}
+}
+
+func TestUnterminatedBlock(t *testing.T) {
+	input := `fn(x) { x + 1`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	expected := []string{"1:14: expected next token to be }, got EOF instead"}
+	diagnostics := []string{}
+	for _, diagnostic := range p.Diagnostics() {
+		diagnostics = append(diagnostics, diagnostic.String())
+	}
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Errorf("wrong errors for an unterminated block. want=%q, got=%q", expected, diagnostics)
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -199,6 +346,8 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
 		{"foobar + barfoo;", "foobar", "+", "barfoo"},
 		{"foobar - barfoo;", "foobar", "-", "barfoo"},
 		{"foobar * barfoo;", "foobar", "*", "barfoo"},
@@ -207,6 +356,7 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"foobar < barfoo;", "foobar", "<", "barfoo"},
 		{"foobar == barfoo;", "foobar", "==", "barfoo"},
 		{"foobar != barfoo;", "foobar", "!=", "barfoo"},
+		{"foobar ?? barfoo;", "foobar", "??", "barfoo"},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -249,6 +399,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"!-a",
 			"(!(-a))",
 		},
+		{
+			"spawn f(1) + 2",
+			"((spawn f(1)) + 2)",
+		},
 		{
 			"a + b + c",
 			"((a + b) + c)",
@@ -269,6 +423,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b / c",
 			"(a + (b / c))",
 		},
+		{
+			"a - b % c * d",
+			"(a - ((b % c) * d))",
+		},
+		{
+			"a ?? b == c ?? d",
+			"((a ?? (b == c)) ?? d)",
+		},
+		{
+			"-a.b(c).d()[0] * e",
+			"((-(a.b(c).d()[0])) * e)",
+		},
+		{
+			"a?[1]?(2)[3] ?? b",
+			"(((a?[1])?(2)[3]) ?? b)",
+		},
 		{
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
@@ -285,6 +455,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"5 < 4 != 3 > 4",
 			"((5 < 4) != (3 > 4))",
 		},
+		{
+			"a + 1 <= b == c >= d * 2",
+			"(((a + 1) <= b) == (c >= (d * 2)))",
+		},
 		{
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
@@ -341,6 +515,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"a[1 + 1:-1] + b[:2] * c[1:][0]",
+			"((a[(1 + 1):(-1)]) + ((b[:2]) * ((c[1:])[0])))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -548,6 +734,53 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -670,6 +903,547 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingEmptyArrayLiterals(t *testing.T) {
+	input := "[]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, "{}"},
+		{`{"one": 1, "two": 2}`, "{one: 1, two: 2}"},
+		{`{1: true, x: y + 1, "a" + "b": [1]}`, "{1: true, x: (y + 1), (a + b): [1]}"},
+		{`{"f": fn(x) { x }, "h": {"nested": 1}}`, "{f: fn(x)x, h: {nested: 1}}"},
+		{`let h = {"a": 1}; h["a"]`, "let h = {a: 1};(h[a])"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	// the pairs are kept in the order they are written
+	p := New(lexer.New(`{"b": 1, "a": 2}`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	hash, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.HashLiteral. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("len(hash.Pairs) not 2. got=%d", len(hash.Pairs))
+	}
+	testLiteralExpression(t, hash.Pairs[0].Value, 1)
+	testLiteralExpression(t, hash.Pairs[1].Value, 2)
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a" 1}`, "1:6: expected next token to be :, got INT instead"},
+		{`{"a": 1 "b": 2}`, "1:9: expected next token to be }, got STRING instead"},
+		{`{"a": 1,}`, "1:9: no prefix parse function for } found"},
+		{`{"a": 1`, "1:8: expected next token to be }, got EOF instead"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].String() != tt.expected {
+			t.Errorf("diagnostics wrong for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	input := `try { f(x) } catch (e) { e }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+	}
+
+	if len(exp.Body.Statements) != 1 || exp.Body.Statements[0].String() != "f(x)" {
+		t.Errorf("body wrong. got=%s", exp.Body)
+	}
+	if !testIdentifier(t, exp.Parameter, "e") {
+		return
+	}
+	if len(exp.Handler.Statements) != 1 || exp.Handler.Statements[0].String() != "e" {
+		t.Errorf("handler wrong. got=%s", exp.Handler)
+	}
+	if exp.String() != "try f(x)catch(e) e" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 }", "1:10: expected next token to be CATCH, got EOF instead"},
+		{"try { 1 } catch { 2 }", "1:17: expected next token to be (, got { instead"},
+		{"try { 1 } catch (1) { 2 }", "1:18: expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].String() != tt.expected {
+			t.Errorf("diagnostics wrong for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestSelectExpression(t *testing.T) {
+	input := `select { v = ch => v * 2, timeout(100) => { let x = 1; x }, done => {} }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.SelectExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.SelectExpression. got=%T", stmt.Expression)
+	}
+	if len(exp.Cases) != 3 {
+		t.Fatalf("exp.Cases does not contain 3 cases. got=%d", len(exp.Cases))
+	}
+
+	tests := []struct {
+		name       string
+		channel    string
+		statements int
+	}{
+		{"v", "ch", 1},
+		{"", "timeout(100)", 2},
+		{"", "done", 0},
+	}
+
+	for i, tt := range tests {
+		selectCase := exp.Cases[i]
+		if tt.name == "" && selectCase.Name != nil {
+			t.Errorf("case %d has a name. got=%s", i, selectCase.Name)
+		}
+		if tt.name != "" && !testIdentifier(t, selectCase.Name, tt.name) {
+			return
+		}
+		if selectCase.Channel.String() != tt.channel {
+			t.Errorf("channel of case %d wrong. expected=%s, got=%s", i, tt.channel, selectCase.Channel)
+		}
+		if len(selectCase.Body.Statements) != tt.statements {
+			t.Errorf("body of case %d wrong. got=%s", i, selectCase.Body)
+		}
+	}
+	if exp.String() != "select { v = ch => (v * 2), timeout(100) => let x = 1;x, done =>  }" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"select ch", "1:8: expected next token to be {, got IDENT instead"},
+		{"select { ch }", "1:13: expected next token to be =>, got } instead"},
+		{"select { ch => 1 ch => 2 }", "1:18: expected next token to be }, got IDENT instead"},
+		{"select { ch => 1, }", "1:19: no prefix parse function for } found"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].String() != tt.expected {
+			t.Errorf("diagnostics wrong for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input string
+		start interface{}
+		end   interface{}
+	}{
+		{"s[1:4]", 1, 4},
+		{"s[:3]", nil, 3},
+		{"s[2:]", 2, nil},
+		{"s[:]", nil, nil},
+	}
+
+	for _, tt := range tests {
+		program := New(lexer.New(tt.input)).ParseProgram()
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		sliceExp, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression for %q. got=%T", tt.input, stmt.Expression)
+		}
+
+		if !testIdentifier(t, sliceExp.Left, "s") {
+			return
+		}
+		for _, bound := range []struct {
+			expression ast.Expression
+			expected   interface{}
+		}{{sliceExp.Start, tt.start}, {sliceExp.End, tt.end}} {
+			if bound.expected == nil {
+				if bound.expression != nil {
+					t.Errorf("bound of %q not left out. got=%s", tt.input, bound.expression)
+				}
+				continue
+			}
+			testLiteralExpression(t, bound.expression, bound.expected)
+		}
+	}
+}
+
+func TestFailedStatementsAreDropped(t *testing.T) {
+	input := "let = 5; let x 5; 10;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+
+	for i, stmt := range program.Statements {
+		if letStmt, ok := stmt.(*ast.LetStatement); ok && letStmt == nil {
+			t.Errorf("program.Statements[%d] is a nil *ast.LetStatement", i)
+		}
+	}
+}
+
+func TestDiagnosticPositions(t *testing.T) {
+	input := "let x = 5;\nlet = 10;\n  let y 3;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	expected := []string{
+		"2:5: expected next token to be IDENT, got = instead",
+		"2:5: no prefix parse function for = found",
+		"3:9: expected next token to be =, got INT instead",
+	}
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. expected=%d, got=%d (%q)", len(expected), len(diagnostics), p.Errors())
+	}
+
+	for i, diagnostic := range diagnostics {
+		if diagnostic.String() != expected[i] {
+			t.Errorf("diagnostics[%d] wrong. expected=%q, got=%q", i, expected[i], diagnostic.String())
+		}
+	}
+}
+
+func TestDiagnosticReporting(t *testing.T) {
+	tests := []struct {
+		name        string
+		diagnostics []Diagnostic
+		severity    Severity
+		limit       int
+		expected    []string
+	}{
+		{
+			"sorted by position",
+			[]Diagnostic{{SEVERITY_ERROR, "c", 2, 1}, {SEVERITY_ERROR, "a", 1, 5}, {SEVERITY_ERROR, "b", 1, 9}, {SEVERITY_ERROR, "d", 2, 1}},
+			SEVERITY_ERROR,
+			0,
+			[]string{"1:5: a", "1:9: b", "2:1: c", "2:1: d"},
+		},
+		{
+			"duplicates dropped",
+			[]Diagnostic{{SEVERITY_ERROR, "a", 1, 5}, {SEVERITY_ERROR, "b", 1, 5}, {SEVERITY_ERROR, "a", 1, 5}, {SEVERITY_ERROR, "a", 2, 5}},
+			SEVERITY_ERROR,
+			0,
+			[]string{"1:5: a", "1:5: b", "2:5: a"},
+		},
+		{
+			"cut off after the limit",
+			[]Diagnostic{{SEVERITY_ERROR, "a", 1, 1}, {SEVERITY_ERROR, "b", 2, 1}, {SEVERITY_ERROR, "c", 3, 1}, {SEVERITY_ERROR, "d", 4, 1}},
+			SEVERITY_ERROR,
+			2,
+			[]string{"1:1: a", "2:1: b", "3:1: too many errors, 2 more not shown"},
+		},
+		{
+			"exactly the limit",
+			[]Diagnostic{{SEVERITY_ERROR, "a", 1, 1}, {SEVERITY_ERROR, "b", 2, 1}},
+			SEVERITY_ERROR,
+			2,
+			[]string{"1:1: a", "2:1: b"},
+		},
+		{
+			"unlimited",
+			[]Diagnostic{{SEVERITY_ERROR, "a", 1, 1}, {SEVERITY_ERROR, "b", 2, 1}, {SEVERITY_ERROR, "c", 3, 1}},
+			SEVERITY_ERROR,
+			-1,
+			[]string{"1:1: a", "2:1: b", "3:1: c"},
+		},
+		{
+			"warnings apart from errors",
+			[]Diagnostic{{SEVERITY_WARNING, "a", 1, 1}, {SEVERITY_ERROR, "b", 2, 1}, {SEVERITY_WARNING, "c", 3, 1}, {SEVERITY_WARNING, "d", 4, 1}},
+			SEVERITY_WARNING,
+			1,
+			[]string{"1:1: warning: a", "3:1: warning: too many warnings, 2 more not shown"},
+		},
+	}
+
+	for _, tt := range tests {
+		reported := report(tt.diagnostics, tt.severity, tt.limit)
+		got := make([]string, len(reported))
+		for i, diagnostic := range reported {
+			got[i] = diagnostic.String()
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: wrong diagnostics. want=%q, got=%q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestDiagnosticLimit(t *testing.T) {
+	input := strings.Repeat("let = 1;\n", 25)
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != MAX_DIAGNOSTICS+1 {
+		t.Fatalf("wrong number of diagnostics. expected=%d, got=%d", MAX_DIAGNOSTICS+1, len(diagnostics))
+	}
+	if last := diagnostics[MAX_DIAGNOSTICS].String(); last != "11:5: too many errors, 30 more not shown" {
+		t.Errorf("wrong last diagnostic. got=%q", last)
+	}
+	if len(p.Errors()) != len(diagnostics) {
+		t.Errorf("errors and diagnostics differ. errors=%d, diagnostics=%d", len(p.Errors()), len(diagnostics))
+	}
+
+	p.LimitDiagnostics(-1)
+	if len(p.Diagnostics()) != 50 {
+		t.Errorf("wrong number of unlimited diagnostics. expected=50, got=%d", len(p.Diagnostics()))
+	}
+
+	document := ParseDocument(input)
+	if !reflect.DeepEqual(document.Diagnostics(), diagnostics) {
+		t.Errorf("document diagnostics differ. want=%v, got=%v", diagnostics, document.Diagnostics())
+	}
+	document.LimitDiagnostics(-1)
+	if !reflect.DeepEqual(document.Diagnostics(), p.Diagnostics()) {
+		t.Errorf("unlimited document diagnostics differ. want=%v, got=%v", p.Diagnostics(), document.Diagnostics())
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x; puts(x);", []string{"1:12: warning: statement has no effect"}},
+		{"1\n\"two\";\ntrue == !false; 4", []string{
+			"1:1: warning: statement has no effect",
+			"2:1: warning: statement has no effect",
+			"3:1: warning: statement has no effect",
+		}},
+		{"fn(x) { x; x }; 1", []string{"1:1: warning: statement has no effect", "1:9: warning: statement has no effect"}},
+		{"let x = 1; x", []string{}},
+		{"if (true) { 1 } else { 2 }; puts(1)", []string{}},
+		{"puts(1); len(\"a\") == 1; 1 / 0; 2", []string{}},
+		{"-x; x < 1; 2", []string{}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		checkParserErrors(t, p)
+
+		warnings := []string{}
+		for _, warning := range p.Warnings() {
+			warnings = append(warnings, warning.String())
+		}
+		if !reflect.DeepEqual(warnings, tt.expected) {
+			t.Errorf("wrong warnings for %q. want=%q, got=%q", tt.input, tt.expected, warnings)
+		}
+
+		document := ParseDocument(tt.input)
+		if !reflect.DeepEqual(document.Warnings(), p.Warnings()) {
+			t.Errorf("document warnings differ for %q. want=%v, got=%v", tt.input, p.Warnings(), document.Warnings())
+		}
+	}
+}
+
+func TestDocument(t *testing.T) {
+	source := "/// one\nlet one = 1;\nlet two = fn(x) {\n  x + one\n};\nputs(two(2)); let three = 3;\n\n/// four\nlet four = [1, 2];\n"
+
+	tests := []struct {
+		name  string
+		edit  Edit
+		kept  int // statements kept from before, of the 5
+		moved int // statements kept and moved to other lines
+	}{
+		{"rename a parameter", Edit{Start: 34, End: 35, Text: "y"}, 4, 0},
+		{"lengthen a line", Edit{Start: 78, End: 79, Text: "33"}, 4, 0},
+		{"add lines", Edit{Start: 49, End: 49, Text: "\n  + 1"}, 4, 3},
+		{"remove a line", Edit{Start: 8, End: 21, Text: ""}, 3, 3},
+		{"join statements", Edit{Start: 50, End: 57, Text: "("}, 3, 2},
+		{"split a statement", Edit{Start: 18, End: 18, Text: "; 2"}, 4, 0},
+		{"break a statement", Edit{Start: 21, End: 23, Text: ""}, 3, 0},
+		{"open a block", Edit{Start: 66, End: 66, Text: "if (x) { "}, 2, 0},
+		{"change a doc comment", Edit{Start: 86, End: 90, Text: "the fourth"}, 3, 0},
+		{"append", Edit{Start: 110, End: 110, Text: "let five = 5;\n"}, 4, 0},
+		{"remove everything", Edit{Start: 0, End: 110, Text: ""}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		document := ParseDocument(source)
+		before := document.Program().Statements
+
+		if err := document.Edit(tt.edit); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		edited := source[:tt.edit.Start] + tt.edit.Text + source[tt.edit.End:]
+		if document.Source() != edited {
+			t.Fatalf("%s: wrong source. want=%q, got=%q", tt.name, edited, document.Source())
+		}
+
+		// the document is the same as the edited source parsed whole
+		p := New(lexer.New(edited))
+		program := p.ParseProgram()
+		if !reflect.DeepEqual(document.Program(), program) {
+			t.Errorf("%s: wrong program.\nwant=%s\ngot= %s", tt.name, program, document.Program())
+		}
+		if !reflect.DeepEqual(document.Diagnostics(), p.Diagnostics()) {
+			t.Errorf("%s: wrong diagnostics. want=%v, got=%v", tt.name, p.Diagnostics(), document.Diagnostics())
+		}
+		if !reflect.DeepEqual(document.Warnings(), p.Warnings()) {
+			t.Errorf("%s: wrong warnings. want=%v, got=%v", tt.name, p.Warnings(), document.Warnings())
+		}
+
+		kept, moved := 0, 0
+		for _, statement := range document.Program().Statements {
+			for _, old := range before {
+				if statement == old {
+					kept++
+				}
+			}
+		}
+		for i, statement := range before {
+			if ast.StartToken(statement).Line != ast.StartToken(ParseDocument(source).Program().Statements[i]).Line {
+				moved++
+			}
+		}
+		if kept != tt.kept || moved != tt.moved {
+			t.Errorf("%s: wrong statements kept. want %d kept and %d moved, got %d and %d", tt.name, tt.kept, tt.moved, kept, moved)
+		}
+	}
+
+	document := ParseDocument(source)
+	if err := document.Edit(Edit{Start: 100, End: 200}); err == nil {
+		t.Errorf("no error for an edit past the end of the source")
+	}
+}
+
+func TestNestingLimit(t *testing.T) {
+	tests := []struct {
+		input  string
+		errors int
+	}{
+		{strings.Repeat("(", MAX_NESTING-1) + "1" + strings.Repeat(")", MAX_NESTING-1), 0},
+		{strings.Repeat("1 + ", MAX_NESTING/2) + "1", 0},
+		{strings.Repeat("(", MAX_NESTING) + "1" + strings.Repeat(")", MAX_NESTING) + "; let x = ", 1},
+		{strings.Repeat("-", 10*MAX_NESTING) + "1", 1},
+		{strings.Repeat("1 + ", MAX_NESTING) + "1", 1},
+		{strings.Repeat("if (x) { ", MAX_NESTING), 1},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) != tt.errors {
+			t.Errorf("wrong number of errors. expected=%d, got=%d (%.100q)", tt.errors, len(p.Errors()), p.Errors())
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -815,3 +1589,127 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+// benchmarkPrograms are representative programs to parse, repeated to the size of a
+// large file.
+var benchmarkPrograms = map[string]string{
+	"arithmetic": "let x = 1 + 2 * 3 - (4 / 5) % 6; let y = -x < 10 == !(x > 2) != false ?? x;\n",
+	"functions": `let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+let each = fn(array, f) {
+  let loop = fn(index) {
+    if (index < len(array)) { f(array[index]); loop(index + 1) }
+  };
+  loop(0)
+};
+let safe = fn(x) { try { 10 / x } catch (e) { e["message"] } };
+`,
+	"data": `let people = [["alice", 30], ["bob", 25]];
+let names = people.map(fn(person) { person[0].upper() });
+let first = names?[0] ?? "nobody";
+let bytes = b"\x00\x01" + "text".to_bytes();
+puts(first, bytes.hex_encode(), names[1:], len(people));
+`,
+}
+
+func BenchmarkParseProgram(b *testing.B) {
+	for name, program := range benchmarkPrograms {
+		input := strings.Repeat(program, 200)
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				New(lexer.New(input)).ParseProgram()
+			}
+		})
+	}
+}
+
+func BenchmarkDocumentEdit(b *testing.B) {
+	for name, program := range benchmarkPrograms {
+		input := strings.Repeat(program, 200)
+		b.Run(name, func(b *testing.B) {
+			document := ParseDocument(input)
+			middle := strings.Index(input[len(input)/2:], "\n") + len(input)/2
+
+			// typing a line in the middle of the file and deleting it again
+			for i := 0; i < b.N; i++ {
+				if i%2 == 0 {
+					document.Edit(Edit{Start: middle, End: middle, Text: "\nx"})
+				} else {
+					document.Edit(Edit{Start: middle, End: middle + 2})
+				}
+			}
+		})
+	}
+}
+
+func FuzzParseProgram(f *testing.F) {
+	for _, program := range benchmarkPrograms {
+		f.Add(program)
+	}
+	for _, seed := range []string{"let = 5;", "fn(x, { x }", "if (x) { y } else", "a[1:2:3]", "try { } catch"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if program == nil {
+			t.Fatalf("no program for %q", input)
+		}
+		for _, diagnostic := range p.Diagnostics() {
+			if diagnostic.Message == "" {
+				t.Fatalf("diagnostic without a message for %q", input)
+			}
+		}
+		// the program of an input with no errors can be printed
+		if len(p.Errors()) == 0 {
+			_ = program.String()
+		}
+	})
+}
+
+func FuzzDocument(f *testing.F) {
+	for _, program := range benchmarkPrograms {
+		f.Add(program, 10, 20, "x")
+		f.Add(program, 30, 30, "}\n/// doc\nlet")
+	}
+	f.Add("let a = 1;\nb(2)", 10, 11, "")
+	f.Add("let s = \"a\nb\"; /// doc\nlet c = 3;", 11, 12, "\n\n")
+
+	f.Fuzz(func(t *testing.T, source string, start, end int, text string) {
+		if start < 0 || end < start || end > len(source) {
+			return
+		}
+
+		document := ParseDocument(source)
+		if err := document.Edit(Edit{Start: start, End: end, Text: text}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the document is the same as the edited source parsed whole, and again after
+		// the edit is undone
+		p := New(lexer.New(document.Source()))
+		program := p.ParseProgram()
+		if !reflect.DeepEqual(document.Diagnostics(), p.Diagnostics()) {
+			t.Fatalf("edit of %q to %q diagnosed differently. want=%v, got=%v",
+				source, document.Source(), p.Diagnostics(), document.Diagnostics())
+		}
+		if !reflect.DeepEqual(document.Warnings(), p.Warnings()) {
+			t.Fatalf("edit of %q to %q warned differently. want=%v, got=%v",
+				source, document.Source(), p.Warnings(), document.Warnings())
+		}
+		if !reflect.DeepEqual(document.Program(), program) {
+			t.Fatalf("edit of %q to %q parsed differently.\nwant=%s\ngot= %s", source, document.Source(), program, document.Program())
+		}
+
+		if err := document.Edit(Edit{Start: start, End: start + len(text), Text: source[start:end]}); err != nil {
+			t.Fatal(err)
+		}
+		p = New(lexer.New(source))
+		program = p.ParseProgram()
+		if !reflect.DeepEqual(document.Program(), program) || !reflect.DeepEqual(document.Diagnostics(), p.Diagnostics()) {
+			t.Fatalf("undoing an edit of %q parsed differently.\nwant=%s %v\ngot= %s %v",
+				source, program, p.Diagnostics(), document.Program(), document.Diagnostics())
+		}
+	})
+}
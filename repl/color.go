@@ -0,0 +1,68 @@
+package repl
+
+import (
+	"io"
+	"os"
+)
+
+// color is an ANSI escape sequence, or an empty string when colors are disabled.
+type color string
+
+// ANSI escape sequences used by the REPL
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorCyan   = "\x1b[36m"
+)
+
+// palette assigns a color to each kind of REPL output.
+type palette struct {
+	prompt       color
+	result       color
+	parseError   color
+	warning      color
+	runtimeError color
+}
+
+// newPalette returns the colored palette if the output supports it, and an empty palette otherwise.
+func newPalette(out io.Writer) palette {
+	if !colorEnabled(out) {
+		return palette{}
+	}
+
+	return colorPalette()
+}
+
+// colorPalette returns the palette used when colors are enabled.
+func colorPalette() palette {
+	return palette{
+		prompt:       colorBold + colorBlue,
+		result:       colorGreen,
+		parseError:   colorYellow,
+		warning:      colorCyan,
+		runtimeError: colorBold + colorRed,
+	}
+}
+
+// colorEnabled reports whether the output is a terminal and NO_COLOR is not set.
+func colorEnabled(out io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	file, ok := out.(*os.File)
+	return ok && isTerminal(file.Fd())
+}
+
+// wrap surrounds the text with the color and a reset sequence.
+func (c color) wrap(text string) string {
+	if c == "" {
+		return text
+	}
+
+	return string(c) + text + colorReset
+}
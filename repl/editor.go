@@ -0,0 +1,264 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// MAX_HISTORY is the number of entries kept in the history file.
+const MAX_HISTORY = 1000
+
+// key codes understood by the editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyCtrlK     = 11
+	keyNewline   = 10
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// editor is a minimal readline-style line editor with history.
+type editor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	history     []string
+	historyFile string
+
+	// raw switches the terminal into raw mode and returns a function restoring it
+	raw func() func()
+}
+
+// newTerminalEditor creates an editor reading from a terminal, loading the history from the given file.
+func newTerminalEditor(file *os.File, out io.Writer, historyFile string) *editor {
+	editor := &editor{
+		in:          bufio.NewReader(file),
+		out:         out,
+		historyFile: historyFile,
+	}
+
+	// the terminal is only in raw mode while a line is being edited, so output
+	// produced during evaluation is rendered normally
+	editor.raw = func() func() {
+		restore, err := makeRaw(file.Fd())
+		if err != nil {
+			return func() {}
+		}
+		return restore
+	}
+
+	editor.loadHistory()
+
+	return editor
+}
+
+// ReadLine prints the prompt and lets the user edit a line until Enter is pressed.
+func (editor *editor) ReadLine(prompt string) (string, error) {
+	if editor.raw != nil {
+		restore := editor.raw()
+		defer restore()
+	}
+
+	line := []rune{}
+	position := 0
+
+	// historyIndex points one past the last entry while editing a new line
+	historyIndex := len(editor.history)
+	pending := ""
+
+	editor.refresh(prompt, line, position)
+
+	for {
+		char, _, err := editor.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch char {
+		case keyEnter, keyNewline:
+			io.WriteString(editor.out, "\r\n")
+			return string(line), nil
+		case keyCtrlC:
+			io.WriteString(editor.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			// Ctrl-D on an empty line ends the input, otherwise it deletes forward
+			if len(line) == 0 {
+				io.WriteString(editor.out, "\r\n")
+				return "", io.EOF
+			}
+			if position < len(line) {
+				line = append(line[:position], line[position+1:]...)
+			}
+		case keyBackspace, keyDelete:
+			if position > 0 {
+				line = append(line[:position-1], line[position:]...)
+				position--
+			}
+		case keyCtrlA:
+			position = 0
+		case keyCtrlE:
+			position = len(line)
+		case keyCtrlB:
+			if position > 0 {
+				position--
+			}
+		case keyCtrlF:
+			if position < len(line) {
+				position++
+			}
+		case keyCtrlK:
+			line = line[:position]
+		case keyCtrlU:
+			line = line[position:]
+			position = 0
+		case keyCtrlP, keyCtrlN:
+			line, historyIndex, pending = editor.browseHistory(char == keyCtrlP, line, historyIndex, pending)
+			position = len(line)
+		case keyEscape:
+			line, position, historyIndex, pending = editor.handleEscape(line, position, historyIndex, pending)
+		default:
+			// ignore any other control characters
+			if char < ' ' {
+				continue
+			}
+			line = append(line[:position], append([]rune{char}, line[position:]...)...)
+			position++
+		}
+
+		editor.refresh(prompt, line, position)
+	}
+}
+
+// handleEscape interprets the arrow, home, end, and delete escape sequences.
+func (editor *editor) handleEscape(line []rune, position, historyIndex int, pending string) ([]rune, int, int, string) {
+	next, _, err := editor.in.ReadRune()
+	if err != nil || (next != '[' && next != 'O') {
+		return line, position, historyIndex, pending
+	}
+
+	code, _, err := editor.in.ReadRune()
+	if err != nil {
+		return line, position, historyIndex, pending
+	}
+
+	switch code {
+	case 'A':
+		line, historyIndex, pending = editor.browseHistory(true, line, historyIndex, pending)
+		position = len(line)
+	case 'B':
+		line, historyIndex, pending = editor.browseHistory(false, line, historyIndex, pending)
+		position = len(line)
+	case 'C':
+		if position < len(line) {
+			position++
+		}
+	case 'D':
+		if position > 0 {
+			position--
+		}
+	case 'H':
+		position = 0
+	case 'F':
+		position = len(line)
+	case '3':
+		// the delete key is sent as ESC [ 3 ~
+		if tilde, _, err := editor.in.ReadRune(); err == nil && tilde == '~' && position < len(line) {
+			line = append(line[:position], line[position+1:]...)
+		}
+	}
+
+	return line, position, historyIndex, pending
+}
+
+// browseHistory moves through the history, remembering the line being typed so it can be returned to.
+func (editor *editor) browseHistory(previous bool, line []rune, historyIndex int, pending string) ([]rune, int, string) {
+	if historyIndex == len(editor.history) {
+		pending = string(line)
+	}
+
+	if previous && historyIndex > 0 {
+		historyIndex--
+	} else if !previous && historyIndex < len(editor.history) {
+		historyIndex++
+	} else {
+		return line, historyIndex, pending
+	}
+
+	if historyIndex == len(editor.history) {
+		return []rune(pending), historyIndex, pending
+	}
+
+	return []rune(editor.history[historyIndex]), historyIndex, pending
+}
+
+// refresh redraws the prompt and the line, placing the cursor at the given position.
+func (editor *editor) refresh(prompt string, line []rune, position int) {
+	fmt.Fprintf(editor.out, "\r%s%s\x1b[K", prompt, string(line))
+
+	// move the cursor back from the end of the line to its position
+	if back := len(line) - position; back > 0 {
+		fmt.Fprintf(editor.out, "\x1b[%dD", back)
+	}
+}
+
+// AddHistory appends a line to the history, skipping blank lines and immediate repeats.
+func (editor *editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(editor.history) > 0 && editor.history[len(editor.history)-1] == line {
+		return
+	}
+
+	editor.history = append(editor.history, line)
+}
+
+// Close writes the history back to the history file.
+func (editor *editor) Close() error {
+	if editor.historyFile == "" {
+		return nil
+	}
+
+	history := editor.history
+	if len(history) > MAX_HISTORY {
+		history = history[len(history)-MAX_HISTORY:]
+	}
+
+	// multi-line entries are stored on a single line
+	var output string
+	for _, entry := range history {
+		output += strings.ReplaceAll(entry, "\n", " ") + "\n"
+	}
+
+	return os.WriteFile(editor.historyFile, []byte(output), 0600)
+}
+
+// loadHistory reads the history file, if one exists.
+func (editor *editor) loadHistory() {
+	if editor.historyFile == "" {
+		return
+	}
+
+	content, err := os.ReadFile(editor.historyFile)
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		editor.AddHistory(line)
+	}
+}
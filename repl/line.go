@@ -0,0 +1,65 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// HISTORY_FILE is the name of the file in the user's home directory that keeps the input history.
+const HISTORY_FILE = ".monkey_history"
+
+// errInterrupted is returned when the user cancels the line being edited with Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads lines of input for the REPL.
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	AddHistory(line string)
+	Close() error
+}
+
+// newLineReader returns a line editor when the input is a terminal and a plain scanner otherwise.
+func newLineReader(in io.Reader, out io.Writer, historyFile string) lineReader {
+	if file, ok := in.(*os.File); ok && isTerminal(file.Fd()) {
+		return newTerminalEditor(file, out, historyFile)
+	}
+
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+// historyPath returns the location of the history file, or an empty string if there is no home directory.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, HISTORY_FILE)
+}
+
+// scannerReader reads lines from a non-interactive input without any editing support.
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+// ReadLine prints the prompt and reads the next line of input.
+func (reader *scannerReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(reader.out, prompt)
+
+	if !reader.scanner.Scan() {
+		if err := reader.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	return reader.scanner.Text(), nil
+}
+
+func (reader *scannerReader) AddHistory(line string) {}
+func (reader *scannerReader) Close() error           { return nil }
@@ -0,0 +1,113 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"monkey/module"
+	"monkey/object"
+)
+
+// engines that can execute the inputs
+const (
+	ENGINE_EVAL = "eval" // the tree-walking evaluator
+	ENGINE_VM   = "vm"   // the bytecode compiler and virtual machine
+)
+
+// ColorMode controls whether the REPL colors its output.
+type ColorMode int
+
+const (
+	COLOR_AUTO   ColorMode = iota // color only when writing to a terminal and NO_COLOR is unset
+	COLOR_ALWAYS                  // always color the output
+	COLOR_NEVER                   // never color the output
+)
+
+// Options configures a REPL started with StartWithOptions. The zero value gives the default REPL.
+type Options struct {
+	// Prompt is shown before each input, PROMPT if empty.
+	Prompt string
+
+	// Banner is printed once before the first prompt.
+	Banner string
+
+	// Env is the environment inputs are evaluated in, so embedders can preseed bindings.
+	// A new environment is created if it is nil. The vm engine starts with its bindings
+	// as globals instead, leaving it unchanged, and can call builtins bound in it but not
+	// functions made by the evaluator.
+	Env *object.Environment
+
+	// Engine selects how inputs are executed, ENGINE_EVAL or ENGINE_VM, ENGINE_EVAL if empty.
+	Engine string
+
+	// HistoryFile is where the line editor keeps its history, ~/.monkey_history if empty.
+	HistoryFile string
+
+	// Color controls colored output.
+	Color ColorMode
+
+	// Trace starts the REPL with evaluation tracing on, as after `:trace on`.
+	Trace bool
+
+	// AllowExec lets inputs run commands with the exec builtin, which otherwise fails
+	// when called.
+	AllowExec bool
+
+	// MaxDepth is the number of function calls that can be in progress at once, with
+	// either engine, evaluator.DEFAULT_MAX_DEPTH if zero and unlimited if negative.
+	MaxDepth int
+
+	// CheckedArithmetic makes integer arithmetic that overflows fail with an error
+	// instead of producing a big integer.
+	CheckedArithmetic bool
+
+	// StrictBooleans makes conditions and the operand of ! fail with an error unless they
+	// are booleans.
+	StrictBooleans bool
+
+	// Loader imports the modules of the inputs, relative to the working directory. A
+	// new loader is created if it is nil.
+	Loader *module.Loader
+}
+
+// withDefaults fills in the unset options and validates the rest.
+func (options Options) withDefaults() (Options, error) {
+	if options.Prompt == "" {
+		options.Prompt = PROMPT
+	}
+
+	if options.Env == nil {
+		options.Env = object.NewEnvironment()
+	}
+
+	if options.Engine == "" {
+		options.Engine = ENGINE_EVAL
+	}
+	if options.Engine != ENGINE_EVAL && options.Engine != ENGINE_VM {
+		return options, fmt.Errorf("unknown engine: %s", options.Engine)
+	}
+	if options.Engine == ENGINE_VM && options.Trace {
+		return options, fmt.Errorf("tracing requires the %s engine", ENGINE_EVAL)
+	}
+
+	if options.HistoryFile == "" {
+		options.HistoryFile = historyPath()
+	}
+
+	if options.Loader == nil {
+		options.Loader = module.NewLoader()
+	}
+
+	return options, nil
+}
+
+// palette returns the palette to use for the output according to the color mode.
+func (options Options) palette(out io.Writer) palette {
+	switch options.Color {
+	case COLOR_ALWAYS:
+		return colorPalette()
+	case COLOR_NEVER:
+		return palette{}
+	default:
+		return newPalette(out)
+	}
+}
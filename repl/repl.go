@@ -1,50 +1,400 @@
 package repl
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
+	"monkey/vm"
+	"os"
+	"os/signal"
+	"strings"
 )
 
 const PROMPT = ">>> "
 
-// Start initializes the REPL.
+// CONTINUATION_PROMPT is shown while the REPL waits for the rest of an unfinished input.
+const CONTINUATION_PROMPT = "... "
+
+// session holds the state shared by every input of a REPL run.
+type session struct {
+	out    io.Writer
+	env    *object.Environment
+	colors palette
+
+	// macroEnv holds the macros defined so far, which expand the inputs after them
+	macroEnv *object.Environment
+
+	// trace prints every evaluated node, toggled with :trace
+	trace bool
+
+	// loader imports the modules of every input, so each is evaluated once
+	loader *module.Loader
+
+	// allowExec lets the inputs run commands with exec
+	allowExec bool
+
+	// maxDepth limits the calls in progress at once, with either engine
+	maxDepth int
+
+	// checkedArithmetic fails integer arithmetic that overflows, with either engine
+	checkedArithmetic bool
+
+	// strictBooleans fails conditions that are not booleans, with either engine
+	strictBooleans bool
+
+	// the vm engine compiles every input with the symbols and constants of the
+	// inputs before it, and runs it with their globals
+	engine      string
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+
+	// inputs holds every input that was evaluated without errors, for :save
+	inputs []string
+}
+
+// Start initializes the REPL with the default options.
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	StartWithOptions(in, out, Options{})
+}
+
+// StartWithOptions initializes the REPL configured by the given options.
+func StartWithOptions(in io.Reader, out io.Writer, options Options) error {
+	options, err := options.withDefaults()
+	if err != nil {
+		return err
+	}
+
+	reader := newLineReader(in, out, options.HistoryFile)
+	defer reader.Close()
+
+	// every line is evaluated in the same environment so bindings survive between lines
+	session := &session{
+		out:               out,
+		env:               options.Env,
+		colors:            options.palette(out),
+		macroEnv:          object.NewEnvironment(),
+		trace:             options.Trace,
+		engine:            options.Engine,
+		loader:            options.Loader,
+		allowExec:         options.AllowExec,
+		maxDepth:          options.MaxDepth,
+		checkedArithmetic: options.CheckedArithmetic,
+		strictBooleans:    options.StrictBooleans,
+	}
+	if session.engine == ENGINE_VM {
+		session.symbolTable = compiler.NewGlobalSymbolTable()
+		session.constants = []object.Object{}
+		session.globals = make([]object.Object, vm.GLOBALS_SIZE)
+
+		// the bindings of the environment become globals, which the inputs change in its place
+		for _, name := range options.Env.Names() {
+			value, _ := options.Env.Get(name)
+			session.globals[session.symbolTable.Define(name).Index] = value
+		}
+	}
+
+	if options.Banner != "" {
+		io.WriteString(out, options.Banner+"\n")
+	}
+
+	prompt := session.colors.prompt.wrap(options.Prompt)
+	continuationPrompt := session.colors.prompt.wrap(CONTINUATION_PROMPT)
 
 	for {
 		// read input from the user
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
+		line, err := reader.ReadLine(prompt)
+		if err == errInterrupted {
+			continue
+		}
 
-		// check if the user has entered any input or exits the REPL
-		if !scanned || scanner.Text() == "" || scanner.Text() == "exit" {
-			return
+		// stop at the end of the input or when the user asks to leave
+		if err != nil || isExit(line) {
+			return nil
+		}
+
+		// blank lines simply prompt again
+		if strings.TrimSpace(line) == "" {
+			continue
 		}
 
-		// lex the input
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+		// keep reading lines while the input is unfinished
+		input := line
+		for err == nil && isIncomplete(input) {
+			line, err = reader.ReadLine(continuationPrompt)
+			input += "\n" + line
+		}
+		if err == errInterrupted {
+			continue
+		} else if err != nil {
+			return nil
+		}
+		reader.AddHistory(input)
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		// commands start with a colon and are handled by the REPL itself
+		if strings.HasPrefix(input, ":") {
+			session.runCommand(input)
 			continue
 		}
 
-		// print the tokens
-		io.WriteString(out, program.String())
-		io.WriteString(out, "\n")
+		session.evalInput(input)
+	}
+}
+
+// evalInput lexes, parses, expands, and evaluates the input in the session environment, printing the result.
+func (session *session) evalInput(input string) {
+	// lex the input
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		session.printParserErrors(p.Errors())
+		return
+	}
+	session.printWarnings(p.Warnings())
+
+	// macros are defined and expanded before the input runs, on either engine
+	evaluator.DefineMacros(program, session.macroEnv)
+	expanded, errObj := evaluator.ExpandMacros(program, session.macroEnv)
+	if errObj != nil {
+		io.WriteString(session.out, session.colors.runtimeError.wrap(errObj.Inspect())+"\n")
+		return
+	}
+	program = expanded.(*ast.Program)
+
+	if session.engine == ENGINE_VM {
+		session.runInput(input, program)
+		return
+	}
+
+	// evaluate the program, letting Ctrl-C cancel it and return to the prompt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// imports are relative to the working directory
+	evaluatorOptions := evaluator.Options{
+		Importer:          session.loader,
+		AllowExec:         session.allowExec,
+		MaxDepth:          session.maxDepth,
+		CheckedArithmetic: session.checkedArithmetic,
+		StrictBooleans:    session.strictBooleans,
+	}
+	if session.trace {
+		evaluatorOptions.Trace = session.out
+	}
+
+	evaluated := evaluator.EvalWithOptions(ctx, program, session.env, evaluatorOptions)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		io.WriteString(session.out, session.colors.runtimeError.wrap(errObj.Inspect())+"\n")
+		for _, line := range errObj.TraceLines(func(line, column int) string { return fmt.Sprintf("%d:%d", line, column) }) {
+			io.WriteString(session.out, session.colors.runtimeError.wrap("    "+line)+"\n")
+		}
+		return
+	}
+
+	session.inputs = append(session.inputs, input)
+
+	// statements such as let produce no value, and null is not worth echoing
+	if evaluated == nil || evaluated == evaluator.NULL {
+		return
+	}
+
+	io.WriteString(session.out, session.colors.result.wrap(evaluated.Inspect())+"\n")
+}
+
+// runInput compiles the program and runs it on the virtual machine, printing the result.
+// An input that fails leaves no bindings behind for the next one.
+func (session *session) runInput(input string, program *ast.Program) {
+	symbolTable := session.symbolTable.Copy()
+
+	c := compiler.NewWithState(symbolTable, session.constants)
+	if err := c.Compile(program); err != nil {
+		session.printError("ERROR: " + err.Error())
+		return
+	}
+	bytecode := c.Bytecode()
+
+	// run the program, letting Ctrl-C cancel it and return to the prompt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	machine := vm.NewWithOptions(bytecode, session.globals, vm.Options{
+		MaxDepth:          session.maxDepth,
+		AllowExec:         session.allowExec,
+		CheckedArithmetic: session.checkedArithmetic,
+		StrictBooleans:    session.strictBooleans,
+	})
+	if err := machine.RunContext(ctx); err != nil {
+		session.printError("ERROR: " + err.Error())
+		if errObj, ok := err.(*object.Error); ok {
+			for _, line := range errObj.TraceLines(func(line, column int) string { return fmt.Sprintf("%d:%d", line, column) }) {
+				session.printError("    " + line)
+			}
+		}
+		return
+	}
+
+	session.symbolTable = symbolTable
+	session.constants = bytecode.Constants
+	session.inputs = append(session.inputs, input)
+
+	// a let statement produces no value, as in the evaluator
+	if len(program.Statements) == 0 {
+		return
+	}
+	if _, ok := program.Statements[len(program.Statements)-1].(*ast.LetStatement); ok {
+		return
+	}
+
+	result := machine.LastPoppedStackElem()
+	if result == nil || result == evaluator.NULL {
+		return
+	}
+
+	io.WriteString(session.out, session.colors.result.wrap(result.Inspect())+"\n")
+}
+
+// runCommand executes a REPL command such as :load.
+func (session *session) runCommand(input string) {
+	fields := strings.Fields(input)
+	name, arguments := fields[0], fields[1:]
+
+	switch name {
+	case ":load":
+		if len(arguments) != 1 {
+			io.WriteString(session.out, "usage: :load <file>\n")
+			return
+		}
+
+		content, err := os.ReadFile(arguments[0])
+		if err != nil {
+			session.printError(fmt.Sprintf("could not load %s: %s", arguments[0], err))
+			return
+		}
+
+		session.evalInput(string(content))
+	case ":save":
+		if len(arguments) != 1 {
+			io.WriteString(session.out, "usage: :save <file>\n")
+			return
+		}
+
+		if err := os.WriteFile(arguments[0], []byte(session.transcript()), 0644); err != nil {
+			session.printError(fmt.Sprintf("could not save %s: %s", arguments[0], err))
+			return
+		}
+
+		fmt.Fprintf(session.out, "saved %d inputs to %s\n", len(session.inputs), arguments[0])
+	case ":restore":
+		if len(arguments) != 1 {
+			io.WriteString(session.out, "usage: :restore <file>\n")
+			return
+		}
+
+		content, err := os.ReadFile(arguments[0])
+		if err != nil {
+			session.printError(fmt.Sprintf("could not restore %s: %s", arguments[0], err))
+			return
+		}
+
+		session.evalInput(string(content))
+	case ":trace":
+		if len(arguments) != 1 || arguments[0] != "on" && arguments[0] != "off" {
+			io.WriteString(session.out, "usage: :trace on|off\n")
+			return
+		}
+
+		if session.engine == ENGINE_VM && arguments[0] == "on" {
+			session.printError(fmt.Sprintf("tracing requires the %s engine", ENGINE_EVAL))
+			return
+		}
+
+		session.trace = arguments[0] == "on"
+	default:
+		session.printError(fmt.Sprintf("unknown command: %s", name))
+	}
+}
+
+// transcript joins the successfully evaluated inputs into a program that recreates the session.
+func (session *session) transcript() string {
+	var output string
+
+	for _, input := range session.inputs {
+		input = strings.TrimSpace(input)
+
+		// terminate each input so consecutive inputs cannot run together when parsed again
+		if !strings.HasSuffix(input, ";") {
+			input += ";"
+		}
+
+		output += input + "\n"
+	}
+
+	return output
+}
+
+// isExit reports whether the line asks the REPL to quit.
+func isExit(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "exit" || line == ":quit"
+}
+
+// isIncomplete reports whether the input ends mid-expression, either because a
+// parenthesis, bracket or brace is still open or because the last token expects an operand.
+func isIncomplete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+	var last token.Token
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.OPTIONAL_LPAREN, token.LBRACKET, token.OPTIONAL_LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			depth--
+		}
+		last = tok
+	}
+
+	if depth > 0 {
+		return true
 	}
+
+	switch last.Type {
+	case token.ASSIGN, token.PLUS, token.MINUS, token.BANG, token.ASTERISK, token.SLASH, token.PERCENT, token.COALESCE,
+		token.LT, token.GT, token.LT_EQ, token.GT_EQ, token.EQ, token.NOT_EQ, token.COMMA, token.ELSE:
+		return true
+	}
+
+	return false
 }
 
 // printParserErrors prints the parser errors to the output.
-func printParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, "Parser errors:\n")
+func (session *session) printParserErrors(errors []string) {
+	io.WriteString(session.out, session.colors.parseError.wrap("Parser errors:")+"\n")
 	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+		io.WriteString(session.out, "\t"+session.colors.parseError.wrap(msg)+"\n")
 	}
 }
+
+// printWarnings prints the parser warnings to the output, which do not stop the input
+// from running.
+func (session *session) printWarnings(warnings []parser.Diagnostic) {
+	for _, warning := range warnings {
+		io.WriteString(session.out, session.colors.warning.wrap(warning.String())+"\n")
+	}
+}
+
+// printError prints a message about a problem with the REPL itself, such as a bad command.
+func (session *session) printError(msg string) {
+	io.WriteString(session.out, session.colors.runtimeError.wrap(msg)+"\n")
+}
@@ -0,0 +1,339 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", false},
+		{"let add = fn(x, y) {", true},
+		{"let add = fn(x, y) {\n  x + y;\n};", false},
+		{"add(1,", true},
+		{"1 +", true},
+		{"let x =", true},
+		{"if (x) { 1 } else", true},
+		{"(1 + 2", true},
+		{"[1,\n2]", false},
+		{"[", true},
+		{"a?[", true},
+		{"a?[\n0]", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIncomplete(tt.input); got != tt.expected {
+			t.Errorf("isIncomplete(%q) wrong. expected=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStartMultiLineInput(t *testing.T) {
+	input := "let add = fn(x, y) {\n  x + y\n};\nadd(1,\n2)\nlet a = [1,\n2];\na?[\n0]\nexit\n"
+	var out bytes.Buffer
+
+	Start(strings.NewReader(input), &out)
+
+	expected := PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + PROMPT + CONTINUATION_PROMPT + "3\n" +
+		PROMPT + CONTINUATION_PROMPT + PROMPT + CONTINUATION_PROMPT + "1\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestEditorReadLine(t *testing.T) {
+	tests := []struct {
+		keys     string
+		history  []string
+		expected string
+	}{
+		{"let x = 5;\r", nil, "let x = 5;"},
+		{"ac\x1b[Db\r", nil, "abc"},
+		{"bc\x01a\x05d\r", nil, "abcd"},
+		{"abx\x7fc\r", nil, "abc"},
+		{"abcdef\x01\x06\x06\x0b\r", nil, "ab"},
+		{"\x1b[A\r", []string{"first", "second"}, "second"},
+		{"\x1b[A\x1b[A\r", []string{"first", "second"}, "first"},
+		{"new\x1b[A\x1b[B\r", []string{"first"}, "new"},
+		{"abc\x1b[D\x1b[3~\r", nil, "ab"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := &editor{in: bufio.NewReader(strings.NewReader(tt.keys)), out: &out}
+		for _, entry := range tt.history {
+			e.AddHistory(entry)
+		}
+
+		line, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("ReadLine(%q) returned error: %s", tt.keys, err)
+		}
+		if line != tt.expected {
+			t.Errorf("ReadLine(%q) wrong. expected=%q, got=%q", tt.keys, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorControlKeys(t *testing.T) {
+	var out bytes.Buffer
+
+	e := &editor{in: bufio.NewReader(strings.NewReader("\x04")), out: &out}
+	if _, err := e.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl-D on empty line should return io.EOF. got=%v", err)
+	}
+
+	e = &editor{in: bufio.NewReader(strings.NewReader("abc\x03")), out: &out}
+	if _, err := e.ReadLine(PROMPT); err != errInterrupted {
+		t.Errorf("Ctrl-C should return errInterrupted. got=%v", err)
+	}
+}
+
+func TestEditorHistoryFile(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), HISTORY_FILE)
+
+	e := &editor{historyFile: historyFile}
+	e.AddHistory("let x = 5;")
+	e.AddHistory("")
+	e.AddHistory("x + 1")
+	e.AddHistory("x + 1")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close returned error: %s", err)
+	}
+
+	loaded := &editor{historyFile: historyFile}
+	loaded.loadHistory()
+
+	expected := []string{"let x = 5;", "x + 1"}
+	if strings.Join(loaded.history, "|") != strings.Join(expected, "|") {
+		t.Errorf("history wrong. expected=%q, got=%q", expected, loaded.history)
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "script.monkey")
+	script := "let double = fn(x) {\n  x * 2\n};\nlet base = 20;\n"
+	if err := os.WriteFile(file, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := ":load " + file + "\ndouble(base) + 2\n:load missing.monkey\n:nope\nexit\n"
+	var out bytes.Buffer
+
+	Start(strings.NewReader(input), &out)
+
+	for _, expected := range []string{"42\n", "could not load missing.monkey", "unknown command: :nope"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output does not contain %q. got=%q", expected, out.String())
+		}
+	}
+}
+
+func TestSaveAndRestoreCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "session.mky")
+
+	input := "let x = 5;\nfoo\nlet double = fn(n) {\n  n * 2\n}\ndouble(x)\n1 +\n-2\n:save " + file + "\nexit\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("session file was not written: %s", err)
+	}
+
+	expected := "let x = 5;\nlet double = fn(n) {\n  n * 2\n};\ndouble(x);\n1 +\n-2;\n"
+	if string(content) != expected {
+		t.Errorf("saved session wrong. expected=%q, got=%q", expected, string(content))
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":restore "+file+"\ndouble(x) + 1\nexit\n"), &out)
+
+	if !strings.Contains(out.String(), "11\n") {
+		t.Errorf("restored session does not contain bindings. got=%q", out.String())
+	}
+}
+
+func TestStartWithOptions(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("answer", &object.Integer{Value: 42})
+
+	var out bytes.Buffer
+	err := StartWithOptions(strings.NewReader("answer\nexit\n"), &out, Options{
+		Prompt: "monkey> ",
+		Banner: "Welcome",
+		Env:    env,
+		Color:  COLOR_ALWAYS,
+	})
+	if err != nil {
+		t.Fatalf("StartWithOptions returned error: %s", err)
+	}
+
+	prompt := colorPalette().prompt.wrap("monkey> ")
+	expected := "Welcome\n" + prompt + colorPalette().result.wrap("42") + "\n" + prompt
+	if out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+
+	// the vm engine starts with the bindings of the environment
+	out.Reset()
+	env.Set("double", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 2 * args[0].(*object.Integer).Value}
+	}})
+	err = StartWithOptions(strings.NewReader("let answer = double(answer)\nanswer + 1\nexit\n"), &out, Options{
+		Prompt: "monkey> ",
+		Env:    env,
+		Engine: ENGINE_VM,
+		Color:  COLOR_NEVER,
+	})
+	if err != nil {
+		t.Fatalf("StartWithOptions returned error: %s", err)
+	}
+	if expected := "monkey> monkey> 85\nmonkey> "; out.String() != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+	}
+	if answer, _ := env.Get("answer"); answer.Inspect() != "42" {
+		t.Errorf("environment changed by the vm engine. got=%s", answer.Inspect())
+	}
+
+	err = StartWithOptions(strings.NewReader(""), &out, Options{Engine: "jit"})
+	if err == nil || err.Error() != "unknown engine: jit" {
+		t.Errorf("expected unknown engine error. got=%v", err)
+	}
+}
+
+func TestTraceCommand(t *testing.T) {
+	input := ":trace on\n1 + 2\n:trace off\n3 + 4\n:trace maybe\nexit\n"
+	var out bytes.Buffer
+
+	Start(strings.NewReader(input), &out)
+
+	result := strings.ReplaceAll(out.String(), PROMPT, "")
+	expected := "1 => 1\n2 => 2\n(1 + 2) => 3\n3\n7\nusage: :trace on|off\n"
+	if result != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, result)
+	}
+}
+
+func TestPrintResults(t *testing.T) {
+	input := "let x = 5;\nx * 2\nif (false) { 1 }\nfn(a) { a }\ntrue\nexit\n"
+	var out bytes.Buffer
+
+	Start(strings.NewReader(input), &out)
+
+	result := strings.ReplaceAll(out.String(), PROMPT, "")
+	expected := "10\nfn(a) {\na\n}\ntrue\n"
+	if result != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, result)
+	}
+}
+
+func TestVMEngine(t *testing.T) {
+	input := "let x = 5;\nlet double = fn(n) { n * 2 };\ndouble(x)\nlet y = 1; y + true\ny\nlen(\"abc\")\n:trace on\nexit\n"
+	var out bytes.Buffer
+
+	err := StartWithOptions(strings.NewReader(input), &out, Options{Engine: ENGINE_VM, Color: COLOR_NEVER})
+	if err != nil {
+		t.Fatalf("StartWithOptions returned error: %s", err)
+	}
+
+	// the failed input does not leave y behind
+	result := strings.ReplaceAll(out.String(), PROMPT, "")
+	expected := "10\nERROR: type mismatch: INTEGER + BOOLEAN\nERROR: identifier not found: y\n3\ntracing requires the eval engine\n"
+	if result != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, result)
+	}
+
+	err = StartWithOptions(strings.NewReader(""), &out, Options{Engine: ENGINE_VM, Trace: true})
+	if err == nil || err.Error() != "tracing requires the eval engine" {
+		t.Errorf("expected tracing error. got=%v", err)
+	}
+}
+
+func TestMacros(t *testing.T) {
+	input := "let unless = macro(c, a) { quote(if (!unquote(c)) { unquote(a) }) };\nunless(false, 1)\nlet m = macro() { 2 };\nm()\nexit\n"
+
+	for _, engine := range []string{ENGINE_EVAL, ENGINE_VM} {
+		var out bytes.Buffer
+
+		err := StartWithOptions(strings.NewReader(input), &out, Options{Engine: engine, Color: COLOR_NEVER})
+		if err != nil {
+			t.Fatalf("StartWithOptions returned error: %s", err)
+		}
+
+		// macros defined by one input expand the inputs after it
+		result := strings.ReplaceAll(out.String(), PROMPT, "")
+		expected := "1\nERROR: macro m returned INTEGER, want QUOTE\n"
+		if result != expected {
+			t.Errorf("output wrong for %s. expected=%q, got=%q", engine, expected, result)
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	var out bytes.Buffer
+
+	err := StartWithOptions(strings.NewReader("1; 2\n"), &out, Options{Color: COLOR_NEVER})
+	if err != nil {
+		t.Fatalf("StartWithOptions returned error: %s", err)
+	}
+
+	// the input still runs after the warning
+	result := strings.ReplaceAll(out.String(), PROMPT, "")
+	expected := "1:1: warning: statement has no effect\n2\n"
+	if result != expected {
+		t.Errorf("output wrong. expected=%q, got=%q", expected, result)
+	}
+}
+
+func TestColors(t *testing.T) {
+	colors := palette{result: colorGreen, runtimeError: colorRed}
+
+	if got := colors.result.wrap("5"); got != colorGreen+"5"+colorReset {
+		t.Errorf("colored result wrong. got=%q", got)
+	}
+	if got := colors.prompt.wrap(PROMPT); got != PROMPT {
+		t.Errorf("empty color should leave text unchanged. got=%q", got)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if colorEnabled(os.Stdout) {
+		t.Errorf("colors should be disabled when NO_COLOR is set")
+	}
+
+	var out bytes.Buffer
+	if newPalette(&out) != (palette{}) {
+		t.Errorf("colors should be disabled when the output is not a terminal")
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"\n\n1 + 1\nexit\n2 + 2\n", "2\n"},
+		{"   \n1 + 1\n:quit\n2 + 2\n", "2\n"},
+		{"1 + 1\n", "2\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		result := strings.ReplaceAll(out.String(), PROMPT, "")
+		if result != tt.expected {
+			t.Errorf("output wrong for %q. expected=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package repl
+
+import "errors"
+
+// isTerminal always reports false on platforms without termios support, so the plain scanner is used.
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+// makeRaw is not supported on platforms without termios.
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
@@ -1,55 +1,142 @@
 package token
 
-type TokenType string
+// TokenType is the type of a token, which is small enough to index arrays with.
+type TokenType int
 
 type Token struct {
 	Type    TokenType
 	Literal string
+
+	// position of the first character of the token, both starting at 1
+	Line   int
+	Column int
 }
 
 const (
 	// special tokens
-	ILLEGAL = "ILLEGAL"
-	EOF     = "EOF"
+	ILLEGAL TokenType = iota
+	EOF
+	COMMENT // collected by the lexer but never returned by NextToken
 
 	// identifiers and literals
-	IDENT = "IDENT" // add, foobar, x, y, ...
-	INT   = "INT"   // 1343456
+	IDENT  // add, foobar, x, y, ...
+	INT    // 1343456
+	STRING // "foobar"
+	BYTES  // b"\x00\x01"
 
 	// operators
-	ASSIGN   = "="
-	PLUS     = "+"
-	MINUS    = "-"
-	BANG     = "!"
-	ASTERISK = "*"
-	SLASH    = "/"
+	ASSIGN
+	PLUS
+	MINUS
+	BANG
+	ASTERISK
+	SLASH
+	PERCENT
+
+	LT
+	GT
+	LT_EQ
+	GT_EQ
 
-	LT = "<"
-	GT = ">"
+	COALESCE
+
+	// optional chaining, which gives null instead of indexing or calling null
+	OPTIONAL_LPAREN
+	OPTIONAL_LBRACKET
 
 	// equality
-	EQ     = "=="
-	NOT_EQ = "!="
+	EQ
+	NOT_EQ
 
 	// delimiters
-	COMMA     = ","
-	SEMICOLON = ";"
+	COMMA
+	SEMICOLON
+	COLON
+	DOT
+	ARROW
+
+	LPAREN
+	RPAREN
+	LBRACE
+	RBRACE
 
-	LPAREN = "("
-	RPAREN = ")"
-	LBRACE = "{"
-	RBRACE = "}"
+	LBRACKET
+	RBRACKET
 
 	// keywords
-	FUNCTION = "FUNCTION"
-	LET      = "LET"
-	TRUE     = "TRUE"
-	FALSE    = "FALSE"
-	IF       = "IF"
-	ELSE     = "ELSE"
-	RETURN   = "RETURN"
+	FUNCTION
+	LET
+	TRUE
+	FALSE
+	IF
+	ELSE
+	RETURN
+	MACRO
+	EXPORT
+	TRY
+	CATCH
+	SPAWN
+	SELECT
+
+	// the number of token types, which is not one itself
+	TOKEN_TYPES
 )
 
+// names are the names of the token types as messages show them, which for operators
+// and delimiters are the characters themselves.
+var names = [TOKEN_TYPES]string{
+	ILLEGAL:           "ILLEGAL",
+	EOF:               "EOF",
+	COMMENT:           "COMMENT",
+	IDENT:             "IDENT",
+	INT:               "INT",
+	STRING:            "STRING",
+	BYTES:             "BYTES",
+	ASSIGN:            "=",
+	PLUS:              "+",
+	MINUS:             "-",
+	BANG:              "!",
+	ASTERISK:          "*",
+	SLASH:             "/",
+	PERCENT:           "%",
+	LT:                "<",
+	GT:                ">",
+	LT_EQ:             "<=",
+	GT_EQ:             ">=",
+	COALESCE:          "??",
+	OPTIONAL_LPAREN:   "?(",
+	OPTIONAL_LBRACKET: "?[",
+	EQ:                "==",
+	NOT_EQ:            "!=",
+	COMMA:             ",",
+	SEMICOLON:         ";",
+	COLON:             ":",
+	DOT:               ".",
+	ARROW:             "=>",
+	LPAREN:            "(",
+	RPAREN:            ")",
+	LBRACE:            "{",
+	RBRACE:            "}",
+	LBRACKET:          "[",
+	RBRACKET:          "]",
+	FUNCTION:          "FUNCTION",
+	LET:               "LET",
+	TRUE:              "TRUE",
+	FALSE:             "FALSE",
+	IF:                "IF",
+	ELSE:              "ELSE",
+	RETURN:            "RETURN",
+	MACRO:             "MACRO",
+	EXPORT:            "EXPORT",
+	TRY:               "TRY",
+	CATCH:             "CATCH",
+	SPAWN:             "SPAWN",
+	SELECT:            "SELECT",
+}
+
+// String returns the name of the token type.
+func (tokenType TokenType) String() string { return names[tokenType] }
+
 var keywords = map[string]TokenType{
 	"fn":     FUNCTION,
 	"let":    LET,
@@ -58,6 +145,12 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"macro":  MACRO,
+	"export": EXPORT,
+	"try":    TRY,
+	"catch":  CATCH,
+	"spawn":  SPAWN,
+	"select": SELECT,
 }
 
 // LookupIdent checks if the given identifier is a keyword.
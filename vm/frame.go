@@ -0,0 +1,30 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+// Frame is the activation of a function: the closure called, where it is in its
+// instructions, and where its locals start on the stack.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int // the stack slot of the first local, just above the called function
+}
+
+// NewFrame creates a frame that starts before the first instruction of the closure.
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+// Instructions returns the instructions of the frame's function.
+func (frame *Frame) Instructions() code.Instructions {
+	return frame.cl.Fn.Instructions
+}
+
+// position returns the line and column in the source of the instruction the frame is
+// at, or zeros if the source map of its function does not place it.
+func (frame *Frame) position() (int, int) {
+	return frame.cl.Fn.SourceMap.Lookup(frame.ip)
+}
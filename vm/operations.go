@@ -0,0 +1,279 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// infixOperators maps the binary opcodes to the operators the evaluator applies.
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:                "+",
+	code.OpSub:                "-",
+	code.OpMul:                "*",
+	code.OpDiv:                "/",
+	code.OpMod:                "%",
+	code.OpEqual:              "==",
+	code.OpNotEqual:           "!=",
+	code.OpGreaterThan:        ">",
+	code.OpLessThan:           "<",
+	code.OpGreaterThanOrEqual: ">=",
+	code.OpLessThanOrEqual:    "<=",
+}
+
+// jumpOperators maps the fused comparison jumps to the comparisons they jump unless.
+var jumpOperators = map[code.Opcode]string{
+	code.OpJumpNotEqual:              "==",
+	code.OpJumpEqual:                 "!=",
+	code.OpJumpNotGreaterThan:        ">",
+	code.OpJumpNotLessThan:           "<",
+	code.OpJumpNotGreaterThanOrEqual: ">=",
+	code.OpJumpNotLessThanOrEqual:    "<=",
+}
+
+// superinstructionOperators maps the superinstructions to the operators they apply to a local and a constant.
+var superinstructionOperators = map[code.Opcode]string{
+	code.OpGetLocalConstantAdd: "+",
+	code.OpGetLocalConstantSub: "-",
+}
+
+// executeBinaryOperation replaces the two operands on top of the stack with the result of the operator.
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	return vm.pushAllocated(vm.infixOperation(infixOperators[op], left, right))
+}
+
+// infixOperation applies an infix operator to two operands as the evaluator does,
+// checking arithmetic for overflow if the options ask for it.
+func (vm *VM) infixOperation(operator string, left, right object.Object) object.Object {
+	result := evaluator.InfixOperation(operator, left, right)
+	if vm.checkedArithmetic {
+		return evaluator.CheckOverflow(result, operator, left, right)
+	}
+
+	return result
+}
+
+// executeComparisonJump compares the two operands on top of the stack and reports
+// whether the fused jump has to be taken, which is when the comparison does not hold.
+func (vm *VM) executeComparisonJump(op code.Opcode) (bool, error) {
+	right := vm.pop()
+	left := vm.pop()
+
+	result := evaluator.InfixOperation(jumpOperators[op], left, right)
+	if err, ok := result.(*object.Error); ok {
+		return false, err
+	}
+
+	return !evaluator.IsTruthy(result), nil
+}
+
+// executePrefixOperation replaces the operand on top of the stack with the result of the operator.
+func (vm *VM) executePrefixOperation(operator string) error {
+	right := vm.pop()
+	if vm.strictBooleans && operator == "!" {
+		if err := evaluator.CheckBoolean("operand of !", right); err != nil {
+			return err
+		}
+	}
+
+	result := evaluator.PrefixOperation(operator, right)
+	if vm.checkedArithmetic {
+		result = evaluator.CheckOverflow(result, operator, right)
+	}
+	return vm.pushAllocated(result)
+}
+
+// executeIndexExpression pushes the element of the left object at the index.
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	return vm.pushResult(evaluator.IndexOperation(left, index))
+}
+
+// buildArray collects the stack slots from start up to end into an array.
+func (vm *VM) buildArray(start, end int) object.Object {
+	elements := make([]object.Object, end-start)
+	copy(elements, vm.stack[start:end])
+
+	return &object.Array{Elements: elements}
+}
+
+// pushResult pushes the result of an operation, failing with an error object as the runtime error.
+func (vm *VM) pushResult(result object.Object) error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+
+	return vm.push(result)
+}
+
+// pushAllocated pushes the result of an operation like pushResult, charging it against
+// the memory limit as a new object.
+func (vm *VM) pushAllocated(result object.Object) error {
+	if _, ok := result.(*object.Error); !ok {
+		if err := vm.charge(evaluator.AllocationSize(result)); err != nil {
+			return err
+		}
+	}
+
+	return vm.pushResult(result)
+}
+
+// executeCall calls the function below the arguments on top of the stack. A closure
+// gets a new frame whose locals start with the arguments, while a builtin is applied
+// right away and replaced by its result.
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		if numArgs != callee.Fn.NumParameters {
+			return fmt.Errorf("wrong number of arguments: want=%d, got=%d", callee.Fn.NumParameters, numArgs)
+		}
+
+		// a frame and its locals are charged like the environment of a call in the evaluator
+		if err := vm.charge(evaluator.ENVIRONMENT_SIZE + evaluator.ELEMENT_SIZE*callee.Fn.NumLocals); err != nil {
+			return err
+		}
+
+		frame := NewFrame(callee, vm.sp-numArgs)
+
+		// the other locals take the slots above the arguments, which have to fit on the stack
+		if err := vm.reserve(frame.basePointer + callee.Fn.NumLocals); err != nil {
+			return err
+		}
+		if err := vm.pushFrame(frame); err != nil {
+			return err
+		}
+
+		vm.sp = frame.basePointer + callee.Fn.NumLocals
+		return nil
+	case *object.Builtin:
+		// the arguments stay on the stack while the builtin runs, so the functions it
+		// calls back are pushed above them
+		arguments := vm.stack[vm.sp-numArgs : vm.sp]
+		var result object.Object
+		if callee.HigherOrderFn != nil {
+			result = callee.HigherOrderFn(vm.callFunction, arguments...)
+		} else if callee.ContextFn != nil {
+			result = callee.ContextFn(vm.ctx, arguments...)
+		} else {
+			result = callee.Fn(arguments...)
+		}
+
+		vm.sp = vm.sp - numArgs - 1
+		return vm.pushAllocated(result)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// callFunction calls a function for a builtin that calls back into the program, running
+// a closure until it returns before the builtin goes on. Errors are returned as objects,
+// which the builtin passes on.
+func (vm *VM) callFunction(function object.Object, args ...object.Object) object.Object {
+	if err := vm.push(function); err != nil {
+		return errorObject(err)
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return errorObject(err)
+		}
+	}
+
+	// a closure gets a frame to run, while a builtin has already pushed its result
+	depth := vm.framesIndex
+	if err := vm.executeCall(len(args)); err != nil {
+		return errorObject(err)
+	}
+	if vm.framesIndex > depth {
+		if err := vm.run(depth + 1); err != nil {
+			return errorObject(err)
+		}
+	}
+
+	return vm.pop()
+}
+
+// spawn starts a task that calls the closure without arguments on a virtual machine of
+// its own with the same limits, as the evaluator runs it in an evaluation of its own,
+// drawing on the budget of this one.
+// The task gets a copy of the globals, so neither it nor the program sees the globals
+// the other sets afterwards. Closures hold the values of their free variables, and the
+// other values are never changed in place, so those are shared.
+func (vm *VM) spawn(function object.Object) (*object.Task, error) {
+	if _, ok := function.(*object.Closure); !ok {
+		return nil, fmt.Errorf("cannot spawn %s", function.Type())
+	}
+
+	task := &VM{
+		constants:    vm.constants,
+		frames:       []*Frame{NewFrame(&object.Closure{Fn: &object.CompiledFunction{}}, 0)},
+		framesIndex:  1,
+		maxDepth:     vm.maxDepth,
+		stack:        make([]object.Object, min(INITIAL_STACK_SIZE, vm.maxStackSize)),
+		maxStackSize: vm.maxStackSize,
+		globals:      append([]object.Object(nil), vm.globals...),
+		builtins:     vm.builtins,
+		ctx:          vm.ctx,
+		budget:       vm.budget,
+		maxSteps:     vm.maxSteps,
+		maxMemory:    vm.maxMemory,
+
+		checkedArithmetic: vm.checkedArithmetic,
+		strictBooleans:    vm.strictBooleans,
+	}
+
+	return object.NewTask(func() object.Object {
+		return task.callFunction(function)
+	}), nil
+}
+
+// selectChannel waits for the first of the channels to give a value or be closed, and
+// returns its index with the value, or null if it was closed.
+func (vm *VM) selectChannel(objects []object.Object) (int, object.Object, error) {
+	channels := make([]*object.Channel, len(objects))
+	for i, obj := range objects {
+		channel, ok := obj.(*object.Channel)
+		if !ok {
+			return 0, nil, fmt.Errorf("select case must be CHANNEL, got %s", obj.Type())
+		}
+		channels[i] = channel
+	}
+
+	index, value, ok, err := object.Select(vm.ctx, channels)
+	if err != nil {
+		return 0, nil, &object.Error{Message: fmt.Sprintf("evaluation interrupted: %s", vm.ctx.Err()), Fatal: true}
+	}
+	if !ok {
+		return index, evaluator.NULL, nil
+	}
+	return index, value, nil
+}
+
+// errorObject returns a runtime error as an error object, keeping the one it is made
+// from if it is one, so that thrown values and fatal errors pass through builtins.
+func errorObject(err error) *object.Error {
+	if errObj, ok := err.(*object.Error); ok {
+		return errObj
+	}
+
+	return &object.Error{Message: err.Error()}
+}
+
+// pushClosure wraps the compiled function in the constants in a closure, capturing
+// the free values on top of the stack.
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	function, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", vm.constants[constIndex])
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	return vm.pushAllocated(&object.Closure{Fn: function, Free: free})
+}
@@ -0,0 +1,650 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// INITIAL_STACK_SIZE is the number of values the stack holds before it first grows.
+const INITIAL_STACK_SIZE = 256
+
+// MAX_STACK_SIZE is the number of values the stack can grow to, unless configured otherwise.
+const MAX_STACK_SIZE = 1 << 20
+
+// GLOBALS_SIZE is the number of global bindings, the most a two byte operand can address.
+const GLOBALS_SIZE = 65536
+
+// loadBuiltins looks up the builtin functions by their names in the compiler's order.
+// They are looked up for every machine, since packages may register more at startup.
+func loadBuiltins(lookup func(name string) (*object.Builtin, bool)) []*object.Builtin {
+	names := evaluator.BuiltinNames()
+
+	loaded := make([]*object.Builtin, len(names))
+	for i, name := range names {
+		loaded[i], _ = lookup(name)
+	}
+
+	return loaded
+}
+
+// Options configure a virtual machine.
+type Options struct {
+	// MaxDepth is the number of function calls that can be in progress at once, as in
+	// the evaluator: evaluator.DEFAULT_MAX_DEPTH if zero and unlimited if negative. A call
+	// beyond it fails with an error that try can catch.
+	MaxDepth int
+
+	// MaxStackSize is the number of values the stack can grow to, MAX_STACK_SIZE if zero.
+	// Pushing beyond it fails with a stack overflow.
+	MaxStackSize int
+
+	// MaxSteps is the number of instructions that can be executed, unlimited if zero. As
+	// in the evaluator, try can catch the error of going beyond it, but the handler fails
+	// in turn at its first instruction.
+	MaxSteps int
+
+	// MaxMemory is the approximate number of bytes of objects that can be allocated,
+	// as estimated by evaluator.AllocationSize, unlimited if zero. Every allocation
+	// after a caught error of going beyond it fails again.
+	MaxMemory int
+
+	// Sandbox leaves out the builtins with side effects, which fail when called.
+	Sandbox bool
+
+	// Output receives what puts and printf print, in place of standard output, when set,
+	// as it does in the evaluator.
+	Output io.Writer
+
+	// AllowExec lets programs run commands with the exec builtin, which otherwise fails
+	// when called. Sandbox mode leaves it out regardless.
+	AllowExec bool
+
+	// CheckedArithmetic makes integer arithmetic that overflows fail with an error
+	// instead of producing a big integer, as it does in the evaluator.
+	CheckedArithmetic bool
+
+	// StrictBooleans makes conditions and the operand of ! fail with an error unless they
+	// are booleans, as it does in the evaluator.
+	StrictBooleans bool
+}
+
+// VM runs the bytecode produced by the compiler. It shares the evaluator's true, false,
+// and null objects and applies operators through the evaluator, so both agree on results.
+type VM struct {
+	constants []object.Object
+
+	// the program itself runs in the first frame, as a function without parameters
+	frames      []*Frame
+	framesIndex int
+	maxDepth    int // zero if unlimited
+
+	// the stack doubles in size whenever it is full, up to maxStackSize
+	stack        []object.Object
+	sp           int // the next free slot, so the top of the stack is stack[sp-1]
+	maxStackSize int
+
+	globals  []object.Object
+	builtins []*object.Builtin
+
+	// checkedArithmetic fails integer arithmetic that overflows instead of making it big
+	checkedArithmetic bool
+
+	// strictBooleans fails conditions and operands of ! that are not booleans
+	strictBooleans bool
+
+	// result is the value of a top-level return, which ends the program
+	result object.Object
+
+	// handlers holds the try expressions whose bodies are running, innermost last
+	handlers []handler
+
+	// ctx cancels the run, checked at every call and backward jump
+	ctx context.Context
+
+	// what the run and its tasks have used so far, counted against the limits of the options
+	budget    *evaluator.Budget
+	maxSteps  int
+	maxMemory int
+}
+
+// handler is where the run goes on when an instruction fails inside the body of a try:
+// the frame and the size of the stack at the OpTry, and the offset of the handler.
+type handler struct {
+	framesIndex int
+	sp          int
+	ip          int
+}
+
+// New creates a virtual machine for the bytecode with empty globals.
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GLOBALS_SIZE))
+}
+
+// NewWithGlobalsStore creates a virtual machine that keeps its globals in the given
+// store, so they survive from one program to the next as in the REPL.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	return NewWithOptions(bytecode, globals, Options{})
+}
+
+// NewWithOptions creates a virtual machine with the given globals store, configured by the options.
+func NewWithOptions(bytecode *compiler.Bytecode, globals []object.Object, options Options) *VM {
+	if options.MaxStackSize <= 0 {
+		options.MaxStackSize = MAX_STACK_SIZE
+	}
+
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	// frames are allocated as calls get deeper, so a generous limit costs nothing up front
+	frames := []*Frame{NewFrame(mainClosure, 0)}
+
+	builtinOptions := evaluator.Options{Sandbox: options.Sandbox, AllowExec: options.AllowExec, Output: options.Output}
+	lookup := func(name string) (*object.Builtin, bool) {
+		return evaluator.LookupBuiltinWith(name, builtinOptions)
+	}
+
+	return &VM{
+		constants:    bytecode.Constants,
+		frames:       frames,
+		framesIndex:  1,
+		maxDepth:     evaluator.MaxDepth(evaluator.Options{MaxDepth: options.MaxDepth}),
+		stack:        make([]object.Object, min(INITIAL_STACK_SIZE, options.MaxStackSize)),
+		sp:           0,
+		maxStackSize: options.MaxStackSize,
+		globals:      globals,
+		builtins:     loadBuiltins(lookup),
+		budget:       &evaluator.Budget{},
+		maxSteps:     options.MaxSteps,
+		maxMemory:    options.MaxMemory,
+
+		checkedArithmetic: options.CheckedArithmetic,
+		strictBooleans:    options.StrictBooleans,
+	}
+}
+
+// StackTop returns the object on top of the stack, or nil if the stack is empty.
+func (vm *VM) StackTop() object.Object {
+	if vm.sp == 0 {
+		return nil
+	}
+
+	return vm.stack[vm.sp-1]
+}
+
+// LastPoppedStackElem returns the value of the program: the last object popped off
+// the stack, or the value of the return statement that ended it.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.result != nil {
+		return vm.result
+	}
+	if vm.sp >= len(vm.stack) {
+		return nil
+	}
+
+	return vm.stack[vm.sp]
+}
+
+// Run executes the instructions, stopping at the first runtime error.
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext executes the instructions like Run, failing as soon as the context is
+// cancelled. The context is checked whenever a function is called or a jump goes
+// backward, so any program that runs for long keeps checking it.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.ctx = ctx
+	return vm.run(1)
+}
+
+// run executes instructions until the frame at the depth, the number of frames there are
+// with it, returns, or the program ends when the depth is 1. An error inside a try of
+// one of those frames goes on at its handler.
+func (vm *VM) run(depth int) error {
+	for {
+		err := vm.execute(depth)
+		if err == nil {
+			return nil
+		}
+
+		err = vm.locate(err)
+		if !vm.catch(err, depth) {
+			return err
+		}
+	}
+}
+
+// locate places an error that has no position yet at the instruction that failed, with
+// the calls of the frames it happened inside of as its stack trace, innermost first, as
+// the evaluator does. It is called while the frames are still those of the failure.
+// Errors from runs for functions that builtins call back are located by the inner run.
+func (vm *VM) locate(err error) error {
+	errObj := errorObject(err)
+	if errObj.Line != 0 {
+		return errObj
+	}
+
+	errObj.Line, errObj.Column = vm.currentFrame().position()
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		line, column := vm.frames[i-1].position()
+		if line == 0 {
+			continue
+		}
+		errObj.Trace = append(errObj.Trace, object.Call{Function: vm.frames[i].cl.Fn.Name, Line: line, Column: column})
+	}
+
+	return errObj
+}
+
+// catch unwinds the run at the depth to the handler of the innermost try, with the
+// error it caught on the stack, and reports whether there was one to catch the error.
+// Fatal errors and the tries of the frames of an outer run are left alone.
+func (vm *VM) catch(err error, depth int) bool {
+	errObj := errorObject(err)
+	if errObj.Fatal || len(vm.handlers) == 0 {
+		return false
+	}
+
+	handler := vm.handlers[len(vm.handlers)-1]
+	if handler.framesIndex < depth {
+		return false
+	}
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.framesIndex = handler.framesIndex
+	vm.sp = handler.sp
+	// the loop moves past the instruction it is at before executing the next one
+	vm.currentFrame().ip = handler.ip - 1
+
+	return vm.push(evaluator.CaughtValue(errObj)) == nil
+}
+
+// execute runs the instructions of run, stopping at the first error.
+func (vm *VM) execute(depth int) error {
+	for vm.framesIndex >= depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if err := vm.step(); err != nil {
+			return err
+		}
+
+		vm.currentFrame().ip++
+
+		ip := vm.currentFrame().ip
+		instructions := vm.currentFrame().Instructions()
+		op := code.Opcode(instructions[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(instructions[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+		case code.OpPop:
+			vm.pop()
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterThanOrEqual, code.OpLessThanOrEqual:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+		case code.OpBang:
+			if err := vm.executePrefixOperation("!"); err != nil {
+				return err
+			}
+		case code.OpMinus:
+			if err := vm.executePrefixOperation("-"); err != nil {
+				return err
+			}
+		case code.OpTrue:
+			if err := vm.push(evaluator.TRUE); err != nil {
+				return err
+			}
+		case code.OpFalse:
+			if err := vm.push(evaluator.FALSE); err != nil {
+				return err
+			}
+		case code.OpNull:
+			if err := vm.push(evaluator.NULL); err != nil {
+				return err
+			}
+		case code.OpJump:
+			position := int(code.ReadUint16(instructions[ip+1:]))
+			if position <= ip {
+				if err := vm.interrupted(); err != nil {
+					return err
+				}
+			}
+
+			// the loop increments ip, so stop just before the target
+			vm.currentFrame().ip = position - 1
+		case code.OpJumpNotNull:
+			position := int(code.ReadUint16(instructions[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if vm.stack[vm.sp-1] != evaluator.NULL {
+				vm.currentFrame().ip = position - 1
+			} else {
+				vm.pop()
+			}
+		case code.OpJumpNull:
+			position := int(code.ReadUint16(instructions[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if vm.stack[vm.sp-1] == evaluator.NULL {
+				vm.currentFrame().ip = position - 1
+			}
+		case code.OpJumpNotTruthy:
+			position := int(code.ReadUint16(instructions[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if vm.strictBooleans {
+				if err := evaluator.CheckBoolean("condition", condition); err != nil {
+					return err
+				}
+			}
+			if !evaluator.IsTruthy(condition) {
+				vm.currentFrame().ip = position - 1
+			}
+		case code.OpJumpNotEqual, code.OpJumpEqual, code.OpJumpNotGreaterThan, code.OpJumpNotLessThan,
+			code.OpJumpNotGreaterThanOrEqual, code.OpJumpNotLessThanOrEqual:
+			position := int(code.ReadUint16(instructions[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			jump, err := vm.executeComparisonJump(op)
+			if err != nil {
+				return err
+			}
+			if jump {
+				vm.currentFrame().ip = position - 1
+			}
+		case code.OpGetLocalConstantAdd, code.OpGetLocalConstantSub:
+			localIndex := code.ReadUint8(instructions[ip+1:])
+			constIndex := code.ReadUint16(instructions[ip+2:])
+			vm.currentFrame().ip += 3
+
+			left := vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			if err := vm.pushAllocated(vm.infixOperation(superinstructionOperators[op], left, vm.constants[constIndex])); err != nil {
+				return err
+			}
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(instructions[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(instructions[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.globals[globalIndex]); err != nil {
+				return err
+			}
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(instructions[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(instructions[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			if err := vm.push(vm.stack[frame.basePointer+int(localIndex)]); err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(instructions[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.builtins[builtinIndex]); err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(instructions[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.currentFrame().cl.Free[freeIndex]); err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := int(code.ReadUint16(instructions[ip+1:]))
+			numFree := int(code.ReadUint8(instructions[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(constIndex, numFree); err != nil {
+				return err
+			}
+		case code.OpCurrentClosure:
+			if err := vm.push(vm.currentFrame().cl); err != nil {
+				return err
+			}
+		case code.OpArray:
+			numElements := int(code.ReadUint16(instructions[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err := vm.pushAllocated(array); err != nil {
+				return err
+			}
+		case code.OpHash:
+			numKeysAndValues := int(code.ReadUint16(instructions[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			keysAndValues := make([]object.Object, numKeysAndValues)
+			copy(keysAndValues, vm.stack[vm.sp-numKeysAndValues:vm.sp])
+			vm.sp = vm.sp - numKeysAndValues
+
+			if err := vm.pushAllocated(evaluator.NewHash(keysAndValues)); err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+		case code.OpTry:
+			handlerIP := int(code.ReadUint16(instructions[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, handler{framesIndex: vm.framesIndex, sp: vm.sp, ip: handlerIP})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			if err := vm.pushAllocated(evaluator.SliceOperation(left, start, end)); err != nil {
+				return err
+			}
+		case code.OpMethod:
+			constIndex := code.ReadUint16(instructions[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[constIndex].(*object.String).Value
+			if err := vm.pushResult(evaluator.MethodOperation(vm.pop(), name)); err != nil {
+				return err
+			}
+		case code.OpSpawn:
+			task, err := vm.spawn(vm.pop())
+			if err != nil {
+				return err
+			}
+			if err := vm.push(task); err != nil {
+				return err
+			}
+		case code.OpSelect:
+			numChannels := int(code.ReadUint8(instructions[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			index, value, err := vm.selectChannel(vm.stack[vm.sp-numChannels : vm.sp])
+			if err != nil {
+				return err
+			}
+			vm.sp -= numChannels
+			if err := vm.push(value); err != nil {
+				return err
+			}
+
+			// the loop increments ip, so stop just before the OpJump of the channel
+			vm.currentFrame().ip += index * len(code.Make(code.OpJump, 0))
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(instructions[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			if err := vm.interrupted(); err != nil {
+				return err
+			}
+			if err := vm.executeCall(numArgs); err != nil {
+				return err
+			}
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// outside of a function a return ends the program
+			if vm.framesIndex == 1 {
+				vm.result = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			// drop the locals and the function itself
+			vm.sp = frame.basePointer - 1
+			vm.dropHandlers()
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			vm.dropHandlers()
+
+			if err := vm.push(evaluator.NULL); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("opcode %d undefined", op)
+		}
+	}
+
+	return nil
+}
+
+// step counts an instruction executed, failing once there are more than the limit allows.
+func (vm *VM) step() error {
+	if err := vm.budget.Step(vm.maxSteps); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// charge adds bytes to the memory the run has allocated so far, failing once it is
+// more than the limit allows. As in the evaluator, memory is never given back.
+func (vm *VM) charge(size int) error {
+	if err := vm.budget.Charge(size, vm.maxMemory); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// interrupted returns an error if the context of the run has been cancelled, with
+// the message the evaluator gives.
+func (vm *VM) interrupted() error {
+	select {
+	case <-vm.ctx.Done():
+		return &object.Error{Message: fmt.Sprintf("evaluation interrupted: %s", vm.ctx.Err()), Fatal: true}
+	default:
+		return nil
+	}
+}
+
+// dropHandlers forgets the tries of the frames that have returned from inside their bodies.
+func (vm *VM) dropHandlers() {
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex > vm.framesIndex {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+}
+
+// currentFrame returns the frame of the function being executed.
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+// pushFrame makes the frame the current one, failing once the calls in progress, which
+// are the frames but the first, reach the depth limit.
+func (vm *VM) pushFrame(frame *Frame) error {
+	if vm.maxDepth > 0 && vm.framesIndex-1 >= vm.maxDepth {
+		return &object.Error{Message: fmt.Sprintf("maximum recursion depth exceeded: %d calls", vm.maxDepth)}
+	}
+
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, frame)
+	} else {
+		vm.frames[vm.framesIndex] = frame
+	}
+	vm.framesIndex++
+
+	return nil
+}
+
+// popFrame leaves the current frame and returns it.
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// push puts an object on top of the stack.
+func (vm *VM) push(obj object.Object) error {
+	if err := vm.reserve(vm.sp + 1); err != nil {
+		return err
+	}
+
+	vm.stack[vm.sp] = obj
+	vm.sp++
+
+	return nil
+}
+
+// reserve grows the stack until it holds size values, failing beyond the maximum size.
+func (vm *VM) reserve(size int) error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+	if size > vm.maxStackSize {
+		return &object.Error{Message: "stack overflow", Fatal: true}
+	}
+
+	capacity := len(vm.stack)
+	for capacity < size {
+		capacity *= 2
+	}
+
+	stack := make([]object.Object, min(capacity, vm.maxStackSize))
+	copy(stack, vm.stack)
+	vm.stack = stack
+
+	return nil
+}
+
+// pop removes the object on top of the stack and returns it. The slot keeps
+// the object so LastPoppedStackElem can still find it.
+func (vm *VM) pop() object.Object {
+	obj := vm.stack[vm.sp-1]
+	vm.sp--
+
+	return obj
+}
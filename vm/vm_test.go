@@ -0,0 +1,745 @@
+package vm
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-10 + 100 + -50", 40},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"17 % 5 * 2", 4},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 <= 2", true},
+		{"2 <= 1", false},
+		{"2 >= 2", true},
+		{"1 >= 2", false},
+		{`"a" <= "b"`, true},
+		{`"a" >= "b"`, false},
+		{"true == false", false},
+		{"(1 < 2) == true", true},
+		{"!true", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", evaluator.NULL},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (2 <= 2) { 10 } else { 20 }", 10},
+		{"if (1 >= 2) { 10 } else { 20 }", 20},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 1; let x = x + 1; x", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringsArraysAndIndexes(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mon" + "key"`, "monkey"},
+		{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+		{"[]", []int{}},
+		{"[1, 2, 3][1]", 2},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[1, 2, 3][99]", evaluator.NULL},
+		{"[1][-1]", evaluator.NULL},
+		{`"monkey"[-1]`, "y"},
+		{`"monkey"[7]`, evaluator.NULL},
+		{`"monkey"[1:4]`, "onk"},
+		{`"monkey"[:-3]`, "mon"},
+		{`"monkey"[3:]`, "key"},
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3][:]", []int{1, 2, 3}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 10; 9;", 10},
+		{"if (true) { return 1; }; 2", 1},
+		{"9; return 2 * 5; 9;", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let one = fn() { 1; }; let two = fn() { one() + 1; }; two() + one()", 3},
+		{"let early = fn() { return 99; 100; }; early();", 99},
+		{"let noReturn = fn() { }; noReturn();", evaluator.NULL},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);", 10},
+		{"let returnsOne = fn() { 1; }; let returner = fn() { returnsOne; }; returner()();", 1},
+		{"let apply = fn(f, x) { f(x) }; apply(fn(n) { n * 2 }, 21)", 42},
+		{"len([1, 2, 3])", 3},
+		{`let f = fn(s) { len(s) }; f("four")`, 4},
+		{`puts("")`, evaluator.NULL},
+		{"first([1, 2, 3])", 1},
+		{"last([1, 2, 3])", 3},
+		{"rest([1, 2, 3])", []int{2, 3}},
+		{"rest([])", evaluator.NULL},
+		{"let a = [1]; push(a, 2); a", []int{1}},
+		{"push(pop([1, 2, 3]), 4)", []int{1, 2, 4}},
+		{"concat([1], [2, 3])", []int{1, 2, 3}},
+		{"map([1, 2, 3], fn(x) { x * 2 })", []int{2, 4, 6}},
+		{"let n = 10; map([1, 2], fn(x) { x + n })", []int{11, 12}},
+		{"let f = fn(k) { map([1, 2], fn(x) { x * k }) }; f(3)", []int{3, 6}},
+		{`map(["a", "bc"], len)`, []int{1, 2}},
+		{"map([[1], [2, 3]], fn(a) { reduce(a, 0, fn(s, x) { s + x }) })", []int{1, 5}},
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", []int{3, 4}},
+		{"reduce([1, 2, 3], 0, fn(sum, x) { sum + x })", 6},
+		{"sort([3, 1, 2])", []int{1, 2, 3}},
+		{"type(fn() { 1 })", "FUNCTION"},
+		{"let f = fn(x) { fn() { x } }; type(f(1))", "FUNCTION"},
+		{"sort([3, 1, 2], fn(a, b) { b - a })", []int{3, 2, 1}},
+		{"let key = fn(x) { -x }; sort([1, 3, 2], fn(a, b) { key(a) < key(b) })", []int{3, 2, 1}},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; map([3, 4], fact)", []int{6, 24}},
+		{"let f = fn() { let xs = map([1], fn(x) { return x + 1; }); first(xs) + 1 }; f()", 3},
+		{`values(merge(json_parse("{\"b\": 1}"), json_parse("{\"a\": 2}")))`, []int{2, 1}},
+		{`let h = json_parse("{\"a\": 1}"); len(delete(h, "a")) + len(keys(h))`, 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLocalBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = fn() { let one = 1; one }; one();", 1},
+		{"let g = 50; let minusOne = fn() { let num = 1; g - num; }; minusOne();", 49},
+		// a local never touches the global of the same name
+		{"let x = 1; let f = fn() { let x = 2; x }; f() + x", 3},
+		{"let f = fn(a) { let b = a * 2; let a = b + 1; a }; f(1) + f(2)", 8},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();", 99},
+		{"let newAdder = fn(a, b) { fn(c) { a + b + c }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{"let newAdder = fn(a, b) { let c = a + b; fn(d) { c + d }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{`
+		let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) {
+				let e = d + c;
+				fn(f) { e + f; };
+			};
+		};
+		let newAdderInner = newAdderOuter(1, 2);
+		let adder = newAdderInner(3);
+		adder(8);`, 14},
+		{"let a = 1; let newAdder = fn(b) { fn(c) { a + b + c }; }; newAdder(2)(8);", 11},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } }; countDown(1);", 0},
+		{`
+		let fibonacci = fn(x) {
+			if (x == 0) { return 0; }
+			if (x == 1) { return 1; }
+			fibonacci(x - 1) + fibonacci(x - 2);
+		};
+		fibonacci(15);`, 610},
+		{`
+		let wrapper = fn() {
+			let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			countDown(1);
+		};
+		wrapper();`, 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"1 < true", "type mismatch: INTEGER < BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{"true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{`if ("a" >= 1) { 10 }`, "type mismatch: STRING >= INTEGER"},
+		{"{[1]: 2}", "unusable as hash key: ARRAY"},
+		{"fn() { 1; }(1);", "wrong number of arguments: want=0, got=1"},
+		{"fn(a, b) { a + b; }(1);", "wrong number of arguments: want=2, got=1"},
+		{"1()", "not a function: INTEGER"},
+		{"let f = fn(x) { 10 / x }; f(0)", "division by zero"},
+		{"10 % 0", "modulo by zero"},
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+		{"push(1, 1)", "argument to `push` must be ARRAY, got INTEGER"},
+		{`map([1, "a"], fn(x) { -x })`, "unknown operator: -STRING"},
+		{"map([1], fn(a, b) { a })", "wrong number of arguments: want=2, got=1"},
+	}
+
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+
+		err := vm.Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxDepth int
+		expected string
+	}{
+		{"let f = fn(n) { f(n + 1) }; f(0)", 0, "maximum recursion depth exceeded: 10000 calls"},
+		{"let f = fn() { let a = 1; let b = 2; let c = 3; f() }; f()", 20, "maximum recursion depth exceeded: 20 calls"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(20)", 10, "maximum recursion depth exceeded: 10 calls"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(9)", 10, ""},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(2000)", 0, ""},
+		// without a limit the stack runs out instead
+		{"let f = fn(n) { f(n + 1) }; f(0)", -1, "stack overflow"},
+	}
+
+	for _, tt := range tests {
+		machine := NewWithOptions(compile(t, tt.input), make([]object.Object, GLOBALS_SIZE), Options{MaxDepth: tt.maxDepth})
+
+		err := machine.Run()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRunContextCancellation(t *testing.T) {
+	// doubling calls take far longer than the deadline without ever getting deep
+	input := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(60)"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := New(compile(t, input)).RunContext(ctx)
+
+	expected := "evaluation interrupted: context deadline exceeded"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%v", expected, err)
+	}
+
+	// a cancelled context stops the program at its first call
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	machine := New(compile(t, "let x = 1; fn() { 2 }(); x"))
+	if err := machine.RunContext(ctx); err == nil || err.Error() != "evaluation interrupted: context canceled" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	// the builtins that wait stop waiting too
+	for _, input := range []string{`sleep(60000)`, `exec("sleep", ["60"])`} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		start := time.Now()
+		machine := NewWithOptions(compile(t, input), make([]object.Object, GLOBALS_SIZE), Options{AllowExec: true})
+		err := machine.RunContext(ctx)
+		cancel()
+
+		if err == nil || err.Error() != expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", input, expected, err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("%q ran on for %s after the timeout", input, elapsed)
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 + "a" } catch (e) { e["message"] }`, "type mismatch: INTEGER + STRING"},
+		{`try { throw(error("boom", 42)) } catch (e) { e["data"] }`, 42},
+		{`try { } catch (e) { 2 }`, evaluator.NULL},
+		{`1 + try { throw(1) } catch (e) { e + 1 }`, 3},
+		{`let f = fn() { throw(error("deep")) }; let g = fn() { f() }; try { g() } catch (e) { e["message"] }`, "deep"},
+		{`let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f()`, 1},
+		// a try left by a return does not catch what fails after it
+		{`let f = fn() { try { return 1; } catch (e) { 2 } }; try { f(); throw(5) } catch (e) { e }`, 5},
+		{`let f = fn(x) { try { throw(x) } catch (e) { let y = e * 2; y } }; f(1) + f(2)`, 6},
+		{`try { throw(1) } catch (e) { try { throw(e + 1) } catch (e) { e * 10 } }`, 20},
+		{`map([1, 0], fn(x) { try { if (x == 0) { throw(9) } else { x } } catch (e) { e } })`, []int{1, 9}},
+		{`try { map([1, 0], fn(x) { if (x == 0) { throw(7) } else { x } }) } catch (e) { e }`, 7},
+		{`let g = fn(x) { try { if (x > 0) { g(x - 1) } else { throw(3) } } catch (e) { e } }; g(3)`, 3},
+	}
+
+	runVmTests(t, tests)
+
+	machine := New(compile(t, `try { throw(1) } catch (e) { throw(error("again")) }`))
+	if err := machine.Run(); err == nil || err.Error() != "again" {
+		t.Errorf("expected the error of the handler. got=%v", err)
+	}
+
+	// the step limit can be caught, but the handler fails in turn
+	input := `let f = fn(n) { f(n + 1) }; try { f(0) } catch (e) { 0 }`
+	machine = NewWithOptions(compile(t, input), make([]object.Object, GLOBALS_SIZE), Options{MaxSteps: 50})
+	if err := machine.Run(); err == nil || err.Error() != "step limit exceeded: 50 steps" {
+		t.Errorf("expected the step limit to be exceeded again. got=%v", err)
+	}
+
+	// the depth limit can be caught, as in the evaluator
+	machine = NewWithOptions(compile(t, input), make([]object.Object, GLOBALS_SIZE), Options{MaxDepth: 20})
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, input, 0, machine.LastPoppedStackElem())
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		options  Options
+		expected string
+	}{
+		{"let f = fn(n) { f(n + 1) }; f(0)", Options{MaxSteps: 50}, "step limit exceeded: 50 steps"},
+		{"let f = fn(s) { f(s + s) }; f(\"ab\")", Options{MaxMemory: 4096}, "memory limit exceeded: 4096 bytes"},
+		{"let f = fn(a) { f([a, a]) }; f(1)", Options{MaxMemory: 4096}, "memory limit exceeded: 4096 bytes"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(5)", Options{MaxSteps: 200, MaxMemory: 1024}, ""},
+		// tasks draw on the budget of the program that spawns them
+		{"let f = fn() { let g = fn(n) { if (n == 0) { 0 } else { g(n - 1) } }; g(50) }; [spawn f].map(fn(t) { t.join() })[0]", Options{MaxSteps: 1000}, ""},
+		{"let f = fn() { let g = fn(n) { if (n == 0) { 0 } else { g(n - 1) } }; g(50) }; [spawn f, spawn f, spawn f, spawn f].map(fn(t) { t.join() })", Options{MaxSteps: 1000}, "step limit exceeded: 1000 steps"},
+		{"let f = fn() { let g = fn(s, n) { if (n == 0) { 0 } else { g(s + \"xxxxxxxxxx\", n - 1) } }; g(\"\", 40) }; [spawn f].map(fn(t) { t.join() })[0]", Options{MaxMemory: 20000}, ""},
+		{"let f = fn() { let g = fn(s, n) { if (n == 0) { 0 } else { g(s + \"xxxxxxxxxx\", n - 1) } }; g(\"\", 40) }; [spawn f, spawn f, spawn f, spawn f].map(fn(t) { t.join() })", Options{MaxMemory: 20000}, "memory limit exceeded: 20000 bytes"},
+	}
+
+	for _, tt := range tests {
+		machine := NewWithOptions(compile(t, tt.input), make([]object.Object, GLOBALS_SIZE), tt.options)
+
+		err := machine.Run()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 * 2", "integer overflow: 9223372036854775807 * 2"},
+		{"let f = fn(x) { x + 1 }; f(9223372036854775807)", "integer overflow: 9223372036854775807 + 1"},
+		{"let m = -9223372036854775807 - 1; -m", "integer overflow: -(-9223372036854775808)"},
+		{"big(9223372036854775807) + 1", ""},
+	}
+
+	for _, tt := range tests {
+		machine := NewWithOptions(compile(t, tt.input), make([]object.Object, GLOBALS_SIZE), Options{CheckedArithmetic: true})
+
+		err := machine.Run()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestStrictBooleans(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (1) { 10 }", "condition must be BOOLEAN, got INTEGER"},
+		{"let f = fn(x) { if (x) { 1 } else { 2 } }; f([])", "condition must be BOOLEAN, got ARRAY"},
+		{`!"a"`, "operand of ! must be BOOLEAN, got STRING"},
+		{"if (1 < 2) { 10 }", ""},
+		{"if (!(1 == 2)) { 10 }", ""},
+	}
+
+	for _, tt := range tests {
+		machine := NewWithOptions(compile(t, tt.input), make([]object.Object, GLOBALS_SIZE), Options{StrictBooleans: true})
+
+		err := machine.Run()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	machine := NewWithOptions(compile(t, `len("pure"); puts("escaped")`), make([]object.Object, GLOBALS_SIZE), Options{Sandbox: true})
+	if err := machine.Run(); err == nil || err.Error() != "puts is not available in sandbox mode" {
+		t.Errorf("expected sandbox error. got=%v", err)
+	}
+
+	machine = NewWithOptions(compile(t, `len("pure")`), make([]object.Object, GLOBALS_SIZE), Options{Sandbox: true})
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, `len("pure")`, 4, machine.LastPoppedStackElem())
+
+	// what programs print reaches only the host when it takes the output
+	var output strings.Builder
+	machine = NewWithOptions(compile(t, `puts("kept")`), make([]object.Object, GLOBALS_SIZE), Options{Sandbox: true, Output: &output})
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if output.String() != "kept\n" {
+		t.Errorf("wrong output. got=%q", output.String())
+	}
+}
+
+func TestExec(t *testing.T) {
+	input := `exec("sh", ["-c", "exit 3"])["code"]`
+
+	machine := NewWithOptions(compile(t, input), make([]object.Object, GLOBALS_SIZE), Options{AllowExec: true})
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, input, 3, machine.LastPoppedStackElem())
+
+	machine = New(compile(t, input))
+	if err := machine.Run(); err == nil || err.Error() != "exec is not enabled" {
+		t.Errorf("expected exec to be disabled. got=%v", err)
+	}
+
+	machine = NewWithOptions(compile(t, input), make([]object.Object, GLOBALS_SIZE), Options{Sandbox: true, AllowExec: true})
+	if err := machine.Run(); err == nil || err.Error() != "exec is not available in sandbox mode" {
+		t.Errorf("expected sandbox error. got=%v", err)
+	}
+}
+
+func TestStackGrowth(t *testing.T) {
+	// more values than the stack starts with are pushed at once
+	input := "[" + strings.Repeat("1, ", 5000) + "1]"
+
+	machine := New(compile(t, input))
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if array, ok := machine.LastPoppedStackElem().(*object.Array); !ok || len(array.Elements) != 5001 {
+		t.Errorf("wrong result. got=%T", machine.LastPoppedStackElem())
+	}
+
+	machine = NewWithOptions(compile(t, input), make([]object.Object, GLOBALS_SIZE), Options{MaxStackSize: 1000})
+	if err := machine.Run(); err == nil || err.Error() != "stack overflow" {
+		t.Errorf("expected stack overflow. got=%v", err)
+	}
+
+	// locals are reserved on the stack as well
+	input = "let f = fn() { let a = 1; let b = 2; a + b }; f()"
+	machine = NewWithOptions(compile(t, input), make([]object.Object, GLOBALS_SIZE), Options{MaxStackSize: 2})
+	if err := machine.Run(); err == nil || err.Error() != "stack overflow" {
+		t.Errorf("expected stack overflow. got=%v", err)
+	}
+}
+
+// TestMatchesEvaluator runs programs through both engines and compares what they produce.
+func TestMatchesEvaluator(t *testing.T) {
+	inputs := []string{
+		"1 + 2 * 3 - 4 / 2",
+		"let a = 5; let b = a * 2; [a, b, a + b]",
+		`let s = "hello"; s + " " + s == "hello hello"`,
+		"if (0) { 1 } else { 2 }",
+		`if ("") { "truthy" }`,
+		"!!(if (false) { 1 })",
+		"[1, [2, 3]][1][0] == 2",
+		"1 == true",
+		`[1, "two", true, if (false) { 1 }]`,
+		"let x = 10; if (x > 5) { return x * 2; }; x",
+		"let f = len; [f, puts]",
+		"let len = 1; len",
+		"let add = fn(a, b) { a + b }; add(1, 2) * add(3, 4)",
+		"let f = fn(x) { if (x > 1) { return x; } 0 }; [f(1), f(2)]",
+		"let g = 1; let f = fn() { let g = 2; g }; [f(), g]",
+		"let f = fn() { }; f() == f()",
+		"fn(x) { x }(1, 2)",
+		"let adder = fn(a) { fn(b) { a + b } }; let addTwo = adder(2); [addTwo(1), adder(10)(5)]",
+		"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(10)",
+		`len("abc", "d")`,
+		"9223372036854775807 + 1",
+		"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(25)",
+		"big(2) * 3 > 5",
+		"[1, [2, 3]] == [1, [2, 3]]",
+		"[1 ?? 2, if (false) { 1 } ?? 2, false ?? 3]",
+		"let f = fn(x) { x ?? 0 }; f(if (false) { 1 }) + f(5)",
+		`[[3, 1, 2].sort().len(), "Hi".upper(), [1, 2].map(fn(x) { x + 1 }), [1].first()]`,
+		`"a".nope()`,
+		"let f = fn() { let x = 1; let g = fn() { x }; let x = 2; [g(), x] }; f()",
+		"let a = freeze([1, [2]]); let b = clone(a); [b == a, is_frozen(b[1])]",
+		"let a = freeze([1, [2]]); [is_frozen(a), is_frozen(a[1]), is_frozen(push(a, 3))]",
+		`let b = b"\x00\x01AB"; [b, len(b), b[-1], b[1:3], b + b"z", b == b"\x00\x01AB", to_bytes("hi").hex_encode()]`,
+		`[if ("apple" < "banana") { 1 } else { 2 }, "b" > "a", "a" > "ab"]`,
+		`let none = if (false) { 1 }; [none?[0], none?[1:], none?(1), [1, 2]?[1], len?("ab"), none?[0]?[1] ?? 3]`,
+		`if ([1] != [1, 2]) { "different" }`,
+		"let x = 1; let t = spawn fn() { x + 1 }; let x = 5; [t.join(), t.result(), x]",
+		"let f = fn(n) { spawn fn() { n * 2 } }; map([f(1), f(2)], fn(t) { t.join() })",
+		`let t = spawn fn() { 1 / 0 }; try { t.join() } catch (e) { e["message"] }`,
+		"spawn 1",
+		"let ch = channel(); let t = spawn fn() { ch.recv() * 2 }; ch.send(21); [t.join(), close(ch), recv(ch)]",
+		"let ch = channel(1); close(ch); send(ch, 1)",
+		"let a = channel(1); let b = channel(1); send(b, 2); [select { v = a => v, v = b => v * 10 }, select { a => 1, timeout(10) => 2 }]",
+		"let f = fn(ch) { select { x = ch => { let y = x + 1; y }, timeout(5000) => 0 } }; let ch = channel(); spawn fn() { send(ch, 5) }; f(ch)",
+		"let a = channel(); close(a); [select { a => {} }, select { v = a => v ?? 3 }]",
+		"select { 1 => 2 }",
+		`{}`,
+		`let two = "two"; {"one": 10 - 9, two: 1 + 1, 3: [3], true: {"x": [1]}}`,
+		`let h = {"a": 1, "a": 2, "b": {"c": [3]}}; [h["a"], h["b"]["c"][0], h?["z"], h["b"]?["c"]]`,
+		`let f = fn(x) { {"x": x, "y": fn() { x * 2 }} }; [f(3)["x"], f(4)["y"]()]`,
+		"{[1]: 2}",
+	}
+
+	for _, input := range inputs {
+		program := parse(input)
+
+		expected := evaluator.Eval(program, object.NewEnvironment())
+
+		var actual object.Object
+		vm := New(compile(t, input))
+		if err := vm.Run(); err != nil {
+			actual = &object.Error{Message: err.Error()}
+		} else {
+			actual = vm.LastPoppedStackElem()
+		}
+
+		if expected.Type() != actual.Type() || expected.Inspect() != actual.Inspect() {
+			t.Errorf("engines disagree on %q. evaluator=%s, vm=%s", input, expected.Inspect(), actual.Inspect())
+		}
+	}
+}
+
+// TestOptimizedMatchesUnoptimized runs programs with and without the peephole optimizations.
+func TestOptimizedMatchesUnoptimized(t *testing.T) {
+	inputs := []string{
+		"if (1 < 2) { 10 } else { 20 }",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (1 == 1) { if (2 != 2) { 1 } else { 2 } } else { 3 }",
+		"let f = fn(x) { x; 1; if (x == 1) { 2 } }; [f(1), f(2)]",
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)",
+		"let a = 1; a; a; 3",
+		"let f = fn(x) { x ?? 1; x ?? 2 }; [f(if (false) { 0 }), f(3)]",
+		`if ("a" == "a") { 1 }`,
+		`let f = fn(s, n) { [s + "!", n - 1, n + 1] }; f("a", 1)`,
+		"let a = channel(1); send(a, 1); let f = fn(x) { select { v = a => if (v == x) { 1 } else { 2 }, b = timeout(10) => { b; 3 } } }; [f(1), f(1)]",
+	}
+
+	for _, input := range inputs {
+		bytecode := compile(t, input)
+
+		plain := New(bytecode)
+		if err := plain.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", input, err)
+		}
+
+		optimized := New(compiler.Optimize(bytecode))
+		if err := optimized.Run(); err != nil {
+			t.Fatalf("vm error for optimized %q: %s", input, err)
+		}
+
+		expected, actual := plain.LastPoppedStackElem(), optimized.LastPoppedStackElem()
+		if expected.Inspect() != actual.Inspect() {
+			t.Errorf("optimization changed %q. want=%s, got=%s", input, expected.Inspect(), actual.Inspect())
+		}
+	}
+
+	// comparisons fused with jumps still report errors
+	machine := New(compiler.Optimize(compile(t, "if (1 < true) { 1 }")))
+	if err := machine.Run(); err == nil || err.Error() != "type mismatch: INTEGER < BOOLEAN" {
+		t.Errorf("wrong error from a fused comparison. got=%v", err)
+	}
+
+	// and so do superinstructions
+	machine = New(compiler.Optimize(compile(t, "fn(x) { x - 1 }(true)")))
+	if err := machine.Run(); err == nil || err.Error() != "type mismatch: BOOLEAN - INTEGER" {
+		t.Errorf("wrong error from a superinstruction. got=%v", err)
+	}
+}
+
+// TestErrorPositions checks that runtime errors are located where the evaluator locates
+// them, with the same stack traces, whether the bytecode is optimized or not.
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		strictBooleans bool
+	}{
+		{input: "5 + true"},
+		{input: "let x = 1;\nlet y = -true;"},
+		{input: "[1, 2][0][1]"},
+		{input: "len(1)"},
+		{input: "[1].push(2).upper()"},
+		{input: "let f = fn(x) {\n  x / 0\n};\nf(1)"},
+		{input: "let f = fn(x) { x - 1 };\nf(true)"},
+		{input: "let inner = fn() { 1 + true };\nlet outer = fn() { inner() };\nouter()"},
+		{input: "let f = fn(n) { if (n == 0) { n + true } else { f(n - 1) } };\nf(3)"},
+		{input: "if (1 < true) { 1 }"},
+		{input: "let f = fn(x) {\n  if (x) { 1 }\n};\nf(1)", strictBooleans: true},
+		{input: "fn(a) { a }(1, 2)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		evaluated := evaluator.EvalWithOptions(context.Background(), program, object.NewEnvironment(), evaluator.Options{StrictBooleans: tt.strictBooleans})
+		expected, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("evaluator did not fail on %q. got=%s", tt.input, evaluated.Inspect())
+		}
+
+		bytecode := compile(t, tt.input)
+		for _, bytecode := range []*compiler.Bytecode{bytecode, compiler.Optimize(bytecode)} {
+			machine := NewWithOptions(bytecode, make([]object.Object, GLOBALS_SIZE), Options{StrictBooleans: tt.strictBooleans})
+			err := machine.Run()
+
+			actual, ok := err.(*object.Error)
+			if !ok {
+				t.Errorf("vm did not fail with an error object on %q. got=%v", tt.input, err)
+				continue
+			}
+			if actual.Message != expected.Message || actual.Line != expected.Line || actual.Column != expected.Column {
+				t.Errorf("wrong error for %q. want=%d:%d %s, got=%d:%d %s", tt.input,
+					expected.Line, expected.Column, expected.Message, actual.Line, actual.Column, actual.Message)
+			}
+			if !reflect.DeepEqual(actual.Trace, expected.Trace) {
+				t.Errorf("wrong stack trace for %q. want=%+v, got=%+v", tt.input, expected.Trace, actual.Trace)
+			}
+		}
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		vm := New(compile(t, tt.input))
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		testExpectedObject(t, tt.input, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("wrong result for %q. want=%d, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case bool:
+		boolean, ok := actual.(*object.Boolean)
+		if !ok || boolean.Value != expected {
+			t.Errorf("wrong result for %q. want=%t, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("wrong result for %q. want=%q, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("wrong result for %q. want=%v, got=%T (%+v)", input, expected, actual, actual)
+			return
+		}
+		for i, element := range expected {
+			testExpectedObject(t, input, element, array.Elements[i])
+		}
+	case *object.Null:
+		if actual != evaluator.NULL {
+			t.Errorf("wrong result for %q. want=NULL, got=%T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+
+	compiler := compiler.New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error for %q: %s", input, err)
+	}
+
+	return compiler.Bytecode()
+}